@@ -0,0 +1,397 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/daviddengcn/go-colortext"
+	"github.com/echa/log"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvpro-go/mvpro"
+	"github.com/mavryk-network/mvpro-go/mvpro/index"
+)
+
+// sync conflict policies
+const (
+	policySource = "source" // target becomes an exact copy of source
+	policyTarget = "target" // only add missing entries and fields to target
+	policyMerge  = "merge"  // add missing, source wins on conflicting fields
+)
+
+type diffKind byte
+
+const (
+	diffAdded   diffKind = '+'
+	diffRemoved diffKind = '-'
+	diffChanged diffKind = '~'
+)
+
+type fieldDiff struct {
+	Kind  diffKind
+	Field string
+	Old   string
+	New   string
+}
+
+// entryDiff lists field differences for one address or token, seen from
+// target towards source, i.e. added means present in source only.
+type entryDiff struct {
+	Kind   diffKind
+	ID     string
+	Fields []fieldDiff
+}
+
+type metaSet map[string]index.Metadata
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// loadMetaSet reads metadata from an index API URL or a JSON export file.
+func loadMetaSet(ctx context.Context, spec string) (metaSet, error) {
+	set := make(metaSet)
+	if isURL(spec) {
+		list, err := mvpro.NewClient(spec, nil).WithLogger(log.Log).Metadata.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+		for _, v := range list {
+			set[v.ID()] = v
+		}
+		return set, nil
+	}
+	content, err := readFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	for n, v := range content {
+		v.Address, v.TokenId, err = parseAddressAndTokend(n)
+		if err != nil {
+			return nil, err
+		}
+		set[v.ID()] = v
+	}
+	return set, nil
+}
+
+// generic converts typed metadata models into plain JSON values so that
+// models from different sources compare equal.
+func generic(md index.Metadata) map[string]any {
+	out := make(map[string]any, len(md.Contents))
+	for n, v := range md.Contents {
+		if v == nil {
+			continue
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		var val any
+		if err := json.Unmarshal(buf, &val); err != nil {
+			continue
+		}
+		out[n] = val
+	}
+	return out
+}
+
+// flatten maps namespace.field keys to JSON encoded values. Non-object
+// namespaces are kept as a single value under the namespace name.
+func flatten(md index.Metadata) map[string]string {
+	out := make(map[string]string)
+	for ns, v := range generic(md) {
+		if m, ok := v.(map[string]any); ok {
+			for k, vv := range m {
+				buf, _ := json.Marshal(vv)
+				out[ns+"."+k] = string(buf)
+			}
+			continue
+		}
+		buf, _ := json.Marshal(v)
+		out[ns] = string(buf)
+	}
+	return out
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func diffEntry(src, dst index.Metadata) []fieldDiff {
+	fs, fd := flatten(src), flatten(dst)
+	res := make([]fieldDiff, 0)
+	for _, k := range sortedKeys(fs) {
+		v, ok := fd[k]
+		switch {
+		case !ok:
+			res = append(res, fieldDiff{Kind: diffAdded, Field: k, New: fs[k]})
+		case v != fs[k]:
+			res = append(res, fieldDiff{Kind: diffChanged, Field: k, Old: v, New: fs[k]})
+		}
+	}
+	for _, k := range sortedKeys(fd) {
+		if _, ok := fs[k]; !ok {
+			res = append(res, fieldDiff{Kind: diffRemoved, Field: k, Old: fd[k]})
+		}
+	}
+	return res
+}
+
+// diffSets compares source against target and returns differences sorted
+// by id and the number of unchanged entries.
+func diffSets(src, dst metaSet) ([]entryDiff, int) {
+	ids := make(map[string]struct{}, len(src)+len(dst))
+	for n := range src {
+		ids[n] = struct{}{}
+	}
+	for n := range dst {
+		ids[n] = struct{}{}
+	}
+	var (
+		res       []entryDiff
+		unchanged int
+	)
+	for _, id := range sortedKeys(ids) {
+		s, inSrc := src[id]
+		d, inDst := dst[id]
+		switch {
+		case !inDst:
+			res = append(res, entryDiff{Kind: diffAdded, ID: id, Fields: diffEntry(s, index.Metadata{})})
+		case !inSrc:
+			res = append(res, entryDiff{Kind: diffRemoved, ID: id, Fields: diffEntry(index.Metadata{}, d)})
+		default:
+			if f := diffEntry(s, d); len(f) > 0 {
+				res = append(res, entryDiff{Kind: diffChanged, ID: id, Fields: f})
+			} else {
+				unchanged++
+			}
+		}
+	}
+	return res, unchanged
+}
+
+func printDiff(diffs []entryDiff, unchanged int) {
+	var added, removed, changed int
+	for _, e := range diffs {
+		switch e.Kind {
+		case diffAdded:
+			added++
+		case diffRemoved:
+			removed++
+		case diffChanged:
+			changed++
+		}
+		printDiffLine(e.Kind, "%c %s\n", e.Kind, e.ID)
+		for _, f := range e.Fields {
+			switch f.Kind {
+			case diffAdded:
+				printDiffLine(f.Kind, "    + %s = %s\n", f.Field, f.New)
+			case diffRemoved:
+				printDiffLine(f.Kind, "    - %s = %s\n", f.Field, f.Old)
+			case diffChanged:
+				printDiffLine(f.Kind, "    ~ %s: %s -> %s\n", f.Field, f.Old, f.New)
+			}
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed, %d unchanged\n", added, removed, changed, unchanged)
+}
+
+func printDiffLine(kind diffKind, format string, args ...any) {
+	if !nocolor {
+		switch kind {
+		case diffAdded:
+			ct.ChangeColor(ct.Green, false, ct.None, false)
+		case diffRemoved:
+			ct.ChangeColor(ct.Red, false, ct.None, false)
+		case diffChanged:
+			ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		}
+		defer ct.ResetColor()
+	}
+	fmt.Printf(format, args...)
+}
+
+// sourceAndTarget parses `<source> [<target>]` arguments, target defaults
+// to the -index URL.
+func sourceAndTarget() (string, string, error) {
+	if flags.NArg() < 2 {
+		return "", "", fmt.Errorf("missing source")
+	}
+	src, dst := flags.Arg(1), apiurl
+	if flags.NArg() > 2 {
+		dst = flags.Arg(2)
+	}
+	return src, dst, nil
+}
+
+func diffAliases(ctx context.Context) error {
+	src, dst, err := sourceAndTarget()
+	if err != nil {
+		return err
+	}
+	srcSet, err := loadMetaSet(ctx, src)
+	if err != nil {
+		return err
+	}
+	dstSet, err := loadMetaSet(ctx, dst)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Comparing %d source and %d target entries", len(srcSet), len(dstSet))
+	printDiff(diffSets(srcSet, dstSet))
+	return nil
+}
+
+// mergeEntry combines source and target at field level. Values from the
+// preferred side win on conflict.
+func mergeEntry(src, dst index.Metadata, preferSource bool) index.Metadata {
+	gs, gd := generic(src), generic(dst)
+	lo, hi := gd, gs
+	if !preferSource {
+		lo, hi = gs, gd
+	}
+	out := make(map[string]any, len(lo)+len(hi))
+	for ns, v := range lo {
+		out[ns] = v
+	}
+	for ns, v := range hi {
+		hm, ok1 := v.(map[string]any)
+		lm, ok2 := out[ns].(map[string]any)
+		if !ok1 || !ok2 {
+			out[ns] = v
+			continue
+		}
+		m := make(map[string]any, len(lm)+len(hm))
+		for k, vv := range lm {
+			m[k] = vv
+		}
+		for k, vv := range hm {
+			m[k] = vv
+		}
+		out[ns] = m
+	}
+	return index.Metadata{
+		Address:  dst.Address,
+		TokenId:  dst.TokenId,
+		Contents: out,
+	}
+}
+
+func syncAliases(ctx context.Context) error {
+	src, dst, err := sourceAndTarget()
+	if err != nil {
+		return err
+	}
+	if !isURL(dst) {
+		return fmt.Errorf("sync target must be an index URL")
+	}
+	switch policy {
+	case policySource, policyTarget, policyMerge:
+	default:
+		return fmt.Errorf("unknown conflict policy %q", policy)
+	}
+	srcSet, err := loadMetaSet(ctx, src)
+	if err != nil {
+		return err
+	}
+	dstSet, err := loadMetaSet(ctx, dst)
+	if err != nil {
+		return err
+	}
+	diffs, unchanged := diffSets(srcSet, dstSet)
+	printDiff(diffs, unchanged)
+
+	// plan writes
+	var (
+		upserts []index.Metadata
+		removes []index.Metadata
+	)
+	for _, e := range diffs {
+		s, d := srcSet[e.ID], dstSet[e.ID]
+		switch e.Kind {
+		case diffAdded:
+			upserts = append(upserts, index.Metadata{
+				Address:  s.Address,
+				TokenId:  s.TokenId,
+				Contents: generic(s),
+			})
+		case diffRemoved:
+			if policy == policySource {
+				removes = append(removes, d)
+			}
+		case diffChanged:
+			var md index.Metadata
+			switch policy {
+			case policySource:
+				md = index.Metadata{
+					Address:  d.Address,
+					TokenId:  d.TokenId,
+					Contents: generic(s),
+				}
+				// namespaces are replaced on create, but never deleted
+				// so entries with dropped namespaces are recreated
+				for ns := range generic(d) {
+					if _, ok := md.Contents[ns]; !ok {
+						removes = append(removes, d)
+						break
+					}
+				}
+			case policyTarget:
+				md = mergeEntry(s, d, false)
+			case policyMerge:
+				md = mergeEntry(s, d, true)
+			}
+			if !reflect.DeepEqual(md.Contents, generic(d)) {
+				upserts = append(upserts, md)
+			}
+		}
+	}
+
+	if dryRun {
+		log.Infof("Dry-run: would remove %d and create/update %d entries at %s (policy %s)",
+			len(removes), len(upserts), dst, policy)
+		return nil
+	}
+	if len(removes)+len(upserts) == 0 {
+		log.Infof("Nothing to sync")
+		return nil
+	}
+
+	c := mvpro.NewClient(dst, nil).WithLogger(log.Log)
+	if !nobackup {
+		log.Debugf("Creating backup")
+		if err := exportTo(ctx, c, defaultFilename()); err != nil {
+			return err
+		}
+	}
+	for _, v := range removes {
+		if v.TokenId == nil {
+			err = c.Metadata.RemoveWallet(ctx, v.Address)
+		} else {
+			err = c.Metadata.RemoveAsset(ctx, mavryk.NewToken(v.Address, *v.TokenId))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.ID(), err)
+		}
+	}
+	if len(upserts) > 0 {
+		if _, err := c.Metadata.Create(ctx, upserts); err != nil {
+			return err
+		}
+	}
+	log.Infof("Synced %s to %s: removed %d, created/updated %d entries (policy %s)",
+		src, dst, len(removes), len(upserts), policy)
+	return nil
+}
@@ -32,7 +32,9 @@ var (
 	nobackup bool
 	nocolor  bool
 	local    bool
+	dryRun   bool
 	apiurl   string
+	policy   string
 )
 
 const defaultFilePrefix = "mvalias-export"
@@ -45,12 +47,15 @@ func init() {
 	flags.BoolVar(&nocolor, "no-color", false, "disable color output")
 	flags.BoolVar(&local, "local", false, "use embedded JSON schema")
 	flags.StringVar(&apiurl, "index", "http://localhost:8000", "Index API URL")
+	flags.BoolVar(&dryRun, "dry-run", false, "show sync changes without writing")
+	flags.StringVar(&policy, "policy", policyMerge, "sync conflict policy (source, target, merge)")
 }
 
 func main() {
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		if err == flag.ErrHelp {
 			fmt.Println("Usage: mvalias <cmd> [address[_token_id]] [fields] [<file>]")
+			fmt.Println("       mvalias diff|sync <source> [<target>]")
 			flags.PrintDefaults()
 			fmt.Println("\nCommands")
 			fmt.Printf("  export          download and save metadata to `file`\n")
@@ -61,6 +66,12 @@ func main() {
 			fmt.Printf("  update          update existing metadata\n")
 			fmt.Printf("  remove          removes existing metadata (DESTRUCTIVE!)\n")
 			fmt.Printf("  purge           drop all metadata (DESTRUCTIVE!)\n")
+			fmt.Printf("  diff            compare metadata between two index URLs or files\n")
+			fmt.Printf("  sync            apply differences from source to target index\n")
+			fmt.Println("\nSync policies")
+			fmt.Printf("  source          make target an exact copy of source (DESTRUCTIVE!)\n")
+			fmt.Printf("  target          only add entries and fields missing in target\n")
+			fmt.Printf("  merge           add missing, source wins on conflicting fields\n")
 			fmt.Println("\nFields")
 			fmt.Printf("  alias.name            (string) account/token display name\n")
 			fmt.Printf("  alias.kind            (enum) e.g. validator, payout, token, oracle, issuer, registry, ...\n")
@@ -153,6 +164,10 @@ func run() error {
 		return removeAlias(ctx, client)
 	case "validate":
 		return validateAliases(ctx, client)
+	case "diff":
+		return diffAliases(ctx)
+	case "sync":
+		return syncAliases(ctx)
 	default:
 		return fmt.Errorf("unkown command %s", cmd)
 	}
@@ -177,6 +192,10 @@ func makeFilename() string {
 		}
 		return name
 	}
+	return defaultFilename()
+}
+
+func defaultFilename() string {
 	return defaultFilePrefix + "-" + time.Now().UTC().Format("2006-01-02T15-04-05") + ".json"
 }
 
@@ -228,7 +247,10 @@ func readFile(fname string) (map[string]index.Metadata, error) {
 }
 
 func exportAliases(ctx context.Context, c *mvpro.Client) error {
-	fname := makeFilename()
+	return exportTo(ctx, c, makeFilename())
+}
+
+func exportTo(ctx context.Context, c *mvpro.Client, fname string) error {
 	aliases, err := c.Metadata.List(ctx)
 	if err != nil {
 		return err
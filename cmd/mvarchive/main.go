@@ -0,0 +1,180 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/echa/log"
+	"github.com/mavryk-network/mvindex/etl/archive"
+)
+
+var (
+	flags   = flag.NewFlagSet("mvarchive", flag.ContinueOnError)
+	verbose bool
+	path    string
+)
+
+func init() {
+	flags.Usage = func() {}
+	flags.BoolVar(&verbose, "v", false, "be verbose")
+	flags.StringVar(&path, "path", "./db/archive", "block archive path")
+}
+
+func main() {
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			fmt.Println("Usage: mvarchive [flags] <cmd> [<from> <to>] [<file>]")
+			flags.PrintDefaults()
+			fmt.Println("\nCommands")
+			fmt.Printf("  info            show archived block range and size\n")
+			fmt.Printf("  list            list archived blocks in range\n")
+			fmt.Printf("  prune           remove archived blocks in range (DESTRUCTIVE!)\n")
+			fmt.Printf("  export          write archived blocks in range to tar `file` or stdout\n")
+			fmt.Println("\nRanges are inclusive, use -1 as upper bound for no limit.")
+			os.Exit(0)
+		}
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if verbose {
+		log.SetLevel(log.LevelDebug)
+	}
+
+	if err := run(); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if flags.NArg() < 1 {
+		return fmt.Errorf("command required")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("archive %s: %v", path, err)
+	}
+	arch, err := archive.Open(path)
+	if err != nil {
+		return err
+	}
+
+	switch cmd := flags.Arg(0); cmd {
+	case "info":
+		return info(arch)
+	case "list":
+		return list(arch)
+	case "prune":
+		return prune(arch)
+	case "export":
+		return export(arch)
+	default:
+		return fmt.Errorf("unkown command %s", cmd)
+	}
+}
+
+// rangeArgs parses optional from/to arguments.
+func rangeArgs(required bool) (int64, int64, error) {
+	from, to := int64(0), int64(-1)
+	if flags.NArg() < 3 {
+		if required {
+			return 0, 0, fmt.Errorf("block range required")
+		}
+		return from, to, nil
+	}
+	from, err := strconv.ParseInt(flags.Arg(1), 10, 64)
+	if err != nil || from < 0 {
+		return 0, 0, fmt.Errorf("invalid from height %q", flags.Arg(1))
+	}
+	to, err = strconv.ParseInt(flags.Arg(2), 10, 64)
+	if err != nil || (to >= 0 && to < from) {
+		return 0, 0, fmt.Errorf("invalid to height %q", flags.Arg(2))
+	}
+	return from, to, nil
+}
+
+func info(arch *archive.Archive) error {
+	from, to, err := rangeArgs(false)
+	if err != nil {
+		return err
+	}
+	entries, err := arch.List(from, to)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Path    %s\n", arch.Path())
+	fmt.Printf("Blocks  %d\n", len(entries))
+	if len(entries) == 0 {
+		return nil
+	}
+	var (
+		size int64
+		gaps int64
+	)
+	for i, v := range entries {
+		size += v.Size
+		if i > 0 {
+			gaps += v.Height - entries[i-1].Height - 1
+		}
+	}
+	fmt.Printf("Range   %d - %d\n", entries[0].Height, entries[len(entries)-1].Height)
+	fmt.Printf("Missing %d\n", gaps)
+	fmt.Printf("Size    %.2f MiB\n", float64(size)/(1<<20))
+	return nil
+}
+
+func list(arch *archive.Archive) error {
+	from, to, err := rangeArgs(false)
+	if err != nil {
+		return err
+	}
+	entries, err := arch.List(from, to)
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		fmt.Printf("%10d %s %d\n", v.Height, v.Hash, v.Size)
+	}
+	return nil
+}
+
+func prune(arch *archive.Archive) error {
+	from, to, err := rangeArgs(true)
+	if err != nil {
+		return err
+	}
+	n, err := arch.Prune(from, to)
+	if err != nil {
+		return err
+	}
+	log.Infof("Removed %d blocks", n)
+	return nil
+}
+
+func export(arch *archive.Archive) error {
+	from, to, err := rangeArgs(true)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if flags.NArg() > 3 {
+		f, err := os.Create(flags.Arg(3))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := arch.Export(w, from, to)
+	if err != nil {
+		return err
+	}
+	log.Infof("Exported %d blocks", n)
+	return nil
+}
@@ -71,17 +71,24 @@ func newRPCClient() (*rpc.Client, error) {
 		return nil, fmt.Errorf("rpc client: %w", err)
 	}
 	usetls := !config.GetBool("rpc.disable_tls")
-	u, err := url.Parse(config.GetString("rpc.url"))
-	if err != nil {
-		return nil, err
-	}
-	if usetls {
-		u.Scheme = "https"
+	urls := config.GetStringSlice("rpc.urls")
+	if len(urls) == 0 {
+		urls = []string{config.GetString("rpc.url")}
 	}
-	if p := config.GetString("rpc.path"); p != "" {
-		u.Path = p
+	for i, v := range urls {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		if usetls {
+			u.Scheme = "https"
+		}
+		if p := config.GetString("rpc.path"); p != "" {
+			u.Path = p
+		}
+		urls[i] = u.String()
 	}
-	rpcclient, err := rpc.NewClient(u.String(), c)
+	rpcclient, err := rpc.NewClientWithEndpoints(urls, c)
 	if err != nil {
 		return nil, fmt.Errorf("rpc client: %w", err)
 	}
@@ -91,6 +98,10 @@ func newRPCClient() (*rpc.Client, error) {
 		WithRetry(
 			config.GetInt("rpc.retries"),
 			config.GetDuration("rpc.retry_delay"),
+		).
+		WithHealthCheck(
+			config.GetDuration("rpc.health_interval"),
+			config.GetInt64("rpc.max_lag"),
 		)
 
 	return rpcclient, nil
@@ -112,6 +123,11 @@ func enabledIndexes() (list []model.BlockIndexer) {
 		index.NewSupplyIndex(),
 		index.NewBigmapIndex(),
 		index.NewTicketIndex(),
+		index.NewCallIndex(),
+		index.NewSaplingIndex(),
+		index.NewDomainIndex(),
+		index.NewConsensusKeyIndex(),
+		index.NewReorgIndex(),
 	)
 	if !lightIndex {
 		list = append(list,
@@ -127,5 +143,7 @@ func enabledIndexes() (list []model.BlockIndexer) {
 			index.NewTokenIndex(),
 		)
 	}
+	// counts token transfers from events written by the token index
+	list = append(list, index.NewCounterpartyIndex())
 	return
 }
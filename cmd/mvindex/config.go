@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/echa/config"
+	"github.com/mavryk-network/mvindex/etl"
 )
 
 var (
@@ -37,6 +38,7 @@ var (
 	noapi        bool
 	cors         bool
 	validate     bool
+	validateSply bool
 	stop         int64
 	lightIndex   bool
 	notls        bool
@@ -67,6 +69,7 @@ func init() {
 	flags.BoolVar(&noindex, "noindex", false, "disable indexing")
 	flags.BoolVar(&nomonitor, "nomonitor", false, "disable block monitor")
 	flags.BoolVar(&validate, "validate", false, "validate account balances")
+	flags.BoolVar(&validateSply, "validate-supply", false, "reconcile supply and issuance at cycle end")
 	flags.Int64Var(&stop, "stop", 0, "stop indexing after `height`")
 	flags.BoolVar(&cors, "enable-cors", false, "enable API CORS support")
 	flags.BoolVar(&experimental, "experimental", false, "enable experimental features")
@@ -92,6 +95,19 @@ func init() {
 	config.SetDefault("crawler.snapshot.path", "./db/snapshots/")
 	config.SetDefault("crawler.snapshot.blocks", nil)
 	config.SetDefault("crawler.snapshot.interval", 0)
+	config.SetDefault("crawler.archive.path", "")
+	config.SetDefault("crawler.archive.source", true)
+
+	// change-data-capture log
+	config.SetDefault("cdc.path", "")                 // empty = disabled
+	config.SetDefault("cdc.max_size", int64(128<<20)) // rotate log files at this size
+	config.SetDefault("cdc.max_files", 0)             // 0 = keep all files
+	config.SetDefault("cdc.tables", etl.CdcTables())
+
+	// history retention in cycles per table (0 = keep all)
+	for _, v := range etl.RetentionTables() {
+		config.SetDefault("retention."+v, 0)
+	}
 
 	// HTTP API server
 	config.SetDefault("server.addr", "127.0.0.1")
@@ -101,6 +117,7 @@ func init() {
 	config.SetDefault("server.name", UserAgent())
 	config.SetDefault("server.threads", 64)
 	config.SetDefault("server.queue", 128)
+	config.SetDefault("server.max_streams", 16)
 	config.SetDefault("server.timeout_header", "")
 	config.SetDefault("server.fail_header", "")
 	config.SetDefault("server.limit_header", "")
@@ -112,6 +129,7 @@ func init() {
 	config.SetDefault("server.max_list_count", 50000)
 	config.SetDefault("server.default_list_count", 500)
 	config.SetDefault("server.max_series_duration", 0)
+	config.SetDefault("server.max_aggregate_rows", 10000000)
 	config.SetDefault("server.max_explore_count", 1000)
 	config.SetDefault("server.default_explore_count", 20)
 	config.SetDefault("server.cors_enable", false)
@@ -140,6 +158,7 @@ func init() {
 
 	// REST client
 	config.SetDefault("rpc.url", "http://127.0.0.1:8732")
+	config.SetDefault("rpc.urls", []string{})
 	config.SetDefault("rpc.user", "")
 	config.SetDefault("rpc.pass", "")
 	config.SetDefault("rpc.disable_tls", true)
@@ -155,6 +174,8 @@ func init() {
 	config.SetDefault("rpc.idle_conns", 16)
 	config.SetDefault("rpc.retries", 3)
 	config.SetDefault("rpc.retry_delay", time.Second)
+	config.SetDefault("rpc.health_interval", 30*time.Second)
+	config.SetDefault("rpc.max_lag", 2)
 	config.SetDefault("rpc.api_key", os.Getenv("MVPRO_API_KEY"))
 
 	// Metadata settings
@@ -12,7 +12,9 @@ import (
 	logpkg "github.com/echa/log"
 	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/archive"
 	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/cdc"
 	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/rpc"
@@ -41,6 +43,8 @@ func init() {
 	// assign default loggers
 	etl.UseLogger(etlLog)
 	cache.UseLogger(etlLog)
+	archive.UseLogger(etlLog)
+	cdc.UseLogger(etlLog)
 	model.UseLogger(etlLog)
 	index.UseLogger(etlLog)
 	store.UseLogger(dataLog)
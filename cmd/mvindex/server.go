@@ -9,12 +9,15 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"syscall"
 
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/store"
 	"github.com/echa/config"
 	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/archive"
+	"github.com/mavryk-network/mvindex/etl/cdc"
 	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/metadata"
 	"github.com/mavryk-network/mvindex/rpc"
@@ -31,6 +34,11 @@ func runServer() error {
 		return err
 	}
 
+	// load contract template registry
+	if err := etl.LoadContractTemplates(); err != nil {
+		return err
+	}
+
 	// init database
 	pathname := config.GetString("db.path")
 	dbOpts := DBOpts(false)
@@ -76,6 +84,36 @@ func runServer() error {
 		noindex = true
 	}
 
+	// open change-data-capture log when configured
+	var cdcLog *cdc.Log
+	if cdcPath := config.GetString("cdc.path"); cdcPath != "" {
+		tables := config.GetStringSlice("cdc.tables")
+		for _, v := range tables {
+			if !slices.Contains(etl.CdcTables(), v) {
+				return fmt.Errorf("cdc: unsupported table %q", v)
+			}
+		}
+		cdcLog, err = cdc.Open(cdc.Config{
+			Path:     cdcPath,
+			MaxSize:  config.GetInt64("cdc.max_size"),
+			MaxFiles: config.GetInt("cdc.max_files"),
+			Tables:   tables,
+		})
+		if err != nil {
+			return fmt.Errorf("cdc: %v", err)
+		}
+		defer cdcLog.Close()
+	}
+
+	// history retention per table
+	retention := make(map[string]int64)
+	for _, v := range etl.RetentionTables() {
+		if n := config.GetInt64("retention." + v); n > 0 {
+			retention[v] = n
+			log.Infof("Keeping %d cycles of %s history.", n, v)
+		}
+	}
+
 	// enable index storage tables
 	indexer := etl.NewIndexer(etl.IndexerConfig{
 		DBPath:    pathname,
@@ -83,26 +121,44 @@ func runServer() error {
 		StateDB:   statedb,
 		Indexes:   enabledIndexes(),
 		LightMode: lightIndex,
+		CDC:       cdcLog,
+		Retention: retention,
 	})
 	defer indexer.Close()
 
+	// open raw block archive when configured
+	var arch *archive.Archive
+	if archPath := config.GetString("crawler.archive.path"); archPath != "" {
+		arch, err = archive.Open(archPath)
+		if err != nil {
+			return fmt.Errorf("block archive: %v", err)
+		}
+		log.Infof("Archiving raw blocks to %s", archPath)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	if rpcclient != nil {
+		rpcclient.StartHealthCheck(ctx)
+	}
 
 	crawler := etl.NewCrawler(etl.CrawlerConfig{
-		DB:            statedb,
-		Indexer:       indexer,
-		Client:        rpcclient,
-		Queue:         config.GetInt("crawler.queue"),
-		Delay:         config.GetInt("crawler.delay"),
-		EnableMonitor: !nomonitor,
-		StopBlock:     stop,
-		Validate:      validate,
+		DB:             statedb,
+		Indexer:        indexer,
+		Client:         rpcclient,
+		Queue:          config.GetInt("crawler.queue"),
+		Delay:          config.GetInt("crawler.delay"),
+		EnableMonitor:  !nomonitor,
+		StopBlock:      stop,
+		Validate:       validate,
+		ValidateSupply: validateSply,
 		Snapshot: &etl.SnapshotConfig{
 			Path:          config.GetString("crawler.snapshot.path"),
 			Blocks:        config.GetInt64Slice("crawler.snapshot.blocks"),
 			BlockInterval: config.GetInt64("crawler.snapshot.interval"),
 		},
+		Archive:       arch,
+		ArchiveSource: config.GetBool("crawler.archive.source"),
 	})
 	// not indexing means we do not auto-index, but allow access to
 	// existing indexes
@@ -129,6 +185,7 @@ func runServer() error {
 				Port:                config.GetInt("server.port"),
 				MaxWorkers:          config.GetInt("server.threads"),
 				MaxQueue:            config.GetInt("server.queue"),
+				MaxStreams:          config.GetInt("server.max_streams"),
 				TimeoutHeader:       config.GetString("server.timeout_header"),
 				FailHeader:          config.GetString("server.fail_header"),
 				LimitHeader:         config.GetString("server.limit_header"),
@@ -153,6 +210,7 @@ func runServer() error {
 				CacheExpires:        config.GetDuration("server.cache_expires"),
 				CacheMaxExpires:     config.GetDuration("server.cache_max"),
 				MaxSeriesDuration:   config.GetDuration("server.max_series_duration"),
+				MaxAggregateRows:    config.GetUint("server.max_aggregate_rows"),
 			},
 		})
 		if err != nil {
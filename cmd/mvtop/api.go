@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -28,11 +29,13 @@ type Tip struct {
 }
 
 type Status struct {
-	Mode     string  `json:"mode"`
-	Status   string  `json:"status"`
-	Blocks   int64   `json:"blocks"`
-	Indexed  int64   `json:"indexed"`
-	Progress float64 `json:"progress"`
+	Mode       string    `json:"mode"`
+	Status     string    `json:"status"`
+	Blocks     int64     `json:"blocks"`
+	Finalized  int64     `json:"finalized"`
+	Indexed    int64     `json:"indexed"`
+	Progress   float64   `json:"progress"`
+	LastUpdate time.Time `json:"last_update"`
 }
 
 func (c *Client) GetTableStats() (TableResponse, error) {
@@ -268,3 +271,119 @@ type SysStat struct {
 	CpuSys   float64 `json:"cpu_system"`
 	CpuTotal float64 `json:"cpu_total"`
 }
+
+func (c *Client) GetStatus() (Status, error) {
+	var s Status
+	err := c.get("/explorer/status", &s)
+	return s, err
+}
+
+func (c *Client) GetReorgs() ([]Reorg, error) {
+	list := make([]Reorg, 0)
+	err := c.get("/system/reorgs", &list)
+	return list, err
+}
+
+type Reorg struct {
+	Time         time.Time `json:"time"`
+	ForkHeight   int64     `json:"fork_height"`
+	ForkHash     string    `json:"fork_hash"`
+	Depth        int       `json:"depth"`
+	Attached     int       `json:"attached"`
+	FormerHeight int64     `json:"former_height"`
+	FormerHash   string    `json:"former_hash"`
+	NewHeight    int64     `json:"new_height"`
+	NewHash      string    `json:"new_hash"`
+	IsRollback   bool      `json:"is_rollback"`
+}
+
+func (c *Client) GetTaskStats() (TaskStats, error) {
+	var s TaskStats
+	err := c.get("/system/tasks", &s)
+	return s, err
+}
+
+type TaskStats struct {
+	MaxTasks   int   `json:"max_tasks"`
+	Idle       int   `json:"idle"`
+	Running    int   `json:"running"`
+	Pending    int   `json:"pending"`
+	Success    int64 `json:"success"`
+	Failed     int64 `json:"failed"`
+	Timeout    int64 `json:"timeout"`
+	Delivered  int64 `json:"delivered"`
+	Inflight   int   `json:"inflight"`
+	RetryAfter int64 `json:"retry_interval"`
+}
+
+func (c *Client) GetCacheStats() (CacheResponse, error) {
+	caches := make(CacheResponse)
+	err := c.get("/system/caches", &caches)
+	return caches, err
+}
+
+type CacheResponse map[string]CacheStats
+
+// Names returns cache names in sorted order.
+func (r CacheResponse) Names() []string {
+	names := make([]string, 0, len(r))
+	for n := range r {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type CacheStats struct {
+	Size      int   `json:"size"`
+	Bytes     int64 `json:"bytes"`
+	Inserts   int64 `json:"inserts"`
+	Updates   int64 `json:"updates"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+func (s CacheStats) GetHitRate(p CacheStats, tm time.Time) string {
+	num := s.Hits
+	denom := s.Hits + s.Misses
+	if denom == 0 {
+		denom = 1
+	}
+	total := strconv.FormatFloat(float64(num*100)/float64(denom), 'f', 2, 64) + "%"
+	now := "-- %"
+	if !tm.IsZero() {
+		num = s.Hits - p.Hits
+		denom = s.Hits + s.Misses - p.Hits - p.Misses
+		if denom == 0 {
+			denom = 1
+		}
+		now = strconv.FormatFloat(float64(num*100)/float64(denom), 'f', 2, 64) + "%"
+	}
+	return now + " / " + total
+}
+
+func (c *Client) GetRouteStats() ([]RouteStats, error) {
+	list := make([]RouteStats, 0)
+	err := c.get("/system/routes", &list)
+	return list, err
+}
+
+type RouteStats struct {
+	Route  string  `json:"route"`
+	Calls  int64   `json:"calls"`
+	Errors int64   `json:"errors"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+func (s RouteStats) GetRate(p RouteStats, tm time.Time) string {
+	if tm.IsZero() {
+		return "-- rps"
+	}
+	tmDiff := float64(time.Since(tm)) / float64(time.Second)
+	return fmt.Sprintf("%3.1f rps", float64(s.Calls-p.Calls)/tmDiff)
+}
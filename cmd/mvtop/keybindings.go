@@ -25,9 +25,37 @@ func (t *Top) Keybindings() error {
 	if err := t.g.SetKeybinding("", key, qModifier, t.quit); err != nil {
 		return err
 	}
+	if err := t.g.SetKeybinding("", gocui.KeyTab, gocui.ModNone, t.nextScreen); err != nil {
+		return err
+	}
+	for s := ScreenTables; s < numScreens; s++ {
+		if err := t.g.SetKeybinding("", rune('1'+s), gocui.ModNone, t.showScreen(s)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (t *Top) nextScreen(g *gocui.Gui, v *gocui.View) error {
+	return t.showScreen(screen.Next())(g, v)
+}
+
+func (t *Top) showScreen(s Screen) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		g.UpdateAsync(func(g *gocui.Gui) error {
+			screen = s
+			position, writePos = 0, 0
+			for _, n := range []string{TableName, FooterName} {
+				if vv, ok := t.views[n]; ok {
+					update(vv)
+				}
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
 func (t *Top) quit(g *gocui.Gui, v *gocui.View) error {
 	return gocui.ErrQuit
 }
@@ -50,7 +78,7 @@ func (t *Top) moveUp(g *gocui.Gui, v *gocui.View) error {
 }
 
 func (t *Top) moveDown(g *gocui.Gui, v *gocui.View) error {
-	if position < len(next.Table)-1 {
+	if position < screen.NumRows(next)-1 {
 		if vv, ok := t.views[TableName]; ok {
 			g.UpdateAsync(func(g *gocui.Gui) error {
 				position++
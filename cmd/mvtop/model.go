@@ -7,11 +7,16 @@ import (
 )
 
 type Model struct {
-	Time  time.Time
-	Table TableResponse
-	Sys   SysStat
-	Tip   Tip
-	Error error
+	Time   time.Time
+	Table  TableResponse
+	Sys    SysStat
+	Tip    Tip
+	Status Status
+	Reorgs []Reorg
+	Tasks  TaskStats
+	Caches CacheResponse
+	Routes []RouteStats
+	Error  error
 }
 
 func (m Model) IsValid() bool {
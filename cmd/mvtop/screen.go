@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+import (
+	"time"
+)
+
+// Screen selects the content of the main table view.
+type Screen int
+
+const (
+	ScreenTables Screen = iota
+	ScreenSync
+	ScreenReorgs
+	ScreenTasks
+	ScreenCaches
+	ScreenRoutes
+	numScreens
+)
+
+var screenNames = [numScreens]string{
+	"tables",
+	"sync",
+	"reorgs",
+	"tasks",
+	"caches",
+	"api",
+}
+
+func (s Screen) String() string {
+	if s < 0 || s >= numScreens {
+		return "unknown"
+	}
+	return screenNames[s]
+}
+
+func (s Screen) Next() Screen {
+	return (s + 1) % numScreens
+}
+
+// Headers returns the table header for screen s.
+func (s Screen) Headers() []*TableHeader {
+	switch s {
+	case ScreenSync, ScreenTasks:
+		return metricHeaders
+	case ScreenReorgs:
+		return reorgHeaders
+	case ScreenCaches:
+		return cacheHeaders
+	case ScreenRoutes:
+		return routeHeaders
+	default:
+		return headers
+	}
+}
+
+// Rows returns all table rows for screen s without row numbers.
+func (s Screen) Rows(res Model) [][]*RowCell {
+	switch s {
+	case ScreenSync:
+		return syncRows(res)
+	case ScreenReorgs:
+		return reorgRows(res)
+	case ScreenTasks:
+		return taskRows(res)
+	case ScreenCaches:
+		return cacheRows(res)
+	case ScreenRoutes:
+		return routeRows(res)
+	default:
+		return tableRows(res)
+	}
+}
+
+// NumRows is used as scroll limit.
+func (s Screen) NumRows(res Model) int {
+	return len(s.Rows(res))
+}
+
+var metricHeaders = []*TableHeader{
+	{
+		Label: "#",
+		Width: MIN_CELLWIDTH,
+	},
+	{
+		Label: "METRIC",
+		Align: AlignLeft,
+		Width: 24,
+	},
+	{
+		Label: "VALUE",
+		Align: AlignLeft,
+	},
+}
+
+func metricRow(name, value string) []*RowCell {
+	return []*RowCell{{Text: name}, {Text: value}}
+}
+
+// rate returns the per second change between two samples.
+func rate(n, p int64, tm time.Time) float64 {
+	if tm.IsZero() {
+		return 0
+	}
+	dt := float64(time.Since(tm)) / float64(time.Second)
+	if dt <= 0 {
+		return 0
+	}
+	return float64(n-p) / dt
+}
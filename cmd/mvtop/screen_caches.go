@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+var cacheHeaders = []*TableHeader{
+	{
+		Label: "#",
+		Width: MIN_CELLWIDTH,
+	},
+	{
+		Label: "CACHE",
+		Align: AlignLeft,
+		Width: 24,
+	},
+	{
+		Label: "ENTRIES",
+		Align: AlignRight,
+		Width: 12,
+	},
+	{
+		Label: "SIZE",
+		Align: AlignRight,
+		Width: 12,
+	},
+	{
+		Label: "HITS",
+		Align: AlignSlash,
+		Width: 20,
+	},
+	{
+		Label: "INSERTS",
+		Align: AlignRight,
+	},
+	{
+		Label: "UPDATES",
+		Align: AlignRight,
+	},
+	{
+		Label: "EVICTIONS",
+		Align: AlignRight,
+	},
+}
+
+func cacheRows(res Model) [][]*RowCell {
+	names := res.Caches.Names()
+	rows := make([][]*RowCell, 0, len(names))
+	for _, n := range names {
+		c := res.Caches[n]
+		p := prev.Caches[n]
+		rows = append(rows, []*RowCell{
+			{Text: n},
+			{Text: FormatPretty(c.Size)},
+			{Text: FormatBytes(int(c.Bytes))},
+			{Text: c.GetHitRate(p, prev.Time)},
+			{Text: FormatPretty(c.Inserts)},
+			{Text: FormatPretty(c.Updates)},
+			{Text: FormatPretty(c.Evictions)},
+		})
+	}
+	return rows
+}
@@ -32,6 +32,8 @@ func createFooter(g *gocui.Gui) (*View, error) {
 			)
 			VerticalSpacer(v)
 			fmt.Fprintf(v, " Health %d%% ", res.Tip.Health)
+			VerticalSpacer(v)
+			fmt.Fprintf(v, " [%d] %s (1-%d/Tab to switch) ", screen+1, screen, numScreens)
 		}
 		return nil
 	})
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+import (
+	"strconv"
+)
+
+var reorgHeaders = []*TableHeader{
+	{
+		Label: "#",
+		Width: MIN_CELLWIDTH,
+	},
+	{
+		Label: "TIME",
+		Align: AlignLeft,
+		Width: 22,
+	},
+	{
+		Label: "TYPE",
+		Align: AlignLeft,
+		Width: 10,
+	},
+	{
+		Label: "DEPTH",
+		Align: AlignRight,
+		Width: 8,
+	},
+	{
+		Label: "ATTACHED",
+		Align: AlignRight,
+		Width: 10,
+	},
+	{
+		Label: "FORK",
+		Align: AlignRight,
+		Width: 12,
+	},
+	{
+		Label: "FORMER TIP",
+		Align: AlignLeft,
+	},
+	{
+		Label: "NEW TIP",
+		Align: AlignLeft,
+	},
+}
+
+// reorgRows lists reorgs newest first.
+func reorgRows(res Model) [][]*RowCell {
+	rows := make([][]*RowCell, 0, len(res.Reorgs))
+	for i := len(res.Reorgs) - 1; i >= 0; i-- {
+		r := res.Reorgs[i]
+		typ := "reorg"
+		if r.IsRollback {
+			typ = "rollback"
+		}
+		rows = append(rows, []*RowCell{
+			{Text: r.Time.Format("2006-01-02 15:04:05")},
+			{Text: typ},
+			{Text: strconv.Itoa(r.Depth)},
+			{Text: strconv.Itoa(r.Attached)},
+			{Text: PrettyInt64(r.ForkHeight)},
+			{Text: PrettyInt64(r.FormerHeight) + " " + shortHash(r.FormerHash)},
+			{Text: PrettyInt64(r.NewHeight) + " " + shortHash(r.NewHash)},
+		})
+	}
+	return rows
+}
+
+func shortHash(h string) string {
+	if len(h) <= 12 {
+		return h
+	}
+	return h[:8] + "…" + h[len(h)-4:]
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+import (
+	"strconv"
+)
+
+var routeHeaders = []*TableHeader{
+	{
+		Label: "#",
+		Width: MIN_CELLWIDTH,
+	},
+	{
+		Label: "ROUTE",
+		Align: AlignLeft,
+		Width: 48,
+	},
+	{
+		Label: "CALLS",
+		Align: AlignRight,
+		Width: 12,
+	},
+	{
+		Label: "RATE",
+		Align: AlignRight,
+		Width: 12,
+	},
+	{
+		Label: "ERRORS",
+		Align: AlignRight,
+		Width: 10,
+	},
+	{
+		Label: "MEAN",
+		Align: AlignRight,
+	},
+	{
+		Label: "P50",
+		Align: AlignRight,
+	},
+	{
+		Label: "P95",
+		Align: AlignRight,
+	},
+	{
+		Label: "P99",
+		Align: AlignRight,
+	},
+	{
+		Label: "MAX",
+		Align: AlignRight,
+	},
+}
+
+func routeRows(res Model) [][]*RowCell {
+	rows := make([][]*RowCell, 0, len(res.Routes))
+	for _, r := range res.Routes {
+		var p RouteStats
+		for _, v := range prev.Routes {
+			if v.Route == r.Route {
+				p = v
+				break
+			}
+		}
+		rows = append(rows, []*RowCell{
+			{Text: r.Route},
+			{Text: FormatPretty(r.Calls)},
+			{Text: r.GetRate(p, prev.Time)},
+			{Text: FormatPretty(r.Errors)},
+			{Text: formatMillis(r.Mean)},
+			{Text: formatMillis(r.P50)},
+			{Text: formatMillis(r.P95)},
+			{Text: formatMillis(r.P99)},
+			{Text: formatMillis(r.Max)},
+		})
+	}
+	return rows
+}
+
+func formatMillis(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 1, 64) + "ms"
+}
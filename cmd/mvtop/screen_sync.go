@@ -0,0 +1,40 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func syncRows(res Model) [][]*RowCell {
+	s := res.Status
+	if !res.IsValid() {
+		return nil
+	}
+	lag := s.Finalized - s.Indexed
+	if lag < 0 || s.Finalized < 0 {
+		lag = 0
+	}
+	bps := rate(s.Indexed, prev.Status.Indexed, prev.Time)
+	eta := "--"
+	switch {
+	case lag == 0:
+		eta = "in sync"
+	case bps > 0:
+		eta = (time.Duration(float64(lag)/bps) * time.Second).Truncate(time.Second).String()
+	}
+	return [][]*RowCell{
+		metricRow("STATE", s.Status),
+		metricRow("MODE", s.Mode),
+		metricRow("NODE HEAD", PrettyInt64(s.Blocks)),
+		metricRow("FINALIZED", PrettyInt64(s.Finalized)),
+		metricRow("INDEXED", PrettyInt64(s.Indexed)),
+		metricRow("LAG", PrettyInt64(lag)+" blocks"),
+		metricRow("PROGRESS", fmt.Sprintf("%.4f%%", s.Progress*100)),
+		metricRow("SPEED", fmt.Sprintf("%.2f blocks/s", bps)),
+		metricRow("ETA", eta),
+		metricRow("LAST BLOCK", s.LastUpdate.Format("2006-01-02 15:04:05")+
+			" ("+time.Since(s.LastUpdate).Truncate(time.Second).String()+" ago)"),
+	}
+}
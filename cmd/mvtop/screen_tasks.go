@@ -0,0 +1,37 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Authors: abdul@blockwatch.cc, alex@blockwatch.cc
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func taskRows(res Model) [][]*RowCell {
+	t := res.Tasks
+	if !res.IsValid() {
+		return nil
+	}
+	return [][]*RowCell{
+		metricRow("WORKERS", fmt.Sprintf("%d / %d", t.Inflight, t.MaxTasks)),
+		metricRow("QUEUED", PrettyInt(t.Idle)),
+		metricRow("RUNNING", PrettyInt(t.Running)),
+		metricRow("UNDELIVERED", PrettyInt(t.Pending)),
+		metricRow("SUCCESS", PrettyInt64(t.Success)),
+		metricRow("FAILED", PrettyInt64(t.Failed)),
+		metricRow("TIMEOUT", PrettyInt64(t.Timeout)),
+		metricRow("DELIVERED", PrettyInt64(t.Delivered)),
+		metricRow("THROUGHPUT", fmt.Sprintf("%3.1f tasks/s",
+			rate(t.Delivered, prev.Tasks.Delivered, prev.Time))),
+		metricRow("RETRY INTERVAL", (time.Duration(t.RetryAfter) * time.Millisecond).String()),
+		metricRow("ERROR RATE", errorRate(t.Failed+t.Timeout, t.Success+t.Failed+t.Timeout)),
+	}
+}
+
+func errorRate(n, total int64) string {
+	if total == 0 {
+		return "-- %"
+	}
+	return strconv.FormatFloat(float64(n*100)/float64(total), 'f', 2, 64) + "%"
+}
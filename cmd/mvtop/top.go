@@ -11,8 +11,9 @@ import (
 
 var (
 	next, prev Model
-	position   int = 0
-	writePos   int = 0
+	position   int    = 0
+	writePos   int    = 0
+	screen     Screen = ScreenTables
 )
 
 type Top struct {
@@ -43,10 +44,22 @@ func (t *Top) poll() {
 	go func() {
 		for {
 			prev = next
-			next.Time = time.Now()
-			next.Table, next.Error = t.api.GetTableStats()
-			next.Sys, next.Error = t.api.GetSysStats()
-			next.Tip, next.Error = t.api.GetTip()
+			next = Model{Time: time.Now()}
+			var errs [8]error
+			next.Table, errs[0] = t.api.GetTableStats()
+			next.Sys, errs[1] = t.api.GetSysStats()
+			next.Tip, errs[2] = t.api.GetTip()
+			next.Status, errs[3] = t.api.GetStatus()
+			next.Reorgs, errs[4] = t.api.GetReorgs()
+			next.Tasks, errs[5] = t.api.GetTaskStats()
+			next.Caches, errs[6] = t.api.GetCacheStats()
+			next.Routes, errs[7] = t.api.GetRouteStats()
+			for _, err := range errs {
+				if err != nil {
+					next.Error = err
+					break
+				}
+			}
 			if next.Error != nil {
 				if f, ok := t.views[FooterName]; ok {
 					f.Refresh(next)
@@ -0,0 +1,319 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package archive stores raw RPC block bundles as compressed JSON files so
+// that blocks can be re-indexed without an archive node.
+//
+// Blocks are kept as the unmodified node response next to the raw script and
+// storage responses fetched for originations, so decoding an archived block
+// goes through the same code path as decoding it from the node.
+//
+// Files are grouped into directories of 10,000 blocks and named after block
+// height and hash, e.g. `0000123/0001234567_BLxyz.json.gz`. Only one block
+// per height is kept, writing a block replaces orphans at the same height.
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+var ErrNotFound = errors.New("archive: block not found")
+
+const (
+	groupSize = 10000
+	fileExt   = ".json.gz"
+)
+
+type Archive struct {
+	mu   sync.RWMutex
+	path string
+}
+
+// Open opens or creates an archive at path.
+func Open(path string) (*Archive, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &Archive{path: path}, nil
+}
+
+func (a *Archive) Path() string {
+	return a.path
+}
+
+func (a *Archive) dir(height int64) string {
+	return filepath.Join(a.path, fmt.Sprintf("%07d", height/groupSize))
+}
+
+func (a *Archive) filename(height int64, hash mavryk.BlockHash) string {
+	return filepath.Join(a.dir(height), fmt.Sprintf("%010d_%s%s", height, hash, fileExt))
+}
+
+// find returns all files stored for height.
+func (a *Archive) find(height int64) ([]string, error) {
+	return filepath.Glob(filepath.Join(a.dir(height), fmt.Sprintf("%010d_*%s", height, fileExt)))
+}
+
+// record is the file layout. The raw block shadows the decoded block of the
+// embedded bundle, files written before raw blocks were kept contain the
+// re-encoded block which decodes the same way.
+type record struct {
+	*rpc.Bundle
+	Block json.RawMessage
+}
+
+// Put writes a bundle and removes other blocks stored at the same height.
+func (a *Archive) Put(b *rpc.Bundle) error {
+	if !b.IsValid() {
+		return fmt.Errorf("archive: invalid bundle")
+	}
+	height := b.Height()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(a.dir(height), 0700); err != nil {
+		return err
+	}
+	fname := a.filename(height, b.Hash())
+	tmp := fname + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	rec := record{Bundle: b, Block: b.Raw}
+	if len(rec.Block) == 0 {
+		rec.Block, err = json.Marshal(b.Block)
+	}
+	zw := gzip.NewWriter(f)
+	if err == nil {
+		err = json.NewEncoder(zw).Encode(rec)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("archive: write block %d: %w", height, err)
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		return err
+	}
+
+	// drop orphans
+	files, _ := a.find(height)
+	for _, v := range files {
+		if v != fname {
+			log.Debugf("archive: removing orphan %s", filepath.Base(v))
+			os.Remove(v)
+		}
+	}
+	return nil
+}
+
+// Get reads the bundle at height. When hash is valid the stored block must
+// match, otherwise ErrNotFound is returned.
+func (a *Archive) Get(height int64, hash mavryk.BlockHash) (*rpc.Bundle, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var fname string
+	if hash.IsValid() {
+		fname = a.filename(height, hash)
+	} else {
+		files, err := a.find(height)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, ErrNotFound
+		}
+		fname = files[0]
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("archive: read block %d: %w", height, err)
+	}
+	defer zr.Close()
+	rec := record{Bundle: &rpc.Bundle{}}
+	if err := json.NewDecoder(zr).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("archive: decode block %d: %w", height, err)
+	}
+	b := rec.Bundle
+	if len(rec.Block) > 0 {
+		b.Block = &rpc.Block{}
+		if err := json.Unmarshal(rec.Block, b.Block); err != nil {
+			return nil, fmt.Errorf("archive: decode block %d: %w", height, err)
+		}
+		b.Raw = rec.Block
+	}
+	if !b.IsValid() {
+		return nil, fmt.Errorf("archive: invalid block %d", height)
+	}
+	// replay recorded script and storage responses
+	if !b.Scripts.IsEmpty() {
+		if err := b.Block.UpdateAllOriginatedScripts(context.Background(), b.Scripts); err != nil {
+			return nil, fmt.Errorf("archive: scripts for block %d: %w", height, err)
+		}
+	}
+	return b, nil
+}
+
+// Entry describes an archived block file.
+type Entry struct {
+	Height int64
+	Hash   string
+	Path   string
+	Size   int64
+}
+
+// List returns archived blocks in [from, to] sorted by height. A negative
+// to means no upper limit.
+func (a *Archive) List(from, to int64) ([]Entry, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	res := make([]Entry, 0)
+	err := filepath.WalkDir(a.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == a.path {
+				return nil
+			}
+			// skip groups outside the range
+			g, err := strconv.ParseInt(d.Name(), 10, 64)
+			if err != nil {
+				return fs.SkipDir
+			}
+			if (g+1)*groupSize <= from || (to >= 0 && g*groupSize > to) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		name, ok := strings.CutSuffix(d.Name(), fileExt)
+		if !ok {
+			return nil
+		}
+		h, hash, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil
+		}
+		height, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || height < from || (to >= 0 && height > to) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		res = append(res, Entry{
+			Height: height,
+			Hash:   hash,
+			Path:   path,
+			Size:   info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Height < res[j].Height })
+	return res, nil
+}
+
+// Prune deletes archived blocks in [from, to] and returns the number of
+// removed files.
+func (a *Archive) Prune(from, to int64) (int, error) {
+	list, err := a.List(from, to)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var n int
+	for _, v := range list {
+		if err := os.Remove(v.Path); err != nil {
+			return n, err
+		}
+		n++
+	}
+	// remove empty group directories
+	dirs, _ := os.ReadDir(a.path)
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		p := filepath.Join(a.path, d.Name())
+		if files, _ := os.ReadDir(p); len(files) == 0 {
+			os.Remove(p)
+		}
+	}
+	return n, nil
+}
+
+// Export writes archived blocks in [from, to] as a tar stream using the
+// same file layout so it can be extracted into another archive directory.
+func (a *Archive) Export(w io.Writer, from, to int64) (int, error) {
+	list, err := a.List(from, to)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	tw := tar.NewWriter(w)
+	var n int
+	for _, v := range list {
+		if err := exportFile(tw, a.path, v.Path); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, tw.Close()
+}
+
+func exportFile(tw *tar.Writer, base, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name, _ = filepath.Rel(base, path)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,106 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+var (
+	testSource   = mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{1}, 20))
+	testContract = mavryk.NewAddress(mavryk.AddressTypeContract, bytes.Repeat([]byte{2}, 20))
+	testHash     = mavryk.NewBlockHash(bytes.Repeat([]byte{3}, 32))
+)
+
+// testBlock renders a node block response at level 5 with an origination
+// whose storage contains a bigmap and must be fetched from the node.
+func testBlock() []byte {
+	return []byte(fmt.Sprintf(`{"protocol":%q,"chain_id":%q,"hash":%q,`+
+		`"header":{"level":5,"proto":1,"predecessor":%q,"timestamp":"2024-01-01T00:00:00Z"},`+
+		`"metadata":{"protocol":%q,"level_info":{"level":5,"cycle":0,"cycle_position":4}},`+
+		`"operations":[[{"hash":%q,"contents":[]}],[],[],[{"hash":%q,"contents":[`+
+		`{"kind":"origination","source":%q,"fee":"1000","counter":"1","gas_limit":"1000","storage_limit":"1000","balance":"0",`+
+		`"script":{"code":[{"prim":"parameter","args":[{"prim":"unit"}]},{"prim":"storage","args":[{"prim":"big_map","args":[{"prim":"string"},{"prim":"nat"}]}]},`+
+		`{"prim":"code","args":[[{"prim":"CDR"},{"prim":"NIL","args":[{"prim":"operation"}]},{"prim":"PAIR"}]]}],"storage":[]},`+
+		`"metadata":{"operation_result":{"status":"applied","originated_contracts":[%q]}}}]}]]}`,
+		mavryk.ProtoAlpha, mavryk.Mainnet, testHash, testHash,
+		mavryk.ProtoAlpha, mavryk.ZeroOpHash, mavryk.ZeroOpHash, testSource, testContract))
+}
+
+func TestArchiveRawBlock(t *testing.T) {
+	raw := testBlock()
+	block := &rpc.Block{}
+	if err := json.Unmarshal(raw, block); err != nil {
+		t.Fatal(err)
+	}
+
+	// record the storage response as if fetched from the node
+	scripts := &rpc.ScriptStore{
+		Storage: map[string]json.RawMessage{testContract.String(): json.RawMessage(`{"int":"42"}`)},
+	}
+	if err := block.UpdateAllOriginatedScripts(context.Background(), scripts); err != nil {
+		t.Fatal(err)
+	}
+	if got := originationStorage(t, block); got != 42 {
+		t.Fatalf("storage bigmap %d, want 42", got)
+	}
+
+	arch, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &rpc.Bundle{Block: block, Params: rpc.NewParams(), Scripts: scripts, Raw: raw}
+	if err := arch.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file keeps the node response as is
+	f, err := os.Open(arch.filename(5, testHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := io.ReadAll(zr)
+	if !bytes.Contains(buf, raw) {
+		t.Errorf("archived file does not contain the raw block")
+	}
+
+	// decoding replays recorded storage
+	res, err := arch.Get(5, mavryk.BlockHash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Raw, raw) {
+		t.Errorf("raw block mismatch")
+	}
+	if !res.Hash().Equal(testHash) || res.Height() != 5 {
+		t.Errorf("block %d %s, want 5 %s", res.Height(), res.Hash(), testHash)
+	}
+	if got := originationStorage(t, res.Block); got != 42 {
+		t.Errorf("storage bigmap %d, want 42", got)
+	}
+}
+
+func originationStorage(t *testing.T, b *rpc.Block) int64 {
+	t.Helper()
+	org, ok := b.Operations[3][0].Contents[0].(*rpc.Origination)
+	if !ok || org.Script == nil {
+		t.Fatalf("missing origination script")
+	}
+	if org.Script.Storage.Int == nil {
+		return -1
+	}
+	return org.Script.Storage.Int.Int64()
+}
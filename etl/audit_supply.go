@@ -0,0 +1,409 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/store"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+type SupplyCheckStatus string
+
+const (
+	SupplyCheckOk       SupplyCheckStatus = "ok"
+	SupplyCheckMismatch SupplyCheckStatus = "mismatch" // actual != expected
+	SupplyCheckExceeded SupplyCheckStatus = "exceeded" // actual > expected upper bound
+	SupplyCheckSkipped  SupplyCheckStatus = "skipped"  // data not available
+)
+
+// SupplyCheck is a single reconciliation result. Exact checks must match
+// to the last mumav, bound checks treat the expected value as upper limit
+// since missed blocks, endorsements or nonces reduce actual issuance.
+type SupplyCheck struct {
+	Name     string            `json:"name"`
+	Expected int64             `json:"expected"`
+	Actual   int64             `json:"actual"`
+	Diff     int64             `json:"diff"`
+	IsBound  bool              `json:"is_bound"`
+	Status   SupplyCheckStatus `json:"status"`
+	Note     string            `json:"note,omitempty"`
+}
+
+func (c *SupplyCheck) eval() {
+	c.Diff = c.Actual - c.Expected
+	switch {
+	case c.Status == SupplyCheckSkipped:
+	case c.IsBound && c.Diff > 0:
+		c.Status = SupplyCheckExceeded
+	case !c.IsBound && c.Diff != 0:
+		c.Status = SupplyCheckMismatch
+	default:
+		c.Status = SupplyCheckOk
+	}
+}
+
+func (c SupplyCheck) IsFailed() bool {
+	return c.Status == SupplyCheckMismatch || c.Status == SupplyCheckExceeded
+}
+
+// SupplyAudit reconciles indexed supply changes within a cycle against
+// protocol issuance and (at chain tip) against the sum of all balances.
+type SupplyAudit struct {
+	Cycle       int64          `json:"cycle"`
+	StartHeight int64          `json:"start_height"`
+	EndHeight   int64          `json:"end_height"`
+	IsComplete  bool           `json:"is_complete"`
+	Start       *model.Supply  `json:"-"`
+	End         *model.Supply  `json:"-"`
+	Minted      int64          `json:"minted"`
+	Burned      int64          `json:"burned"`
+	Issuance    rpc.Issuance   `json:"issuance"`
+	Checks      []*SupplyCheck `json:"checks"`
+	Failed      int            `json:"failed"`
+}
+
+func (a *SupplyAudit) add(c *SupplyCheck) {
+	c.eval()
+	if c.IsFailed() {
+		a.Failed++
+	}
+	a.Checks = append(a.Checks, c)
+}
+
+func (a SupplyAudit) IsValid() bool {
+	return a.Failed == 0
+}
+
+// ErrNoAudit is returned when no audit was stored for a cycle.
+var ErrNoAudit = errors.New("supply audit not found")
+
+// AuditSupply reconciles supply for cycle up to the current tip height. The balance sum check only runs for the cycle that contains the tip because
+// account and baker tables only keep live state, it is skipped when a block
+// is written while balances are summed.
+func (m *Indexer) AuditSupply(ctx context.Context, cycle, height int64) (*SupplyAudit, error) {
+	p := m.ParamsByCycle(cycle)
+	if p == nil {
+		return nil, model.ErrNoCycle
+	}
+	start, end := p.CycleStartHeight(cycle), p.CycleEndHeight(cycle)
+	if start > height {
+		return nil, model.ErrNoCycle
+	}
+	audit := &SupplyAudit{
+		Cycle:       cycle,
+		StartHeight: start,
+		EndHeight:   min(end, height),
+		IsComplete:  end <= height,
+	}
+
+	// supply state before and at the end of the audited range
+	var err error
+	if start > 0 {
+		audit.Start, err = m.SupplyByHeight(ctx, start-1)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		audit.Start = &model.Supply{}
+	}
+	audit.End, err = m.SupplyByHeight(ctx, audit.EndHeight)
+	if err != nil {
+		return nil, err
+	}
+	s0, s1 := audit.Start, audit.End
+	audit.Minted = s1.Minted - s0.Minted
+	audit.Burned = s1.Burned - s0.Burned
+
+	// 1 - component sums
+	audit.add(&SupplyCheck{
+		Name:     "minted_components",
+		Expected: audit.Minted,
+		Actual: (s1.MintedBaking - s0.MintedBaking) +
+			(s1.MintedEndorsing - s0.MintedEndorsing) +
+			(s1.MintedSeeding - s0.MintedSeeding) +
+			(s1.MintedAirdrop - s0.MintedAirdrop) +
+			(s1.MintedSubsidy - s0.MintedSubsidy),
+	})
+	audit.add(&SupplyCheck{
+		Name:     "burned_components",
+		Expected: audit.Burned,
+		Actual: (s1.BurnedDoubleBaking - s0.BurnedDoubleBaking) +
+			(s1.BurnedDoubleEndorse - s0.BurnedDoubleEndorse) +
+			(s1.BurnedOrigination - s0.BurnedOrigination) +
+			(s1.BurnedAllocation - s0.BurnedAllocation) +
+			(s1.BurnedSeedMiss - s0.BurnedSeedMiss) +
+			(s1.BurnedStorage - s0.BurnedStorage) +
+			(s1.BurnedOffline - s0.BurnedOffline) +
+			(s1.BurnedRollup - s0.BurnedRollup),
+		Note: "explicit burns to the burn address are not part of burned supply",
+	})
+
+	// 2 - total supply delta
+	audit.add(&SupplyCheck{
+		Name:     "total_delta",
+		Expected: audit.Minted - audit.Burned,
+		Actual:   s1.Total - s0.Total,
+	})
+
+	// 3 - protocol issuance limits from indexed cycle rates
+	cc, err := m.CycleByNum(ctx, cycle)
+	if err != nil {
+		return nil, err
+	}
+	audit.Issuance = rpc.Issuance{
+		Cycle:           cycle,
+		BakingReward:    cc.BlockReward,
+		BakingBonus:     cc.BlockBonusPerSlot,
+		AttestingReward: cc.EndorsementRewardPerSlot,
+		LBSubsidy:       cc.LBSubsidy,
+		SeedNonceTip:    cc.NonceRevelationReward,
+		VdfTip:          cc.VdfRevelationReward,
+	}
+	nBlocks := audit.EndHeight - audit.StartHeight + 1
+	nSlots := int64(p.ConsensusCommitteeSize)
+	if p.Version < 12 {
+		nSlots = int64(p.EndorsersPerBlock)
+	}
+	var nNonces int64
+	if p.BlocksPerCommitment > 0 {
+		nNonces = nBlocks / p.BlocksPerCommitment
+	}
+	audit.add(&SupplyCheck{
+		Name:     "minted_baking",
+		Expected: nBlocks * cc.MaxBlockReward,
+		Actual:   s1.MintedBaking - s0.MintedBaking,
+		IsBound:  true,
+	})
+	audit.add(&SupplyCheck{
+		Name:     "minted_endorsing",
+		Expected: nBlocks * nSlots * cc.EndorsementRewardPerSlot,
+		Actual:   s1.MintedEndorsing - s0.MintedEndorsing,
+		IsBound:  true,
+	})
+	audit.add(&SupplyCheck{
+		Name:     "minted_seeding",
+		Expected: nNonces*cc.NonceRevelationReward + cc.VdfRevelationReward,
+		Actual:   s1.MintedSeeding - s0.MintedSeeding,
+		IsBound:  true,
+	})
+	audit.add(&SupplyCheck{
+		Name:     "minted_subsidy",
+		Expected: nBlocks * cc.LBSubsidy,
+		Actual:   s1.MintedSubsidy - s0.MintedSubsidy,
+		IsBound:  true,
+	})
+
+	// 4 - compare rewards paid in receipts against indexed issuance rates
+	check, err := m.auditIssuance(ctx, cc, p, audit.StartHeight, audit.EndHeight)
+	if err != nil {
+		return nil, err
+	}
+	audit.add(check)
+
+	// 5 - sum of all balances vs total supply (only possible at tip)
+	check = &SupplyCheck{
+		Name:     "balance_sum",
+		Expected: s1.Total,
+	}
+	if audit.EndHeight != height {
+		check.Status = SupplyCheckSkipped
+		check.Note = "account balances are only available at chain tip"
+	} else if seq := m.writeSeq.Load(); seq&1 != 0 || m.writeHeight.Load() != height {
+		check.Status = SupplyCheckSkipped
+		check.Note = "chain advanced beyond the audited height"
+	} else {
+		check.Actual, err = m.SumBalances(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if m.writeSeq.Load() != seq {
+			check.Status = SupplyCheckSkipped
+			check.Note = "chain advanced while summing balances"
+		}
+	}
+	audit.add(check)
+
+	return audit, nil
+}
+
+// auditIssuance compares rewards paid in block receipts between heights from
+// and to against the issuance rates indexed for the cycle. Bake, seed nonce,
+// vdf and subsidy ops must pay the cycle rate, bonus ops pay the bonus rate
+// for every attested slot above threshold the block includes. Rates stem
+// from the node's expected issuance while payouts come from balance updates,
+// so a mismatch points to wrong rates or misattributed rewards.
+func (m *Indexer) auditIssuance(ctx context.Context, cc *model.Cycle, p *rpc.Params, from, to int64) (*SupplyCheck, error) {
+	check := &SupplyCheck{
+		Name: "issuance_rates",
+	}
+	if p.Version < 12 {
+		check.Status = SupplyCheckSkipped
+		check.Note = "rewards before Tenderbake are not paid per kind"
+		return check, nil
+	}
+	if first := m.PrunedHeight(model.OpTableKey); first > from {
+		check.Status = SupplyCheckSkipped
+		check.Note = fmt.Sprintf("operations before block %d have been pruned", first)
+		return check, nil
+	}
+	blocks, err := m.Table(model.BlockTableKey)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// bonus in block h pays for attestations of block h-1
+	var (
+		b     model.Block
+		slots = make(map[int64]int)
+	)
+	err = pack.NewQuery("audit.issuance_slots").
+		WithTable(blocks).
+		WithFields("h", "e").
+		AndRange("height", from-1, to-1).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&b); err != nil {
+				return err
+			}
+			slots[b.Height] = b.NSlotsEndorsed
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	types := []model.OpType{
+		model.OpTypeBake,
+		model.OpTypeBonus,
+		model.OpTypeNonceRevelation,
+		model.OpTypeVdfRevelation,
+		model.OpTypeSubsidy,
+	}
+	var (
+		op   model.Op
+		paid = make(map[model.OpType]int64)
+		want = make(map[model.OpType]int64)
+	)
+	err = pack.NewQuery("audit.issuance_ops").
+		WithTable(ops).
+		WithFields("t", "h", "r", "v").
+		AndRange("height", from, to).
+		AndIn("type", types).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&op); err != nil {
+				return err
+			}
+			paid[op.Type] += op.Reward + op.Volume
+			switch op.Type {
+			case model.OpTypeBake:
+				want[op.Type] += cc.BlockReward
+			case model.OpTypeBonus:
+				extra := max(slots[op.Height-1]-p.ConsensusThreshold, 0)
+				want[op.Type] += cc.BlockBonusPerSlot * int64(extra)
+			case model.OpTypeNonceRevelation:
+				want[op.Type] += cc.NonceRevelationReward
+			case model.OpTypeVdfRevelation:
+				want[op.Type] += cc.VdfRevelationReward
+			case model.OpTypeSubsidy:
+				want[op.Type] += cc.LBSubsidy
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]string, 0)
+	for _, typ := range types {
+		check.Expected += want[typ]
+		check.Actual += paid[typ]
+		if want[typ] != paid[typ] {
+			notes = append(notes, fmt.Sprintf("%s paid %d expected %d", typ, paid[typ], want[typ]))
+		}
+	}
+	check.Note = strings.Join(notes, ", ")
+	return check, nil
+}
+
+// StoreSupplyAudit persists a cycle-end audit, replacing an audit stored for
+// the same cycle before a reorg.
+func (m *Indexer) StoreSupplyAudit(audit *SupplyAudit) error {
+	return m.statedb.Update(func(dbTx store.Tx) error {
+		return dbStoreSupplyAudit(dbTx, audit)
+	})
+}
+
+// SupplyAuditByCycle returns the audit stored at the end of cycle.
+func (m *Indexer) SupplyAuditByCycle(ctx context.Context, cycle int64) (*SupplyAudit, error) {
+	var audit *SupplyAudit
+	err := m.statedb.View(func(dbTx store.Tx) error {
+		var err error
+		audit, err = dbLoadSupplyAudit(dbTx, cycle)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if audit == nil {
+		return nil, ErrNoAudit
+	}
+	return audit, nil
+}
+
+// SumBalances returns the sum of all spendable, unclaimed, bonded, unstaked,
+// frozen and staked balances across all accounts and bakers.
+func (m *Indexer) SumBalances(ctx context.Context) (int64, error) {
+	accounts, err := m.Table(model.AccountTableKey)
+	if err != nil {
+		return 0, err
+	}
+	bakers, err := m.Table(model.BakerTableKey)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		sum int64
+		acc model.Account
+		bkr model.Baker
+	)
+	err = pack.NewQuery("audit.sum_accounts").
+		WithTable(accounts).
+		WithoutCache().
+		WithFields("s", "U", "L", "Z").
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&acc); err != nil {
+				return err
+			}
+			sum += acc.Balance() + acc.UnclaimedBalance
+			return nil
+		})
+	if err != nil {
+		return 0, err
+	}
+	err = pack.NewQuery("audit.sum_bakers").
+		WithTable(bakers).
+		WithoutCache().
+		WithFields("z", "Z", "Y", "g").
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&bkr); err != nil {
+				return err
+			}
+			sum += bkr.FrozenDeposits + bkr.FrozenRewards + bkr.FrozenFees + bkr.TotalStake
+			return nil
+		})
+	if err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
@@ -739,17 +739,18 @@ func (b *Builder) InitAccounts(ctx context.Context) error {
 		b.block.ProposerConsensusKeyId = b.block.BakerId
 	}
 
-	if b.block.ProposerId != b.block.ProposerConsensusKeyId {
-		acc, ok := b.AccountById(b.block.ProposerConsensusKeyId)
+	// resolve consensus keys active at this height (v015+)
+	if addr := b.block.MV.Block.Metadata.ProposerConsensusKey; addr.IsValid() {
+		acc, ok := b.AccountByAddress(addr)
 		if !ok {
-			return fmt.Errorf("missing proposer consensus key account %d", b.block.ProposerConsensusKeyId)
+			return fmt.Errorf("missing proposer consensus key account %s", addr)
 		}
 		b.block.ProposerConsensusKeyId = acc.RowId
 	}
-	if b.block.BakerId != b.block.BakerConsensusKeyId {
-		acc, ok := b.AccountById(b.block.BakerConsensusKeyId)
+	if addr := b.block.MV.Block.Metadata.BakerConsensusKey; addr.IsValid() {
+		acc, ok := b.AccountByAddress(addr)
 		if !ok {
-			return fmt.Errorf("missing baker consensus key account %d", b.block.BakerConsensusKeyId)
+			return fmt.Errorf("missing baker consensus key account %s", addr)
 		}
 		b.block.BakerConsensusKeyId = acc.RowId
 	}
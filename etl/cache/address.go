@@ -6,7 +6,9 @@ package cache
 import (
 	"bytes"
 	"context"
+	"math/big"
 	"sort"
+	"strings"
 
 	"blockwatch.cc/packdb/pack"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -157,3 +159,118 @@ func (c *AddressCache) Update(accounts map[model.AccountID]*model.Account) error
 	c.stats.CountInserts(int64(len(ins)))
 	return nil
 }
+
+// maxPrefixScans bounds the number of concurrent FindPrefix calls.
+const maxPrefixScans = 2
+
+var prefixScans = make(chan struct{}, maxPrefixScans)
+
+// prefixRange is the inclusive range of hashes whose base58 encoding under
+// address type typ may start with a given prefix.
+type prefixRange struct {
+	typ    byte
+	lo, hi [20]byte
+}
+
+// newPrefixRanges translates a base58 address prefix into hash ranges, one
+// for each address type the prefix can belong to. Because all addresses of a
+// type encode to the same length, padding the prefix with the smallest and
+// largest base58 digit yields the smallest and largest matching payload.
+func newPrefixRanges(prefix string) []prefixRange {
+	res := make([]prefixRange, 0)
+	for t := mavryk.AddressTypeEd25519; t <= mavryk.AddressTypeSmartRollup; t++ {
+		ht := t.HashType()
+		if ht.Len != 20 || len(prefix) > ht.B58Len {
+			continue
+		}
+		pad := ht.B58Len - len(prefix)
+		lo, ok := decodeBase58Fixed(prefix+strings.Repeat("1", pad), len(ht.Id)+ht.Len+4)
+		if !ok {
+			// invalid base58 or out of range for this type
+			continue
+		}
+		hi, _ := decodeBase58Fixed(prefix+strings.Repeat("z", pad), len(ht.Id)+ht.Len+4)
+		m := len(ht.Id)
+		if bytes.Compare(ht.Id, lo[:m]) < 0 || bytes.Compare(ht.Id, hi[:m]) > 0 {
+			continue
+		}
+		r := prefixRange{typ: byte(t)}
+		if bytes.Equal(ht.Id, lo[:m]) {
+			copy(r.lo[:], lo[m:])
+		}
+		if bytes.Equal(ht.Id, hi[:m]) {
+			copy(r.hi[:], hi[m:])
+		} else {
+			copy(r.hi[:], bytes.Repeat([]byte{0xff}, 20))
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// decodeBase58Fixed decodes s into a big-endian number of exactly n bytes.
+// Values that do not fit are clamped to the largest n byte number and
+// reported as not ok.
+func decodeBase58Fixed(s string, n int) ([]byte, bool) {
+	v := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base58Alphabet, s[i])
+		if d < 0 {
+			return nil, false
+		}
+		v.Mul(v, radix).Add(v, big.NewInt(int64(d)))
+	}
+	buf := make([]byte, n)
+	if v.BitLen() > n*8 {
+		return bytes.Repeat([]byte{0xff}, n), false
+	}
+	return v.FillBytes(buf), true
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// FindPrefix returns ids of addresses whose string encoding starts with prefix.
+// The prefix is translated into raw hash ranges so that the linear scan only
+// base58-encodes candidates. Scans stop after limit matches and at most
+// maxPrefixScans run concurrently.
+func (c *AddressCache) FindPrefix(ctx context.Context, prefix string, limit int) []model.AccountID {
+	ranges := newPrefixRanges(prefix)
+	if len(ranges) == 0 || limit <= 0 {
+		return nil
+	}
+	select {
+	case prefixScans <- struct{}{}:
+		defer func() { <-prefixScans }()
+	case <-ctx.Done():
+		return nil
+	}
+	hashes := c.hashes
+	res := make([]model.AccountID, 0)
+	for offs := 0; offs+addrLen <= len(hashes); offs += addrLen {
+		if offs&0xffff == 0 && ctx.Err() != nil {
+			break
+		}
+		var match bool
+		for _, r := range ranges {
+			h := hashes[offs+1 : offs+addrLen]
+			if hashes[offs] == r.typ && bytes.Compare(h, r.lo[:]) >= 0 && bytes.Compare(h, r.hi[:]) <= 0 {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		a := mavryk.Address(hashes[offs : offs+addrLen])
+		if !strings.HasPrefix(a.String(), prefix) {
+			continue
+		}
+		res = append(res, model.AccountID(offs/addrLen+1))
+		if len(res) >= limit {
+			break
+		}
+	}
+	c.stats.CountHits(1)
+	return res
+}
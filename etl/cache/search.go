@@ -0,0 +1,375 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/tidwall/gjson"
+)
+
+type SearchDocKind byte
+
+const (
+	SearchDocAccount SearchDocKind = iota
+	SearchDocToken
+)
+
+// searchable text fields with their ranking weight
+var searchFields = []struct {
+	Name   string
+	Path   string
+	Weight int
+}{
+	{"alias", "alias.name", 10},
+	{"domain", "tzdomain.name", 8},
+	{"profile", "tzprofile.alias", 6},
+}
+
+var searchTokenFields = []struct {
+	Name   string
+	Path   string
+	Weight int
+}{
+	{"symbol", "symbol", 9},
+	{"name", "name", 7},
+}
+
+// SearchDoc is a searchable account or token. Accounts are keyed by address
+// because metadata may exist for accounts that are not indexed yet.
+type SearchDoc struct {
+	Kind    SearchDocKind
+	Address mavryk.Address
+	TokenId model.TokenID
+	Fields  map[string]string
+	weights map[string]int
+}
+
+func (d *SearchDoc) key() string {
+	if d.Kind == SearchDocToken {
+		return "T" + strconv.FormatUint(d.TokenId.U64(), 10)
+	}
+	return "A" + string(d.Address[:])
+}
+
+// SearchMatch is a ranked search result.
+type SearchMatch struct {
+	Doc   *SearchDoc
+	Field string
+	Score int
+}
+
+// SearchIndex is an in-memory inverted index over lowercased words of
+// account metadata names and token metadata names and symbols.
+type SearchIndex struct {
+	mu     sync.RWMutex
+	docs   map[string]*SearchDoc
+	terms  map[string]map[string]struct{}
+	sorted []string
+	dirty  bool
+	built  bool
+	stats  Stats
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		docs:  make(map[string]*SearchDoc),
+		terms: make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *SearchIndex) IsBuilt() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.built
+}
+
+func (c *SearchIndex) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.docs)
+}
+
+func (c *SearchIndex) Stats() Stats {
+	s := c.stats.Get()
+	s.Size = c.Len()
+	return s
+}
+
+// Reset drops all documents so the index is rebuilt on next use.
+func (c *SearchIndex) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs = make(map[string]*SearchDoc)
+	c.terms = make(map[string]map[string]struct{})
+	c.sorted = nil
+	c.built = false
+}
+
+// Build loads all account and token metadata. Either table may be nil when
+// the respective index is disabled. Updates are blocked while building.
+func (c *SearchIndex) Build(ctx context.Context, meta, tokens *pack.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs = make(map[string]*SearchDoc)
+	c.terms = make(map[string]map[string]struct{})
+	c.stats.CountUpdates(1)
+	if meta != nil {
+		m := &model.Metadata{}
+		err := pack.NewQuery("cache.search.meta").
+			WithTable(meta).
+			WithoutCache().
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(m); err != nil {
+					return err
+				}
+				c.updateMetadata(m)
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	if tokens != nil {
+		m := &model.TokenMeta{}
+		err := pack.NewQuery("cache.search.token").
+			WithTable(tokens).
+			WithoutCache().
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(m); err != nil {
+					return err
+				}
+				c.updateTokenMeta(m)
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	c.dirty = true
+	c.built = true
+	return nil
+}
+
+// UpdateMetadata indexes names from an account metadata model. Updates
+// before the index is built are ignored since build reads current state.
+func (c *SearchIndex) UpdateMetadata(m *model.Metadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.built {
+		return
+	}
+	c.stats.CountUpdates(1)
+	c.updateMetadata(m)
+}
+
+// RemoveMetadata drops an account from the index.
+func (c *SearchIndex) RemoveMetadata(addr mavryk.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.built {
+		return
+	}
+	c.stats.CountEvictions(1)
+	c.remove((&SearchDoc{Address: addr}).key())
+}
+
+// UpdateTokenMeta indexes name and symbol from a token metadata model.
+func (c *SearchIndex) UpdateTokenMeta(m *model.TokenMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.built {
+		return
+	}
+	c.stats.CountUpdates(1)
+	c.updateTokenMeta(m)
+}
+
+func (c *SearchIndex) updateMetadata(m *model.Metadata) {
+	doc := &SearchDoc{
+		Kind:    SearchDocAccount,
+		Address: m.Address.Clone(),
+		Fields:  make(map[string]string),
+		weights: make(map[string]int),
+	}
+	if len(m.Content) > 0 {
+		res := gjson.ParseBytes(m.Content)
+		for _, f := range searchFields {
+			if v := res.Get(f.Path).String(); v != "" {
+				doc.Fields[f.Name] = v
+				doc.weights[f.Name] = f.Weight
+			}
+		}
+	}
+	c.insert(doc)
+}
+
+func (c *SearchIndex) updateTokenMeta(m *model.TokenMeta) {
+	doc := &SearchDoc{
+		Kind:    SearchDocToken,
+		TokenId: m.Token,
+		Fields:  make(map[string]string),
+		weights: make(map[string]int),
+	}
+	if len(m.Data) > 0 {
+		res := gjson.ParseBytes(m.Data)
+		for _, f := range searchTokenFields {
+			if v := res.Get(f.Path).String(); v != "" {
+				doc.Fields[f.Name] = v
+				doc.weights[f.Name] = f.Weight
+			}
+		}
+	}
+	c.insert(doc)
+}
+
+func (c *SearchIndex) insert(doc *SearchDoc) {
+	key := doc.key()
+	c.remove(key)
+	if len(doc.Fields) == 0 {
+		return
+	}
+	c.docs[key] = doc
+	for _, v := range doc.Fields {
+		for _, t := range tokenize(v) {
+			set, ok := c.terms[t]
+			if !ok {
+				set = make(map[string]struct{})
+				c.terms[t] = set
+				c.dirty = true
+			}
+			set[key] = struct{}{}
+		}
+	}
+}
+
+func (c *SearchIndex) remove(key string) {
+	doc, ok := c.docs[key]
+	if !ok {
+		return
+	}
+	delete(c.docs, key)
+	for _, v := range doc.Fields {
+		for _, t := range tokenize(v) {
+			set := c.terms[t]
+			delete(set, key)
+			if len(set) == 0 {
+				delete(c.terms, t)
+				c.dirty = true
+			}
+		}
+	}
+}
+
+// Search returns documents where every query word is a prefix of some word
+// in a document field, ranked by match quality and field weight.
+func (c *SearchIndex) Search(q string, limit int) []SearchMatch {
+	words := tokenize(q)
+	if len(words) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if c.dirty {
+		c.sorted = make([]string, 0, len(c.terms))
+		for t := range c.terms {
+			c.sorted = append(c.sorted, t)
+		}
+		sort.Strings(c.sorted)
+		c.dirty = false
+	}
+	c.mu.Unlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// intersect candidates across all query words
+	var cand map[string]struct{}
+	for _, w := range words {
+		next := make(map[string]struct{})
+		for i := sort.SearchStrings(c.sorted, w); i < len(c.sorted) && strings.HasPrefix(c.sorted[i], w); i++ {
+			for key := range c.terms[c.sorted[i]] {
+				if cand == nil {
+					next[key] = struct{}{}
+				} else if _, ok := cand[key]; ok {
+					next[key] = struct{}{}
+				}
+			}
+		}
+		cand = next
+		if len(cand) == 0 {
+			c.stats.CountMisses(1)
+			return nil
+		}
+	}
+	c.stats.CountHits(1)
+
+	// rank
+	lq := strings.ToLower(strings.TrimSpace(q))
+	res := make([]SearchMatch, 0, len(cand))
+	for key := range cand {
+		doc := c.docs[key]
+		best := SearchMatch{Doc: doc}
+		for name, v := range doc.Fields {
+			lv := strings.ToLower(v)
+			var score int
+			switch {
+			case lv == lq:
+				score = 100
+			case strings.HasPrefix(lv, lq):
+				score = 75
+			case strings.Contains(lv, lq):
+				score = 50
+			default:
+				score = 25
+			}
+			score += doc.weights[name]
+			if score > best.Score || (score == best.Score && name < best.Field) {
+				best.Score = score
+				best.Field = name
+			}
+		}
+		res = append(res, best)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		vi, vj := res[i].Doc.Fields[res[i].Field], res[j].Doc.Fields[res[j].Field]
+		if len(vi) != len(vj) {
+			return len(vi) < len(vj)
+		}
+		return vi < vj
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// tokenize splits s into unique lowercase words.
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < 2 {
+		return words
+	}
+	sort.Strings(words)
+	n := 1
+	for i := 1; i < len(words); i++ {
+		if words[i] != words[n-1] {
+			words[n] = words[i]
+			n++
+		}
+	}
+	return words[:n]
+}
@@ -39,6 +39,9 @@ func (m *Indexer) CacheStats() map[string]interface{} {
 	stats["bigmap_types"] = m.bigmap_types.Stats()
 	stats["contract_types"] = m.contract_types.Stats()
 	stats["ticket_types"] = m.ticket_types.Stats()
+	if m.search.IsBuilt() {
+		stats["search"] = m.search.Stats()
+	}
 	return stats
 }
 
@@ -54,6 +57,7 @@ func (m *Indexer) PurgeCaches() {
 	m.bigmap_types.Purge()
 	m.contract_types.Purge()
 	m.ticket_types.Purge()
+	m.search.Reset()
 	for _, idx := range m.indexes {
 		for _, t := range idx.Tables() {
 			t.PurgeCache()
@@ -102,6 +106,33 @@ func (m *Indexer) LookupBlockTime(ctx context.Context, height int64) time.Time {
 	return last.Add(time.Duration(height-l+1) * p.BlockTime())
 }
 
+// called concurrently from API consumers, uses read-mostly cache and
+// resolves the cache once for all heights
+func (m *Indexer) LookupBlockTimes(ctx context.Context, heights []int64) []time.Time {
+	res := make([]time.Time, len(heights))
+	cc, err := m.getBlocks(ctx)
+	if err != nil {
+		return res
+	}
+	l := int64(cc.Len())
+	var (
+		last time.Time
+		bt   time.Duration
+	)
+	for i, height := range heights {
+		if height < l {
+			res[i] = cc.GetTime(height)
+			continue
+		}
+		if bt == 0 {
+			last = cc.GetTime(l - 1)
+			bt = m.reg.GetParamsLatest().BlockTime()
+		}
+		res[i] = last.Add(time.Duration(height-l+1) * bt)
+	}
+	return res
+}
+
 // called concurrently from API consumers, uses read-mostly cache
 func (m *Indexer) LookupBlockTimeMs(ctx context.Context, height int64) int64 {
 	if height == 0 {
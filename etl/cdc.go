@@ -0,0 +1,175 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/cdc"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// cdcHeightTables lists append-only tables that are captured by block height.
+// Rows are read back from tables after connect and before disconnect or
+// delete.
+var cdcHeightTables = []struct {
+	Key string
+	New func() cdc.Row
+}{
+	{model.BlockTableKey, func() cdc.Row { return &model.Block{} }},
+	{model.OpTableKey, func() cdc.Row { return &model.Op{} }},
+	{model.EndorseOpTableKey, func() cdc.Row { return &model.Endorsement{} }},
+	{model.FlowTableKey, func() cdc.Row { return &model.Flow{} }},
+	{model.EventTableKey, func() cdc.Row { return &model.Event{} }},
+	{model.TokenEventTableKey, func() cdc.Row { return &model.TokenEvent{} }},
+	{model.TicketEventTableKey, func() cdc.Row { return &model.TicketEvent{} }},
+}
+
+// CdcTables returns the names of all tables that support change capture.
+func CdcTables() []string {
+	keys := make([]string, 0, len(cdcHeightTables)+2)
+	for _, v := range cdcHeightTables {
+		keys = append(keys, v.Key)
+	}
+	return append(keys, model.AccountTableKey, model.BakerTableKey)
+}
+
+func (m *Indexer) CDC() *cdc.Log {
+	return m.cdc
+}
+
+// holdCdc queues a block's change log transaction until the table updates
+// it describes are flushed. This way a crash cannot emit events for blocks
+// that were never committed to the database.
+func (m *Indexer) holdCdc(tx *cdc.Tx) {
+	m.cdcMu.Lock()
+	m.cdcPending = append(m.cdcPending, tx)
+	m.cdcMu.Unlock()
+}
+
+// commitCdc writes all held back change log transactions in block order.
+// It must only be called after tables were flushed successfully.
+func (m *Indexer) commitCdc() error {
+	m.cdcMu.Lock()
+	defer m.cdcMu.Unlock()
+	for i, tx := range m.cdcPending {
+		if err := tx.Commit(); err != nil {
+			m.cdcPending = m.cdcPending[i:]
+			return err
+		}
+	}
+	m.cdcPending = m.cdcPending[:0]
+	return nil
+}
+
+// FlushCdc flushes table journals and releases held back change log events.
+// It is a no-op when no events are pending.
+func (m *Indexer) FlushCdc(ctx context.Context) error {
+	m.cdcMu.Lock()
+	n := len(m.cdcPending)
+	m.cdcMu.Unlock()
+	if n == 0 {
+		return nil
+	}
+	return m.FlushJournals(ctx)
+}
+
+// captureRows adds all rows at height from append-only tables to tx.
+func (m *Indexer) captureRows(ctx context.Context, tx *cdc.Tx, op string, height int64) error {
+	for _, v := range cdcHeightTables {
+		if !m.cdc.Enabled(v.Key) {
+			continue
+		}
+		table, ok := m.tables[v.Key]
+		if !ok {
+			continue
+		}
+		row := v.New()
+		err := pack.NewQuery("cdc.rows").
+			WithTable(table).
+			AndEqual("height", height).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(row); err != nil {
+					return err
+				}
+				if op == cdc.OpDelete {
+					tx.Delete(v.Key, row)
+				} else {
+					tx.Insert(v.Key, row)
+				}
+				return nil
+			})
+		if err != nil {
+			return fmt.Errorf("cdc: read %s: %v", v.Key, err)
+		}
+	}
+	return nil
+}
+
+// captureAccounts adds account and baker changes from the builder to tx.
+// New accounts are inserted on connect and removed on disconnect.
+func (m *Indexer) captureAccounts(tx *cdc.Tx, builder model.BlockBuilder, disconnect bool) {
+	accounts := m.cdc.Enabled(model.AccountTableKey)
+	bakers := m.cdc.Enabled(model.BakerTableKey)
+	addAccount := func(acc *model.Account) {
+		switch {
+		case !accounts:
+		case disconnect && acc.MustDelete:
+			tx.Delete(model.AccountTableKey, acc)
+		case !disconnect && acc.IsNew:
+			tx.Insert(model.AccountTableKey, acc)
+		case acc.IsDirty:
+			tx.Update(model.AccountTableKey, acc)
+		}
+	}
+	for _, acc := range builder.Accounts() {
+		addAccount(acc)
+	}
+	for _, bkr := range builder.Bakers() {
+		addAccount(bkr.Account)
+		switch {
+		case !bakers:
+		case disconnect && bkr.Account.MustDelete:
+			tx.Delete(model.BakerTableKey, bkr)
+		case !disconnect && bkr.IsNew:
+			tx.Insert(model.BakerTableKey, bkr)
+		case bkr.IsDirty:
+			tx.Update(model.BakerTableKey, bkr)
+		}
+	}
+}
+
+// captureDeletedAccounts adds accounts and bakers first seen at height to tx.
+func (m *Indexer) captureDeletedAccounts(ctx context.Context, tx *cdc.Tx, height int64) error {
+	for _, v := range []struct {
+		Key   string
+		Field string
+		New   func() cdc.Row
+	}{
+		{model.AccountTableKey, "first_seen", func() cdc.Row { return &model.Account{} }},
+		{model.BakerTableKey, "baker_since", func() cdc.Row { return &model.Baker{} }},
+	} {
+		table, ok := m.tables[v.Key]
+		if !ok || !m.cdc.Enabled(v.Key) {
+			continue
+		}
+		row := v.New()
+		err := pack.NewQuery("cdc.rows").
+			WithTable(table).
+			AndEqual(v.Field, height).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(row); err != nil {
+					return err
+				}
+				tx.Delete(v.Key, row)
+				return nil
+			})
+		if err != nil {
+			return fmt.Errorf("cdc: read %s: %v", v.Key, err)
+		}
+	}
+	return nil
+}
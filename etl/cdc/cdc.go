@@ -0,0 +1,485 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package cdc writes an append-only change-data-capture log of table row
+// inserts, updates and deletes for replication into downstream databases.
+//
+// The log is a sequence of JSON lines stored in rotating files. Each indexed,
+// rolled back or deleted block forms a transaction that starts with a begin
+// event and ends with a commit event carrying block height and hash. Every
+// event has a unique increasing sequence number that consumers use as
+// checkpoint.
+package cdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+var (
+	ErrClosed = errors.New("cdc: log closed")
+	ErrPruned = errors.New("cdc: checkpoint no longer available")
+)
+
+// event types
+const (
+	OpBegin  = "begin"
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpCommit = "commit"
+)
+
+// transaction kinds
+const (
+	KindConnect    = "connect"    // block added to main chain
+	KindDisconnect = "disconnect" // block removed during reorg
+	KindDelete     = "delete"     // block data removed after a failed build
+)
+
+const (
+	filePrefix      = "cdc-"
+	fileExt         = ".jsonl"
+	defaultFileSize = 128 << 20
+)
+
+// Row is a table row with a unique id.
+type Row interface {
+	ID() uint64
+}
+
+// Event is a single line in the log. Seq must remain the first field, it is
+// parsed from raw lines without decoding.
+type Event struct {
+	Seq    uint64          `json:"seq"`
+	Op     string          `json:"op"`
+	Kind   string          `json:"kind,omitempty"`
+	Height int64           `json:"height"`
+	Hash   string          `json:"hash"`
+	Table  string          `json:"table,omitempty"`
+	Key    uint64          `json:"key,omitempty"`
+	Count  int             `json:"count,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type Config struct {
+	Path     string   // log directory
+	MaxSize  int64    // rotate files after this size in bytes
+	MaxFiles int      // number of files to keep, 0 keeps all
+	Tables   []string // captured tables
+}
+
+type Log struct {
+	mu     sync.RWMutex
+	cfg    Config
+	tables map[string]struct{}
+	files  []uint64 // first seq of each file, sorted
+	file   *os.File
+	size   int64
+	seq    uint64 // last committed seq
+	notify chan struct{}
+	closed bool
+}
+
+// Open opens or creates a log in cfg.Path. An incomplete transaction at the
+// end of the last file, e.g. after a crash, is truncated.
+func Open(cfg Config) (*Log, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultFileSize
+	}
+	if err := os.MkdirAll(cfg.Path, 0700); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		cfg:    cfg,
+		tables: make(map[string]struct{}),
+		notify: make(chan struct{}),
+	}
+	for _, v := range cfg.Tables {
+		l.tables[v] = struct{}{}
+	}
+	files, err := l.listFiles()
+	if err != nil {
+		return nil, err
+	}
+	l.files = files
+	if len(files) == 0 {
+		if err := l.openFile(1); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	first := files[len(files)-1]
+	f, err := os.OpenFile(l.filename(first), os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	seq, size, err := lastCommit(f)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cdc: recover %s: %w", l.filename(first), err)
+	}
+	if seq == 0 {
+		seq = first - 1
+	}
+	l.file, l.size, l.seq = f, size, seq
+	log.Infof("CDC log at seq %d in %s", l.seq, cfg.Path)
+	return l, nil
+}
+
+// Enabled returns true when changes to table are captured.
+func (l *Log) Enabled(table string) bool {
+	_, ok := l.tables[table]
+	return ok
+}
+
+func (l *Log) Tables() []string {
+	return l.cfg.Tables
+}
+
+// LastSeq returns the sequence number of the last committed event.
+func (l *Log) LastSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.seq
+}
+
+// FirstSeq returns the sequence number of the oldest available event.
+func (l *Log) FirstSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.files[0]
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.notify)
+	return l.file.Close()
+}
+
+// Begin starts a transaction for a block.
+func (l *Log) Begin(kind string, height int64, hash mavryk.BlockHash) *Tx {
+	return &Tx{
+		log:    l,
+		kind:   kind,
+		height: height,
+		hash:   hash.String(),
+		buf:    bytes.NewBuffer(nil),
+	}
+}
+
+// Wait blocks until events after seq are committed.
+func (l *Log) Wait(ctx context.Context, seq uint64) error {
+	for {
+		l.mu.RLock()
+		last, ch, closed := l.seq, l.notify, l.closed
+		l.mu.RUnlock()
+		if closed {
+			return ErrClosed
+		}
+		if last > seq {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Read calls fn with each committed raw event line after since and returns
+// the seq of the last line read. A since of zero reads from the oldest
+// available event. fn may return io.EOF to stop after the current line.
+func (l *Log) Read(since uint64, fn func(seq uint64, line []byte) error) (uint64, error) {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return since, ErrClosed
+	}
+	last := l.seq
+	files := make([]uint64, len(l.files))
+	copy(files, l.files)
+	l.mu.RUnlock()
+
+	if since >= last {
+		return since, nil
+	}
+	if since > 0 && since+1 < files[0] {
+		return since, ErrPruned
+	}
+
+	// start with the last file containing since+1
+	start := sort.Search(len(files), func(i int) bool { return files[i] > since+1 }) - 1
+	if start < 0 {
+		start = 0
+	}
+	for _, first := range files[start:] {
+		if first > last {
+			break
+		}
+		f, err := os.Open(l.filename(first))
+		if err != nil {
+			return since, err
+		}
+		r := bufio.NewReaderSize(f, 1<<16)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				// skip incomplete lines
+				break
+			}
+			seq, ok := parseSeq(line)
+			if !ok || seq <= since {
+				continue
+			}
+			if seq > last {
+				f.Close()
+				return since, nil
+			}
+			err = fn(seq, line)
+			if err == nil || err == io.EOF {
+				since = seq
+			}
+			if err != nil {
+				f.Close()
+				return since, err
+			}
+		}
+		f.Close()
+	}
+	return since, nil
+}
+
+func (l *Log) commit(tx *Tx) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	seq, err := tx.encode(l.seq)
+	if err != nil {
+		return fmt.Errorf("cdc: encode: %w", err)
+	}
+	// write the entire transaction at once, readers skip incomplete lines
+	if _, err := l.file.Write(tx.buf.Bytes()); err != nil {
+		return fmt.Errorf("cdc: write: %w", err)
+	}
+	l.size += int64(tx.buf.Len())
+	l.seq = seq
+	close(l.notify)
+	l.notify = make(chan struct{})
+	if l.size >= l.cfg.MaxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("cdc: rotate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := l.openFile(l.seq + 1); err != nil {
+		return err
+	}
+	for l.cfg.MaxFiles > 0 && len(l.files) > l.cfg.MaxFiles {
+		name := l.filename(l.files[0])
+		log.Debugf("cdc: removing %s", filepath.Base(name))
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		l.files = l.files[1:]
+	}
+	return nil
+}
+
+func (l *Log) openFile(first uint64) error {
+	f, err := os.OpenFile(l.filename(first), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.size = 0
+	l.files = append(l.files, first)
+	return nil
+}
+
+func (l *Log) filename(first uint64) string {
+	return filepath.Join(l.cfg.Path, fmt.Sprintf("%s%016d%s", filePrefix, first, fileExt))
+}
+
+func (l *Log) listFiles() ([]uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(l.cfg.Path, filePrefix+"*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]uint64, 0, len(matches))
+	for _, v := range matches {
+		var first uint64
+		if _, err := fmt.Sscanf(filepath.Base(v), filePrefix+"%016d"+fileExt, &first); err == nil {
+			files = append(files, first)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
+	return files, nil
+}
+
+// lastCommit returns the seq of the last commit event in f and the file
+// offset behind it.
+func lastCommit(f *os.File) (uint64, int64, error) {
+	var (
+		seq       uint64
+		pos, size int64
+		ev        struct{ Op string }
+	)
+	r := bufio.NewReaderSize(f, 1<<16)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return seq, size, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		pos += int64(len(line))
+		s, ok := parseSeq(line)
+		if !ok || json.Unmarshal(line, &ev) != nil {
+			continue
+		}
+		if ev.Op == OpCommit {
+			seq, size = s, pos
+		}
+	}
+}
+
+// parseSeq reads the seq number from a raw event line.
+func parseSeq(line []byte) (uint64, bool) {
+	const prefix = `{"seq":`
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return 0, false
+	}
+	line = line[len(prefix):]
+	end := bytes.IndexByte(line, ',')
+	if end < 0 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(string(line[:end]), 10, 64)
+	return seq, err == nil
+}
+
+// Tx collects row changes of a single block. Row data is encoded when added
+// so callers may reuse rows. Nothing is written before Commit.
+type Tx struct {
+	log    *Log
+	kind   string
+	height int64
+	hash   string
+	buf    *bytes.Buffer
+	events []Event
+	err    error
+}
+
+func (tx *Tx) Insert(table string, row Row) {
+	tx.add(OpInsert, table, row)
+}
+
+func (tx *Tx) Update(table string, row Row) {
+	tx.add(OpUpdate, table, row)
+}
+
+// Delete records a row removal. Data contains the row before deletion.
+func (tx *Tx) Delete(table string, row Row) {
+	tx.add(OpDelete, table, row)
+}
+
+func (tx *Tx) Len() int {
+	return len(tx.events)
+}
+
+func (tx *Tx) add(op, table string, row Row) {
+	if tx.err != nil {
+		return
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		tx.err = fmt.Errorf("cdc: encode %s row %d: %w", table, row.ID(), err)
+		return
+	}
+	tx.events = append(tx.events, Event{
+		Op:     op,
+		Kind:   tx.kind,
+		Height: tx.height,
+		Hash:   tx.hash,
+		Table:  table,
+		Key:    row.ID(),
+		Data:   data,
+	})
+}
+
+// Commit writes the transaction with begin and commit events.
+func (tx *Tx) Commit() error {
+	if tx.err != nil {
+		return tx.err
+	}
+	return tx.log.commit(tx)
+}
+
+// encode writes all events numbered from seq+1 into tx.buf and returns
+// the last seq.
+func (tx *Tx) encode(seq uint64) (uint64, error) {
+	tx.buf.Reset()
+	enc := json.NewEncoder(tx.buf)
+	enc.SetEscapeHTML(false)
+	seq++
+	if err := enc.Encode(Event{
+		Seq:    seq,
+		Op:     OpBegin,
+		Kind:   tx.kind,
+		Height: tx.height,
+		Hash:   tx.hash,
+	}); err != nil {
+		return 0, err
+	}
+	for i := range tx.events {
+		seq++
+		tx.events[i].Seq = seq
+		if err := enc.Encode(tx.events[i]); err != nil {
+			return 0, err
+		}
+	}
+	seq++
+	err := enc.Encode(Event{
+		Seq:    seq,
+		Op:     OpCommit,
+		Kind:   tx.kind,
+		Height: tx.height,
+		Hash:   tx.hash,
+		Count:  len(tx.events),
+	})
+	return seq, err
+}
@@ -16,6 +16,7 @@ import (
 	"blockwatch.cc/packdb/store"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/archive"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/rpc"
 )
@@ -58,15 +59,18 @@ const (
 )
 
 type CrawlerConfig struct {
-	DB            store.DB
-	Indexer       *Indexer
-	Client        *rpc.Client
-	Queue         int
-	Delay         int
-	StopBlock     int64
-	Snapshot      *SnapshotConfig
-	EnableMonitor bool
-	Validate      bool
+	DB             store.DB
+	Indexer        *Indexer
+	Client         *rpc.Client
+	Queue          int
+	Delay          int
+	StopBlock      int64
+	Snapshot       *SnapshotConfig
+	Archive        *archive.Archive // optional raw block archive
+	ArchiveSource  bool             // read blocks from archive before RPC
+	EnableMonitor  bool
+	Validate       bool
+	ValidateSupply bool
 }
 
 type SnapshotConfig struct {
@@ -80,15 +84,18 @@ type SnapshotConfig struct {
 // It also handles chain reorganizations and API calls.
 type Crawler struct {
 	sync.RWMutex
-	state         State
-	mode          Mode
-	snap          *SnapshotConfig
-	useMonitor    bool
-	enableMonitor bool
-	stopHeight    int64
+	state          State
+	mode           Mode
+	snap           *SnapshotConfig
+	useMonitor     bool
+	enableMonitor  bool
+	validateSupply bool
+	stopHeight     int64
 
 	db        store.DB
 	rpc       *rpc.Client
+	archive   *archive.Archive
+	fromArch  bool
 	builder   *Builder
 	indexer   *Indexer
 	finalized chan *rpc.Bundle
@@ -110,26 +117,35 @@ type Crawler struct {
 
 	// coordinated snapshot
 	snapch chan error
+
+	// background supply audit is running
+	auditing atomic.Bool
+
+	// recent reorg history
+	reorgs reorgHistory
 }
 
 func NewCrawler(cfg CrawlerConfig) *Crawler {
 	queue := make(chan *rpc.Bundle, cfg.Queue)
 	return &Crawler{
-		state:         STATE_LOADING,
-		mode:          MODE_SYNC,
-		snap:          cfg.Snapshot,
-		useMonitor:    false,
-		enableMonitor: cfg.EnableMonitor,
-		stopHeight:    cfg.StopBlock,
-		db:            cfg.DB,
-		rpc:           cfg.Client,
-		builder:       NewBuilder(cfg.Indexer, cfg.Client, cfg.Validate),
-		indexer:       cfg.Indexer,
-		finalized:     queue,
-		filter:        NewReorgDelayFilter(cfg.Delay, queue),
-		delay:         int64(cfg.Delay),
-		plog:          NewBlockProgressLogger("Processed"),
-		quit:          make(chan struct{}),
+		state:          STATE_LOADING,
+		mode:           MODE_SYNC,
+		snap:           cfg.Snapshot,
+		useMonitor:     false,
+		enableMonitor:  cfg.EnableMonitor,
+		validateSupply: cfg.ValidateSupply,
+		stopHeight:     cfg.StopBlock,
+		db:             cfg.DB,
+		rpc:            cfg.Client,
+		archive:        cfg.Archive,
+		fromArch:       cfg.Archive != nil && cfg.ArchiveSource,
+		builder:        NewBuilder(cfg.Indexer, cfg.Client, cfg.Validate),
+		indexer:        cfg.Indexer,
+		finalized:      queue,
+		filter:         NewReorgDelayFilter(cfg.Delay, queue),
+		delay:          int64(cfg.Delay),
+		plog:           NewBlockProgressLogger("Processed"),
+		quit:           make(chan struct{}),
 	}
 }
 
@@ -1033,6 +1049,13 @@ func (c *Crawler) syncBlockchain() {
 			break
 		}
 
+		// publish an in-memory view of recent blocks for API reads
+		if block.Height+viewDepth >= atomic.LoadInt64(&c.head) {
+			if err = c.indexer.publishView(ctxNonStop, block); err != nil {
+				log.Errorf("Publishing view for block %d: %s", block.Height, err)
+			}
+		}
+
 		// update chain tip
 		newTip := &model.ChainTip{
 			Name:        tip.Name,
@@ -1086,17 +1109,30 @@ func (c *Crawler) syncBlockchain() {
 				log.Errorf("finalizing tables: %v", err)
 			}
 
+			// prune history beyond configured retention in background
+			c.indexer.MaybePrune(ctx, block)
+
 			// update rights cache at cycle start (or later when we we're not in sync then)
 			if err := c.indexer.updateRights(ctx, block.Height); err != nil {
 				log.Errorf("updating rights cache: %s", err)
 			}
 		}
 
+		// reconcile supply at cycle end in the background
+		if c.validateSupply && block.MV.IsCycleEnd() {
+			c.startAuditSupply(ctx, block)
+		}
+
 		// log progress once every 10sec or immediatly when in sync
 		c.plog.LogBlockHeight(block, len(c.finalized), state, time.Since(blockstart), state == STATE_SYNCHRONIZED)
 
 		// update state every 256 blocks or every block when synchronized
 		if state == STATE_SYNCHRONIZED || block.Height&0xff == 0 {
+			// persist tables before releasing held back change log events
+			if err := c.indexer.FlushCdc(ctx); err != nil {
+				log.Errorf("Flushing change log for block %d: %s", tip.BestHeight, err)
+				break
+			}
 			err := c.db.Update(func(dbTx store.Tx) error {
 				if err := c.indexer.storeTips(dbTx); err != nil {
 					return err
@@ -1129,16 +1165,61 @@ func (c *Crawler) syncBlockchain() {
 	c.setState(STATE_FAILED, MONITOR_DISABLE)
 }
 
-func (c *Crawler) fetchBlock(ctx context.Context, id rpc.BlockID) (b *rpc.Bundle, err error) {
-	p := c.indexer.reg.GetParamsLatest()
-	if c.indexer.lightMode {
-		b, err = c.rpc.GetLightBundle(ctx, id, p)
-	} else {
-		b, err = c.rpc.GetFullBundle(ctx, id, p)
+// startAuditSupply runs a cycle-end supply audit as background job so that
+// summing all balances does not stall block processing. A new audit is
+// skipped while the previous one is still running.
+func (c *Crawler) startAuditSupply(ctx context.Context, block *model.Block) {
+	if !c.auditing.CompareAndSwap(false, true) {
+		log.Warnf("Audit %d supply: skipping cycle %d, previous audit still running", block.Height, block.Cycle)
+		return
 	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.auditing.Store(false)
+		c.auditSupply(ctx, block.Cycle, block.Height)
+	}()
+}
+
+func (c *Crawler) auditSupply(ctx context.Context, cycle, height int64) {
+	audit, err := c.indexer.AuditSupply(ctx, cycle, height)
 	if err != nil {
+		log.Errorf("Audit %d supply: %v", height, err)
 		return
 	}
+	if err := c.indexer.StoreSupplyAudit(audit); err != nil {
+		log.Errorf("Audit %d supply: storing cycle %d: %v", height, cycle, err)
+	}
+	for _, v := range audit.Checks {
+		if !v.IsFailed() {
+			continue
+		}
+		log.Errorf("Audit %d supply %s %s in cycle %d: expected=%d actual=%d diff=%d",
+			height, v.Name, v.Status, audit.Cycle, v.Expected, v.Actual, v.Diff)
+	}
+	if audit.IsValid() {
+		log.Infof("Audit %d supply reconciled for cycle %d", height, audit.Cycle)
+	}
+}
+
+func (c *Crawler) fetchBlock(ctx context.Context, id rpc.BlockID) (b *rpc.Bundle, err error) {
+	p := c.indexer.reg.GetParamsLatest()
+	b = c.loadArchivedBlock(id)
+	if b == nil {
+		if c.indexer.lightMode {
+			b, err = c.rpc.GetLightBundle(ctx, id, p)
+		} else {
+			b, err = c.rpc.GetFullBundle(ctx, id, p)
+		}
+		if err != nil {
+			return
+		}
+		if c.archive != nil {
+			if err := c.archive.Put(b); err != nil {
+				log.Errorf("archive: %v", err)
+			}
+		}
+	}
 
 	// check chain match
 	if c.chainId.IsValid() && c.chainId != b.Block.ChainId {
@@ -1158,6 +1239,30 @@ func (c *Crawler) fetchBlock(ctx context.Context, id rpc.BlockID) (b *rpc.Bundle
 	return b, nil
 }
 
+// loadArchivedBlock returns a block from the local archive when enabled.
+// Only lookups by height are served, light bundles are skipped in full mode
+// when they lack rights data.
+func (c *Crawler) loadArchivedBlock(id rpc.BlockID) *rpc.Bundle {
+	if !c.fromArch {
+		return nil
+	}
+	level, ok := id.(rpc.BlockLevel)
+	if !ok {
+		return nil
+	}
+	b, err := c.archive.Get(int64(level), mavryk.BlockHash{})
+	if err != nil {
+		if err != archive.ErrNotFound {
+			log.Warnf("archive: %v", err)
+		}
+		return nil
+	}
+	if !c.indexer.lightMode && (b.Height() == 1 || b.IsCycleStart()) && len(b.Baking) == 0 {
+		return nil
+	}
+	return b
+}
+
 func (c *Crawler) fetchBlockchainInfo(ctx context.Context) error {
 	head, err := c.rpc.GetTipHeader(ctx)
 	if err != nil {
@@ -0,0 +1,321 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const CallIndexKey = "contract_calls"
+
+type callKey struct {
+	account    model.AccountID
+	entrypoint int
+}
+
+type callerKey struct {
+	callKey
+	sender model.AccountID
+}
+
+func logKey(l *model.CallerLog) callKey {
+	return callKey{l.AccountId, l.Entrypoint}
+}
+
+// CallIndex maintains daily per-entrypoint call statistics for smart
+// contracts. Distinct senders are counted from a short-lived caller log
+// which also allows to revert statistics on reorg.
+type CallIndex struct {
+	db     *pack.DB
+	tables map[string]*pack.Table
+	stats  *dailyTables[callKey, model.CallStat, *model.CallStat]
+	seen   map[callerKey]struct{} // current day senders
+}
+
+var _ model.BlockIndexer = (*CallIndex)(nil)
+
+func NewCallIndex() *CallIndex {
+	return &CallIndex{
+		tables: make(map[string]*pack.Table),
+	}
+}
+
+func (idx *CallIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *CallIndex) Tables() []*pack.Table {
+	t := []*pack.Table{}
+	for _, v := range idx.tables {
+		t = append(t, v)
+	}
+	return t
+}
+
+func (idx *CallIndex) Key() string {
+	return CallIndexKey
+}
+
+func (idx *CallIndex) Name() string {
+	return CallIndexKey + " index"
+}
+
+func (idx *CallIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	for _, m := range []model.Model{
+		model.CallStat{},
+		model.CallerLog{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+		_, err = db.CreateTableIfNotExists(key, fields, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *CallIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	for _, m := range []model.Model{
+		model.CallStat{},
+		model.CallerLog{},
+	} {
+		key := m.TableKey()
+		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	idx.stats = &dailyTables[callKey, model.CallStat, *model.CallStat]{
+		name:  "call_stats",
+		stats: idx.tables[model.CallStatTableKey],
+		logs:  idx.tables[model.CallerLogTableKey],
+		match: func(q pack.Query, key callKey) pack.Query {
+			return q.AndEqual("account_id", key.account).
+				AndEqual("entrypoint_id", key.entrypoint)
+		},
+		init: func(stat *model.CallStat, key callKey, d time.Time) {
+			stat.AccountId = key.account
+			stat.Entrypoint = key.entrypoint
+			stat.Day = d
+		},
+	}
+	return nil
+}
+
+func (idx *CallIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *CallIndex) Close() error {
+	for n, v := range idx.tables {
+		if err := v.Close(); err != nil {
+			log.Errorf("Closing %s table: %s", n, err)
+		}
+		delete(idx.tables, n)
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *CallIndex) ConnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	today := block.Timestamp.UTC().Truncate(oneDay)
+	if !today.Equal(idx.stats.day) {
+		if err := idx.loadDay(ctx, today); err != nil {
+			return err
+		}
+	}
+
+	// sum calls per sender and entrypoint
+	logs := make([]*model.CallerLog, 0)
+	logMap := make(map[callerKey]*model.CallerLog)
+	for _, op := range block.Ops {
+		if op.Type != model.OpTypeTransaction || !op.IsSuccess || !op.IsContract {
+			continue
+		}
+		key := callerKey{callKey{op.ReceiverId, op.Entrypoint}, op.SenderId}
+		l, ok := logMap[key]
+		if !ok {
+			l = &model.CallerLog{
+				AccountId:  op.ReceiverId,
+				Entrypoint: op.Entrypoint,
+				SenderId:   op.SenderId,
+				Day:        today,
+				Height:     block.Height,
+			}
+			if _, ok := idx.seen[key]; !ok {
+				l.IsFirst = true
+				idx.seen[key] = struct{}{}
+			}
+			logMap[key] = l
+			logs = append(logs, l)
+		}
+		l.NCalls++
+		l.Volume += op.Volume
+		l.GasUsed += op.GasUsed
+		l.StorageBurn += op.Burned
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+
+	// add to daily stats
+	stats := make([]*model.CallStat, 0, len(logs))
+	for _, l := range logs {
+		stat, err := idx.stats.Get(ctx, logKey(l), today)
+		if err != nil {
+			return err
+		}
+		if stat.FirstHeight == 0 {
+			stat.FirstHeight = block.Height
+		}
+		stat.LastHeight = block.Height
+		stat.NCalls += l.NCalls
+		stat.Volume += l.Volume
+		stat.GasUsed += l.GasUsed
+		stat.StorageBurn += l.StorageBurn
+		if l.IsFirst {
+			stat.NSenders++
+		}
+		stats = append(stats, stat)
+	}
+	if err := idx.stats.Store(ctx, stats); err != nil {
+		return err
+	}
+
+	items := make([]pack.Item, len(logs))
+	for i, l := range logs {
+		items[i] = l
+	}
+	return idx.stats.AppendLog(ctx, items)
+}
+
+func (idx *CallIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *CallIndex) DeleteBlock(ctx context.Context, height int64) error {
+	logs := make([]*model.CallerLog, 0)
+	if err := idx.stats.ListLog(ctx, height, &logs); err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+
+	upd := make([]*model.CallStat, 0)
+	del := make([]uint64, 0)
+	for _, l := range logs {
+		key := logKey(l)
+		stat, err := idx.stats.Get(ctx, key, l.Day)
+		if err != nil {
+			return err
+		}
+		stat.NCalls -= l.NCalls
+		stat.Volume -= l.Volume
+		stat.GasUsed -= l.GasUsed
+		stat.StorageBurn -= l.StorageBurn
+		if l.IsFirst {
+			stat.NSenders--
+			if l.Day.Equal(idx.stats.day) {
+				delete(idx.seen, callerKey{key, l.SenderId})
+			}
+		}
+		if stat.RowId == 0 {
+			continue
+		}
+		if stat.NCalls <= 0 {
+			del = append(del, stat.RowId)
+			idx.stats.Forget(key, l.Day)
+			continue
+		}
+
+		// find the previous call on the same day
+		stat.LastHeight, err = idx.stats.PrevHeight(ctx, key, l.Day, height)
+		if err != nil {
+			return err
+		}
+		upd = append(upd, stat)
+	}
+	if err := idx.stats.Store(ctx, upd); err != nil {
+		return err
+	}
+	if err := idx.stats.Delete(ctx, del); err != nil {
+		return err
+	}
+	return idx.stats.DeleteLog(ctx, height)
+}
+
+func (idx *CallIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *CallIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *CallIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
+
+// loadDay resets caches for a new day, loads senders already seen on that
+// day and removes caller log entries older than the previous day.
+func (idx *CallIndex) loadDay(ctx context.Context, today time.Time) error {
+	if err := idx.stats.SetDay(ctx, today); err != nil {
+		return err
+	}
+	idx.seen = make(map[callerKey]struct{})
+
+	var l model.CallerLog
+	err := pack.NewQuery("etl.callers.load").
+		WithTable(idx.tables[model.CallerLogTableKey]).
+		WithFields("account_id", "entrypoint_id", "sender_id").
+		AndEqual("time", today).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&l); err != nil {
+				return err
+			}
+			idx.seen[callerKey{logKey(&l), l.SenderId}] = struct{}{}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("load caller log: %w", err)
+	}
+	return nil
+}
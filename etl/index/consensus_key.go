@@ -0,0 +1,213 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+const ConsensusKeyIndexKey = "consensus_key"
+
+// ConsensusKeyIndex keeps the history of consensus key updates and drains
+// for each baker.
+type ConsensusKeyIndex struct {
+	db    *pack.DB
+	table *pack.Table
+}
+
+var _ model.BlockIndexer = (*ConsensusKeyIndex)(nil)
+
+func NewConsensusKeyIndex() *ConsensusKeyIndex {
+	return &ConsensusKeyIndex{}
+}
+
+func (idx *ConsensusKeyIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *ConsensusKeyIndex) Tables() []*pack.Table {
+	return []*pack.Table{idx.table}
+}
+
+func (idx *ConsensusKeyIndex) Key() string {
+	return ConsensusKeyIndexKey
+}
+
+func (idx *ConsensusKeyIndex) Name() string {
+	return ConsensusKeyIndexKey + " index"
+}
+
+func (idx *ConsensusKeyIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating database: %w", err)
+	}
+	defer db.Close()
+
+	m := model.ConsensusKey{}
+	key := m.TableKey()
+	fields, err := pack.Fields(m)
+	if err != nil {
+		return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	}
+	if _, err := db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key))); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	m := model.ConsensusKey{}
+	key := m.TableKey()
+	table, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	idx.table = table
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) Close() error {
+	if idx.table != nil {
+		if err := idx.table.Close(); err != nil {
+			log.Errorf("Closing %s: %s", idx.Name(), err)
+		}
+		idx.table = nil
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) ConnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
+	ins := make([]pack.Item, 0)
+	for _, op := range block.Ops {
+		if !op.IsSuccess {
+			continue
+		}
+		switch op.Type {
+		case model.OpTypeUpdateConsensusKey:
+			uop, ok := op.Raw.(*rpc.UpdateConsensusKey)
+			if !ok {
+				return fmt.Errorf("consensus_key: %s op [%d:%d]: unexpected type %T",
+					op.Raw.Kind(), op.Type.ListId(), op.OpP, op.Raw)
+			}
+			prev, err := idx.lastKey(ctx, op.SenderId, builder)
+			if err != nil {
+				return fmt.Errorf("consensus_key: loading previous key for %d: %w", op.SenderId, err)
+			}
+			ins = append(ins, &model.ConsensusKey{
+				BakerId:         op.SenderId,
+				Type:            model.ConsensusKeyEventTypeUpdate,
+				Height:          block.Height,
+				Cycle:           block.Cycle,
+				Time:            block.Timestamp,
+				OpId:            op.Id(),
+				ActivationCycle: block.Cycle + block.Params.PreservedCycles + 1,
+				OldKey:          prev,
+				NewKey:          uop.Pk,
+			})
+
+		case model.OpTypeDrainDelegate:
+			dop, ok := op.Raw.(*rpc.DrainDelegate)
+			if !ok {
+				return fmt.Errorf("consensus_key: %s op [%d:%d]: unexpected type %T",
+					op.Raw.Kind(), op.Type.ListId(), op.OpP, op.Raw)
+			}
+			ins = append(ins, &model.ConsensusKey{
+				BakerId:       op.SenderId,
+				Type:          model.ConsensusKeyEventTypeDrain,
+				Height:        block.Height,
+				Cycle:         block.Cycle,
+				Time:          block.Timestamp,
+				OpId:          op.Id(),
+				Signer:        dop.ConsensusKey,
+				DestinationId: op.ReceiverId,
+				Amount:        op.Volume,
+			})
+		}
+	}
+
+	if len(ins) > 0 {
+		if err := idx.table.Insert(ctx, ins); err != nil {
+			return fmt.Errorf("consensus_key: insert: %w", err)
+		}
+	}
+	return nil
+}
+
+// lastKey returns the most recently registered consensus key of a baker
+// whether active or pending. Bakers without updates use their own key.
+func (idx *ConsensusKeyIndex) lastKey(ctx context.Context, id model.AccountID, builder model.BlockBuilder) (mavryk.Key, error) {
+	k := &model.ConsensusKey{}
+	err := pack.NewQuery("consensus_key.last").
+		WithTable(idx.table).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("baker_id", id).
+		AndEqual("type", model.ConsensusKeyEventTypeUpdate).
+		Execute(ctx, k)
+	if err != nil {
+		return mavryk.InvalidKey, err
+	}
+	if k.RowId > 0 {
+		return k.NewKey, nil
+	}
+	if acc, ok := builder.AccountById(id); ok {
+		return acc.Pubkey, nil
+	}
+	return mavryk.InvalidKey, nil
+}
+
+func (idx *ConsensusKeyIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *ConsensusKeyIndex) DeleteBlock(ctx context.Context, height int64) error {
+	_, err := pack.NewQuery("etl.delete").
+		WithTable(idx.table).
+		AndEqual("height", height).
+		Delete(ctx)
+	return err
+}
+
+func (idx *ConsensusKeyIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *ConsensusKeyIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const CounterpartyIndexKey = "counterparty"
+
+type edgeKey struct {
+	sender   model.AccountID
+	receiver model.AccountID
+}
+
+// CounterpartyIndex maintains daily directed edges between accounts from
+// successful transactions and token transfer events. Token events are
+// written by the token index which must run first. A short-lived edge log
+// allows to revert edges on reorg.
+type CounterpartyIndex struct {
+	db     *pack.DB
+	tables map[string]*pack.Table
+	edges  *dailyTables[edgeKey, model.Counterparty, *model.Counterparty]
+}
+
+var _ model.BlockIndexer = (*CounterpartyIndex)(nil)
+
+func NewCounterpartyIndex() *CounterpartyIndex {
+	return &CounterpartyIndex{
+		tables: make(map[string]*pack.Table),
+	}
+}
+
+func (idx *CounterpartyIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *CounterpartyIndex) Tables() []*pack.Table {
+	t := []*pack.Table{}
+	for _, v := range idx.tables {
+		t = append(t, v)
+	}
+	return t
+}
+
+func (idx *CounterpartyIndex) Key() string {
+	return CounterpartyIndexKey
+}
+
+func (idx *CounterpartyIndex) Name() string {
+	return CounterpartyIndexKey + " index"
+}
+
+func (idx *CounterpartyIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	for _, m := range []model.Model{
+		model.Counterparty{},
+		model.CounterpartyLog{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+		_, err = db.CreateTableIfNotExists(key, fields, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *CounterpartyIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	for _, m := range []model.Model{
+		model.Counterparty{},
+		model.CounterpartyLog{},
+	} {
+		key := m.TableKey()
+		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	idx.edges = &dailyTables[edgeKey, model.Counterparty, *model.Counterparty]{
+		name:  "counterparty",
+		stats: idx.tables[model.CounterpartyTableKey],
+		logs:  idx.tables[model.CounterpartyLogTableKey],
+		match: func(q pack.Query, key edgeKey) pack.Query {
+			return q.AndEqual("sender_id", key.sender).
+				AndEqual("receiver_id", key.receiver)
+		},
+		init: func(edge *model.Counterparty, key edgeKey, d time.Time) {
+			edge.SenderId = key.sender
+			edge.ReceiverId = key.receiver
+			edge.Day = d
+		},
+	}
+	return nil
+}
+
+func (idx *CounterpartyIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *CounterpartyIndex) Close() error {
+	for n, v := range idx.tables {
+		if err := v.Close(); err != nil {
+			log.Errorf("Closing %s table: %s", n, err)
+		}
+		delete(idx.tables, n)
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *CounterpartyIndex) ConnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	today := block.Timestamp.UTC().Truncate(oneDay)
+	if !today.Equal(idx.edges.day) {
+		if err := idx.edges.SetDay(ctx, today); err != nil {
+			return err
+		}
+	}
+
+	// sum transactions and token transfers per edge
+	logs := make([]*model.CounterpartyLog, 0)
+	logMap := make(map[edgeKey]*model.CounterpartyLog)
+	getLog := func(key edgeKey) *model.CounterpartyLog {
+		l, ok := logMap[key]
+		if !ok {
+			l = &model.CounterpartyLog{
+				SenderId:   key.sender,
+				ReceiverId: key.receiver,
+				Day:        today,
+				Height:     block.Height,
+			}
+			logMap[key] = l
+			logs = append(logs, l)
+		}
+		return l
+	}
+	for _, op := range block.Ops {
+		if op.Type != model.OpTypeTransaction || !op.IsSuccess {
+			continue
+		}
+		if op.SenderId > 0 && op.ReceiverId > 0 && op.SenderId != op.ReceiverId {
+			l := getLog(edgeKey{op.SenderId, op.ReceiverId})
+			l.NTx++
+			l.Volume += op.Volume
+		}
+	}
+	for _, ev := range block.TokenEvents {
+		if ev.Type != model.TokenEventTypeTransfer {
+			continue
+		}
+		if ev.Sender > 0 && ev.Receiver > 0 && ev.Sender != ev.Receiver {
+			getLog(edgeKey{ev.Sender, ev.Receiver}).NTokenTx++
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+
+	// add to daily edges
+	edges := make([]*model.Counterparty, 0, len(logs))
+	for _, l := range logs {
+		edge, err := idx.edges.Get(ctx, edgeKey{l.SenderId, l.ReceiverId}, today)
+		if err != nil {
+			return err
+		}
+		if edge.FirstHeight == 0 {
+			edge.FirstHeight = block.Height
+		}
+		edge.LastHeight = block.Height
+		edge.NTx += l.NTx
+		edge.Volume += l.Volume
+		edge.NTokenTx += l.NTokenTx
+		edges = append(edges, edge)
+	}
+	if err := idx.edges.Store(ctx, edges); err != nil {
+		return err
+	}
+
+	items := make([]pack.Item, len(logs))
+	for i, l := range logs {
+		items[i] = l
+	}
+	return idx.edges.AppendLog(ctx, items)
+}
+
+func (idx *CounterpartyIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *CounterpartyIndex) DeleteBlock(ctx context.Context, height int64) error {
+	logs := make([]*model.CounterpartyLog, 0)
+	if err := idx.edges.ListLog(ctx, height, &logs); err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+
+	upd := make([]*model.Counterparty, 0)
+	del := make([]uint64, 0)
+	for _, l := range logs {
+		key := edgeKey{l.SenderId, l.ReceiverId}
+		edge, err := idx.edges.Get(ctx, key, l.Day)
+		if err != nil {
+			return err
+		}
+		edge.NTx -= l.NTx
+		edge.Volume -= l.Volume
+		edge.NTokenTx -= l.NTokenTx
+		if edge.RowId == 0 {
+			continue
+		}
+		if edge.NTx <= 0 && edge.NTokenTx <= 0 {
+			del = append(del, edge.RowId)
+			idx.edges.Forget(key, l.Day)
+			continue
+		}
+
+		// find the previous interaction on the same day
+		edge.LastHeight, err = idx.edges.PrevHeight(ctx, key, l.Day, height)
+		if err != nil {
+			return err
+		}
+		upd = append(upd, edge)
+	}
+	if err := idx.edges.Store(ctx, upd); err != nil {
+		return err
+	}
+	if err := idx.edges.Delete(ctx, del); err != nil {
+		return err
+	}
+	return idx.edges.DeleteLog(ctx, height)
+}
+
+func (idx *CounterpartyIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *CounterpartyIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *CounterpartyIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
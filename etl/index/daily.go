@@ -0,0 +1,180 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+)
+
+const oneDay = 24 * time.Hour
+
+// dailyRow is a pointer to an aggregate row stored per UTC day.
+type dailyRow[T any] interface {
+	*T
+	pack.Item
+}
+
+// dailyTables maintains per-day aggregate rows together with a short-lived
+// log of per-block deltas. Aggregates of the current day are cached, rows of
+// earlier days are loaded on demand when a reorg reverts them. The log
+// keeps today and the previous day so that blocks around midnight can be
+// reverted. Both tables use columns `time` for the day and the log uses
+// `height` for the block.
+type dailyTables[K comparable, T any, P dailyRow[T]] struct {
+	name  string
+	stats *pack.Table
+	logs  *pack.Table
+	day   time.Time // current day
+	rows  map[K]P   // current day rows
+
+	// match adds key conditions to a stats or log query
+	match func(pack.Query, K) pack.Query
+
+	// init sets key and day of a new row
+	init func(P, K, time.Time)
+}
+
+// SetDay resets the row cache for a new day and removes log entries older
+// than the previous day.
+func (d *dailyTables[K, T, P]) SetDay(ctx context.Context, today time.Time) error {
+	d.day = today
+	d.rows = make(map[K]P)
+	_, err := pack.NewQuery("etl."+d.name+".prune").
+		WithTable(d.logs).
+		AndLt("time", today.Add(-oneDay)).
+		Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("prune %s log: %w", d.name, err)
+	}
+	return nil
+}
+
+// Get returns the row for key on day day. Rows for the current day are
+// cached. New rows have a zero id.
+func (d *dailyTables[K, T, P]) Get(ctx context.Context, key K, day time.Time) (P, error) {
+	isToday := day.Equal(d.day)
+	if isToday {
+		if row, ok := d.rows[key]; ok {
+			return row, nil
+		}
+	}
+	row := P(new(T))
+	q := pack.NewQuery("etl." + d.name + ".find").
+		WithTable(d.stats).
+		WithLimit(1)
+	err := d.match(q, key).
+		AndEqual("time", day).
+		Execute(ctx, row)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", d.name, err)
+	}
+	if row.ID() == 0 {
+		d.init(row, key, day)
+	}
+	if isToday {
+		d.rows[key] = row
+	}
+	return row, nil
+}
+
+// Forget drops a deleted row from the cache.
+func (d *dailyTables[K, T, P]) Forget(key K, day time.Time) {
+	if day.Equal(d.day) {
+		delete(d.rows, key)
+	}
+}
+
+// Store inserts new and updates existing rows. Rows may repeat.
+func (d *dailyTables[K, T, P]) Store(ctx context.Context, rows []P) error {
+	ins := make([]pack.Item, 0)
+	upd := make([]pack.Item, 0)
+	seen := make(map[P]struct{}, len(rows))
+	for _, row := range rows {
+		if _, ok := seen[row]; ok {
+			continue
+		}
+		seen[row] = struct{}{}
+		if row.ID() == 0 {
+			ins = append(ins, row)
+		} else {
+			upd = append(upd, row)
+		}
+	}
+	if len(ins) > 0 {
+		if err := d.stats.Insert(ctx, ins); err != nil {
+			return fmt.Errorf("%s insert: %w", d.name, err)
+		}
+	}
+	if len(upd) > 0 {
+		if err := d.stats.Update(ctx, upd); err != nil {
+			return fmt.Errorf("%s update: %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes rows by id.
+func (d *dailyTables[K, T, P]) Delete(ctx context.Context, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := d.stats.DeleteIds(ctx, ids); err != nil {
+		return fmt.Errorf("%s delete: %w", d.name, err)
+	}
+	return nil
+}
+
+// AppendLog writes log entries of a block.
+func (d *dailyTables[K, T, P]) AppendLog(ctx context.Context, items []pack.Item) error {
+	if err := d.logs.Insert(ctx, items); err != nil {
+		return fmt.Errorf("%s log insert: %w", d.name, err)
+	}
+	return nil
+}
+
+// ListLog loads log entries written at height into val.
+func (d *dailyTables[K, T, P]) ListLog(ctx context.Context, height int64, val interface{}) error {
+	err := pack.NewQuery("etl.rollback.list_"+d.name+"_log").
+		WithTable(d.logs).
+		AndEqual("height", height).
+		Execute(ctx, val)
+	if err != nil {
+		return fmt.Errorf("list %s log: %w", d.name, err)
+	}
+	return nil
+}
+
+// PrevHeight returns the height of the last log entry for key on day before
+// height or zero.
+func (d *dailyTables[K, T, P]) PrevHeight(ctx context.Context, key K, day time.Time, height int64) (int64, error) {
+	var prev struct {
+		Height int64 `pack:"h"`
+	}
+	q := pack.NewQuery("etl.rollback.last_" + d.name).
+		WithTable(d.logs).
+		WithFields("height").
+		WithDesc().
+		WithLimit(1)
+	err := d.match(q, key).
+		AndEqual("time", day).
+		AndLt("height", height).
+		Execute(ctx, &prev)
+	if err != nil {
+		return 0, fmt.Errorf("find previous %s log: %w", d.name, err)
+	}
+	return prev.Height, nil
+}
+
+// DeleteLog removes log entries written at height.
+func (d *dailyTables[K, T, P]) DeleteLog(ctx context.Context, height int64) error {
+	_, err := pack.NewQuery("etl.rollback.delete_"+d.name+"_log").
+		WithTable(d.logs).
+		AndEqual("height", height).
+		Delete(ctx)
+	return err
+}
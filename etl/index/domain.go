@@ -0,0 +1,446 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/metadata/decoder/domain"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const DomainIndexKey = "domain"
+
+// DomainIndex decodes forward records and expiry dates of the name registry
+// into a table of current domain state and a table of change events. Removed
+// domains keep their row with an empty owner so that history and reorg
+// handling work on a single record per name.
+type DomainIndex struct {
+	db       *pack.DB
+	tables   map[string]*pack.Table
+	registry map[model.AccountID]*domain.Registry
+}
+
+var _ model.BlockIndexer = (*DomainIndex)(nil)
+
+func NewDomainIndex() *DomainIndex {
+	return &DomainIndex{
+		tables:   make(map[string]*pack.Table),
+		registry: make(map[model.AccountID]*domain.Registry),
+	}
+}
+
+func (idx *DomainIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *DomainIndex) Tables() []*pack.Table {
+	t := []*pack.Table{}
+	for _, v := range idx.tables {
+		t = append(t, v)
+	}
+	return t
+}
+
+func (idx *DomainIndex) Key() string {
+	return DomainIndexKey
+}
+
+func (idx *DomainIndex) Name() string {
+	return DomainIndexKey + " index"
+}
+
+func (idx *DomainIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	for _, m := range []model.Model{
+		model.Domain{},
+		model.DomainEvent{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+		_, err = db.CreateTableIfNotExists(key, fields, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *DomainIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	for _, m := range []model.Model{
+		model.Domain{},
+		model.DomainEvent{},
+	} {
+		key := m.TableKey()
+		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	return nil
+}
+
+func (idx *DomainIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *DomainIndex) Close() error {
+	for n, v := range idx.tables {
+		if err := v.Close(); err != nil {
+			log.Errorf("Closing %s table: %s", n, err)
+		}
+		delete(idx.tables, n)
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *DomainIndex) ConnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	domains := make(map[string]*model.Domain)
+	events := make([]*model.DomainEvent, 0)
+	for _, op := range block.Ops {
+		if !op.IsSuccess || !op.IsContract || op.CodeHash != domain.CodeHash || len(op.BigmapEvents) == 0 {
+			continue
+		}
+		reg, ok := idx.registry[op.ReceiverId]
+		if !ok {
+			var err error
+			reg, err = domain.NewRegistry(op)
+			if err != nil {
+				// skip unknown registry layouts instead of halting the indexer
+				log.Errorf("domain: op %s: %v", op.Hash, err)
+				continue
+			}
+			idx.registry[op.ReceiverId] = reg
+		}
+		recs, exps, err := reg.Decode(op)
+		if err != nil {
+			// skip undecodable updates instead of halting the indexer
+			log.Errorf("domain: op %s: %v", op.Hash, err)
+			continue
+		}
+
+		// names registered in this op receive their expiry with the
+		// register event
+		registered := make(map[string]*model.DomainEvent)
+		for _, upd := range recs {
+			d, err := idx.getDomain(ctx, domains, upd.Name)
+			if err != nil {
+				return err
+			}
+			ev := &model.DomainEvent{
+				Name:          upd.Name,
+				Height:        block.Height,
+				Time:          block.Timestamp,
+				OpId:          op.Id(),
+				PrevAddress:   d.Address,
+				PrevOwner:     d.Owner,
+				PrevExpiry:    d.Expiry,
+				PrevExpiryKey: d.ExpiryKey,
+			}
+			switch {
+			case upd.IsRemoved:
+				if !d.Owner.IsValid() {
+					continue
+				}
+				ev.Type = model.DomainEventTypeRemove
+				d.Address = mavryk.Address{}
+				d.Owner = mavryk.Address{}
+				d.Expiry = time.Time{}
+			case !d.Owner.IsValid():
+				ev.Type = model.DomainEventTypeRegister
+				d.Address = upd.Address
+				d.Owner = upd.Owner
+				d.ExpiryKey = upd.ExpiryKey
+				d.Expiry, err = idx.getExpiry(ctx, domains, upd.ExpiryKey)
+				if err != nil {
+					return err
+				}
+				if d.FirstHeight == 0 {
+					d.FirstHeight = block.Height
+				}
+				registered[d.Name] = ev
+			case !d.Owner.Equal(upd.Owner):
+				ev.Type = model.DomainEventTypeTransfer
+				d.Address = upd.Address
+				d.Owner = upd.Owner
+				d.ExpiryKey = upd.ExpiryKey
+			case !d.Address.Equal(upd.Address) || d.ExpiryKey != upd.ExpiryKey:
+				ev.Type = model.DomainEventTypeUpdate
+				d.Address = upd.Address
+				d.ExpiryKey = upd.ExpiryKey
+			default:
+				continue
+			}
+			d.LastHeight = block.Height
+			ev.Address = d.Address
+			ev.Owner = d.Owner
+			ev.Expiry = d.Expiry
+			events = append(events, ev)
+		}
+
+		for _, upd := range exps {
+			list, err := idx.listByExpiryKey(ctx, domains, upd.Key)
+			if err != nil {
+				return err
+			}
+			for _, d := range list {
+				if ev, ok := registered[d.Name]; ok {
+					d.Expiry = upd.Expiry
+					ev.Expiry = upd.Expiry
+					continue
+				}
+				if !d.Owner.IsValid() || d.Expiry.Equal(upd.Expiry) {
+					continue
+				}
+				events = append(events, &model.DomainEvent{
+					Name:          d.Name,
+					Type:          model.DomainEventTypeRenew,
+					Height:        block.Height,
+					Time:          block.Timestamp,
+					OpId:          op.Id(),
+					Address:       d.Address,
+					Owner:         d.Owner,
+					Expiry:        upd.Expiry,
+					PrevAddress:   d.Address,
+					PrevOwner:     d.Owner,
+					PrevExpiry:    d.Expiry,
+					PrevExpiryKey: d.ExpiryKey,
+				})
+				d.Expiry = upd.Expiry
+				d.LastHeight = block.Height
+			}
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return idx.store(ctx, domains, events)
+}
+
+func (idx *DomainIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *DomainIndex) DeleteBlock(ctx context.Context, height int64) error {
+	eventTable := idx.tables[model.DomainEventTableKey]
+	events := make([]*model.DomainEvent, 0)
+	err := pack.NewQuery("etl.rollback.list_domain_events").
+		WithTable(eventTable).
+		WithDesc().
+		AndEqual("height", height).
+		Execute(ctx, &events)
+	if err != nil {
+		return fmt.Errorf("list domain events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	// revert changes in reverse order
+	domains := make(map[string]*model.Domain)
+	del := make([]uint64, 0)
+	for _, ev := range events {
+		d, err := idx.getDomain(ctx, domains, ev.Name)
+		if err != nil {
+			return err
+		}
+		if d.RowId == 0 {
+			continue
+		}
+		if ev.Type == model.DomainEventTypeRegister && d.FirstHeight == height {
+			del = append(del, d.RowId)
+			delete(domains, d.Name)
+			continue
+		}
+		d.Address = ev.PrevAddress
+		d.Owner = ev.PrevOwner
+		d.Expiry = ev.PrevExpiry
+		d.ExpiryKey = ev.PrevExpiryKey
+
+		// find the previous change
+		var prev model.DomainEvent
+		err = pack.NewQuery("etl.rollback.last_domain_event").
+			WithTable(eventTable).
+			WithFields("height").
+			WithDesc().
+			WithLimit(1).
+			AndEqual("name", d.Name).
+			AndLt("height", height).
+			Execute(ctx, &prev)
+		if err != nil {
+			return fmt.Errorf("find previous domain event: %w", err)
+		}
+		d.LastHeight = prev.Height
+	}
+
+	upd := make([]pack.Item, 0, len(domains))
+	for _, d := range domains {
+		if d.RowId > 0 {
+			upd = append(upd, d)
+		}
+	}
+	if len(upd) > 0 {
+		if err := idx.tables[model.DomainTableKey].Update(ctx, upd); err != nil {
+			return fmt.Errorf("domain update: %w", err)
+		}
+	}
+	if len(del) > 0 {
+		if err := idx.tables[model.DomainTableKey].DeleteIds(ctx, del); err != nil {
+			return fmt.Errorf("domain delete: %w", err)
+		}
+	}
+	_, err = pack.NewQuery("etl.rollback.delete_domain_events").
+		WithTable(eventTable).
+		AndEqual("height", height).
+		Delete(ctx)
+	return err
+}
+
+func (idx *DomainIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *DomainIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *DomainIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
+
+// getDomain returns the domain row for name from cache or table. Unknown
+// names return a new row without id.
+func (idx *DomainIndex) getDomain(ctx context.Context, cache map[string]*model.Domain, name string) (*model.Domain, error) {
+	if d, ok := cache[name]; ok {
+		return d, nil
+	}
+	d := &model.Domain{}
+	err := pack.NewQuery("etl.domain.find").
+		WithTable(idx.tables[model.DomainTableKey]).
+		WithLimit(1).
+		AndEqual("name", name).
+		Execute(ctx, d)
+	if err != nil {
+		return nil, fmt.Errorf("load domain %q: %w", name, err)
+	}
+	if d.RowId == 0 {
+		d.Name = name
+		d.Level = model.DomainLevel(name)
+	}
+	cache[name] = d
+	return d, nil
+}
+
+// listByExpiryKey returns all known domains that share expiry key k.
+func (idx *DomainIndex) listByExpiryKey(ctx context.Context, cache map[string]*model.Domain, k string) ([]*model.Domain, error) {
+	list := make([]*model.Domain, 0)
+	err := pack.NewQuery("etl.domain.list_expiry").
+		WithTable(idx.tables[model.DomainTableKey]).
+		AndEqual("expiry_key", k).
+		Execute(ctx, &list)
+	if err != nil {
+		return nil, fmt.Errorf("list domains by expiry key: %w", err)
+	}
+	res := make([]*model.Domain, 0, len(list))
+	for _, d := range list {
+		if c, ok := cache[d.Name]; ok {
+			d = c
+		} else {
+			cache[d.Name] = d
+		}
+		if d.ExpiryKey == k {
+			res = append(res, d)
+		}
+	}
+	// add new domains not yet stored
+	for _, d := range cache {
+		if d.RowId == 0 && d.ExpiryKey == k {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+// getExpiry returns the current expiry date for expiry key k from any
+// domain that shares it.
+func (idx *DomainIndex) getExpiry(ctx context.Context, cache map[string]*model.Domain, k string) (time.Time, error) {
+	if k == "" {
+		return time.Time{}, nil
+	}
+	list, err := idx.listByExpiryKey(ctx, cache, k)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, d := range list {
+		if !d.Expiry.IsZero() {
+			return d.Expiry, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+func (idx *DomainIndex) store(ctx context.Context, domains map[string]*model.Domain, events []*model.DomainEvent) error {
+	ins := make([]pack.Item, 0)
+	upd := make([]pack.Item, 0)
+	for _, d := range domains {
+		switch {
+		case d.RowId > 0:
+			upd = append(upd, d)
+		case d.FirstHeight > 0:
+			ins = append(ins, d)
+		}
+	}
+	if len(ins) > 0 {
+		if err := idx.tables[model.DomainTableKey].Insert(ctx, ins); err != nil {
+			return fmt.Errorf("domain insert: %w", err)
+		}
+	}
+	if len(upd) > 0 {
+		if err := idx.tables[model.DomainTableKey].Update(ctx, upd); err != nil {
+			return fmt.Errorf("domain update: %w", err)
+		}
+	}
+	items := make([]pack.Item, len(events))
+	for i, ev := range events {
+		items[i] = ev
+	}
+	if err := idx.tables[model.DomainEventTableKey].Insert(ctx, items); err != nil {
+		return fmt.Errorf("domain event insert: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"blockwatch.cc/packdb/pack"
 	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/metadata"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
@@ -18,9 +19,10 @@ import (
 const MetadataIndexKey = "metadata"
 
 type MetadataIndex struct {
-	db    *pack.DB
-	table *pack.Table
-	dec   map[uint64]metadata.Decoder
+	db     *pack.DB
+	table  *pack.Table
+	dec    map[uint64]metadata.Decoder
+	search *cache.SearchIndex
 }
 
 var _ model.BlockIndexer = (*MetadataIndex)(nil)
@@ -35,6 +37,11 @@ func NewMetadataIndex() *MetadataIndex {
 	}
 }
 
+// WithSearch registers a search index to update when metadata changes.
+func (idx *MetadataIndex) WithSearch(s *cache.SearchIndex) {
+	idx.search = s
+}
+
 func (idx *MetadataIndex) DB() *pack.DB {
 	return idx.db
 }
@@ -218,7 +225,9 @@ func (idx *MetadataIndex) ConnectBlock(ctx context.Context, block *model.Block,
 			}
 			if err != nil {
 				log.Errorf("%d meta %s [%d] save: %v", block.Height, ev.Owner, m.RowId, err)
+				continue
 			}
+			idx.updateSearch(m, isEmpty)
 		}
 	}
 
@@ -316,7 +325,20 @@ func (idx *MetadataIndex) OnTaskComplete(ctx context.Context, res *task.TaskResu
 		}
 		if err != nil {
 			log.Errorf("meta %s [%d] save: %v", ev.Owner, m.RowId, err)
+			continue
 		}
+		idx.updateSearch(m, isEmpty)
 	}
 	return nil
 }
+
+func (idx *MetadataIndex) updateSearch(m *model.Metadata, isEmpty bool) {
+	if idx.search == nil {
+		return
+	}
+	if isEmpty {
+		idx.search.RemoveMetadata(m.Address)
+	} else {
+		idx.search.UpdateMetadata(m)
+	}
+}
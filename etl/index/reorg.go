@@ -0,0 +1,168 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const ReorgIndexKey = "reorg"
+
+// ReorgIndex keeps a persistent log of chain reorganizations. Rows are
+// written by the crawler after a reorg completes, not from block data, and
+// are never rolled back.
+type ReorgIndex struct {
+	db     *pack.DB
+	tables map[string]*pack.Table
+}
+
+var _ model.BlockIndexer = (*ReorgIndex)(nil)
+
+func NewReorgIndex() *ReorgIndex {
+	return &ReorgIndex{
+		tables: make(map[string]*pack.Table),
+	}
+}
+
+func (idx *ReorgIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *ReorgIndex) Tables() []*pack.Table {
+	t := []*pack.Table{}
+	for _, v := range idx.tables {
+		t = append(t, v)
+	}
+	return t
+}
+
+func (idx *ReorgIndex) Key() string {
+	return ReorgIndexKey
+}
+
+func (idx *ReorgIndex) Name() string {
+	return ReorgIndexKey + " index"
+}
+
+func (idx *ReorgIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	for _, m := range []model.Model{
+		model.Reorg{},
+		model.ReorgOp{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+		_, err = db.CreateTableIfNotExists(key, fields, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *ReorgIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	for _, m := range []model.Model{
+		model.Reorg{},
+		model.ReorgOp{},
+	} {
+		key := m.TableKey()
+		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	return nil
+}
+
+func (idx *ReorgIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *ReorgIndex) Close() error {
+	for n, v := range idx.tables {
+		if err := v.Close(); err != nil {
+			log.Errorf("Closing %s table: %s", n, err)
+		}
+		delete(idx.tables, n)
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *ReorgIndex) ConnectBlock(_ context.Context, _ *model.Block, _ model.BlockBuilder) error {
+	return nil
+}
+
+func (idx *ReorgIndex) DisconnectBlock(_ context.Context, _ *model.Block, _ model.BlockBuilder) error {
+	// reorg history must survive the reorg it describes
+	return nil
+}
+
+func (idx *ReorgIndex) DeleteBlock(_ context.Context, _ int64) error {
+	return nil
+}
+
+func (idx *ReorgIndex) DeleteCycle(_ context.Context, _ int64) error {
+	return nil
+}
+
+func (idx *ReorgIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *ReorgIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
+
+// Store writes a reorg and its reverted operations. The reorg id is
+// assigned on insert and copied into all ops.
+func (idx *ReorgIndex) Store(ctx context.Context, r *model.Reorg, ops []*model.ReorgOp) error {
+	if err := idx.tables[model.ReorgTableKey].Insert(ctx, []pack.Item{r}); err != nil {
+		return fmt.Errorf("reorg insert: %w", err)
+	}
+	if len(ops) > 0 {
+		items := make([]pack.Item, len(ops))
+		for i, op := range ops {
+			op.ReorgId = r.RowId
+			items[i] = op
+		}
+		if err := idx.tables[model.ReorgOpTableKey].Insert(ctx, items); err != nil {
+			return fmt.Errorf("reorg ops insert: %w", err)
+		}
+	}
+	return idx.Flush(ctx)
+}
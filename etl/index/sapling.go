@@ -0,0 +1,294 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const SaplingIndexKey = "sapling"
+
+// SaplingIndex records public activity of Sapling shielded pools, i.e.
+// shielding, unshielding and shielded transfers, and keeps per-pool totals.
+// Nothing is decrypted, all data is read from public transaction fields.
+type SaplingIndex struct {
+	db     *pack.DB
+	tables map[string]*pack.Table
+	pools  map[model.AccountID]*model.SaplingPool
+}
+
+var _ model.BlockIndexer = (*SaplingIndex)(nil)
+
+func NewSaplingIndex() *SaplingIndex {
+	return &SaplingIndex{
+		tables: make(map[string]*pack.Table),
+		pools:  make(map[model.AccountID]*model.SaplingPool),
+	}
+}
+
+func (idx *SaplingIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *SaplingIndex) Tables() []*pack.Table {
+	t := []*pack.Table{}
+	for _, v := range idx.tables {
+		t = append(t, v)
+	}
+	return t
+}
+
+func (idx *SaplingIndex) Key() string {
+	return SaplingIndexKey
+}
+
+func (idx *SaplingIndex) Name() string {
+	return SaplingIndexKey + " index"
+}
+
+func (idx *SaplingIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	for _, m := range []model.Model{
+		model.SaplingOp{},
+		model.SaplingPool{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+		_, err = db.CreateTableIfNotExists(key, fields, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *SaplingIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	for _, m := range []model.Model{
+		model.SaplingOp{},
+		model.SaplingPool{},
+	} {
+		key := m.TableKey()
+		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+
+	// load pools, there are only few
+	list := make([]*model.SaplingPool, 0)
+	err = pack.NewQuery("etl.sapling.pools").
+		WithTable(idx.tables[model.SaplingPoolTableKey]).
+		Execute(context.Background(), &list)
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	for _, v := range list {
+		idx.pools[v.AccountId] = v
+	}
+	return nil
+}
+
+func (idx *SaplingIndex) FinalizeSync(_ context.Context) error {
+	return nil
+}
+
+func (idx *SaplingIndex) Close() error {
+	for n, v := range idx.tables {
+		if err := v.Close(); err != nil {
+			log.Errorf("Closing %s table: %s", n, err)
+		}
+		delete(idx.tables, n)
+	}
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *SaplingIndex) ConnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
+	ins := make([]pack.Item, 0)
+	dirty := make(map[model.AccountID]*model.SaplingPool)
+	for _, op := range block.Ops {
+		if op.Type != model.OpTypeTransaction || !op.IsSuccess || !op.IsContract || len(op.Parameters) == 0 {
+			continue
+		}
+		con, ok := builder.ContractById(op.ReceiverId)
+		if !ok || !con.Features.Contains(micheline.FeatureSapling) {
+			continue
+		}
+		txs, err := model.DecodeSaplingParams(op.Parameters)
+		if err != nil {
+			log.Warnf("sapling: decoding params of op %s: %v", op.Hash, err)
+			continue
+		}
+		if len(txs) == 0 {
+			continue
+		}
+		pool, ok := idx.pools[op.ReceiverId]
+		if !ok {
+			pool = &model.SaplingPool{AccountId: op.ReceiverId}
+			idx.pools[op.ReceiverId] = pool
+		}
+		for _, tx := range txs {
+			sop := &model.SaplingOp{
+				Height:    block.Height,
+				Timestamp: block.Timestamp,
+				OpId:      op.Id(),
+				AccountId: op.ReceiverId,
+				SenderId:  op.SenderId,
+				Kind:      tx.Kind(),
+				NInputs:   tx.NInputs,
+				NOutputs:  tx.NOutputs,
+				Amount:    -tx.Balance,
+			}
+			pool.Add(sop)
+			ins = append(ins, sop)
+		}
+		dirty[pool.AccountId] = pool
+	}
+	if len(ins) == 0 {
+		return nil
+	}
+	if err := idx.tables[model.SaplingOpTableKey].Insert(ctx, ins); err != nil {
+		return fmt.Errorf("sapling op insert: %w", err)
+	}
+	return idx.storePools(ctx, dirty, nil)
+}
+
+func (idx *SaplingIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *SaplingIndex) DeleteBlock(ctx context.Context, height int64) error {
+	opTable := idx.tables[model.SaplingOpTableKey]
+	list := make([]*model.SaplingOp, 0)
+	err := pack.NewQuery("etl.rollback.list_sapling").
+		WithTable(opTable).
+		AndEqual("height", height).
+		Execute(ctx, &list)
+	if err != nil {
+		return fmt.Errorf("list sapling ops: %w", err)
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	// revert pool totals
+	dirty := make(map[model.AccountID]*model.SaplingPool)
+	for _, v := range list {
+		pool, ok := idx.pools[v.AccountId]
+		if !ok {
+			continue
+		}
+		pool.Remove(v)
+		dirty[pool.AccountId] = pool
+	}
+	_, err = pack.NewQuery("etl.rollback.delete_sapling").
+		WithTable(opTable).
+		AndEqual("height", height).
+		Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("delete sapling ops: %w", err)
+	}
+
+	// restore last activity height, drop pools without activity
+	del := make([]uint64, 0)
+	for id, pool := range dirty {
+		var last model.SaplingOp
+		err := pack.NewQuery("etl.rollback.last_sapling").
+			WithTable(opTable).
+			WithFields("height").
+			WithDesc().
+			WithLimit(1).
+			AndEqual("account_id", id).
+			Execute(ctx, &last)
+		if err != nil {
+			return fmt.Errorf("find last sapling op: %w", err)
+		}
+		if last.Height == 0 {
+			if pool.RowId > 0 {
+				del = append(del, pool.RowId)
+			}
+			delete(idx.pools, id)
+			delete(dirty, id)
+			continue
+		}
+		pool.LastHeight = last.Height
+	}
+	return idx.storePools(ctx, dirty, del)
+}
+
+func (idx *SaplingIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *SaplingIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *SaplingIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
+
+func (idx *SaplingIndex) storePools(ctx context.Context, pools map[model.AccountID]*model.SaplingPool, del []uint64) error {
+	table := idx.tables[model.SaplingPoolTableKey]
+	ins := make([]pack.Item, 0)
+	upd := make([]pack.Item, 0)
+	for _, v := range pools {
+		if v.RowId == 0 {
+			ins = append(ins, v)
+		} else {
+			upd = append(upd, v)
+		}
+	}
+	if len(ins) > 0 {
+		if err := table.Insert(ctx, ins); err != nil {
+			return fmt.Errorf("sapling pool insert: %w", err)
+		}
+	}
+	if len(upd) > 0 {
+		if err := table.Update(ctx, upd); err != nil {
+			return fmt.Errorf("sapling pool update: %w", err)
+		}
+	}
+	if len(del) > 0 {
+		if err := table.DeleteIds(ctx, del); err != nil {
+			return fmt.Errorf("sapling pool delete: %w", err)
+		}
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/tidwall/gjson"
 
+	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
 )
@@ -40,6 +41,7 @@ type TokenIndex struct {
 	tokenCache  *lru.Cache[uint64, *model.Token]
 	ownerCache  *lru.Cache[uint64, *model.TokenOwner]
 	metaBaseUrl string
+	search      *cache.SearchIndex
 }
 
 var _ model.BlockIndexer = (*TokenIndex)(nil)
@@ -55,6 +57,11 @@ func NewTokenIndex() *TokenIndex {
 	}
 }
 
+// WithSearch registers a search index to update when token metadata arrives.
+func (idx *TokenIndex) WithSearch(s *cache.SearchIndex) {
+	idx.search = s
+}
+
 func (idx *TokenIndex) DB() *pack.DB {
 	return idx.db
 }
@@ -260,6 +267,7 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 			log.Errorf("token: %d %sstore events: %v", op.Height, op.Hash, err)
 			continue
 		}
+		block.TokenEvents = append(block.TokenEvents, events...)
 
 		// update owners, balances, token supply from event
 		if err := idx.processEvents(ctx, events); err != nil {
@@ -438,6 +446,9 @@ func (idx *TokenIndex) OnTaskComplete(ctx context.Context, res *task.TaskResult)
 	if err := idx.tables[model.TokenMetaTableKey].Insert(ctx, meta); err != nil {
 		return fmt.Errorf("token: store token T_%d metadata: %v", res.Flags, err)
 	}
+	if idx.search != nil {
+		idx.search.UpdateTokenMeta(meta)
+	}
 
 	return nil
 }
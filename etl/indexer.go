@@ -13,6 +13,7 @@ import (
 	"blockwatch.cc/packdb/store"
 	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/cdc"
 	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
@@ -25,6 +26,8 @@ type IndexerConfig struct {
 	StateDB   store.DB
 	Indexes   []model.BlockIndexer
 	LightMode bool
+	CDC       *cdc.Log         // optional change-data-capture log
+	Retention map[string]int64 // optional number of cycles to keep per table
 }
 
 // Indexer defines an index manager that manages and stores multiple indexes.
@@ -39,6 +42,18 @@ type Indexer struct {
 	bigmap_types   *cache.BigmapCache        // bigmap allocs
 	contract_types *cache.ContractTypeCache  // contract type data
 	ticket_types   *cache.TicketCache        // ticket type data
+	search         *cache.SearchIndex        // metadata and token full-text index
+	view           atomic.Value              // []*BlockView of recent blocks
+	cdc            *cdc.Log                  // change-data-capture log
+	cdcMu          sync.Mutex                // guards cdcPending
+	cdcPending     []*cdc.Tx                 // change log held back until flush
+	retention      map[string]int64          // cycles to keep per table
+	pruned         atomic.Value              // map[string]PruneTip
+	pruning        atomic.Bool               // prune job is running
+	pruneCycle     int64                     // cycle of last prune job
+	writeSeq       atomic.Uint64             // odd while a block is written
+	writeHeight    atomic.Int64              // height of the last written block
+	wg             sync.WaitGroup
 	dbpath         string
 	dbopts         interface{}
 	statedb        store.DB
@@ -53,7 +68,7 @@ type Indexer struct {
 }
 
 func NewIndexer(cfg IndexerConfig) *Indexer {
-	return &Indexer{
+	m := &Indexer{
 		dbpath:         cfg.DBPath,
 		dbopts:         cfg.DBOpts,
 		statedb:        cfg.StateDB,
@@ -62,11 +77,20 @@ func NewIndexer(cfg IndexerConfig) *Indexer {
 		bigmap_types:   cache.NewBigmapCache(0),
 		contract_types: cache.NewContractTypeCache(0),
 		ticket_types:   cache.NewTicketCache(0),
+		search:         cache.NewSearchIndex(),
 		reg:            NewRegistry(),
 		tips:           make(map[string]*IndexTip),
 		tables:         make(map[string]*pack.Table),
 		lightMode:      cfg.LightMode,
+		cdc:            cfg.CDC,
+		retention:      cfg.Retention,
 	}
+	for _, idx := range m.indexes {
+		if s, ok := idx.(searchIndexer); ok {
+			s.WithSearch(m.search)
+		}
+	}
+	return m
 }
 
 func (m *Indexer) ParamsByHeight(height int64) *rpc.Params {
@@ -207,6 +231,8 @@ func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) erro
 		return fmt.Errorf("Corrupted database! Looks like you need to rebuild your database.")
 	}
 
+	m.writeHeight.Store(tip.BestHeight)
+
 	// Initialize each of the enabled indexes.
 	for _, t := range m.indexes {
 		log.Infof("Initializing %s.", t.Name())
@@ -222,6 +248,11 @@ func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) erro
 		}
 	}
 
+	// load history prune heights
+	if err := m.loadPruned(); err != nil {
+		return err
+	}
+
 	// open tasks db/table
 	var tasks task.TaskRequest
 	key := tasks.TableKey()
@@ -274,7 +305,10 @@ func (m *Indexer) Flush(ctx context.Context) error {
 			}
 		}
 	}
-	return m.tasks.Flush(ctx)
+	if err := m.tasks.Flush(ctx); err != nil {
+		return err
+	}
+	return m.commitCdc()
 }
 
 func (m *Indexer) FlushJournals(ctx context.Context) error {
@@ -286,7 +320,10 @@ func (m *Indexer) FlushJournals(ctx context.Context) error {
 			}
 		}
 	}
-	return m.tasks.FlushJournal(ctx)
+	if err := m.tasks.FlushJournal(ctx); err != nil {
+		return err
+	}
+	return m.commitCdc()
 }
 
 func (m *Indexer) GC(ctx context.Context, ratio float64) error {
@@ -334,6 +371,9 @@ func (m *Indexer) GC(ctx context.Context, ratio float64) error {
 }
 
 func (m *Indexer) Close() error {
+	// wait for background prune jobs
+	m.wg.Wait()
+
 	// shutdown task scheduler
 	if m.sched != nil {
 		m.sched.Stop()
@@ -359,7 +399,9 @@ func (m *Indexer) Close() error {
 		// 	return err
 		// }
 	}
-	return nil
+
+	// tables are flushed on close, release held back change log events
+	return m.commitCdc()
 }
 
 func (m *Indexer) ConnectProtocol(ctx context.Context, next, prev *rpc.Params) error {
@@ -383,6 +425,9 @@ func (m *Indexer) ConnectProtocol(ctx context.Context, next, prev *rpc.Params) e
 }
 
 func (m *Indexer) ConnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
+	m.writeSeq.Add(1)
+	defer m.writeSeq.Add(1)
+
 	// insert block into all indexes
 	for _, t := range m.indexes {
 		key := t.Key()
@@ -412,6 +457,18 @@ func (m *Indexer) ConnectBlock(ctx context.Context, block *model.Block, builder
 		return err
 	}
 
+	// write change log
+	if m.cdc != nil {
+		tx := m.cdc.Begin(cdc.KindConnect, block.Height, block.Hash)
+		if err := m.captureRows(ctx, tx, cdc.OpInsert, block.Height); err != nil {
+			return err
+		}
+		m.captureAccounts(tx, builder, false)
+		m.holdCdc(tx)
+	}
+
+	m.writeHeight.Store(block.Height)
+
 	// update live caches
 	if err := m.updateBlocks(ctx, block); err != nil {
 		return err
@@ -427,6 +484,20 @@ func (m *Indexer) ConnectBlock(ctx context.Context, block *model.Block, builder
 }
 
 func (m *Indexer) DisconnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder, ignoreErrors bool) error {
+	m.writeSeq.Add(1)
+	defer m.writeSeq.Add(1)
+	m.dropViews(block.Height)
+
+	// collect rows before indexes remove them
+	var tx *cdc.Tx
+	if m.cdc != nil {
+		tx = m.cdc.Begin(cdc.KindDisconnect, block.Height, block.Hash)
+		if err := m.captureRows(ctx, tx, cdc.OpDelete, block.Height); err != nil && !ignoreErrors {
+			return err
+		}
+		m.captureAccounts(tx, builder, true)
+	}
+
 	for _, t := range m.indexes {
 		key := t.Key()
 		tip, ok := m.tips[key]
@@ -450,11 +521,31 @@ func (m *Indexer) DisconnectBlock(ctx context.Context, block *model.Block, build
 
 	// we don't roll-back caches here because cached data will be overwritten by
 	// roll-forward
+	m.writeHeight.Store(block.Height - 1)
 
+	if tx != nil {
+		m.holdCdc(tx)
+	}
 	return nil
 }
 
 func (m *Indexer) DeleteBlock(ctx context.Context, tz *rpc.Bundle) error {
+	m.writeSeq.Add(1)
+	defer m.writeSeq.Add(1)
+	m.dropViews(tz.Height())
+
+	// collect rows before indexes remove them
+	var tx *cdc.Tx
+	if m.cdc != nil {
+		tx = m.cdc.Begin(cdc.KindDelete, tz.Height(), tz.Hash())
+		if err := m.captureRows(ctx, tx, cdc.OpDelete, tz.Height()); err != nil {
+			return err
+		}
+		if err := m.captureDeletedAccounts(ctx, tx, tz.Height()); err != nil {
+			return err
+		}
+	}
+
 	for _, t := range m.indexes {
 		key := t.Key()
 		tip, ok := m.tips[key]
@@ -473,6 +564,10 @@ func (m *Indexer) DeleteBlock(ctx context.Context, tz *rpc.Bundle) error {
 		tip.Hash = &cloned
 		tip.Height = tz.Height() - 1
 	}
+	m.writeHeight.Store(tz.Height() - 1)
+	if tx != nil && tx.Len() > 0 {
+		m.holdCdc(tx)
+	}
 	return nil
 }
 
@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package domain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// Name registry forward records and expiry dates
+//
+// Bigmap Types
+// records: bytes => struct { address: option address, owner: address, expiry_key: option bytes, ... }
+// expiry_map: bytes => timestamp
+//
+// Sub-domains share the expiry key of their second-level domain.
+
+// RecordUpdate is a decoded change to a forward record.
+type RecordUpdate struct {
+	Name      string
+	Address   mavryk.Address // invalid when the name does not resolve
+	Owner     mavryk.Address
+	ExpiryKey string
+	IsRemoved bool
+}
+
+// ExpiryUpdate is a decoded change to an expiry date. Expiry is zero when the
+// expiry record was removed.
+type ExpiryUpdate struct {
+	Key    string
+	Expiry time.Time
+}
+
+type Registry struct {
+	records   int64
+	expiry    int64
+	recordTyp micheline.Type
+	expiryTyp micheline.Type
+}
+
+// NewRegistry detects record and expiry bigmaps from the script of the
+// contract called by op.
+func NewRegistry(op *model.Op) (*Registry, error) {
+	if op.Contract == nil {
+		return nil, fmt.Errorf("domain: missing contract")
+	}
+	script, err := op.Contract.LoadScript()
+	if err != nil {
+		return nil, fmt.Errorf("domain: cannot load %s script: %v", op.Contract, err)
+	}
+	maps := script.Bigmaps()
+	typs := script.BigmapTypes()
+	if maps == nil || typs == nil {
+		return nil, fmt.Errorf("domain: cannot detect bigmaps")
+	}
+	r := &Registry{}
+	for name, id := range map[string]*int64{
+		"records":    &r.records,
+		"expiry_map": &r.expiry,
+	} {
+		bigmap, ok := maps[name]
+		if !ok {
+			return nil, fmt.Errorf("domain: missing %s bigmap in %s: %#v", name, op.Contract, maps)
+		}
+		*id = bigmap
+	}
+	typ, ok := typs["records"]
+	if !ok {
+		return nil, fmt.Errorf("domain: missing records type in %s", op.Contract)
+	}
+	r.recordTyp = typ.Right()
+	typ, ok = typs["expiry_map"]
+	if !ok {
+		return nil, fmt.Errorf("domain: missing expiry_map type in %s", op.Contract)
+	}
+	r.expiryTyp = typ.Right()
+	return r, nil
+}
+
+// Decode returns forward record and expiry changes contained in op in
+// execution order.
+func (r *Registry) Decode(op *model.Op) ([]RecordUpdate, []ExpiryUpdate, error) {
+	var (
+		recs []RecordUpdate
+		exps []ExpiryUpdate
+	)
+	for _, ev := range op.BigmapEvents {
+		switch ev.Action {
+		case micheline.DiffActionUpdate, micheline.DiffActionRemove:
+		default:
+			continue
+		}
+		switch ev.Id {
+		case r.records:
+			upd := RecordUpdate{
+				Name:      unpackKey(ev.Key),
+				IsRemoved: ev.Action == micheline.DiffActionRemove,
+			}
+			if !upd.IsRemoved {
+				var rec DomainRecord
+				val := micheline.NewValue(r.recordTyp, ev.Value)
+				if err := val.Unmarshal(&rec); err != nil {
+					return nil, nil, fmt.Errorf("domain: unmarshal record %q: %w", upd.Name, err)
+				}
+				upd.Address = rec.Address
+				upd.Owner = rec.Owner
+				upd.ExpiryKey = rec.ExpiryKey
+			}
+			recs = append(recs, upd)
+
+		case r.expiry:
+			upd := ExpiryUpdate{
+				Key: unpackKey(ev.Key),
+			}
+			if ev.Action == micheline.DiffActionUpdate {
+				val := micheline.NewValue(r.expiryTyp, ev.Value)
+				if err := val.Unmarshal(&upd.Expiry); err != nil {
+					return nil, nil, fmt.Errorf("domain: unmarshal expiry %q: %w", upd.Key, err)
+				}
+			}
+			exps = append(exps, upd)
+		}
+	}
+	return recs, exps, nil
+}
+
+func unpackKey(p micheline.Prim) string {
+	name, _ := model.UnpackTnsString(hex.EncodeToString(p.Bytes))
+	return name
+}
+
+type DomainRecord struct {
+	Address   mavryk.Address `json:"address"`
+	Owner     mavryk.Address `json:"owner"`
+	ExpiryKey string         `json:"expiry_key"`
+}
+
+func (r *DomainRecord) UnmarshalJSON(buf []byte) error {
+	type alias DomainRecord
+	if err := json.Unmarshal(buf, (*alias)(r)); err != nil {
+		return err
+	}
+	r.ExpiryKey, _ = model.UnpackTnsString(r.ExpiryKey)
+	return nil
+}
@@ -84,20 +84,21 @@ type Block struct {
 	BakerConsensusKeyId    AccountID               `pack:"y"                json:"baker_consensus_key_id"`
 
 	// other tz or extracted/translated data for processing
-	MV               *rpc.Bundle `pack:"-" json:"-"`
-	Params           *rpc.Params `pack:"-" json:"-"`
-	Chain            *Chain      `pack:"-" json:"-"`
-	Supply           *Supply     `pack:"-" json:"-"`
-	Ops              []*Op       `pack:"-" json:"-"`
-	Flows            []*Flow     `pack:"-" json:"-"`
-	Baker            *Baker      `pack:"-" json:"-"`
-	Proposer         *Baker      `pack:"-" json:"-"`
-	Parent           *Block      `pack:"-" json:"-"`
-	HasProposals     bool        `pack:"-" json:"-"`
-	HasBallots       bool        `pack:"-" json:"-"`
-	HasSeeds         bool        `pack:"-" json:"-"`
-	OfflineBaker     AccountID   `pack:"-" json:"-"`
-	OfflineEndorsers []AccountID `pack:"-" json:"-"`
+	MV               *rpc.Bundle   `pack:"-" json:"-"`
+	Params           *rpc.Params   `pack:"-" json:"-"`
+	Chain            *Chain        `pack:"-" json:"-"`
+	Supply           *Supply       `pack:"-" json:"-"`
+	Ops              []*Op         `pack:"-" json:"-"`
+	Flows            []*Flow       `pack:"-" json:"-"`
+	TokenEvents      []*TokenEvent `pack:"-" json:"-"` // set by token index
+	Baker            *Baker        `pack:"-" json:"-"`
+	Proposer         *Baker        `pack:"-" json:"-"`
+	Parent           *Block        `pack:"-" json:"-"`
+	HasProposals     bool          `pack:"-" json:"-"`
+	HasBallots       bool          `pack:"-" json:"-"`
+	HasSeeds         bool          `pack:"-" json:"-"`
+	OfflineBaker     AccountID     `pack:"-" json:"-"`
+	OfflineEndorsers []AccountID   `pack:"-" json:"-"`
 
 	// annotated ops
 	// BakeOps             BakingOpList           `pack:"-" json:"-"`
@@ -308,6 +309,7 @@ func (b *Block) Clean() {
 		}
 		b.Flows = b.Flows[:0]
 	}
+	b.TokenEvents = nil
 	if b.MV != nil {
 		b.MV.Baking = b.MV.Baking[:0]
 		b.MV.Endorsing = b.MV.Endorsing[:0]
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+)
+
+const (
+	CallStatTableKey  = "contract_calls"
+	CallerLogTableKey = "contract_callers"
+)
+
+var ErrNoCallStat = errors.New("call stats not indexed")
+
+// CallStat aggregates successful calls to a single contract entrypoint per
+// UTC day. Senders counts distinct callers on that day.
+type CallStat struct {
+	RowId       uint64    `pack:"I,pk"      json:"row_id"`
+	AccountId   AccountID `pack:"A,bloom=3" json:"account_id"`
+	Entrypoint  int       `pack:"E,i16"     json:"entrypoint_id"`
+	Day         time.Time `pack:"D"         json:"time"`
+	FirstHeight int64     `pack:"<,i32"     json:"first_height"`
+	LastHeight  int64     `pack:">,i32"     json:"last_height"`
+	NCalls      int       `pack:"n,i32"     json:"n_calls"`
+	NSenders    int       `pack:"s,i32"     json:"n_senders"`
+	Volume      int64     `pack:"v"         json:"volume"`
+	GasUsed     int64     `pack:"g"         json:"gas_used"`
+	StorageBurn int64     `pack:"b"         json:"storage_burn"`
+}
+
+// Ensure CallStat implements the pack.Item interface.
+var _ pack.Item = (*CallStat)(nil)
+
+func (s CallStat) ID() uint64 {
+	return s.RowId
+}
+
+func (s *CallStat) SetID(id uint64) {
+	s.RowId = id
+}
+
+func (s CallStat) Time() time.Time {
+	return s.Day
+}
+
+func (m CallStat) TableKey() string {
+	return CallStatTableKey
+}
+
+func (m CallStat) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       16,
+		FillLevel:       100,
+	}
+}
+
+func (m CallStat) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// CallerLog records per block call totals of a sender to a contract
+// entrypoint. It is used to count distinct senders per day and to roll back
+// call stats on reorg. Entries are only kept for the current and previous
+// day.
+type CallerLog struct {
+	RowId       uint64    `pack:"I,pk"      json:"row_id"`
+	AccountId   AccountID `pack:"A,bloom=3" json:"account_id"`
+	Entrypoint  int       `pack:"E,i16"     json:"entrypoint_id"`
+	SenderId    AccountID `pack:"S"         json:"sender_id"`
+	Day         time.Time `pack:"D"         json:"time"`
+	Height      int64     `pack:"h,i32"     json:"height"`
+	IsFirst     bool      `pack:"f"         json:"is_first"` // first call by sender on this day
+	NCalls      int       `pack:"n,i32"     json:"n_calls"`
+	Volume      int64     `pack:"v"         json:"volume"`
+	GasUsed     int64     `pack:"g"         json:"gas_used"`
+	StorageBurn int64     `pack:"b"         json:"storage_burn"`
+}
+
+// Ensure CallerLog implements the pack.Item interface.
+var _ pack.Item = (*CallerLog)(nil)
+
+func (l CallerLog) ID() uint64 {
+	return l.RowId
+}
+
+func (l *CallerLog) SetID(id uint64) {
+	l.RowId = id
+}
+
+func (m CallerLog) TableKey() string {
+	return CallerLogTableKey
+}
+
+func (m CallerLog) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       4,
+		FillLevel:       100,
+	}
+}
+
+func (m CallerLog) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
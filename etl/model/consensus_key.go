@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+const ConsensusKeyTableKey = "consensus_key"
+
+var ErrNoConsensusKey = errors.New("consensus key not indexed")
+
+type ConsensusKeyEventType byte
+
+const (
+	ConsensusKeyEventTypeInvalid ConsensusKeyEventType = iota
+	ConsensusKeyEventTypeUpdate
+	ConsensusKeyEventTypeDrain
+)
+
+var (
+	consensusKeyEventTypeString         = "invalid_update_drain"
+	consensusKeyEventTypeIdx            = [3][2]int{{0, 7}, {8, 14}, {15, 20}}
+	consensusKeyEventTypeReverseStrings = map[string]ConsensusKeyEventType{}
+)
+
+func init() {
+	for i, v := range consensusKeyEventTypeIdx {
+		consensusKeyEventTypeReverseStrings[consensusKeyEventTypeString[v[0]:v[1]]] = ConsensusKeyEventType(i)
+	}
+}
+
+func (t ConsensusKeyEventType) IsValid() bool {
+	return t > ConsensusKeyEventTypeInvalid && int(t) < len(consensusKeyEventTypeIdx)
+}
+
+func (t ConsensusKeyEventType) String() string {
+	if int(t) >= len(consensusKeyEventTypeIdx) {
+		t = ConsensusKeyEventTypeInvalid
+	}
+	idx := consensusKeyEventTypeIdx[t]
+	return consensusKeyEventTypeString[idx[0]:idx[1]]
+}
+
+func ParseConsensusKeyEventType(s string) ConsensusKeyEventType {
+	return consensusKeyEventTypeReverseStrings[s]
+}
+
+func (t *ConsensusKeyEventType) UnmarshalText(data []byte) error {
+	v := ParseConsensusKeyEventType(string(data))
+	if !v.IsValid() {
+		return fmt.Errorf("invalid consensus key event type %q", string(data))
+	}
+	*t = v
+	return nil
+}
+
+func (t ConsensusKeyEventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ConsensusKey records a consensus key update or a drain of a baker. Updates
+// become active at the start of ActivationCycle, before that the previous
+// key remains in use. Drains are authorized by the consensus key in Signer
+// and move Amount from the baker to the destination account.
+type ConsensusKey struct {
+	RowId           uint64                `pack:"I,pk"      json:"row_id"`
+	BakerId         AccountID             `pack:"B,bloom=3" json:"baker_id"`
+	Type            ConsensusKeyEventType `pack:"y,u8"      json:"type"`
+	Height          int64                 `pack:"h,i32"     json:"height"`
+	Cycle           int64                 `pack:"c,i16"     json:"cycle"`
+	Time            time.Time             `pack:"t"         json:"time"`
+	OpId            uint64                `pack:"o"         json:"op_id"`
+	ActivationCycle int64                 `pack:"a,i16"     json:"activation_cycle"` // update only
+	OldKey          mavryk.Key            `pack:"k"         json:"old_key"`          // update only
+	NewKey          mavryk.Key            `pack:"K"         json:"new_key"`          // update only
+	Signer          mavryk.Address        `pack:"s"         json:"signer"`           // drain only
+	DestinationId   AccountID             `pack:"D"         json:"destination_id"`   // drain only
+	Amount          int64                 `pack:"v,i64"     json:"amount"`           // drain only
+}
+
+// Ensure ConsensusKey implements the pack.Item interface.
+var _ pack.Item = (*ConsensusKey)(nil)
+
+func (k ConsensusKey) ID() uint64 {
+	return k.RowId
+}
+
+func (k *ConsensusKey) SetID(id uint64) {
+	k.RowId = id
+}
+
+func (m ConsensusKey) TableKey() string {
+	return ConsensusKeyTableKey
+}
+
+func (m ConsensusKey) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    10,
+		JournalSizeLog2: 10,
+		CacheSize:       2,
+		FillLevel:       100,
+	}
+}
+
+func (m ConsensusKey) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
@@ -361,6 +361,20 @@ func (c *Contract) ListCallStats() map[string]int {
 		return c.ListSmartRollupCallStats()
 	}
 	// list entrypoint names first
+	byId := c.EntrypointNames()
+	if byId == nil {
+		return nil
+	}
+
+	res := make(map[string]int, len(c.CallStats)>>2)
+	for i, name := range byId {
+		res[name] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
+	}
+	return res
+}
+
+// EntrypointNames returns entrypoint names ordered by entrypoint id.
+func (c *Contract) EntrypointNames() []string {
 	pTyp, _, err := c.LoadType()
 	if err != nil {
 		return nil
@@ -376,12 +390,7 @@ func (c *Contract) ListCallStats() map[string]int {
 	for _, v := range ep {
 		byId[v.Id] = v.Name
 	}
-
-	res := make(map[string]int, len(c.CallStats)>>2)
-	for i, name := range byId {
-		res[name] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
-	}
-	return res
+	return byId
 }
 
 func (c *Contract) NamedBigmaps(m []*BigmapAlloc) map[string]int64 {
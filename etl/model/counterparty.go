@@ -0,0 +1,107 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+)
+
+const (
+	CounterpartyTableKey    = "counterparty"
+	CounterpartyLogTableKey = "counterparty_log"
+)
+
+var ErrNoCounterparty = errors.New("counterparty not indexed")
+
+// Counterparty is a directed edge between two accounts aggregated per UTC
+// day. It counts successful transactions and token transfers from sender to
+// receiver.
+type Counterparty struct {
+	RowId       uint64    `pack:"I,pk"      json:"row_id"`
+	SenderId    AccountID `pack:"S,bloom=3" json:"sender_id"`
+	ReceiverId  AccountID `pack:"R,bloom=3" json:"receiver_id"`
+	Day         time.Time `pack:"D"         json:"time"`
+	FirstHeight int64     `pack:"<,i32"     json:"first_height"`
+	LastHeight  int64     `pack:">,i32"     json:"last_height"`
+	NTx         int       `pack:"n,i32"     json:"n_tx"`
+	Volume      int64     `pack:"v"         json:"volume"`
+	NTokenTx    int       `pack:"k,i32"     json:"n_token_tx"`
+}
+
+// Ensure Counterparty implements the pack.Item interface.
+var _ pack.Item = (*Counterparty)(nil)
+
+func (c Counterparty) ID() uint64 {
+	return c.RowId
+}
+
+func (c *Counterparty) SetID(id uint64) {
+	c.RowId = id
+}
+
+func (c Counterparty) Time() time.Time {
+	return c.Day
+}
+
+func (m Counterparty) TableKey() string {
+	return CounterpartyTableKey
+}
+
+func (m Counterparty) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    15,
+		JournalSizeLog2: 16,
+		CacheSize:       16,
+		FillLevel:       100,
+	}
+}
+
+func (m Counterparty) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// CounterpartyLog records per block edge totals and is used to roll back
+// counterparty edges on reorg. Entries are only kept for the current and
+// previous day.
+type CounterpartyLog struct {
+	RowId      uint64    `pack:"I,pk"      json:"row_id"`
+	SenderId   AccountID `pack:"S"         json:"sender_id"`
+	ReceiverId AccountID `pack:"R"         json:"receiver_id"`
+	Day        time.Time `pack:"D"         json:"time"`
+	Height     int64     `pack:"h,i32"     json:"height"`
+	NTx        int       `pack:"n,i32"     json:"n_tx"`
+	Volume     int64     `pack:"v"         json:"volume"`
+	NTokenTx   int       `pack:"k,i32"     json:"n_token_tx"`
+}
+
+// Ensure CounterpartyLog implements the pack.Item interface.
+var _ pack.Item = (*CounterpartyLog)(nil)
+
+func (l CounterpartyLog) ID() uint64 {
+	return l.RowId
+}
+
+func (l *CounterpartyLog) SetID(id uint64) {
+	l.RowId = id
+}
+
+func (m CounterpartyLog) TableKey() string {
+	return CounterpartyLogTableKey
+}
+
+func (m CounterpartyLog) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       4,
+		FillLevel:       100,
+	}
+}
+
+func (m CounterpartyLog) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+const (
+	DomainTableKey      = "domain"
+	DomainEventTableKey = "domain_events"
+)
+
+var (
+	ErrNoDomain = errors.New("domain not indexed")
+)
+
+// Domain is the current state of a name registry record.
+type Domain struct {
+	RowId       uint64         `pack:"I,pk"      json:"row_id"`
+	Name        string         `pack:"n,bloom=3" json:"name"`
+	Level       int            `pack:"l,i8"      json:"level"`   // number of labels, 2 for example.mav
+	Address     mavryk.Address `pack:"A,bloom=3" json:"address"` // forward resolution target
+	Owner       mavryk.Address `pack:"O,bloom=3" json:"owner"`
+	ExpiryKey   string         `pack:"k,bloom=3" json:"expiry_key"` // names sharing an expiry record
+	Expiry      time.Time      `pack:"x"         json:"expiry"`
+	FirstHeight int64          `pack:"<,i32"     json:"first_height"`
+	LastHeight  int64          `pack:">,i32"     json:"last_height"`
+}
+
+// Ensure Domain implements the pack.Item interface.
+var _ pack.Item = (*Domain)(nil)
+
+func (d Domain) ID() uint64 {
+	return d.RowId
+}
+
+func (d *Domain) SetID(id uint64) {
+	d.RowId = id
+}
+
+func (m Domain) TableKey() string {
+	return DomainTableKey
+}
+
+func (m Domain) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       16,
+		FillLevel:       100,
+	}
+}
+
+func (m Domain) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// Parent returns the parent domain name or an empty string for top-level
+// names.
+func (d Domain) Parent() string {
+	_, parent, ok := strings.Cut(d.Name, ".")
+	if !ok {
+		return ""
+	}
+	return parent
+}
+
+// IsExpired returns true when the domain has an expiry date before now.
+func (d Domain) IsExpired(now time.Time) bool {
+	return !d.Expiry.IsZero() && d.Expiry.Before(now)
+}
+
+// DomainLevel returns the number of labels in a domain name.
+func DomainLevel(name string) int {
+	if name == "" {
+		return 0
+	}
+	return strings.Count(name, ".") + 1
+}
+
+type DomainEventType byte
+
+const (
+	DomainEventTypeInvalid DomainEventType = iota
+	DomainEventTypeRegister
+	DomainEventTypeUpdate
+	DomainEventTypeTransfer
+	DomainEventTypeRenew
+	DomainEventTypeRemove
+)
+
+var (
+	domainEventTypeString         = "invalid_register_update_transfer_renew_remove"
+	domainEventTypeIdx            = [6][2]int{{0, 7}, {8, 16}, {17, 23}, {24, 32}, {33, 38}, {39, 45}}
+	domainEventTypeReverseStrings = map[string]DomainEventType{}
+)
+
+func init() {
+	for i, v := range domainEventTypeIdx {
+		domainEventTypeReverseStrings[domainEventTypeString[v[0]:v[1]]] = DomainEventType(i)
+	}
+}
+
+func (t DomainEventType) IsValid() bool {
+	return t > DomainEventTypeInvalid && int(t) < len(domainEventTypeIdx)
+}
+
+func (t DomainEventType) String() string {
+	if int(t) >= len(domainEventTypeIdx) {
+		t = DomainEventTypeInvalid
+	}
+	idx := domainEventTypeIdx[t]
+	return domainEventTypeString[idx[0]:idx[1]]
+}
+
+func ParseDomainEventType(s string) DomainEventType {
+	return domainEventTypeReverseStrings[s]
+}
+
+func (t *DomainEventType) UnmarshalText(data []byte) error {
+	v := ParseDomainEventType(string(data))
+	if !v.IsValid() {
+		return fmt.Errorf("invalid domain event type %q", string(data))
+	}
+	*t = v
+	return nil
+}
+
+func (t DomainEventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// DomainEvent records a change to a domain. Previous values are kept to
+// build ownership history and to revert changes on reorg.
+type DomainEvent struct {
+	RowId         uint64          `pack:"I,pk"      json:"row_id"`
+	Name          string          `pack:"n,bloom=3" json:"name"`
+	Type          DomainEventType `pack:"y,u8"      json:"type"`
+	Height        int64           `pack:"h,i32"     json:"height"`
+	Time          time.Time       `pack:"t"         json:"time"`
+	OpId          uint64          `pack:"o"         json:"op_id"`
+	Address       mavryk.Address  `pack:"A"         json:"address"`
+	Owner         mavryk.Address  `pack:"O"         json:"owner"`
+	Expiry        time.Time       `pack:"x"         json:"expiry"`
+	PrevAddress   mavryk.Address  `pack:"a"         json:"prev_address"`
+	PrevOwner     mavryk.Address  `pack:"p"         json:"prev_owner"`
+	PrevExpiry    time.Time       `pack:"X"         json:"prev_expiry"`
+	PrevExpiryKey string          `pack:"K"         json:"prev_expiry_key"`
+}
+
+// Ensure DomainEvent implements the pack.Item interface.
+var _ pack.Item = (*DomainEvent)(nil)
+
+func (e DomainEvent) ID() uint64 {
+	return e.RowId
+}
+
+func (e *DomainEvent) SetID(id uint64) {
+	e.RowId = id
+}
+
+func (m DomainEvent) TableKey() string {
+	return DomainEventTableKey
+}
+
+func (m DomainEvent) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       4,
+		FillLevel:       100,
+	}
+}
+
+func (m DomainEvent) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+const (
+	ReorgTableKey   = "reorg"
+	ReorgOpTableKey = "reorg_ops"
+)
+
+var ErrNoReorg = errors.New("reorg not indexed")
+
+// Reorg records a completed chain reorganization or rollback. Depth is the
+// number of orphaned blocks, Attached the number of blocks on the new branch.
+type Reorg struct {
+	RowId        uint64           `pack:"I,pk"      json:"row_id"`
+	Time         time.Time        `pack:"T"         json:"time"`
+	ForkHeight   int64            `pack:"f,i32"     json:"fork_height"`
+	ForkHash     mavryk.BlockHash `pack:"F"         json:"fork_hash"`
+	Depth        int              `pack:"d,i16"     json:"depth"`
+	Attached     int              `pack:"a,i16"     json:"attached"`
+	FormerHeight int64            `pack:"o,i32"     json:"former_height"`
+	FormerHash   mavryk.BlockHash `pack:"O"         json:"former_hash"`
+	NewHeight    int64            `pack:"n,i32"     json:"new_height"`
+	NewHash      mavryk.BlockHash `pack:"N"         json:"new_hash"`
+	IsRollback   bool             `pack:"r"         json:"is_rollback"`
+	NReverted    int              `pack:"v,i32"     json:"n_reverted"`
+}
+
+// Ensure Reorg implements the pack.Item interface.
+var _ pack.Item = (*Reorg)(nil)
+
+func (r Reorg) ID() uint64 {
+	return r.RowId
+}
+
+func (r *Reorg) SetID(id uint64) {
+	r.RowId = id
+}
+
+func (m Reorg) TableKey() string {
+	return ReorgTableKey
+}
+
+func (m Reorg) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    10,
+		JournalSizeLog2: 10,
+		CacheSize:       2,
+		FillLevel:       100,
+	}
+}
+
+func (m Reorg) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// ReorgOp is an operation that was included in an orphaned block but not
+// re-included on the new branch of a reorg. Its effects were reverted.
+type ReorgOp struct {
+	RowId   uint64         `pack:"I,pk"      json:"row_id"`
+	ReorgId uint64         `pack:"R"         json:"reorg_id"`
+	Hash    mavryk.OpHash  `pack:"H,bloom=3" json:"hash"`
+	Height  int64          `pack:"h,i32"     json:"height"` // orphaned block height
+	OpN     int            `pack:"n,i32"     json:"op_n"`
+	Type    OpType         `pack:"t,u8"      json:"type"`
+	Sender  mavryk.Address `pack:"S"         json:"sender"` // accounts may not survive the reorg
+	Volume  int64          `pack:"v"         json:"volume"`
+}
+
+// Ensure ReorgOp implements the pack.Item interface.
+var _ pack.Item = (*ReorgOp)(nil)
+
+func (o ReorgOp) ID() uint64 {
+	return o.RowId
+}
+
+func (o *ReorgOp) SetID(id uint64) {
+	o.RowId = id
+}
+
+func (m ReorgOp) TableKey() string {
+	return ReorgOpTableKey
+}
+
+func (m ReorgOp) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    10,
+		JournalSizeLog2: 10,
+		CacheSize:       2,
+		FillLevel:       100,
+	}
+}
+
+func (m ReorgOp) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const (
+	SaplingOpTableKey   = "sapling_op"
+	SaplingPoolTableKey = "sapling_pool"
+)
+
+var (
+	ErrNoSaplingOp   = errors.New("sapling op not indexed")
+	ErrNoSaplingPool = errors.New("sapling pool not indexed")
+
+	errSaplingShort = errors.New("sapling: short buffer")
+)
+
+type SaplingOpKind byte
+
+const (
+	SaplingOpKindInvalid SaplingOpKind = iota
+	SaplingOpKindShield
+	SaplingOpKindUnshield
+	SaplingOpKindTransfer
+)
+
+var (
+	saplingOpKindString         = "invalid_shield_unshield_transfer"
+	saplingOpKindIdx            = [4][2]int{{0, 7}, {8, 14}, {15, 23}, {24, 32}}
+	saplingOpKindReverseStrings = map[string]SaplingOpKind{}
+)
+
+func init() {
+	for i, v := range saplingOpKindIdx {
+		saplingOpKindReverseStrings[saplingOpKindString[v[0]:v[1]]] = SaplingOpKind(i)
+	}
+}
+
+func (k SaplingOpKind) IsValid() bool {
+	return k > SaplingOpKindInvalid && int(k) < len(saplingOpKindIdx)
+}
+
+func (k SaplingOpKind) String() string {
+	if int(k) >= len(saplingOpKindIdx) {
+		k = SaplingOpKindInvalid
+	}
+	idx := saplingOpKindIdx[k]
+	return saplingOpKindString[idx[0]:idx[1]]
+}
+
+func ParseSaplingOpKind(s string) SaplingOpKind {
+	return saplingOpKindReverseStrings[s]
+}
+
+func (k *SaplingOpKind) UnmarshalText(data []byte) error {
+	v := ParseSaplingOpKind(string(data))
+	if !v.IsValid() {
+		return fmt.Errorf("invalid sapling op kind %q", string(data))
+	}
+	*k = v
+	return nil
+}
+
+func (k SaplingOpKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// SaplingOp records a single Sapling transaction applied to a shielded pool.
+// Each spent input publishes one nullifier and each output adds one note
+// commitment to the pool's tree. Amount is the transparent balance change of
+// the pool, i.e. positive when shielding and negative when unshielding. Pool
+// totals are stored as of after this transaction.
+type SaplingOp struct {
+	RowId           uint64        `pack:"I,pk"      json:"row_id"`
+	Height          int64         `pack:"h,i32"     json:"height"`
+	Timestamp       time.Time     `pack:"T"         json:"time"`
+	OpId            uint64        `pack:"o"         json:"op_id"`
+	AccountId       AccountID     `pack:"A,bloom=3" json:"account_id"` // pool contract
+	SenderId        AccountID     `pack:"S"         json:"sender_id"`
+	Kind            SaplingOpKind `pack:"k,u8"      json:"kind"`
+	NInputs         int           `pack:"i,i16"     json:"n_inputs"`
+	NOutputs        int           `pack:"u,i16"     json:"n_outputs"`
+	Amount          int64         `pack:"a"         json:"amount"`
+	PoolBalance     int64         `pack:"B"         json:"pool_balance"`
+	PoolCommitments int64         `pack:"C"         json:"pool_commitments"`
+	PoolNullifiers  int64         `pack:"N"         json:"pool_nullifiers"`
+}
+
+// Ensure SaplingOp implements the pack.Item interface.
+var _ pack.Item = (*SaplingOp)(nil)
+
+func (o SaplingOp) ID() uint64 {
+	return o.RowId
+}
+
+func (o *SaplingOp) SetID(id uint64) {
+	o.RowId = id
+}
+
+func (o SaplingOp) Time() time.Time {
+	return o.Timestamp
+}
+
+func (m SaplingOp) TableKey() string {
+	return SaplingOpTableKey
+}
+
+func (m SaplingOp) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,
+		JournalSizeLog2: 14,
+		CacheSize:       4,
+		FillLevel:       100,
+	}
+}
+
+func (m SaplingOp) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// SaplingPool holds current statistics of a Sapling shielded pool. A pool is
+// identified by the contract that verifies its updates. The anonymity set is
+// the number of note commitments ever added to the pool.
+type SaplingPool struct {
+	RowId          uint64    `pack:"I,pk"      json:"row_id"`
+	AccountId      AccountID `pack:"A,bloom=3" json:"account_id"`
+	FirstHeight    int64     `pack:"<,i32"     json:"first_height"`
+	LastHeight     int64     `pack:">,i32"     json:"last_height"`
+	Balance        int64     `pack:"B"         json:"balance"`
+	NCommitments   int64     `pack:"C"         json:"n_commitments"`
+	NNullifiers    int64     `pack:"N"         json:"n_nullifiers"`
+	NShield        int       `pack:"s,i32"     json:"n_shield"`
+	NUnshield      int       `pack:"u,i32"     json:"n_unshield"`
+	NTransfer      int       `pack:"t,i32"     json:"n_transfer"`
+	ShieldVolume   int64     `pack:"S"         json:"shield_volume"`
+	UnshieldVolume int64     `pack:"U"         json:"unshield_volume"`
+}
+
+// Ensure SaplingPool implements the pack.Item interface.
+var _ pack.Item = (*SaplingPool)(nil)
+
+func (p SaplingPool) ID() uint64 {
+	return p.RowId
+}
+
+func (p *SaplingPool) SetID(id uint64) {
+	p.RowId = id
+}
+
+func (m SaplingPool) TableKey() string {
+	return SaplingPoolTableKey
+}
+
+func (m SaplingPool) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    10,
+		JournalSizeLog2: 10,
+		CacheSize:       2,
+		FillLevel:       100,
+	}
+}
+
+func (m SaplingPool) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// Add applies a Sapling op to pool totals and sets the op's pool fields.
+func (p *SaplingPool) Add(o *SaplingOp) {
+	if p.FirstHeight == 0 {
+		p.FirstHeight = o.Height
+	}
+	p.LastHeight = o.Height
+	p.Balance += o.Amount
+	p.NCommitments += int64(o.NOutputs)
+	p.NNullifiers += int64(o.NInputs)
+	switch o.Kind {
+	case SaplingOpKindShield:
+		p.NShield++
+		p.ShieldVolume += o.Amount
+	case SaplingOpKindUnshield:
+		p.NUnshield++
+		p.UnshieldVolume -= o.Amount
+	case SaplingOpKindTransfer:
+		p.NTransfer++
+	}
+	o.PoolBalance = p.Balance
+	o.PoolCommitments = p.NCommitments
+	o.PoolNullifiers = p.NNullifiers
+}
+
+// Remove reverts a Sapling op from pool totals. LastHeight must be
+// restored by the caller.
+func (p *SaplingPool) Remove(o *SaplingOp) {
+	p.Balance -= o.Amount
+	p.NCommitments -= int64(o.NOutputs)
+	p.NNullifiers -= int64(o.NInputs)
+	switch o.Kind {
+	case SaplingOpKindShield:
+		p.NShield--
+		p.ShieldVolume -= o.Amount
+	case SaplingOpKindUnshield:
+		p.NUnshield--
+		p.UnshieldVolume += o.Amount
+	case SaplingOpKindTransfer:
+		p.NTransfer--
+	}
+}
+
+// SaplingTx is the public part of a Sapling transaction. Nothing is
+// decrypted, only sizes and the transparent balance are read.
+type SaplingTx struct {
+	NInputs  int
+	NOutputs int
+	Balance  int64 // positive when value leaves the pool
+}
+
+func (t SaplingTx) Kind() SaplingOpKind {
+	switch {
+	case t.Balance < 0:
+		return SaplingOpKindShield
+	case t.Balance > 0:
+		return SaplingOpKindUnshield
+	default:
+		return SaplingOpKindTransfer
+	}
+}
+
+const (
+	saplingSpendSize   = 32 + 32 + 32 + 192 + 64 // cv, nf, rk, proof, sig
+	saplingOutputFixed = 32 + 192 + 32 + 32      // cm, proof, cv, epk
+	saplingOutputTail  = 24 + 80 + 24            // nonce_enc, payload_out, nonce_out
+)
+
+// DecodeSaplingTx decodes the binary encoding of a Michelson
+// sapling_transaction value. Decoding fails unless the entire buffer is
+// consumed.
+func DecodeSaplingTx(buf []byte) (tx SaplingTx, err error) {
+	next := func(n int) ([]byte, bool) {
+		if len(buf) < n {
+			return nil, false
+		}
+		b := buf[:n]
+		buf = buf[n:]
+		return b, true
+	}
+	size := func() (int, bool) {
+		b, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(b)), true
+	}
+
+	// inputs
+	n, ok := size()
+	if !ok {
+		return tx, errSaplingShort
+	}
+	if n%saplingSpendSize != 0 {
+		return tx, fmt.Errorf("sapling: invalid inputs size %d", n)
+	}
+	if _, ok := next(n); !ok {
+		return tx, errSaplingShort
+	}
+	tx.NInputs = n / saplingSpendSize
+
+	// outputs
+	n, ok = size()
+	if !ok {
+		return tx, errSaplingShort
+	}
+	outs, ok := next(n)
+	if !ok {
+		return tx, errSaplingShort
+	}
+	for len(outs) > 0 {
+		if len(outs) < saplingOutputFixed+4 {
+			return tx, errSaplingShort
+		}
+		l := int(binary.BigEndian.Uint32(outs[saplingOutputFixed:]))
+		end := saplingOutputFixed + 4 + l + saplingOutputTail
+		if len(outs) < end {
+			return tx, errSaplingShort
+		}
+		outs = outs[end:]
+		tx.NOutputs++
+	}
+
+	// binding sig, balance, root
+	if _, ok := next(64); !ok {
+		return tx, errSaplingShort
+	}
+	b, ok := next(8)
+	if !ok {
+		return tx, errSaplingShort
+	}
+	tx.Balance = int64(binary.BigEndian.Uint64(b))
+	if _, ok := next(32); !ok {
+		return tx, errSaplingShort
+	}
+
+	// bound data
+	n, ok = size()
+	if !ok {
+		return tx, errSaplingShort
+	}
+	if _, ok := next(n); !ok {
+		return tx, errSaplingShort
+	}
+	if len(buf) > 0 {
+		return tx, fmt.Errorf("sapling: %d trailing bytes", len(buf))
+	}
+	return tx, nil
+}
+
+// DecodeSaplingParams returns all Sapling transactions contained in binary
+// encoded call parameters. Bytes values that do not decode as a Sapling
+// transaction are skipped, so this must only be used for calls to contracts
+// with the Sapling feature.
+func DecodeSaplingParams(data []byte) ([]SaplingTx, error) {
+	var params micheline.Parameters
+	if err := params.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	list := make([]SaplingTx, 0)
+	_ = params.Value.Walk(func(p micheline.Prim) error {
+		if p.Type != micheline.PrimBytes {
+			return nil
+		}
+		if tx, err := DecodeSaplingTx(p.Bytes); err == nil {
+			list = append(list, tx)
+		}
+		return nil
+	})
+	return list, nil
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+// saplingTestTx builds a sapling_transaction in the protocol's binary layout:
+// inputs, outputs, binding_sig, balance, root and bound_data. Proofs, keys and
+// ciphertexts are filled with a counter since the decoder never reads them.
+func saplingTestTx(nIn, nOut int, balance int64, bound []byte) []byte {
+	var (
+		buf bytes.Buffer
+		ctr byte
+	)
+	fill := func(n int) {
+		for i := 0; i < n; i++ {
+			ctr++
+			buf.WriteByte(ctr)
+		}
+	}
+	u32 := func(n int) {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(n))
+	}
+
+	// inputs: cv, nf, rk, proof, signature
+	u32(nIn * saplingSpendSize)
+	fill(nIn * saplingSpendSize)
+
+	// outputs: cm, proof, ciphertext (cv, epk, payload_enc, nonce_enc,
+	// payload_out, nonce_out) with an encrypted payload for an 8 byte memo
+	const payloadEnc = 11 + 8 + 32 + 4 + 8 + 16
+	u32(nOut * (saplingOutputFixed + 4 + payloadEnc + saplingOutputTail))
+	for i := 0; i < nOut; i++ {
+		fill(saplingOutputFixed)
+		u32(payloadEnc)
+		fill(payloadEnc + saplingOutputTail)
+	}
+
+	// binding sig, balance, root, bound data
+	fill(64)
+	_ = binary.Write(&buf, binary.BigEndian, balance)
+	fill(32)
+	u32(len(bound))
+	buf.Write(bound)
+	return buf.Bytes()
+}
+
+// packed key hash as bound to an unshield recipient
+var saplingTestBound = append([]byte{0x05, 0x0a, 0x00, 0x00, 0x00, 0x15, 0x00}, bytes.Repeat([]byte{0xab}, 20)...)
+
+func TestDecodeSaplingTx(t *testing.T) {
+	cases := []struct {
+		name    string
+		buf     []byte
+		in, out int
+		balance int64
+		kind    SaplingOpKind
+	}{
+		{"shield", saplingTestTx(0, 1, -1000000, nil), 0, 1, -1000000, SaplingOpKindShield},
+		{"unshield", saplingTestTx(1, 1, 500000, saplingTestBound), 1, 1, 500000, SaplingOpKindUnshield},
+		{"transfer", saplingTestTx(2, 2, 0, nil), 2, 2, 0, SaplingOpKindTransfer},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tx, err := DecodeSaplingTx(c.buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.NInputs != c.in || tx.NOutputs != c.out || tx.Balance != c.balance {
+				t.Errorf("got %d inputs, %d outputs, balance %d, want %d, %d, %d",
+					tx.NInputs, tx.NOutputs, tx.Balance, c.in, c.out, c.balance)
+			}
+			if k := tx.Kind(); k != c.kind {
+				t.Errorf("kind %s, want %s", k, c.kind)
+			}
+
+			// every truncation must fail
+			for n := 0; n < len(c.buf); n++ {
+				if _, err := DecodeSaplingTx(c.buf[:n]); err == nil {
+					t.Fatalf("no error for buffer truncated to %d of %d bytes", n, len(c.buf))
+				}
+			}
+
+			// trailing bytes must fail
+			if _, err := DecodeSaplingTx(append(c.buf[:len(c.buf):len(c.buf)], 0)); err == nil {
+				t.Errorf("no error for trailing byte")
+			}
+		})
+	}
+}
+
+func TestDecodeSaplingTxInvalidInputs(t *testing.T) {
+	buf := saplingTestTx(1, 0, 0, nil)
+	binary.BigEndian.PutUint32(buf, saplingSpendSize-1)
+	if _, err := DecodeSaplingTx(buf); err == nil {
+		t.Errorf("no error for invalid inputs size")
+	}
+}
+
+func TestDecodeSaplingParams(t *testing.T) {
+	// list (pair (sapling_transaction 8) (option key_hash))
+	shield := saplingTestTx(0, 2, -2000000, nil)
+	unshield := saplingTestTx(1, 1, 700000, saplingTestBound)
+	params := micheline.Parameters{
+		Entrypoint: "default",
+		Value: micheline.NewSeq(
+			micheline.NewPair(micheline.NewBytes(shield), micheline.NewCode(micheline.D_NONE)),
+			micheline.NewPair(micheline.NewBytes(unshield), micheline.NewOption(micheline.NewBytes(bytes.Repeat([]byte{0xab}, 21)))),
+		),
+	}
+	data, err := params.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := DecodeSaplingParams(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(list))
+	}
+	if k := list[0].Kind(); k != SaplingOpKindShield || list[0].NOutputs != 2 {
+		t.Errorf("first tx %s with %d outputs, want shield with 2", k, list[0].NOutputs)
+	}
+	if k := list[1].Kind(); k != SaplingOpKindUnshield || list[1].Balance != 700000 {
+		t.Errorf("second tx %s with balance %d, want unshield with 700000", k, list[1].Balance)
+	}
+
+	// truncated parameters fail
+	if _, err := DecodeSaplingParams(data[:len(data)-1]); err == nil {
+		t.Errorf("no error for truncated parameters")
+	}
+}
@@ -107,6 +107,9 @@ func (m *Indexer) BlockHashById(ctx context.Context, id uint64) (mavryk.BlockHas
 }
 
 func (m *Indexer) BlockByHeight(ctx context.Context, height int64) (*model.Block, error) {
+	if v := m.viewByHeight(height); v != nil {
+		return v.CopyBlock(), nil
+	}
 	table, err := m.Table(model.BlockTableKey)
 	if err != nil {
 		return nil, err
@@ -130,6 +133,11 @@ func (m *Indexer) BlockByHash(ctx context.Context, h mavryk.BlockHash, from, to
 	if !h.IsValid() {
 		return nil, fmt.Errorf("invalid block hash %s", h)
 	}
+	if v := m.viewByHash(h); v != nil {
+		if (from <= 0 || v.Block.Height >= from) && (to <= 0 || v.Block.Height <= to) {
+			return v.CopyBlock(), nil
+		}
+	}
 	table, err := m.Table(model.BlockTableKey)
 	if err != nil {
 		return nil, err
@@ -161,7 +169,7 @@ func (m *Indexer) LookupBlockId(ctx context.Context, blockIdent string) (mavryk.
 	var err error
 	switch {
 	case blockIdent == "head":
-		if b, err2 := m.BlockByHeight(ctx, m.tips[model.BlockTableKey].Height); err2 == nil {
+		if b, err2 := m.BlockByHeight(ctx, m.headHeight(ctx)); err2 == nil {
 			return b.Hash, b.Height, nil
 		} else {
 			err = err2
@@ -194,7 +202,7 @@ func (m *Indexer) LookupBlock(ctx context.Context, blockIdent string) (*model.Bl
 	)
 	switch {
 	case blockIdent == "head":
-		b, err = m.BlockByHeight(ctx, m.tips[model.BlockTableKey].Height)
+		b, err = m.BlockByHeight(ctx, m.headHeight(ctx))
 	case len(blockIdent) == mavryk.HashTypeBlock.B58Len || strings.HasPrefix(blockIdent, mavryk.HashTypeBlock.B58Prefix):
 		// assume it's a hash
 		var blockHash mavryk.BlockHash
@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// LookupConsensusKey returns the consensus key a baker used at height. When
+// no update was active at height the baker signs with its own key and
+// ErrNoConsensusKey is returned.
+func (m *Indexer) LookupConsensusKey(ctx context.Context, id model.AccountID, height int64) (mavryk.Key, error) {
+	table, err := m.Table(model.ConsensusKeyTableKey)
+	if err != nil {
+		return mavryk.InvalidKey, err
+	}
+	cycle := m.ParamsByHeight(height).HeightToCycle(height)
+	k := &model.ConsensusKey{}
+	err = pack.NewQuery("api.consensus_key_at").
+		WithTable(table).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("baker_id", id).
+		AndEqual("type", model.ConsensusKeyEventTypeUpdate).
+		AndLte("activation_cycle", cycle).
+		Execute(ctx, k)
+	if err != nil {
+		return mavryk.InvalidKey, err
+	}
+	if k.RowId == 0 {
+		return mavryk.InvalidKey, model.ErrNoConsensusKey
+	}
+	return k.NewKey, nil
+}
+
+// ListActiveConsensusKeys returns the consensus keys active at height for
+// all bakers that have updated their key.
+func (m *Indexer) ListActiveConsensusKeys(ctx context.Context, height int64) (map[model.AccountID]mavryk.Key, error) {
+	table, err := m.Table(model.ConsensusKeyTableKey)
+	if err != nil {
+		return nil, err
+	}
+	cycle := m.ParamsByHeight(height).HeightToCycle(height)
+	keys := make(map[model.AccountID]mavryk.Key)
+	k := &model.ConsensusKey{}
+	err = pack.NewQuery("api.list_consensus_keys_at").
+		WithTable(table).
+		WithFields("baker_id", "new_key").
+		AndEqual("type", model.ConsensusKeyEventTypeUpdate).
+		AndLte("activation_cycle", cycle).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(k); err != nil {
+				return err
+			}
+			keys[k.BakerId] = k.NewKey.Clone()
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
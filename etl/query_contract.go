@@ -11,6 +11,7 @@ import (
 	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
 )
 
 func (m *Indexer) LookupContract(ctx context.Context, addr mavryk.Address) (*model.Contract, error) {
@@ -166,6 +167,31 @@ func (m *Indexer) ListContracts(ctx context.Context, r ListRequest) ([]*model.Co
 	}
 }
 
+// ListSimilarContracts returns all contracts sharing the same code hash (or
+// interface hash when byIface is set) in deployment order. Only identity
+// fields are loaded.
+func (m *Indexer) ListSimilarContracts(ctx context.Context, hash uint64, byIface bool) ([]*model.Contract, error) {
+	table, err := m.Table(model.ContractTableKey)
+	if err != nil {
+		return nil, err
+	}
+	field := "code_hash"
+	if byIface {
+		field = "iface_hash"
+	}
+	ccs := make([]*model.Contract, 0)
+	err = pack.NewQuery("api.list_similar_contracts").
+		WithTable(table).
+		WithFields("row_id", "address", "account_id", "creator_id", "first_seen", "code_hash", "iface_hash").
+		AndEqual(field, hash).
+		Execute(ctx, &ccs)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ccs, func(i, j int) bool { return ccs[i].FirstSeen < ccs[j].FirstSeen })
+	return ccs, nil
+}
+
 func (m *Indexer) LookupConstant(ctx context.Context, hash mavryk.ExprHash) (*model.Constant, error) {
 	if !hash.IsValid() {
 		return nil, model.ErrInvalidExprHash
@@ -236,6 +262,53 @@ func (m *Indexer) LookupStorage(ctx context.Context, id model.AccountID, h uint6
 	return store, nil
 }
 
+// ContractStorageAt returns binary storage of contract cc at height and the
+// height of the update it originates from. Updates dropped from the storage
+// index (e.g. when exceeding the max entry size) or missing because the
+// storage table is disabled are fetched from the node when c is not nil.
+// Height zero returns the most recent storage.
+func (m *Indexer) ContractStorageAt(ctx context.Context, cc *model.Contract, height int64, c *rpc.Client) ([]byte, int64, error) {
+	if height == 0 || height >= cc.LastSeen {
+		return cc.Storage, cc.LastSeen, nil
+	}
+
+	// find last incoming call at or before height
+	op, err := m.FindLastCall(ctx, cc.AccountId, cc.FirstSeen, height)
+	if err != nil && err != model.ErrNoOp {
+		return nil, 0, err
+	}
+
+	// without calls storage is still in origination state
+	if op == nil {
+		script, err := cc.LoadScript()
+		if err != nil {
+			return nil, 0, err
+		}
+		if script == nil {
+			return nil, cc.FirstSeen, nil
+		}
+		buf, err := script.Storage.MarshalBinary()
+		return buf, cc.FirstSeen, err
+	}
+
+	store, err := m.LookupStorage(ctx, cc.AccountId, op.StorageHash, cc.FirstSeen, op.Height)
+	switch {
+	case err == nil:
+		return store.Storage, op.Height, nil
+	case err != model.ErrNoStorage && err != ErrNoTable || c == nil:
+		return nil, 0, err
+	}
+
+	// fallback to node when the update was not indexed or the storage
+	// table is disabled
+	prim, err := c.GetContractStorage(ctx, cc.Address, rpc.BlockLevel(op.Height))
+	if err != nil {
+		return nil, 0, err
+	}
+	buf, err := prim.MarshalBinary()
+	return buf, op.Height, err
+}
+
 func (m *Indexer) ListContractBigmaps(ctx context.Context, acc model.AccountID, height int64) ([]*model.BigmapAlloc, error) {
 	table, err := m.Table(model.BigmapAllocTableKey)
 	if err != nil {
@@ -0,0 +1,34 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"strings"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// LookupDomain returns the current state of a domain by name. Removed
+// domains are reported as not indexed.
+func (m *Indexer) LookupDomain(ctx context.Context, name string) (*model.Domain, error) {
+	table, err := m.Table(model.DomainTableKey)
+	if err != nil {
+		return nil, err
+	}
+	d := &model.Domain{}
+	err = pack.NewQuery("api.domain_by_name").
+		WithTable(table).
+		WithLimit(1).
+		AndEqual("name", strings.ToLower(name)).
+		Execute(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if d.RowId == 0 || !d.Owner.IsValid() {
+		return nil, model.ErrNoDomain
+	}
+	return d, nil
+}
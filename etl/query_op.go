@@ -33,6 +33,15 @@ func (m *Indexer) LookupOp(ctx context.Context, opIdent string, r ListRequest) (
 		if !oh.IsValid() {
 			return nil, model.ErrNoOp
 		}
+		if ops := m.viewOps(oh); ops != nil {
+			if r.Limit > 0 && uint(len(ops)) > r.Limit {
+				ops = ops[:r.Limit]
+			}
+			if r.WithStorage {
+				m.joinStorage(ctx, ops)
+			}
+			return ops, nil
+		}
 		q = q.AndEqual("hash", oh[:])
 	default:
 		// try parsing as event id
@@ -155,6 +164,13 @@ func (m *Indexer) ListBlockOps(ctx context.Context, r ListRequest) ([]*model.Op,
 	if r.Cursor > 0 {
 		r.Offset = 0
 	}
+	if v := m.viewByHeight(r.Since); v != nil && v.CanListOps(r) {
+		ops := v.ListOps(r)
+		if r.WithStorage {
+			m.joinStorage(ctx, ops)
+		}
+		return ops, nil
+	}
 	q := pack.NewQuery("api.list_block_ops").
 		WithTable(table).
 		WithOrder(r.Order).
@@ -211,6 +227,9 @@ func (m *Indexer) ListBlockEndorsements(ctx context.Context, r ListRequest) ([]*
 	if r.Cursor > 0 {
 		r.Offset = 0
 	}
+	if v := m.viewByHeight(r.Since); v != nil {
+		return v.ListEndorsements(r), nil
+	}
 
 	q := pack.NewQuery("api.list_block_endorse").
 		WithTable(table).
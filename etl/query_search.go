@@ -0,0 +1,85 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// searchIndexer is implemented by indexes that keep the search index current.
+type searchIndexer interface {
+	WithSearch(*cache.SearchIndex)
+}
+
+// SearchIndex returns the full-text search index which may not be built yet.
+// Callers that modify metadata tables directly must report changes here.
+func (m *Indexer) SearchIndex() *cache.SearchIndex {
+	return m.search
+}
+
+func (m *Indexer) getSearch(ctx context.Context) (*cache.SearchIndex, error) {
+	if m.search.IsBuilt() {
+		return m.search, nil
+	}
+	startTime := time.Now()
+	var meta, tokens *pack.Table
+	if t, err := m.Table(model.MetadataTableKey); err == nil {
+		meta = t
+	}
+	if t, err := m.Table(model.TokenMetaTableKey); err == nil {
+		tokens = t
+	}
+	if err := m.search.Build(ctx, meta, tokens); err != nil {
+		return nil, err
+	}
+	log.Infof("Search index with %d entries built in %s", m.search.Len(), time.Since(startTime))
+	return m.search, nil
+}
+
+// SearchText matches words against metadata names, domains, token names
+// and token symbols.
+func (m *Indexer) SearchText(ctx context.Context, q string, limit int) ([]cache.SearchMatch, error) {
+	idx, err := m.getSearch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Search(q, limit), nil
+}
+
+// SearchAddressPrefix returns on-chain addresses starting with prefix.
+func (m *Indexer) SearchAddressPrefix(ctx context.Context, prefix string, limit int) ([]mavryk.Address, error) {
+	addrs, err := m.getAddrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := addrs.FindPrefix(ctx, prefix, limit)
+	res := make([]mavryk.Address, len(ids))
+	for i, id := range ids {
+		res[i] = addrs.GetAddress(id)
+	}
+	return res, nil
+}
+
+// LookupTokens loads tokens by row id.
+func (m *Indexer) LookupTokens(ctx context.Context, ids []model.TokenID) ([]*model.Token, error) {
+	table, err := m.Table(model.TokenTableKey)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.Token, 0, len(ids))
+	err = pack.NewQuery("api.search.tokens").
+		WithTable(table).
+		AndIn("row_id", ids).
+		Execute(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
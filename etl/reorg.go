@@ -7,11 +7,131 @@ import (
 	"container/list"
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"blockwatch.cc/packdb/store"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
 )
 
+const maxReorgHistory = 64
+
+// reorgHistory is a small ring of recent reorgs, newest last. It holds the
+// same records that are written to the reorg table when the reorg index is
+// enabled.
+type reorgHistory struct {
+	sync.Mutex
+	events []model.Reorg
+	notify chan struct{} // closed on each new event
+}
+
+func (h *reorgHistory) add(e model.Reorg) {
+	h.Lock()
+	defer h.Unlock()
+	if len(h.events) >= maxReorgHistory {
+		copy(h.events, h.events[1:])
+		h.events = h.events[:len(h.events)-1]
+	}
+	h.events = append(h.events, e)
+	if h.notify != nil {
+		close(h.notify)
+		h.notify = nil
+	}
+}
+
+func (h *reorgHistory) wait() <-chan struct{} {
+	h.Lock()
+	defer h.Unlock()
+	if h.notify == nil {
+		h.notify = make(chan struct{})
+	}
+	return h.notify
+}
+
+func (h *reorgHistory) list() []model.Reorg {
+	h.Lock()
+	defer h.Unlock()
+	res := make([]model.Reorg, len(h.events))
+	copy(res, h.events)
+	return res
+}
+
+// Reorgs returns recent reorgs since process start, newest last.
+func (c *Crawler) Reorgs() []model.Reorg {
+	return c.reorgs.list()
+}
+
+// ReorgNotify returns a channel that is closed when the next reorg completes.
+// Callers must take it before reading reorgs so that a reorg stored in
+// between is not missed.
+func (c *Crawler) ReorgNotify() <-chan struct{} {
+	return c.reorgs.wait()
+}
+
+// storeReorg writes a reorg and its reverted ops when the reorg index is
+// enabled.
+func (m *Indexer) storeReorg(ctx context.Context, r *model.Reorg, ops []*model.ReorgOp) error {
+	for _, idx := range m.indexes {
+		if v, ok := idx.(*index.ReorgIndex); ok {
+			return v.Store(ctx, r, ops)
+		}
+	}
+	return nil
+}
+
+// collectOrphanOps appends operations of a detached block to list. Implicit
+// events, internal results and consensus operations are skipped since they
+// are never re-included as-is on another branch.
+func (c *Crawler) collectOrphanOps(block *model.Block, list []*model.ReorgOp, seen map[mavryk.OpHash]struct{}) []*model.ReorgOp {
+	for _, op := range block.Ops {
+		if op.IsEvent || op.IsInternal || !op.Hash.IsValid() {
+			continue
+		}
+		switch op.Type {
+		case model.OpTypeEndorsement, model.OpTypePreendorsement:
+			continue
+		}
+		if _, ok := seen[op.Hash]; ok {
+			continue
+		}
+		seen[op.Hash] = struct{}{}
+		rop := &model.ReorgOp{
+			Hash:   op.Hash,
+			Height: block.Height,
+			OpN:    op.OpN,
+			Type:   op.Type,
+			Volume: op.Volume,
+		}
+		if acc, ok := c.builder.AccountById(op.SenderId); ok {
+			rop.Sender = acc.Address
+		}
+		list = append(list, rop)
+	}
+	return list
+}
+
+// revertedOps returns orphaned ops that were neither included on the attached
+// branch nor in the new best block.
+func revertedOps(orphans []*model.ReorgOp, included map[mavryk.OpHash]struct{}, best *rpc.Block) []*model.ReorgOp {
+	if best != nil {
+		for _, list := range best.Operations {
+			for _, op := range list {
+				included[op.Hash] = struct{}{}
+			}
+		}
+	}
+	reverted := orphans[:0]
+	for _, op := range orphans {
+		if _, ok := included[op.Hash]; !ok {
+			reverted = append(reverted, op)
+		}
+	}
+	return reverted
+}
+
 func (c *Crawler) Rollback(ctx context.Context, height int64, ignoreErrors bool) error {
 	tip := c.Tip()
 
@@ -78,6 +198,11 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 	// Disconnect all of the blocks back to the fork point.
 	tip := c.Tip()
 
+	// track ops from orphaned blocks and ops included on the new branch
+	orphans := make([]*model.ReorgOp, 0)
+	orphanSeen := make(map[mavryk.OpHash]struct{})
+	included := make(map[mavryk.OpHash]struct{})
+
 	log.Infof("REORGANIZE: %d blocks to detach, %d blocks to attach.",
 		detach.Len(), attach.Len())
 
@@ -117,6 +242,7 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 			if pid > 0 {
 				block.ParentId = pid
 			}
+			orphans = c.collectOrphanOps(block, orphans, orphanSeen)
 
 			// update indexes to rollback block
 
@@ -201,6 +327,9 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 		if pid > 0 {
 			block.ParentId = pid
 		}
+		for _, op := range block.Ops {
+			included[op.Hash] = struct{}{}
+		}
 
 		if err := ctx.Err(); err != nil {
 			return err
@@ -270,6 +399,39 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 	log.Infof("REORGANIZE: completed successfully at %s (height %d).",
 		tip.BestHash, tip.BestHeight)
 
+	r := &model.Reorg{
+		Time:         time.Now().UTC(),
+		Depth:        detach.Len(),
+		Attached:     attach.Len(),
+		FormerHeight: formerBest.Height,
+		FormerHash:   formerBest.Hash,
+		NewHeight:    tip.BestHeight,
+		NewHash:      tip.BestHash,
+		IsRollback:   rollbackOnly,
+	}
+	if forkBlock != nil {
+		r.ForkHeight = forkBlock.Height
+		r.ForkHash = forkBlock.Hash
+	}
+
+	// the new best block is connected by the caller after the reorg, so it
+	// defines the new head and its ops count as included
+	var best *rpc.Block
+	if !rollbackOnly {
+		r.NewHeight = newBest.Height
+		r.NewHash = newBest.Hash
+		if newBest.MV != nil {
+			best = newBest.MV.Block
+		}
+	}
+	reverted := revertedOps(orphans, included, best)
+	r.NReverted = len(reverted)
+	if err := c.indexer.storeReorg(ctx, r, reverted); err != nil {
+		// the chain is consistent at this point, only history is lost
+		log.Errorf("REORGANIZE: storing reorg history: %v", err)
+	}
+	c.reorgs.add(*r)
+
 	return nil
 }
 
@@ -0,0 +1,39 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+// TestRevertedOpsSingleBlock covers a 1-block reorg where nothing is attached
+// and the orphaned op is re-included in the new best block.
+func TestRevertedOpsSingleBlock(t *testing.T) {
+	var (
+		kept    = mavryk.NewOpHash(bytes.Repeat([]byte{1}, 32))
+		dropped = mavryk.NewOpHash(bytes.Repeat([]byte{2}, 32))
+	)
+	orphans := []*model.ReorgOp{
+		{Hash: kept, Height: 100},
+		{Hash: dropped, Height: 100},
+	}
+	best := &rpc.Block{}
+	best.Operations[3] = []*rpc.Operation{{Hash: kept}}
+
+	reverted := revertedOps(orphans, make(map[mavryk.OpHash]struct{}), best)
+	if len(reverted) != 1 || reverted[0].Hash != dropped {
+		t.Fatalf("got %d reverted ops, want only %s", len(reverted), dropped)
+	}
+
+	// without a best block (rollback) all orphans are reverted
+	orphans = []*model.ReorgOp{{Hash: kept}, {Hash: dropped}}
+	if n := len(revertedOps(orphans, make(map[mavryk.OpHash]struct{}), nil)); n != 2 {
+		t.Errorf("got %d reverted ops on rollback, want 2", n)
+	}
+}
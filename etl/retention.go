@@ -0,0 +1,260 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/store"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// number of blocks deleted per prune query
+const retentionBatchSize = 1 << 12
+
+// retentionTables lists history tables that support pruning by block height.
+// Aggregated tables like accounts, contracts, chain, supply and income are
+// never pruned. Tables with group fields keep the most recent row per group
+// below the prune height so that state lookups and bigmap history replays at
+// later blocks remain correct. Rows the decoder does not assign to a group
+// are kept.
+var retentionTables = []struct {
+	Key    string
+	Height string
+	Group  []string
+	Decode func(pack.Row) (id uint64, group any, height int64, ok bool, err error)
+}{
+	{model.OpTableKey, "height", nil, nil},
+	{model.EndorseOpTableKey, "height", nil, nil},
+	{model.FlowTableKey, "height", nil, nil},
+	{model.EventTableKey, "height", nil, nil},
+	{model.TokenEventTableKey, "height", nil, nil},
+	{model.TicketEventTableKey, "height", nil, nil},
+	{model.TicketUpdateTableKey, "height", nil, nil},
+	{model.BalanceTableKey, "valid_from", []string{"account_id"}, func(r pack.Row) (uint64, any, int64, bool, error) {
+		var b model.Balance
+		err := r.Decode(&b)
+		return b.RowId, b.AccountId, b.ValidFrom, true, err
+	}},
+	{model.StorageTableKey, "height", []string{"account_id"}, func(r pack.Row) (uint64, any, int64, bool, error) {
+		var s model.Storage
+		err := r.Decode(&s)
+		return s.RowId.U64(), s.AccountId, s.Height, true, err
+	}},
+	// key_id is a hash that may collide across bigmaps, group by bigmap and
+	// key hash instead; alloc and copy rows describe the bigmap itself and
+	// copy rows store the source bigmap id in key_id, so they are never pruned
+	{model.BigmapUpdateTableKey, "height", []string{"bigmap_id", "action", "key"}, func(r pack.Row) (uint64, any, int64, bool, error) {
+		var u model.BigmapUpdate
+		if err := r.Decode(&u); err != nil {
+			return 0, nil, 0, false, err
+		}
+		switch {
+		case u.Action != micheline.DiffActionUpdate && u.Action != micheline.DiffActionRemove:
+			return u.RowId, nil, u.Height, false, nil
+		case len(u.Key) == 0:
+			// bigmap removal
+			return u.RowId, nil, u.Height, false, nil
+		}
+		return u.RowId, bigmapKey{u.BigmapId, u.GetKeyHash()}, u.Height, true, nil
+	}},
+}
+
+type bigmapKey struct {
+	id   int64
+	hash mavryk.ExprHash
+}
+
+// RetentionTables returns the names of all tables that support pruning.
+func RetentionTables() []string {
+	keys := make([]string, len(retentionTables))
+	for i, v := range retentionTables {
+		keys[i] = v.Key
+	}
+	return keys
+}
+
+// PrunedHeight returns the first block height that is still available in
+// table key or zero when history was never pruned.
+func (m *Indexer) PrunedHeight(key string) int64 {
+	tips, _ := m.pruned.Load().(map[string]PruneTip)
+	return tips[key].Height
+}
+
+func (m *Indexer) setPruned(key string, tip PruneTip) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, _ := m.pruned.Load().(map[string]PruneTip)
+	tips := make(map[string]PruneTip, len(old)+1)
+	for n, v := range old {
+		tips[n] = v
+	}
+	tips[key] = tip
+	m.pruned.Store(tips)
+}
+
+func (m *Indexer) loadPruned() error {
+	return m.statedb.View(func(dbTx store.Tx) error {
+		tips, err := dbLoadPruneTips(dbTx)
+		if err != nil {
+			return err
+		}
+		m.pruned.Store(tips)
+		return nil
+	})
+}
+
+// MaybePrune starts a background job that removes history beyond the
+// configured retention from all tables once per cycle. It is a no-op when
+// no retention is configured or a previous job is still running.
+func (m *Indexer) MaybePrune(ctx context.Context, block *model.Block) {
+	if len(m.retention) == 0 || block.Cycle == m.pruneCycle {
+		return
+	}
+	if !m.pruning.CompareAndSwap(false, true) {
+		return
+	}
+	m.pruneCycle = block.Cycle
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.pruning.Store(false)
+		m.prune(ctx, block.Cycle)
+	}()
+}
+
+func (m *Indexer) prune(ctx context.Context, cycle int64) {
+	// continue from the last completed prune in case a previous job failed
+	var done map[string]PruneTip
+	err := m.statedb.View(func(dbTx store.Tx) error {
+		var err error
+		done, err = dbLoadPruneTips(dbTx)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Loading prune heights: %v", err)
+		return
+	}
+	for _, v := range retentionTables {
+		n := m.retention[v.Key]
+		if n <= 0 {
+			continue
+		}
+		table, ok := m.tables[v.Key]
+		if !ok {
+			continue
+		}
+		first := cycle - n + 1
+		if first <= 0 {
+			continue
+		}
+		params := m.ParamsByCycle(first)
+		if params == nil {
+			continue
+		}
+		height := params.CycleStartHeight(first)
+		from := done[v.Key].Height
+		if height <= from {
+			continue
+		}
+
+		// publish the new boundary first so that the API rejects requests
+		// for partially deleted history
+		m.setPruned(v.Key, PruneTip{Height: height, Cycle: first})
+
+		start := time.Now()
+		var (
+			count int64
+			err   error
+		)
+		if len(v.Group) > 0 {
+			count, err = m.pruneLatest(ctx, table, v.Height, v.Group, height, v.Decode)
+		} else {
+			count, err = m.pruneRange(ctx, table, v.Height, from, height)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("Pruning %s table: %v", v.Key, err)
+			}
+			return
+		}
+
+		err = m.statedb.Update(func(dbTx store.Tx) error {
+			return dbStorePruneTip(dbTx, v.Key, PruneTip{Height: height, Cycle: first})
+		})
+		if err != nil {
+			log.Errorf("Storing %s prune height: %v", v.Key, err)
+			return
+		}
+		log.Infof("Pruned %d rows before block %d (cycle %d) from %s table in %s.",
+			count, height, first, v.Key, time.Since(start))
+	}
+}
+
+// pruneRange deletes all rows in [from, to) in batches so that concurrent
+// block inserts are not blocked for long.
+func (m *Indexer) pruneRange(ctx context.Context, table *pack.Table, col string, from, to int64) (int64, error) {
+	var count int64
+	for from < to {
+		end := min(from+retentionBatchSize, to)
+		n, err := pack.NewQuery("etl.prune").
+			WithTable(table).
+			AndRange(col, from, end-1).
+			Delete(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += n
+		from = end
+	}
+	return count, nil
+}
+
+// pruneLatest deletes all rows below height except the most recent row
+// per group.
+func (m *Indexer) pruneLatest(ctx context.Context, table *pack.Table, col string, group []string, height int64, decode func(pack.Row) (uint64, any, int64, bool, error)) (int64, error) {
+	type latest struct {
+		id     uint64
+		height int64
+	}
+	var (
+		keep = make(map[any]latest)
+		ids  = make([]uint64, 0)
+	)
+	fields := append([]string{"row_id", col}, group...)
+	err := pack.NewQuery("etl.prune").
+		WithTable(table).
+		WithFields(fields...).
+		AndLt(col, height).
+		Stream(ctx, func(r pack.Row) error {
+			id, key, h, ok, err := decode(r)
+			if err != nil || !ok {
+				return err
+			}
+			prev, ok := keep[key]
+			switch {
+			case !ok:
+				keep[key] = latest{id, h}
+			case h >= prev.height:
+				ids = append(ids, prev.id)
+				keep[key] = latest{id, h}
+			default:
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(ids); i += retentionBatchSize {
+		if err := table.DeleteIds(ctx, ids[i:min(i+retentionBatchSize, len(ids))]); err != nil {
+			return int64(i), err
+		}
+	}
+	return int64(len(ids)), nil
+}
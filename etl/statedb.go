@@ -6,6 +6,7 @@ package etl
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"blockwatch.cc/packdb/store"
@@ -27,6 +28,12 @@ var (
 
 	// deploymentsBucketName is the name of the bucket holding protocol deployment parameters.
 	deploymentsBucketName = []byte("deployments")
+
+	// retentionBucketName is the name of the bucket holding table prune heights.
+	retentionBucketName = []byte("retention")
+
+	// auditBucketName is the name of the bucket holding cycle-end supply audits.
+	auditBucketName = []byte("supply_audits")
 )
 
 func dbLoadChainTip(dbTx store.Tx) (*model.ChainTip, error) {
@@ -104,6 +111,13 @@ func dbLoadDeployments(dbTx store.Tx, tip *model.ChainTip) ([]*rpc.Params, error
 		if err := json.Unmarshal(buf, p); err != nil {
 			return nil, err
 		}
+		// deployments stored before gas limits were tracked
+		if p.HardGasLimitPerOperation == 0 {
+			p.HardGasLimitPerOperation = mavryk.DefaultParams.HardGasLimitPerOperation
+		}
+		if p.HardGasLimitPerBlock == 0 {
+			p.HardGasLimitPerBlock = mavryk.DefaultParams.HardGasLimitPerBlock
+		}
 		plist = append(plist, p)
 	}
 	return plist, nil
@@ -118,3 +132,71 @@ func dbStoreDeployment(dbTx store.Tx, p *rpc.Params) error {
 	bucket.FillPercent(1.0)
 	return bucket.Put(p.Protocol[:], buf)
 }
+
+// PruneTip records the first block height that is still available in a
+// table after history was pruned.
+type PruneTip struct {
+	Height int64 `json:"height"`
+	Cycle  int64 `json:"cycle"`
+}
+
+func dbLoadPruneTips(dbTx store.Tx) (map[string]PruneTip, error) {
+	tips := make(map[string]PruneTip)
+	b := dbTx.Bucket(retentionBucketName)
+	if b == nil {
+		return tips, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		var tip PruneTip
+		if err := json.Unmarshal(v, &tip); err != nil {
+			return err
+		}
+		tips[string(k)] = tip
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tips, nil
+}
+
+func dbStorePruneTip(dbTx store.Tx, key string, tip PruneTip) error {
+	buf, err := json.Marshal(tip)
+	if err != nil {
+		return err
+	}
+	b, err := dbTx.Root().CreateBucketIfNotExists(retentionBucketName)
+	if err != nil {
+		return err
+	}
+	b.FillPercent(1.0)
+	return b.Put([]byte(key), buf)
+}
+
+func dbLoadSupplyAudit(dbTx store.Tx, cycle int64) (*SupplyAudit, error) {
+	b := dbTx.Bucket(auditBucketName)
+	if b == nil {
+		return nil, nil
+	}
+	buf := b.Get([]byte(strconv.FormatInt(cycle, 10)))
+	if buf == nil {
+		return nil, nil
+	}
+	audit := &SupplyAudit{}
+	if err := json.Unmarshal(buf, audit); err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
+
+func dbStoreSupplyAudit(dbTx store.Tx, audit *SupplyAudit) error {
+	buf, err := json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	b, err := dbTx.Root().CreateBucketIfNotExists(auditBucketName)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(strconv.FormatInt(audit.Cycle, 10)), buf)
+}
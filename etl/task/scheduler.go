@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"blockwatch.cc/packdb/pack"
@@ -33,6 +34,25 @@ type Scheduler struct {
 	taskLimiter   *time.Ticker
 	table         *pack.Table
 	client        *client.Client
+
+	// lifetime counters
+	nSuccess   atomic.Int64
+	nFailed    atomic.Int64
+	nTimeout   atomic.Int64
+	nDelivered atomic.Int64
+}
+
+type SchedulerStats struct {
+	MaxTasks   int   `json:"max_tasks"`
+	Idle       int   `json:"idle"`
+	Running    int   `json:"running"`
+	Pending    int   `json:"pending"` // complete, but not yet delivered
+	Success    int64 `json:"success"`
+	Failed     int64 `json:"failed"`
+	Timeout    int64 `json:"timeout"`
+	Delivered  int64 `json:"delivered"`
+	Inflight   int   `json:"inflight"`
+	RetryAfter int64 `json:"retry_interval"` // ms
 }
 
 func NewScheduler() *Scheduler {
@@ -162,6 +182,38 @@ func (s *Scheduler) Run(req TaskRequest) error {
 	return s.table.Insert(s.ctx, &req)
 }
 
+// Stats returns current task queue sizes from the task table and lifetime
+// completion counters.
+func (s *Scheduler) Stats(ctx context.Context) (SchedulerStats, error) {
+	stats := SchedulerStats{
+		MaxTasks:   s.maxTasks,
+		Success:    s.nSuccess.Load(),
+		Failed:     s.nFailed.Load(),
+		Timeout:    s.nTimeout.Load(),
+		Delivered:  s.nDelivered.Load(),
+		Inflight:   s.maxTasks - len(s.taskq),
+		RetryAfter: s.retryInterval.Milliseconds(),
+	}
+	for _, v := range []struct {
+		n    *int
+		stat []TaskStatus
+	}{
+		{&stats.Idle, []TaskStatus{TaskStatusIdle}},
+		{&stats.Running, []TaskStatus{TaskStatusRunning}},
+		{&stats.Pending, []TaskStatus{TaskStatusSuccess, TaskStatusFailed, TaskStatusTimeout}},
+	} {
+		n, err := pack.NewQuery("task_stats").
+			WithTable(s.table).
+			AndIn("status", v.stat).
+			Count(ctx)
+		if err != nil {
+			return stats, err
+		}
+		*v.n = int(n)
+	}
+	return stats, nil
+}
+
 func (s *Scheduler) execute(r TaskRequest) error {
 	// hard-limit number of running async tasks
 	select {
@@ -285,14 +337,18 @@ func (s *Scheduler) fetch(r TaskRequest) TaskRequest {
 		switch {
 		case errors.Is(err, client.ErrNetwork), errors.Is(err, client.ErrPermanent):
 			r.Status = TaskStatusFailed
+			s.nFailed.Add(1)
 		case errors.Is(err, client.ErrTimeout):
 			r.Status = TaskStatusTimeout
+			s.nTimeout.Add(1)
 		default:
 			r.Status = TaskStatusFailed
+			s.nFailed.Add(1)
 		}
 	} else {
 		r.Status = TaskStatusSuccess
 		r.Data = buf
+		s.nSuccess.Add(1)
 	}
 	return r
 }
@@ -333,6 +389,7 @@ func (s *Scheduler) tryDeliver(r TaskRequest) error {
 		if err != nil {
 			return err
 		}
+		s.nDelivered.Add(1)
 	}
 	return nil
 }
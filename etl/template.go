@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/echa/config"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// ContractTemplate identifies a well-known contract family. A contract matches
+// when its code or interface hash is listed or when it implements all listed
+// interfaces and entrypoints.
+type ContractTemplate struct {
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	CodeHashes  []uint64 `json:"-"`
+	IfaceHashes []uint64 `json:"-"`
+	Interfaces  []string `json:"interfaces,omitempty"`
+	Entrypoints []string `json:"entrypoints,omitempty"`
+}
+
+var defaultTemplates = []ContractTemplate{
+	{
+		Name:       "FA1.2 Token",
+		Kind:       "fa1.2",
+		Interfaces: []string{string(micheline.ITzip7)},
+	},
+	{
+		Name:       "FA2 Token",
+		Kind:       "fa2",
+		Interfaces: []string{string(micheline.ITzip12)},
+	},
+	{
+		Name:        "Liquidity Baking DEX",
+		Kind:        "dex",
+		Entrypoints: []string{"addLiquidity", "removeLiquidity", "tokenToXtz", "xtzToToken"},
+	},
+	{
+		Name:        "Quipuswap DEX",
+		Kind:        "dex",
+		Entrypoints: []string{"tezToTokenPayment", "tokenToTezPayment", "investLiquidity", "divestLiquidity"},
+	},
+}
+
+var (
+	templateMu sync.RWMutex
+	templates  = defaultTemplates
+)
+
+// LoadContractTemplates appends user-defined templates from config key
+// `contract.templates` to the built-in list.
+func LoadContractTemplates() error {
+	config.SetDefault("contract.templates", []interface{}{})
+	list := make([]ContractTemplate, len(defaultTemplates))
+	copy(list, defaultTemplates)
+	err := config.ForEach("contract.templates", func(c *config.Config) error {
+		t := ContractTemplate{
+			Name:        c.GetString("name"),
+			Kind:        c.GetString("kind"),
+			Interfaces:  c.GetStringSlice("interfaces"),
+			Entrypoints: c.GetStringSlice("entrypoints"),
+		}
+		for _, v := range c.GetStringSlice("code_hashes") {
+			h, err := strconv.ParseUint(v, 16, 64)
+			if err != nil {
+				return fmt.Errorf("template %s: invalid code hash %q: %w", t.Name, v, err)
+			}
+			t.CodeHashes = append(t.CodeHashes, h)
+		}
+		for _, v := range c.GetStringSlice("iface_hashes") {
+			h, err := strconv.ParseUint(v, 16, 64)
+			if err != nil {
+				return fmt.Errorf("template %s: invalid interface hash %q: %w", t.Name, v, err)
+			}
+			t.IfaceHashes = append(t.IfaceHashes, h)
+		}
+		if t.Name == "" {
+			return fmt.Errorf("template: missing name")
+		}
+		if len(t.CodeHashes)+len(t.IfaceHashes)+len(t.Interfaces)+len(t.Entrypoints) == 0 {
+			return fmt.Errorf("template %s: missing match criteria", t.Name)
+		}
+		list = append(list, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	templateMu.Lock()
+	templates = list
+	templateMu.Unlock()
+	return nil
+}
+
+// ListContractTemplates returns all registered templates.
+func ListContractTemplates() []ContractTemplate {
+	templateMu.RLock()
+	defer templateMu.RUnlock()
+	return templates
+}
+
+// Matches reports whether contract c belongs to template t.
+func (t ContractTemplate) Matches(c *model.Contract) bool {
+	for _, h := range t.CodeHashes {
+		if h == c.CodeHash {
+			return true
+		}
+	}
+	for _, h := range t.IfaceHashes {
+		if h == c.InterfaceHash {
+			return true
+		}
+	}
+	if len(t.Interfaces)+len(t.Entrypoints) == 0 {
+		return false
+	}
+	for _, v := range t.Interfaces {
+		if !c.Interfaces.Contains(micheline.Interface(v)) {
+			return false
+		}
+	}
+	if len(t.Entrypoints) > 0 {
+		pTyp, _, err := c.LoadType()
+		if err != nil {
+			return false
+		}
+		eps, err := pTyp.Entrypoints(false)
+		if err != nil {
+			return false
+		}
+		for _, v := range t.Entrypoints {
+			if _, ok := eps[v]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MatchContractTemplates returns all templates contract c belongs to.
+func MatchContractTemplates(c *model.Contract) []ContractTemplate {
+	res := make([]ContractTemplate, 0)
+	for _, t := range ListContractTemplates() {
+		if t.Matches(c) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// number of recent blocks served from memory
+const viewDepth = 64
+
+// BlockView is an immutable copy of the block and operation rows written
+// for a single block. Views of recent blocks are published after a block
+// has been fully written so that block lookups, operation lookups by hash
+// and block operation and endorsement lists near the chain head never wait
+// for table locks held by the indexer while it connects the next block or
+// flushes journals. All other reads, e.g. accounts, contracts, bigmaps,
+// tables and series, still use table locks until the database supports
+// versioned reads.
+//
+// Views are shared between concurrent requests. Callers receive copies of
+// rows and must not modify view contents.
+type BlockView struct {
+	Block   *model.Block
+	Ops     []*model.Op
+	Endorse []*model.Endorsement
+}
+
+// publishView reads rows written for block and atomically replaces the
+// set of recent views.
+func (m *Indexer) publishView(ctx context.Context, block *model.Block) error {
+	v := &BlockView{
+		Block: &model.Block{},
+	}
+	if table, ok := m.tables[model.BlockTableKey]; ok {
+		err := pack.NewQuery("etl.view").
+			WithTable(table).
+			AndEqual("height", block.Height).
+			Execute(ctx, v.Block)
+		if err != nil {
+			return err
+		}
+		v.Block.Params = block.Params
+	}
+	if v.Block.RowId == 0 {
+		return nil
+	}
+	if table, ok := m.tables[model.OpTableKey]; ok {
+		err := pack.NewQuery("etl.view").
+			WithTable(table).
+			AndEqual("height", block.Height).
+			Execute(ctx, &v.Ops)
+		if err != nil {
+			return err
+		}
+	}
+	if table, ok := m.tables[model.EndorseOpTableKey]; ok {
+		err := pack.NewQuery("etl.view").
+			WithTable(table).
+			AndEqual("height", block.Height).
+			Execute(ctx, &v.Endorse)
+		if err != nil {
+			return err
+		}
+	}
+
+	old := m.views()
+	views := make([]*BlockView, 0, viewDepth)
+	for _, w := range old {
+		if w.Block.Height < block.Height && w.Block.Height > block.Height-viewDepth {
+			views = append(views, w)
+		}
+	}
+	m.view.Store(append(views, v))
+	return nil
+}
+
+// dropViews removes views at and above height, e.g. on reorg.
+func (m *Indexer) dropViews(height int64) {
+	old := m.views()
+	views := make([]*BlockView, 0, len(old))
+	for _, v := range old {
+		if v.Block.Height < height {
+			views = append(views, v)
+		}
+	}
+	m.view.Store(views)
+}
+
+func (m *Indexer) views() []*BlockView {
+	views, _ := m.view.Load().([]*BlockView)
+	return views
+}
+
+// ViewHeight returns the height of the most recent fully written block or
+// -1 when no view was published yet.
+func (m *Indexer) ViewHeight() int64 {
+	views := m.views()
+	if l := len(views); l > 0 {
+		return views[l-1].Block.Height
+	}
+	return -1
+}
+
+type tipHeightKey struct{}
+
+// WithTipHeight returns a context that resolves `head` to height, i.e. the
+// chain tip an API request saw when it started.
+func WithTipHeight(ctx context.Context, height int64) context.Context {
+	return context.WithValue(ctx, tipHeightKey{}, height)
+}
+
+// headHeight returns the visible tip height of ctx or the height of the most
+// recent fully written block.
+func (m *Indexer) headHeight(ctx context.Context) int64 {
+	if h, ok := ctx.Value(tipHeightKey{}).(int64); ok {
+		return h
+	}
+	if h := m.ViewHeight(); h >= 0 {
+		return h
+	}
+	return m.tips[model.BlockTableKey].Height
+}
+
+// viewByHeight returns the view of block at height or nil.
+func (m *Indexer) viewByHeight(height int64) *BlockView {
+	views := m.views()
+	if l := len(views); l == 0 || height < views[0].Block.Height || height > views[l-1].Block.Height {
+		return nil
+	}
+	for _, v := range views {
+		if v.Block.Height == height {
+			return v
+		}
+	}
+	return nil
+}
+
+// viewByHash returns the view of block with hash h or nil.
+func (m *Indexer) viewByHash(h mavryk.BlockHash) *BlockView {
+	views := m.views()
+	for i := len(views) - 1; i >= 0; i-- {
+		if views[i].Block.Hash == h {
+			return views[i]
+		}
+	}
+	return nil
+}
+
+// viewOps returns copies of recent operations matching hash.
+func (m *Indexer) viewOps(h mavryk.OpHash) []*model.Op {
+	views := m.views()
+	for i := len(views) - 1; i >= 0; i-- {
+		var ops []*model.Op
+		for _, op := range views[i].Ops {
+			if op.Hash == h {
+				c := *op
+				ops = append(ops, &c)
+			}
+		}
+		if len(ops) > 0 {
+			return ops
+		}
+	}
+	return nil
+}
+
+// CopyBlock returns a copy of the view's block.
+func (v *BlockView) CopyBlock() *model.Block {
+	b := *v.Block
+	return &b
+}
+
+// CanListOps returns true when the view supports the type filter of r. Type
+// filters support eq, in, ne and nin modes only, other lists must be read
+// from the table.
+func (v *BlockView) CanListOps(r ListRequest) bool {
+	if len(r.Typs) == 0 || !r.Mode.IsValid() {
+		return true
+	}
+	switch r.Mode {
+	case pack.FilterModeEqual, pack.FilterModeIn, pack.FilterModeNotEqual, pack.FilterModeNotIn:
+		return true
+	default:
+		return false
+	}
+}
+
+// ListOps applies block operation list filters to the view. Callers must
+// check CanListOps first.
+func (v *BlockView) ListOps(r ListRequest) []*model.Op {
+	ops := make([]*model.Op, 0)
+	n := len(v.Ops)
+	var skip uint
+	for i := 0; i < n; i++ {
+		op := v.Ops[i]
+		if r.Order == pack.OrderDesc {
+			op = v.Ops[n-i-1]
+		}
+		if r.SenderId > 0 && op.SenderId != r.SenderId {
+			continue
+		}
+		if r.ReceiverId > 0 && op.ReceiverId != r.ReceiverId {
+			continue
+		}
+		if a := r.Account; a != nil {
+			id := a.RowId
+			if op.SenderId != id && op.ReceiverId != id && op.BakerId != id && op.CreatorId != id {
+				continue
+			}
+		}
+		if r.Cursor > 0 {
+			opn := int(r.Cursor & 0xFFFF)
+			if r.Order == pack.OrderDesc && op.OpN >= opn || r.Order != pack.OrderDesc && op.OpN <= opn {
+				continue
+			}
+		}
+		if len(r.Typs) > 0 && r.Mode.IsValid() {
+			switch r.Mode {
+			case pack.FilterModeEqual, pack.FilterModeIn:
+				if !r.Typs.Contains(op.Type) {
+					continue
+				}
+			case pack.FilterModeNotEqual, pack.FilterModeNotIn:
+				if r.Typs.Contains(op.Type) {
+					continue
+				}
+			}
+		}
+		if skip < r.Offset {
+			skip++
+			continue
+		}
+		c := *op
+		ops = append(ops, &c)
+		if r.Limit > 0 && uint(len(ops)) >= r.Limit {
+			break
+		}
+	}
+	return ops
+}
+
+// ListEndorsements applies block endorsement list filters to the view.
+func (v *BlockView) ListEndorsements(r ListRequest) []*model.Endorsement {
+	eds := make([]*model.Endorsement, 0)
+	n := len(v.Endorse)
+	var skip uint
+	for i := 0; i < n; i++ {
+		ed := v.Endorse[i]
+		if r.Order == pack.OrderDesc {
+			ed = v.Endorse[n-i-1]
+		}
+		if r.SenderId > 0 && ed.SenderId != r.SenderId {
+			continue
+		}
+		if r.Account != nil && ed.SenderId != r.Account.RowId {
+			continue
+		}
+		if r.Cursor > 0 {
+			opn := int(r.Cursor & 0xFFFF)
+			if r.Order == pack.OrderDesc && ed.OpN >= opn || r.Order != pack.OrderDesc && ed.OpN <= opn {
+				continue
+			}
+		}
+		if skip < r.Offset {
+			skip++
+			continue
+		}
+		c := *ed
+		eds = append(eds, &c)
+		if r.Limit > 0 && uint(len(eds)) >= r.Limit {
+			break
+		}
+	}
+	return eds
+}
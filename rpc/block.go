@@ -5,6 +5,7 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -274,6 +275,21 @@ func (c *Client) GetBlock(ctx context.Context, id BlockID) (*Block, error) {
 	return &block, nil
 }
 
+// GetRawBlock returns a Tezos block together with the raw node response it
+// was decoded from.
+func (c *Client) GetRawBlock(ctx context.Context, id BlockID) (*Block, json.RawMessage, error) {
+	var raw json.RawMessage
+	u := fmt.Sprintf("chains/main/blocks/%s?metadata=always", id)
+	if err := c.Get(ctx, u, &raw); err != nil {
+		return nil, nil, err
+	}
+	var block Block
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return nil, nil, err
+	}
+	return &block, raw, nil
+}
+
 // GetBlockheader returns information about a Tezos block header
 // https://mavryk.gitlab.io/mainnet/api/rpc.html#get-block-header-id
 func (c *Client) GetBlockHeader(ctx context.Context, id BlockID) (*BlockHeader, error) {
@@ -330,7 +346,15 @@ func (c *Client) GetTipHeader(ctx context.Context) (*BlockHeader, error) {
 // Pulls storage from archive node and replaces storage embedded into originated scripts.
 // For implicit (block-level) originations generated by protocol upgrades we pull the
 // entire script. This is necessary because in script bigmap pointers are not replaced.
-func (b *Block) UpdateAllOriginatedScripts(ctx context.Context, c *Client) error {
+// ScriptSource resolves contract scripts and storage for origination receipts
+// that lack them. Client fetches from the node, ScriptStore can also replay
+// recorded responses.
+type ScriptSource interface {
+	GetContractScript(context.Context, mavryk.Address, BlockID) (*micheline.Script, error)
+	GetContractStorage(context.Context, mavryk.Address, BlockID) (micheline.Prim, error)
+}
+
+func (b *Block) UpdateAllOriginatedScripts(ctx context.Context, c ScriptSource) error {
 	// genesis block has no ops
 	if len(b.Operations[0]) == 0 {
 		return nil
@@ -366,7 +390,7 @@ func (b *Block) UpdateAllOriginatedScripts(ctx context.Context, c *Client) error
 	return b.UpdateHeaderOriginatedScripts(ctx, c)
 }
 
-func (b *Block) UpdateHeaderOriginatedScripts(ctx context.Context, c *Client) error {
+func (b *Block) UpdateHeaderOriginatedScripts(ctx context.Context, c ScriptSource) error {
 	// handle implicit block header results (i.e. liquidity baking)
 	for _, ires := range b.Metadata.ImplicitOperationsResults {
 		if ires.Kind != mavryk.OpTypeOrigination {
@@ -379,7 +403,7 @@ func (b *Block) UpdateHeaderOriginatedScripts(ctx context.Context, c *Client) er
 	return nil
 }
 
-func updateOriginationScript(ctx context.Context, c *Client, o TypedOperation, id BlockID) error {
+func updateOriginationScript(ctx context.Context, c ScriptSource, o TypedOperation, id BlockID) error {
 	org := o.(*Origination)
 	if org.Script == nil {
 		// skip early delegation accounts because they are script-less contracts
@@ -405,7 +429,7 @@ func updateOriginationScript(ctx context.Context, c *Client, o TypedOperation, i
 	return nil
 }
 
-func updateInternalOriginationScript(ctx context.Context, c *Client, iop *InternalResult, id BlockID) error {
+func updateInternalOriginationScript(ctx context.Context, c ScriptSource, iop *InternalResult, id BlockID) error {
 	if iop.Script == nil {
 		// skip early delegation accounts because they are script-less contracts
 		return nil
@@ -430,7 +454,7 @@ func updateInternalOriginationScript(ctx context.Context, c *Client, iop *Intern
 	return nil
 }
 
-func updateImplicitOriginationScript(ctx context.Context, c *Client, ires *ImplicitResult, id BlockID) error {
+func updateImplicitOriginationScript(ctx context.Context, c ScriptSource, ires *ImplicitResult, id BlockID) error {
 	addr := ires.OriginatedContracts[0]
 	script, err := c.GetContractScript(ctx, addr, id)
 	if err != nil {
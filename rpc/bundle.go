@@ -5,6 +5,7 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -18,7 +19,9 @@ type Bundle struct {
 	PrevEndorsing []EndorsingRight   // last block from previous cycle
 	Snapshot      *SnapshotIndex
 	SnapInfo      *SnapshotInfo
-	Issuance      []Issuance // future cycles where rights exist
+	Issuance      []Issuance      // future cycles where rights exist
+	Scripts       *ScriptStore    // scripts and storage fetched for originations
+	Raw           json.RawMessage `json:"-"` // raw node block response
 }
 
 func (b Bundle) IsValid() bool {
@@ -157,10 +160,11 @@ func (b Bundle) GetSnapshotIndex() int {
 
 func (c *Client) GetLightBundle(ctx context.Context, id BlockID, p *Params) (b *Bundle, err error) {
 	b = &Bundle{}
-	if b.Block, err = c.GetBlock(ctx, id); err != nil {
+	if b.Block, b.Raw, err = c.GetRawBlock(ctx, id); err != nil {
 		return
 	}
-	if err = b.Block.UpdateAllOriginatedScripts(ctx, c); err != nil {
+	b.Scripts = NewScriptStore(c)
+	if err = b.Block.UpdateAllOriginatedScripts(ctx, b.Scripts); err != nil {
 		return
 	}
 	if b.Height() > 0 && !b.Protocol().IsValid() {
@@ -13,6 +13,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -28,8 +29,14 @@ const (
 type Client struct {
 	// HTTP client used to communicate with the Tezos node API.
 	client *http.Client
-	// Base URL for API requests.
-	baseURL *url.URL
+	// Node endpoints for API requests, requests go to the active endpoint.
+	endpoints []*endpoint
+	active    int
+	mu        sync.Mutex
+	// Interval between endpoint health checks.
+	healthInterval time.Duration
+	// Max blocks the active endpoint may lag behind the best endpoint.
+	maxLag int64
 	// User agent name for client.
 	userAgent string
 	// Optional API key for protected endpoints
@@ -46,29 +53,34 @@ type Client struct {
 
 // NewClient returns a new Tezos RPC client.
 func NewClient(baseURL string, httpClient *http.Client) (*Client, error) {
+	return NewClientWithEndpoints([]string{baseURL}, httpClient)
+}
+
+// NewClientWithEndpoints returns a new Tezos RPC client that routes requests
+// to the healthiest of several nodes and fails over on errors. Call
+// StartHealthCheck to enable periodic health checks.
+func NewClientWithEndpoints(urls []string, httpClient *http.Client) (*Client, error) {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	if !strings.HasPrefix(baseURL, "http") {
-		baseURL = "http://" + baseURL
-	}
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, err
-	}
-	q := u.Query()
-	key := q.Get("X-Api-Key")
-	if key != "" {
-		q.Del("X-Api-Key")
-		u.RawQuery = q.Encode()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("rpc: missing endpoint url")
 	}
 	c := &Client{
-		client:     httpClient,
-		baseURL:    u,
-		userAgent:  userAgent,
-		apiKey:     key,
-		numRetries: 3,
-		retryDelay: time.Second,
+		client:         httpClient,
+		endpoints:      make([]*endpoint, 0, len(urls)),
+		healthInterval: defaultHealthInterval,
+		maxLag:         defaultMaxLag,
+		userAgent:      userAgent,
+		numRetries:     3,
+		retryDelay:     time.Second,
+	}
+	for _, v := range urls {
+		e, err := parseEndpoint(v)
+		if err != nil {
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, e)
 	}
 	return c, nil
 }
@@ -136,6 +148,15 @@ func (c *Client) Get(ctx context.Context, urlpath string, result interface{}) er
 	return c.Do(req, result)
 }
 
+// Post sends body as JSON and decodes the response into result.
+func (c *Client) Post(ctx context.Context, urlpath string, body, result interface{}) error {
+	req, err := c.NewRequest(ctx, http.MethodPost, urlpath, body)
+	if err != nil {
+		return err
+	}
+	return c.Do(req, result)
+}
+
 func (c *Client) GetAsync(ctx context.Context, urlpath string, mon Monitor) error {
 	req, err := c.NewRequest(ctx, http.MethodGet, urlpath, nil)
 	if err != nil {
@@ -144,14 +165,18 @@ func (c *Client) GetAsync(ctx context.Context, urlpath string, mon Monitor) erro
 	return c.DoAsync(req, mon)
 }
 
-// NewRequest creates a Tezos RPC request.
+// NewRequest creates a Tezos RPC request for the active endpoint.
 func (c *Client) NewRequest(ctx context.Context, method, urlStr string, body interface{}) (*http.Request, error) {
+	return c.newRequest(ctx, c.endpoint(), method, urlStr, body)
+}
+
+func (c *Client) newRequest(ctx context.Context, e *endpoint, method, urlStr string, body interface{}) (*http.Request, error) {
 	rel, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, err
 	}
 
-	u := c.baseURL.ResolveReference(rel)
+	u := e.url.ResolveReference(rel)
 
 	buf := new(bytes.Buffer)
 	if body != nil {
@@ -170,8 +195,8 @@ func (c *Client) NewRequest(ctx context.Context, method, urlStr string, body int
 	req.Header.Add("Content-Type", mediaType)
 	req.Header.Add("Accept", mediaType)
 	req.Header.Add("User-Agent", c.userAgent)
-	if c.apiKey != "" {
-		req.Header.Add("X-Api-Key", c.apiKey)
+	if key := c.keyFor(e); key != "" {
+		req.Header.Add("X-Api-Key", key)
 	}
 
 	log.Debug(newLogClosure(func() string {
@@ -230,11 +255,16 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 		resp *http.Response
 		err  error
 	)
+	e := c.endpointFor(req)
 	for retries := c.numRetries + 1; retries > 0; retries-- {
 		resp, err = c.client.Do(req)
 		if err == nil && resp != nil && resp.StatusCode <= 500 {
 			break
 		}
+		// a cancelled or timed out request says nothing about node health
+		if err != nil && isContextError(req, err) {
+			return err
+		}
 		retryable := isNetError(err) || (resp != nil && resp.StatusCode > 500)
 		if err != nil && !retryable {
 			log.Warnf("rpc: %T %v", err, err)
@@ -244,11 +274,32 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 			resp.Body.Close()
 			resp = nil
 		}
+		// move to another node before retrying
+		if e != nil && len(c.endpoints) > 1 {
+			cause := err
+			if cause == nil {
+				cause = fmt.Errorf("rpc: status %d", resp.StatusCode)
+			}
+			if next := c.failover(e, cause); next != e {
+				if r, rerr := c.rebase(req, e, next); rerr == nil {
+					if err := req.Context().Err(); err != nil {
+						return err
+					}
+					req, e = r, next
+					continue
+				}
+			}
+		}
 		select {
 		case <-req.Context().Done():
 			return req.Context().Err()
 		case <-time.After(c.retryDelay):
-			// continue
+			// rewind request body before retry
+			if req.GetBody != nil {
+				if body, err := req.GetBody(); err == nil {
+					req.Body = body
+				}
+			}
 		}
 	}
 	if err != nil {
@@ -289,6 +340,16 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 	return handleError(resp)
 }
 
+// endpointFor returns the pool endpoint a request was created for.
+func (c *Client) endpointFor(req *http.Request) *endpoint {
+	for _, e := range c.endpoints {
+		if e.url.Host == req.URL.Host && strings.HasPrefix(req.URL.Path, e.url.Path) {
+			return e
+		}
+	}
+	return nil
+}
+
 // DoAsync retrieves values from the API and sends responses using the provided monitor.
 func (c *Client) DoAsync(req *http.Request, mon Monitor) error {
 	//nolint:bodyclose
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCancelKeepsEndpointHealthy(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	var srvs [2]*httptest.Server
+	for i := range srvs {
+		srvs[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-block:
+			case <-r.Context().Done():
+			}
+		}))
+		defer srvs[i].Close()
+	}
+	c, err := NewClientWithEndpoints([]string{srvs[0].URL, srvs[1].URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.retryDelay = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Get(ctx, "chains/main/blocks/head/header", nil); err == nil {
+		t.Fatal("expected error for cancelled request")
+	}
+	for _, e := range c.Endpoints() {
+		if !e.Healthy {
+			t.Errorf("endpoint %s marked unhealthy by cancelled request", e.URL)
+		}
+	}
+	if !c.Endpoints()[0].Active {
+		t.Errorf("active endpoint switched by cancelled request")
+	}
+}
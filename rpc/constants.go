@@ -236,6 +236,8 @@ func (c Constants) Params() *Params {
 	p.LimitOfDelegationOverBaking = c.LimitOfDelegationOverBaking
 	p.GlobalLimitOfStakingOverBaking = c.GlobalLimitOfStakingOverBaking
 	p.MaxSlashingPeriod = c.MaxSlashingPeriod
+	p.HardGasLimitPerOperation = c.HardGasLimitPerOperation
+	p.HardGasLimitPerBlock = c.HardGasLimitPerBlock
 
 	// voting
 	p.MinProposalQuorum = c.MinProposalQuorum
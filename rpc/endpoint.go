@@ -0,0 +1,392 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultMaxLag         = 2
+)
+
+// endpoint is a single node in a client's endpoint pool.
+type endpoint struct {
+	url    *url.URL
+	apiKey string
+
+	mu       sync.Mutex
+	healthy  bool
+	level    int64
+	latency  time.Duration
+	version  string
+	checked  time.Time
+	failures int
+	err      error
+}
+
+func parseEndpoint(s string) (*endpoint, error) {
+	if !strings.HasPrefix(s, "http") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	key := q.Get("X-Api-Key")
+	if key != "" {
+		q.Del("X-Api-Key")
+		u.RawQuery = q.Encode()
+	}
+	return &endpoint{
+		url:     u,
+		apiKey:  key,
+		healthy: true, // until proven otherwise
+	}, nil
+}
+
+func (e *endpoint) fail(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.healthy = false
+	e.failures++
+	e.err = err
+}
+
+// EndpointStatus describes health of a node in the endpoint pool.
+type EndpointStatus struct {
+	URL       string        `json:"url"`
+	Active    bool          `json:"active"`
+	Healthy   bool          `json:"healthy"`
+	Level     int64         `json:"level"`
+	Lag       int64         `json:"lag"`
+	Latency   time.Duration `json:"latency"`
+	Version   string        `json:"version"`
+	LastCheck time.Time     `json:"last_check"`
+	Failures  int           `json:"failures"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Endpoints returns health information for all configured nodes.
+func (c *Client) Endpoints() []EndpointStatus {
+	active := c.endpoint()
+	var best int64
+	res := make([]EndpointStatus, len(c.endpoints))
+	for i, e := range c.endpoints {
+		e.mu.Lock()
+		res[i] = EndpointStatus{
+			URL:       e.url.Redacted(),
+			Active:    e == active,
+			Healthy:   e.healthy,
+			Level:     e.level,
+			Latency:   e.latency,
+			Version:   e.version,
+			LastCheck: e.checked,
+			Failures:  e.failures,
+		}
+		if e.err != nil {
+			res[i].Error = e.err.Error()
+		}
+		e.mu.Unlock()
+		best = max(best, res[i].Level)
+	}
+	for i := range res {
+		res[i].Lag = best - res[i].Level
+	}
+	return res
+}
+
+// WithHealthCheck sets the interval between health checks and the max number
+// of blocks a node may lag behind the best node before requests move away.
+func (c *Client) WithHealthCheck(interval time.Duration, maxLag int64) *Client {
+	if interval > 0 {
+		c.healthInterval = interval
+	}
+	if maxLag > 0 {
+		c.maxLag = maxLag
+	}
+	return c
+}
+
+// StartHealthCheck periodically checks all endpoints until ctx is done.
+// It is a noop for single-endpoint clients.
+func (c *Client) StartHealthCheck(ctx context.Context) {
+	if len(c.endpoints) < 2 {
+		return
+	}
+	go func() {
+		c.checkEndpoints(ctx)
+		ticker := time.NewTicker(c.healthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.checkEndpoints(ctx)
+			}
+		}
+	}()
+}
+
+// checkEndpoints verifies chain id, head level and version of all nodes
+// in parallel, then routes requests to the best node.
+func (c *Client) checkEndpoints(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range c.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			c.checkEndpoint(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+	c.selectEndpoint()
+}
+
+func (c *Client) checkEndpoint(ctx context.Context, e *endpoint) {
+	ctx, cancel := context.WithTimeout(ctx, c.healthInterval)
+	defer cancel()
+	start := time.Now()
+	var (
+		id   mavryk.ChainIdHash
+		head BlockHeader
+		ver  VersionInfo
+	)
+	err := c.getFrom(ctx, e, "chains/main/chain_id", &id)
+	if err == nil && c.chainId.IsValid() && !c.chainId.Equal(id) {
+		err = fmt.Errorf("chain id mismatch %s", id)
+	}
+	if err == nil {
+		err = c.getFrom(ctx, e, "chains/main/blocks/head/header", &head)
+	}
+	if err == nil {
+		err = c.getFrom(ctx, e, "version", &ver)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.checked = time.Now()
+	e.err = err
+	if err != nil {
+		if e.healthy {
+			log.Warnf("rpc: endpoint %s unhealthy: %v", e.url.Redacted(), err)
+		}
+		e.healthy = false
+		e.failures++
+		return
+	}
+	if !e.healthy {
+		log.Infof("rpc: endpoint %s healthy again at level %d", e.url.Redacted(), head.Level)
+	}
+	e.healthy = true
+	e.level = head.Level
+	e.latency = time.Since(start) / 3
+	e.version = fmt.Sprintf("%d.%d", ver.NodeVersion.Major, ver.NodeVersion.Minor)
+}
+
+// getFrom sends a single request to endpoint e without retry or failover.
+func (c *Client) getFrom(ctx context.Context, e *endpoint, urlpath string, result interface{}) error {
+	req, err := c.newRequest(ctx, e, http.MethodGet, urlpath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return handleError(resp)
+	}
+	return c.handleResponse(resp, result)
+}
+
+// selectEndpoint keeps the active node while it is healthy and in sync,
+// otherwise switches to the healthy node with the highest level and lowest
+// latency.
+func (c *Client) selectEndpoint() *endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best int64
+	for _, e := range c.endpoints {
+		e.mu.Lock()
+		if e.healthy {
+			best = max(best, e.level)
+		}
+		e.mu.Unlock()
+	}
+	cur := c.endpoints[c.active]
+	cur.mu.Lock()
+	ok := cur.healthy && best-cur.level <= c.maxLag
+	cur.mu.Unlock()
+	if ok {
+		return cur
+	}
+	next := -1
+	var (
+		nextLevel   int64
+		nextLatency time.Duration
+	)
+	for i, e := range c.endpoints {
+		e.mu.Lock()
+		better := e.healthy && (next < 0 || e.level > nextLevel ||
+			(e.level == nextLevel && e.latency < nextLatency))
+		if better {
+			next, nextLevel, nextLatency = i, e.level, e.latency
+		}
+		e.mu.Unlock()
+	}
+	if next < 0 {
+		// all unhealthy, try the next one in order
+		next = (c.active + 1) % len(c.endpoints)
+	}
+	if next != c.active {
+		log.Infof("rpc: switching endpoint %s -> %s",
+			cur.url.Redacted(), c.endpoints[next].url.Redacted())
+		c.active = next
+	}
+	return c.endpoints[c.active]
+}
+
+// endpoint returns the currently active node.
+func (c *Client) endpoint() *endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.active]
+}
+
+// failover marks e as failed and returns the next node to use.
+func (c *Client) failover(e *endpoint, err error) *endpoint {
+	e.fail(err)
+	if len(c.endpoints) < 2 {
+		return e
+	}
+	return c.selectEndpoint()
+}
+
+// rebase moves a request to another endpoint.
+func (c *Client) rebase(req *http.Request, from, to *endpoint) (*http.Request, error) {
+	base := from.url.ResolveReference(&url.URL{Path: "."})
+	rel := strings.TrimPrefix(req.URL.String(), base.String())
+	r, err := url.Parse(rel)
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.URL = to.url.ResolveReference(r)
+	next.Host = next.URL.Host
+	next.Header.Del("X-Api-Key")
+	if key := c.keyFor(to); key != "" {
+		next.Header.Add("X-Api-Key", key)
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
+
+func (c *Client) keyFor(e *endpoint) string {
+	if e.apiKey != "" {
+		return e.apiKey
+	}
+	return c.apiKey
+}
+
+// monitorBlockHeader relays heads from the active node into monitor and
+// reconnects to another node on stream errors. Heads missed while switching
+// are fetched by level so that no block is lost.
+func (c *Client) monitorBlockHeader(ctx context.Context, monitor *BlockHeaderMonitor) error {
+	e := c.endpoint()
+	inner := NewBlockHeaderMonitor()
+	if err := c.getAsyncFrom(ctx, e, "monitor/heads/main", inner); err != nil {
+		c.failover(e, err)
+		return err
+	}
+
+	// stop the node stream when the caller closes the monitor
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-monitor.Closed():
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	go func() {
+		defer cancel()
+		var last int64
+		for {
+			head, err := inner.Recv(ctx)
+			if err == nil {
+				if last > 0 && head.Level > last+1 {
+					if err = c.backfillHeads(ctx, monitor, last+1, head.Level-1); err != nil {
+						monitor.Err(err)
+						return
+					}
+				}
+				last = max(last, head.Level)
+				monitor.Send(ctx, head)
+				continue
+			}
+			inner.Close()
+			if ctx.Err() != nil {
+				monitor.Close()
+				return
+			}
+
+			// reconnect, trying each node at most once
+			log.Warnf("rpc: monitor on %s failed: %v", e.url.Redacted(), err)
+			for range c.endpoints {
+				e = c.failover(e, err)
+				inner = NewBlockHeaderMonitor()
+				if err = c.getAsyncFrom(ctx, e, "monitor/heads/main", inner); err == nil {
+					log.Infof("rpc: monitor reconnected to %s", e.url.Redacted())
+					break
+				}
+			}
+			if err != nil {
+				monitor.Err(err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// backfillHeads sends heads for levels [from, to] to monitor. The header RPC
+// returns the same fields as the monitor stream.
+func (c *Client) backfillHeads(ctx context.Context, monitor *BlockHeaderMonitor, from, to int64) error {
+	for l := from; l <= to; l++ {
+		head := &BlockHeaderLogEntry{}
+		u := fmt.Sprintf("chains/main/blocks/%d/header", l)
+		if err := c.Get(ctx, u, head); err != nil {
+			return err
+		}
+		monitor.Send(ctx, head)
+	}
+	return nil
+}
+
+func (c *Client) getAsyncFrom(ctx context.Context, e *endpoint, urlpath string, mon Monitor) error {
+	req, err := c.newRequest(ctx, e, http.MethodGet, urlpath, nil)
+	if err != nil {
+		return err
+	}
+	return c.DoAsync(req, mon)
+}
@@ -4,9 +4,11 @@
 package rpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 )
@@ -170,6 +172,14 @@ var (
 	_ RPCError = &rpcError{}
 )
 
+// isContextError returns true when a request failed because its context was
+// cancelled or its deadline expired.
+func isContextError(req *http.Request, err error) bool {
+	return req.Context().Err() != nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
 func isNetError(err error) bool {
 	if err == nil {
 		return false
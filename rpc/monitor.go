@@ -203,7 +203,13 @@ func (m *MempoolMonitor) Closed() <-chan struct{} {
 }
 
 // MonitorBlockHeader reads from the chain heads stream http://mavryk.gitlab.io/mainnet/api/rpc.html#get-monitor-heads-chain-id
+//
+// With multiple endpoints the stream reconnects to another node on error and
+// fetches heads missed in between.
 func (c *Client) MonitorBlockHeader(ctx context.Context, monitor *BlockHeaderMonitor) error {
+	if len(c.endpoints) > 1 {
+		return c.monitorBlockHeader(ctx, monitor)
+	}
 	return c.GetAsync(ctx, "monitor/heads/main", monitor)
 }
 
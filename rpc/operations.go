@@ -228,6 +228,11 @@ func (e Manager) Limits() mavryk.Limits {
 	}
 }
 
+// Sender returns the manager operation source.
+func (e Manager) Sender() mavryk.Address {
+	return e.Source
+}
+
 // Addresses adds all addresses used in this operation to the set.
 // Implements TypedOperation interface.
 func (e Manager) Addresses(set *mavryk.AddressSet) {
@@ -60,6 +60,8 @@ type Params struct {
 	LimitOfDelegationOverBaking    int64 `json:"limit_of_delegation_over_baking,omitempty"`     // v18+
 	GlobalLimitOfStakingOverBaking int64 `json:"global_limit_of_staking_over_baking,omitempty"` // v18+
 	MaxSlashingPeriod              int64 `json:"max_slashing_period,omitempty"`
+	HardGasLimitPerOperation       int64 `json:"hard_gas_limit_per_operation,omitempty"`
+	HardGasLimitPerBlock           int64 `json:"hard_gas_limit_per_block,omitempty"`
 
 	// voting
 	BlocksPerVotingPeriod int64 `json:"blocks_per_voting_period,omitempty"`
@@ -70,6 +70,16 @@ func (s ActiveStake) Value() int64 {
 	return s.Frozen + s.Delegated + s.Combined
 }
 
+// MarshalJSON keeps the pre-v18 single integer format so that values
+// round-trip through UnmarshalJSON.
+func (s ActiveStake) MarshalJSON() ([]byte, error) {
+	if s.Combined != 0 {
+		return []byte(strconv.Quote(strconv.FormatInt(s.Combined, 10))), nil
+	}
+	type alias ActiveStake
+	return json.Marshal(alias(s))
+}
+
 func (s *ActiveStake) UnmarshalJSON(data []byte) error {
 	if len(data) == 0 {
 		return nil
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+// ScriptStore records raw node responses for contract scripts and storage
+// fetched while completing origination receipts of a block. A store without
+// client replays recorded responses so that archived blocks decode exactly
+// as they did when fetched.
+type ScriptStore struct {
+	Scripts map[string]json.RawMessage `json:"scripts,omitempty"`
+	Storage map[string]json.RawMessage `json:"storage,omitempty"`
+	client  *Client
+}
+
+func NewScriptStore(c *Client) *ScriptStore {
+	return &ScriptStore{
+		Scripts: make(map[string]json.RawMessage),
+		Storage: make(map[string]json.RawMessage),
+		client:  c,
+	}
+}
+
+func (s *ScriptStore) IsEmpty() bool {
+	return s == nil || len(s.Scripts)+len(s.Storage) == 0
+}
+
+func (s *ScriptStore) GetContractScript(ctx context.Context, addr mavryk.Address, id BlockID) (*micheline.Script, error) {
+	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/script", id, addr)
+	buf, err := s.get(ctx, s.Scripts, u, addr)
+	if err != nil {
+		return nil, err
+	}
+	script := micheline.NewScript()
+	if err := json.Unmarshal(buf, script); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+func (s *ScriptStore) GetContractStorage(ctx context.Context, addr mavryk.Address, id BlockID) (micheline.Prim, error) {
+	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/storage", id, addr)
+	buf, err := s.get(ctx, s.Storage, u, addr)
+	if err != nil {
+		return micheline.InvalidPrim, err
+	}
+	prim := micheline.Prim{}
+	if err := json.Unmarshal(buf, &prim); err != nil {
+		return micheline.InvalidPrim, err
+	}
+	return prim, nil
+}
+
+func (s *ScriptStore) get(ctx context.Context, m map[string]json.RawMessage, u string, addr mavryk.Address) (json.RawMessage, error) {
+	key := addr.String()
+	if s.client == nil {
+		buf, ok := m[key]
+		if !ok {
+			return nil, fmt.Errorf("rpc: no recorded response for %s", u)
+		}
+		return buf, nil
+	}
+	var buf json.RawMessage
+	if err := s.client.Get(ctx, u, &buf); err != nil {
+		return nil, err
+	}
+	m[key] = buf
+	return buf, nil
+}
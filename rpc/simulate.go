@@ -0,0 +1,58 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mavryk-network/mvgo/codec"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+// SimulationRequest is the request body of run_operation and simulate_operation.
+type SimulationRequest struct {
+	Operation *codec.Op          `json:"operation"`
+	ChainId   mavryk.ChainIdHash `json:"chain_id"`
+	Latency   int64              `json:"latency,omitempty"` // simulate_operation only
+}
+
+// RunOperation executes an operation in the context of block id without
+// checking its signature and returns the receipt. The operation is not
+// injected.
+func (c *Client) RunOperation(ctx context.Context, id BlockID, o *codec.Op) (*Operation, error) {
+	u := fmt.Sprintf("chains/main/blocks/%s/helpers/scripts/run_operation", id)
+	return c.simulate(ctx, u, o, 0)
+}
+
+// SimulateOperation executes an operation in the context of a future block
+// latency blocks after head and returns the receipt. The operation is not
+// injected.
+func (c *Client) SimulateOperation(ctx context.Context, o *codec.Op, latency int64) (*Operation, error) {
+	u := fmt.Sprintf("chains/main/blocks/%s/helpers/scripts/simulate_operation", Head)
+	return c.simulate(ctx, u, o, latency)
+}
+
+func (c *Client) simulate(ctx context.Context, u string, o *codec.Op, latency int64) (*Operation, error) {
+	sim := &codec.Op{
+		Branch:    o.Branch,
+		Contents:  o.Contents,
+		Signature: o.Signature,
+		Params:    o.Params,
+	}
+	// the node requires a signature, but does not check it
+	if !sim.Signature.IsValid() {
+		sim.Signature = mavryk.ZeroSignature
+	}
+	req := SimulationRequest{
+		Operation: sim,
+		ChainId:   c.chainId,
+		Latency:   latency,
+	}
+	var op Operation
+	if err := c.Post(ctx, u, req, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
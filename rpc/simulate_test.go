@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mavryk-network/mvgo/codec"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+var (
+	simSource = mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{1}, 20))
+	simTarget = mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{2}, 20))
+)
+
+// simulation request body as sent to the node
+type simBody struct {
+	Operation struct {
+		Branch    string            `json:"branch"`
+		Contents  []json.RawMessage `json:"contents"`
+		Signature string            `json:"signature"`
+	} `json:"operation"`
+	ChainId string `json:"chain_id"`
+	Latency *int64 `json:"latency"`
+}
+
+func simReceipt() string {
+	return fmt.Sprintf(`{"contents":[{"kind":"transaction","source":%q,"fee":"400","counter":"7","gas_limit":"2000","storage_limit":"0","amount":"1000000","destination":%q,"metadata":{"operation_result":{"status":"applied","consumed_milligas":"1000000"}}}]}`,
+		simSource, simTarget)
+}
+
+// simServer records request bodies and fails the first fail requests with 503.
+func simServer(t *testing.T, path string, fail int) (*httptest.Server, *[][]byte) {
+	bodies := make([][]byte, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		if r.URL.Path != path {
+			t.Errorf("unexpected path %s, want %s", r.URL.Path, path)
+		}
+		buf, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, buf)
+		if len(bodies) <= fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, simReceipt())
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func simClient(t *testing.T, url string, retries int) *Client {
+	c, err := NewClient(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.WithChainId(mavryk.Mainnet).WithRetry(retries, time.Millisecond)
+}
+
+func TestSimulateOperation(t *testing.T) {
+	srv, bodies := simServer(t, "/chains/main/blocks/head/helpers/scripts/simulate_operation", 1)
+	c := simClient(t, srv.URL, 1)
+	op := codec.NewOp().WithSource(simSource).WithTransfer(simTarget, 1000000)
+
+	rcpt, err := c.SimulateOperation(context.Background(), op, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Signature.IsValid() {
+		t.Errorf("operation signature modified")
+	}
+	if len(rcpt.Contents) != 1 || rcpt.Contents[0].Kind() != mavryk.OpTypeTransaction {
+		t.Fatalf("unexpected receipt contents %v", rcpt.Contents)
+	}
+	if !rcpt.Contents[0].Result().IsSuccess() {
+		t.Errorf("unexpected receipt status %s", rcpt.Contents[0].Result().Status)
+	}
+
+	// the retry must send the same body
+	if len(*bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*bodies))
+	}
+	if len((*bodies)[1]) == 0 || !bytes.Equal((*bodies)[0], (*bodies)[1]) {
+		t.Errorf("retry body mismatch:\n%s\n%s", (*bodies)[0], (*bodies)[1])
+	}
+
+	var req simBody
+	if err := json.Unmarshal((*bodies)[1], &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ChainId != mavryk.Mainnet.String() {
+		t.Errorf("chain_id %q, want %q", req.ChainId, mavryk.Mainnet)
+	}
+	if req.Latency == nil || *req.Latency != 2 {
+		t.Errorf("latency %v, want 2", req.Latency)
+	}
+	if req.Operation.Signature != mavryk.ZeroSignature.String() {
+		t.Errorf("signature %q, want zero signature", req.Operation.Signature)
+	}
+	if req.Operation.Branch != op.Branch.String() {
+		t.Errorf("branch %q, want %q", req.Operation.Branch, op.Branch)
+	}
+	if len(req.Operation.Contents) != 1 {
+		t.Fatalf("got %d contents, want 1", len(req.Operation.Contents))
+	}
+	var tx struct {
+		Kind        string `json:"kind"`
+		Destination string `json:"destination"`
+		Amount      string `json:"amount"`
+	}
+	if err := json.Unmarshal(req.Operation.Contents[0], &tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Kind != "transaction" || tx.Destination != simTarget.String() || tx.Amount != "1000000" {
+		t.Errorf("unexpected contents %s", req.Operation.Contents[0])
+	}
+}
+
+func TestRunOperation(t *testing.T) {
+	srv, bodies := simServer(t, "/chains/main/blocks/42/helpers/scripts/run_operation", 0)
+	c := simClient(t, srv.URL, 0)
+	sig := mavryk.NewSignature(mavryk.SignatureTypeEd25519, bytes.Repeat([]byte{3}, 64))
+	op := codec.NewOp().WithSource(simSource).WithTransfer(simTarget, 1000000)
+	op.Signature = sig
+
+	if _, err := c.RunOperation(context.Background(), BlockLevel(42), op); err != nil {
+		t.Fatal(err)
+	}
+	if len(*bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*bodies))
+	}
+	var req simBody
+	if err := json.Unmarshal((*bodies)[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Latency != nil {
+		t.Errorf("unexpected latency %d", *req.Latency)
+	}
+	if req.Operation.Signature != sig.String() {
+		t.Errorf("signature %q, want %q", req.Operation.Signature, sig)
+	}
+}
+
+func TestSimulateOperationRetryExhausted(t *testing.T) {
+	srv, bodies := simServer(t, "/chains/main/blocks/head/helpers/scripts/simulate_operation", 3)
+	c := simClient(t, srv.URL, 1)
+	op := codec.NewOp().WithSource(simSource).WithTransfer(simTarget, 1)
+
+	_, err := c.SimulateOperation(context.Background(), op, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if s := ErrorStatus(err); s != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want %d", s, http.StatusServiceUnavailable)
+	}
+	if len(*bodies) != 2 {
+		t.Errorf("got %d requests, want 2", len(*bodies))
+	}
+}
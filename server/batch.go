@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// context key marking requests that run inline as part of a batch
+type batchKey struct{}
+
+// isSubrequest returns true when r is executed inside the worker slot of a
+// batch request.
+func isSubrequest(r *http.Request) bool {
+	_, ok := r.Context().Value(batchKey{}).(*Context)
+	return ok
+}
+
+// Subrequest executes a request through the API router without scheduling
+// it on the dispatcher. The handler runs synchronously inside the caller's
+// worker slot and shares its deadline. It returns the response status and
+// the response body which is a JSON encoded result or error.
+func (api *Context) Subrequest(n int, method, path, query string) (int, []byte) {
+	u := &url.URL{Path: path, RawQuery: query}
+	ctx := context.WithValue(api.Context, batchKey{}, api)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		e := EBadRequest(EC_BAD_URL_QUERY, "invalid request", err).(*Error)
+		return e.Status, e.Marshal()
+	}
+	req.RemoteAddr = api.Request.RemoteAddr
+	req.Header.Set("X-Real-Ip", api.RemoteIP.String())
+	req.Header.Set("X-Request-ID", api.RequestID+"-"+strconv.Itoa(n))
+
+	w := &bufferedResponse{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+	api.Server.router.ServeHTTP(w, req)
+	return w.status, w.buf.Bytes()
+}
+
+// bufferedResponse collects a sub-request response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponse) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	if status > 0 {
+		w.status = status
+	}
+}
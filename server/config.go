@@ -74,6 +74,7 @@ type HttpConfig struct {
 	Port                int           `json:"port"`
 	MaxWorkers          int           `json:"max_workers"`
 	MaxQueue            int           `json:"max_queue"`
+	MaxStreams          int           `json:"max_streams"`
 	TimeoutHeader       string        `json:"timeout_header"`
 	FailHeader          string        `json:"fail_header"`
 	DegradedHeader      string        `json:"degraded_header"`
@@ -88,6 +89,7 @@ type HttpConfig struct {
 	DefaultExploreCount uint          `json:"default_explore_count"`
 	MaxExploreCount     uint          `json:"max_explore_count"`
 	MaxSeriesDuration   time.Duration `json:"max_series_duration"`
+	MaxAggregateRows    uint          `json:"max_aggregate_rows"`
 	CorsEnable          bool          `json:"cors_enable"`
 	CorsOrigin          string        `json:"cors_origin"`
 	CorsAllowHeaders    string        `json:"cors_allow_headers"`
@@ -111,6 +113,7 @@ func NewHttpConfig() HttpConfig {
 		Port:                8000,
 		MaxWorkers:          50,
 		MaxQueue:            200,
+		MaxStreams:          16,
 		HeaderTimeout:       2 * time.Second,  // header timeout
 		ReadTimeout:         5 * time.Second,  // header+body timeout
 		WriteTimeout:        90 * time.Second, // response deadline
@@ -121,6 +124,7 @@ func NewHttpConfig() HttpConfig {
 		DefaultExploreCount: 20,
 		MaxExploreCount:     100,
 		MaxSeriesDuration:   90 * 24 * time.Hour,
+		MaxAggregateRows:    10000000,
 		CacheExpires:        15 * time.Second,
 		CacheMaxExpires:     24 * time.Hour,
 	}
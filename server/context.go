@@ -99,6 +99,12 @@ func NewContext(ctx context.Context, r *http.Request, w http.ResponseWriter, f A
 		requestId = "BW-" + <-idStream
 	}
 
+	// reads that resolve `head` see the tip the request started with
+	tip := srv.cfg.Crawler.Tip()
+	if tip != nil {
+		ctx = etl.WithTipHeight(ctx, tip.BestHeight)
+	}
+
 	return &Context{
 		Context:        ctx,
 		Now:            now,
@@ -109,7 +115,7 @@ func NewContext(ctx context.Context, r *http.Request, w http.ResponseWriter, f A
 		Crawler:        srv.cfg.Crawler,
 		Indexer:        srv.cfg.Indexer,
 		Client:         srv.cfg.Client,
-		Tip:            srv.cfg.Crawler.Tip(),
+		Tip:            tip,
 		Params:         srv.cfg.Crawler.Params(),
 		Request:        r,
 		ResponseWriter: w,
@@ -124,6 +130,7 @@ func NewContext(ctx context.Context, r *http.Request, w http.ResponseWriter, f A
 
 // GET/POST/PATCH/PATCH load data or fail
 func (api *Context) ParseRequestArgs(args interface{}) {
+	api.resolveDomainArgs()
 	r := api.Request
 	if r.Method == http.MethodGet {
 		if err := schemaDecoder.Decode(args, r.URL.Query()); err != nil {
@@ -152,6 +159,21 @@ func (api *Context) ParseRequestArgs(args interface{}) {
 	}
 }
 
+// CheckPruned fails requests for history that was removed from table by
+// the configured retention policy. Zero heights are ignored.
+func (api *Context) CheckPruned(table string, heights ...int64) {
+	first := api.Indexer.PrunedHeight(table)
+	for _, h := range heights {
+		if h > 0 && h < first {
+			panic(EGone(
+				EC_RESOURCE_PRUNED,
+				fmt.Sprintf("%s history before block %d has been pruned", table, first),
+				nil,
+			))
+		}
+	}
+}
+
 // this is executed in a goroutine per call, panics on error
 func (api *Context) serve() {
 	defer api.complete()
@@ -255,6 +277,9 @@ func (api *Context) jsonStack() ([]byte, error) {
 }
 
 func (api *Context) sendResponse() {
+	// all routes including streams and batch sub-requests respond here
+	defer api.recordLatency()
+
 	// skip when handler was streaming it's response
 	if api.isStreamed {
 		// return error response when connection is still alive
@@ -311,6 +336,10 @@ func (api *Context) RequestString() string {
 }
 
 func (api *Context) StreamResponseHeaders(status int, contentType string) {
+	// batch items are buffered and must return a single JSON result
+	if isSubrequest(api.Request) {
+		panic(EBadRequest(EC_PARAM_NOTEXPECTED, "streaming responses are not supported in batch requests", nil))
+	}
 	api.isStreamed = true
 	api.status = status
 	api.writeResponseHeaders(contentType, headerTrailer)
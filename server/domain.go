@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"strings"
+
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// query arguments that accept domain names in place of addresses
+var domainArgs = map[string]struct{}{
+	"address":  {},
+	"sender":   {},
+	"receiver": {},
+}
+
+// IsDomainName returns true when s looks like a domain name. Addresses
+// never contain dots.
+func IsDomainName(s string) bool {
+	return strings.Contains(s, ".") && !strings.HasPrefix(s, ".") && !strings.HasSuffix(s, ".")
+}
+
+// ResolveDomain returns the address a domain name points to. Removed,
+// expired and unassigned domains do not resolve.
+func (api *Context) ResolveDomain(name string) (*model.Domain, error) {
+	d, err := api.Indexer.LookupDomain(api, name)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Address.IsValid() || d.IsExpired(api.Tip.BestTime) {
+		return nil, model.ErrNoDomain
+	}
+	return d, nil
+}
+
+// resolveDomainArgs replaces domain names in address filter arguments by
+// their forward resolved address. Filter modes like sender.in are
+// supported on comma separated lists.
+func (api *Context) resolveDomainArgs() {
+	r := api.Request
+	if !strings.Contains(r.URL.RawQuery, ".") {
+		return
+	}
+	query := r.URL.Query()
+	var changed bool
+	for key, vals := range query {
+		prefix, _, _ := strings.Cut(key, ".")
+		if _, ok := domainArgs[prefix]; !ok {
+			continue
+		}
+		for i, val := range vals {
+			list := strings.Split(val, ",")
+			for k, v := range list {
+				if !IsDomainName(v) {
+					continue
+				}
+				d, err := api.ResolveDomain(v)
+				if err != nil {
+					panic(ENotFound(EC_RESOURCE_NOTFOUND, "no such domain '"+v+"'", err))
+				}
+				list[k] = d.Address.String()
+				changed = true
+			}
+			vals[i] = strings.Join(list, ",")
+		}
+	}
+	if changed {
+		r.URL.RawQuery = query.Encode()
+	}
+}
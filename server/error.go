@@ -70,6 +70,7 @@ const (
 	EC_RESOURCE_UPDATE_FAILED
 	EC_RESOURCE_DELETE_FAILED
 	EC_RESOURCE_STATE_UNEXPECTED
+	EC_RESOURCE_PRUNED
 )
 
 type Error struct {
@@ -256,9 +257,11 @@ var (
 	ENotAcceptable      = NewWrappedError(http.StatusNotAcceptable, "unsupported response type")
 	EBadMimetype        = NewWrappedError(http.StatusUnsupportedMediaType, "unsupported media type")
 	EConflict           = NewWrappedError(http.StatusConflict, "resource state conflict")
+	EGone               = NewWrappedError(http.StatusGone, "resource no longer available")
 	EInternal           = NewWrappedError(http.StatusInternalServerError, "internal server error")
 	ERequestTooLarge    = NewWrappedError(http.StatusRequestEntityTooLarge, "request size exceeds our limits")
 	ETooManyRequests    = NewWrappedError(http.StatusTooManyRequests, "request limit exceeded")
+	EBadGateway         = NewWrappedError(http.StatusBadGateway, "upstream request failed")
 	EServiceUnavailable = NewWrappedError(http.StatusServiceUnavailable, "service temporarily unavailable")
 	ENotImplemented     = NewWrappedError(http.StatusNotImplemented, "not implemented")
 	EConnectionClosed   = NewWrappedError(499, "connection closed")
@@ -250,6 +250,7 @@ func (b BakerList) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/{ident}/income/{cycle}", server.C(GetBakerIncome)).Methods("GET")
 	r.HandleFunc("/{ident}/rights/{cycle}", server.C(GetBakerRights)).Methods("GET")
 	r.HandleFunc("/{ident}/snapshot/{cycle}", server.C(GetBakerSnapshot)).Methods("GET")
+	r.HandleFunc("/{ident}/keys", server.C(ListBakerKeys)).Methods("GET")
 	r.HandleFunc("/{ident}/metadata", server.C(ReadMetadata)).Methods("GET")
 	return nil
 }
@@ -643,10 +644,19 @@ func ListBakerEndorsements(ctx *server.Context) (interface{}, int) {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read endorsements", err))
 	}
 
+	// keys change at cycle boundaries only
+	keys := make(map[int64]*mavryk.Address)
 	resp := make(OpList, 0)
 	cache := make(map[int64]interface{})
 	for _, v := range ops {
-		resp.Append(NewOp(ctx, v, nil, nil, args, cache), args.WithMerge())
+		key, ok := keys[v.Cycle]
+		if !ok {
+			key = consensusKeyAt(ctx, acc.RowId, v.Height)
+			keys[v.Cycle] = key
+		}
+		op := NewOp(ctx, v, nil, nil, args, cache)
+		op.ConsensusKey = key
+		resp.Append(op, args.WithMerge())
 	}
 	return resp, http.StatusOK
 }
@@ -695,15 +705,16 @@ func ListBakerDelegations(ctx *server.Context) (interface{}, int) {
 }
 
 type ExplorerRights struct {
-	Address  mavryk.Address `json:"address"`
-	Cycle    int64          `json:"cycle"`
-	Height   int64          `json:"start_height"`
-	Bake     string         `json:"baking_rights"`
-	Endorse  string         `json:"endorsing_rights"`
-	Baked    string         `json:"blocks_baked"`
-	Endorsed string         `json:"blocks_endorsed"`
-	Seed     string         `json:"seeds_required"`
-	Seeded   string         `json:"seeds_revealed"`
+	Address      mavryk.Address  `json:"address"`
+	ConsensusKey *mavryk.Address `json:"consensus_key,omitempty"`
+	Cycle        int64           `json:"cycle"`
+	Height       int64           `json:"start_height"`
+	Bake         string          `json:"baking_rights"`
+	Endorse      string          `json:"endorsing_rights"`
+	Baked        string          `json:"blocks_baked"`
+	Endorsed     string          `json:"blocks_endorsed"`
+	Seed         string          `json:"seeds_required"`
+	Seeded       string          `json:"seeds_revealed"`
 }
 
 func GetBakerRights(ctx *server.Context) (interface{}, int) {
@@ -728,15 +739,16 @@ func GetBakerRights(ctx *server.Context) (interface{}, int) {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no rights for cycle", nil))
 	}
 	resp := &ExplorerRights{
-		Address:  acc.Address,
-		Cycle:    cycle,
-		Height:   right.Height,
-		Bake:     right.Bake.String(),
-		Endorse:  right.Endorse.String(),
-		Baked:    right.Baked.String(),
-		Endorsed: right.Endorsed.String(),
-		Seed:     right.Seed.String(),
-		Seeded:   right.Seeded.String(),
+		Address:      acc.Address,
+		ConsensusKey: consensusKeyAt(ctx, acc.AccountId, right.Height),
+		Cycle:        cycle,
+		Height:       right.Height,
+		Bake:         right.Bake.String(),
+		Endorse:      right.Endorse.String(),
+		Baked:        right.Baked.String(),
+		Endorsed:     right.Endorsed.String(),
+		Seed:         right.Seed.String(),
+		Seeded:       right.Seeded.String(),
 	}
 	return resp, http.StatusOK
 }
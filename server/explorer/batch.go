@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// BatchItem is a single explorer lookup in a batch request.
+type BatchItem struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+}
+
+type BatchRequest []BatchItem
+
+func (r *BatchRequest) Parse(ctx *server.Context) {
+	n := uint(len(*r))
+	if n == 0 {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "empty batch", nil))
+	}
+	if max := ctx.Cfg.ClampList(n); n > max {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("batch size %d exceeds limit %d", n, max), nil))
+	}
+	for i, v := range *r {
+		if v.Method == "" {
+			v.Method = http.MethodGet
+		}
+		v.Method = strings.ToUpper(v.Method)
+		path, query, _ := strings.Cut(v.Path, "?")
+		if v.Query == "" {
+			v.Query = query
+		}
+		v.Path = path
+		(*r)[i] = v
+	}
+}
+
+// BatchResult is the response to a single batch item. Body contains the
+// JSON result on success or a server error response otherwise. Non-JSON
+// bodies are embedded as JSON string.
+type BatchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// RunBatch executes explorer lookups in order inside the worker slot of the
+// batch request and returns their results in the same order. Items fail
+// individually, the batch itself only fails on invalid input.
+func RunBatch(ctx *server.Context) (interface{}, int) {
+	args := BatchRequest{}
+	ctx.ParseRequestArgs(&args)
+	res := make([]BatchResult, len(args))
+	for i, v := range args {
+		var e *server.Error
+		switch {
+		case v.Method != http.MethodGet:
+			e = server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported method %s", v.Method), nil).(*server.Error)
+		case !strings.HasPrefix(v.Path, "/explorer/") || strings.HasPrefix(v.Path, "/explorer/batch"):
+			e = server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported path %s", v.Path), nil).(*server.Error)
+		default:
+			// batch results are embedded as JSON
+			if q, err := url.ParseQuery(v.Query); err != nil {
+				e = server.EBadRequest(server.EC_BAD_URL_QUERY, "invalid query", err).(*server.Error)
+			} else if f := q.Get("format"); f != "" && f != "json" {
+				e = server.EBadRequest(server.EC_PARAM_NOTEXPECTED, fmt.Sprintf("unsupported format %s in batch", f), nil).(*server.Error)
+			}
+		}
+		if e != nil {
+			res[i] = BatchResult{
+				Status: e.Status,
+				Body:   e.WithRequestId(ctx.RequestID).Marshal(),
+			}
+			continue
+		}
+		status, body := ctx.Subrequest(i, v.Method, v.Path, v.Query)
+		if len(body) > 0 && !json.Valid(body) {
+			// keep the batch valid when a handler returns non-JSON
+			body, _ = json.Marshal(string(body))
+		}
+		res[i] = BatchResult{
+			Status: status,
+			Body:   body,
+		}
+	}
+	return res, http.StatusOK
+}
@@ -235,6 +235,7 @@ func ReadBigmap(ctx *server.Context) (interface{}, int) {
 func ListBigmapKeys(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.BigmapUpdateTableKey, args.BlockHeight)
 	alloc := loadBigmap(ctx)
 
 	r := etl.ListRequest{
@@ -303,6 +304,7 @@ func ListBigmapKeys(ctx *server.Context) (interface{}, int) {
 func ListBigmapValues(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.BigmapUpdateTableKey, args.BlockHeight)
 	alloc := loadBigmap(ctx)
 
 	r := etl.ListRequest{
@@ -381,6 +383,7 @@ func ListBigmapValues(ctx *server.Context) (interface{}, int) {
 func ReadBigmapValue(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.BigmapUpdateTableKey, args.BlockHeight)
 
 	// support key and key_hash
 	alloc := loadBigmap(ctx)
@@ -455,6 +458,7 @@ func ReadBigmapValue(ctx *server.Context) (interface{}, int) {
 func ListBigmapUpdates(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.BigmapUpdateTableKey, args.SinceHeight, args.BlockHeight)
 	alloc := loadBigmap(ctx)
 	r := etl.ListRequest{
 		BigmapId: alloc.BigmapId,
@@ -592,6 +596,7 @@ func ListBigmapUpdates(ctx *server.Context) (interface{}, int) {
 func ListBigmapKeyUpdates(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.BigmapUpdateTableKey, args.SinceHeight, args.BlockHeight)
 
 	alloc := loadBigmap(ctx)
 	keyType, valType := alloc.GetKeyType(), alloc.GetValueType()
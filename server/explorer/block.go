@@ -6,6 +6,7 @@ package explorer
 import (
 	"net/http"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -85,6 +86,7 @@ type Right struct {
 	Type           mavryk.RightType `json:"type"`
 	AccountId      model.AccountID  `json:"-"`
 	Address        mavryk.Address   `json:"address"`
+	ConsensusKey   *mavryk.Address  `json:"consensus_key,omitempty"`
 	Round          *int             `json:"round,omitempty"`
 	IsUsed         *bool            `json:"is_used,omitempty"`
 	IsLost         *bool            `json:"is_lost,omitempty"`
@@ -199,14 +201,26 @@ func NewBlock(ctx *server.Context, block *model.Block, args server.Options) *Blo
 		if err != nil {
 			log.Errorf("explorer: cannot resolve rights for block %d: %v", block.Height, err)
 		} else {
+			keys, err := ctx.Indexer.ListActiveConsensusKeys(ctx.Context, block.Height)
+			if err != nil {
+				log.Errorf("explorer: cannot resolve consensus keys for block %d: %v", block.Height, err)
+			}
 			b.Rights = make([]Right, 0)
 			for _, v := range rights {
+				var r Right
 				switch v.Type {
 				case mavryk.RightTypeEndorsing:
-					b.Rights = append(b.Rights, NewRight(ctx, v, block.Height < ctx.Tip.BestHeight))
+					r = NewRight(ctx, v, block.Height < ctx.Tip.BestHeight)
 				case mavryk.RightTypeBaking:
-					b.Rights = append(b.Rights, NewRight(ctx, v, block.Height < ctx.Tip.BestHeight))
+					r = NewRight(ctx, v, block.Height < ctx.Tip.BestHeight)
+				default:
+					continue
+				}
+				if key, ok := keys[v.AccountId]; ok {
+					addr := key.Address()
+					r.ConsensusKey = &addr
 				}
+				b.Rights = append(b.Rights, r)
 			}
 		}
 	}
@@ -281,6 +295,10 @@ func loadBlock(ctx *server.Context) *model.Block {
 	if blockIdent, ok := mux.Vars(ctx.Request)["ident"]; !ok || blockIdent == "" {
 		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing block identifier", nil))
 	} else {
+		// head resolves to the tip visible when the request started
+		if blockIdent == "head" {
+			blockIdent = strconv.FormatInt(ctx.Tip.BestHeight, 10)
+		}
 		block, err := ctx.Indexer.LookupBlock(ctx, blockIdent)
 		if err != nil {
 			switch err {
@@ -335,6 +353,7 @@ func listBlockOps(ctx *server.Context) OpList {
 	args := &OpsRequest{}
 	ctx.ParseRequestArgs(args)
 	block := loadBlock(ctx)
+	ctx.CheckPruned(model.OpTableKey, block.Height)
 
 	// don't use offset/limit because we mix in endorsements
 	r := etl.ListRequest{
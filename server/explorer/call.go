@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type EntrypointStatsRequest struct {
+	ListRequest
+	Entrypoint string `schema:"entrypoint"` // name or id
+}
+
+// EntrypointStat is the daily call summary of a single contract entrypoint.
+type EntrypointStat struct {
+	RowId        uint64    `json:"row_id"`
+	Entrypoint   string    `json:"entrypoint"`
+	EntrypointId int       `json:"entrypoint_id"`
+	Time         time.Time `json:"time"`
+	FirstHeight  int64     `json:"first_height"`
+	LastHeight   int64     `json:"last_height"`
+	NCalls       int       `json:"n_calls"`
+	NSenders     int       `json:"n_senders"`
+	Volume       float64   `json:"volume"`
+	GasUsed      int64     `json:"gas_used"`
+	StorageBurn  float64   `json:"storage_burn"`
+}
+
+// ListEntrypointStats returns daily call statistics per entrypoint of a
+// contract ordered by day. Senders are distinct per day and entrypoint.
+func ListEntrypointStats(ctx *server.Context) (interface{}, int) {
+	args := &EntrypointStatsRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+
+	table, err := ctx.Indexer.Table(model.CallStatTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access call stats table", err))
+	}
+
+	names := cc.EntrypointNames()
+	q := pack.NewQuery("contract.entrypoint_stats").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("account_id", cc.AccountId)
+
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+
+	if args.Entrypoint != "" {
+		id, err := strconv.Atoi(args.Entrypoint)
+		if err != nil {
+			id = util.StringList(names).Index(args.Entrypoint)
+			if id < 0 {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unknown entrypoint %q", args.Entrypoint), nil))
+			}
+		}
+		q = q.AndEqual("entrypoint_id", id)
+	}
+
+	// filter by time condition
+	q = withTimeFilter(ctx, q)
+
+	list := make([]*model.CallStat, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list entrypoint stats", err))
+	}
+
+	params := ctx.Params
+	resp := make([]EntrypointStat, len(list))
+	for i, v := range list {
+		var name string
+		if v.Entrypoint >= 0 && v.Entrypoint < len(names) {
+			name = names[v.Entrypoint]
+		}
+		resp[i] = EntrypointStat{
+			RowId:        v.RowId,
+			Entrypoint:   name,
+			EntrypointId: v.Entrypoint,
+			Time:         v.Day,
+			FirstHeight:  v.FirstHeight,
+			LastHeight:   v.LastHeight,
+			NCalls:       v.NCalls,
+			NSenders:     v.NSenders,
+			Volume:       params.ConvertValue(v.Volume),
+			GasUsed:      v.GasUsed,
+			StorageBurn:  params.ConvertValue(v.StorageBurn),
+		}
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+var _ server.Resource = (*ContractCluster)(nil)
+
+// ContractCluster groups all contracts sharing a code or interface hash.
+type ContractCluster struct {
+	HashType      string                    `json:"hash_type"`
+	Hash          string                    `json:"hash"`
+	Count         int                       `json:"count"`
+	FirstContract string                    `json:"first_contract"`
+	FirstDeployer string                    `json:"first_deployer"`
+	FirstSeen     int64                     `json:"first_seen"`
+	FirstSeenTime time.Time                 `json:"first_seen_time"`
+	LastSeen      int64                     `json:"last_seen"`
+	LastSeenTime  time.Time                 `json:"last_seen_time"`
+	Templates     []ContractTemplate        `json:"templates"`
+	Deployments   []ClusterDeployments      `json:"deployments"`
+	Contracts     []ClusterMember           `json:"contracts"`
+	Metadata      map[string]*ShortMetadata `json:"metadata,omitempty"`
+
+	expires time.Time `json:"-"`
+}
+
+// ClusterDeployments counts deployments per UTC day.
+type ClusterDeployments struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type ClusterMember struct {
+	Address       string    `json:"address"`
+	Creator       string    `json:"creator"`
+	FirstSeen     int64     `json:"first_seen"`
+	FirstSeenTime time.Time `json:"first_seen_time"`
+	CodeHash      string    `json:"code_hash"`
+	InterfaceHash string    `json:"iface_hash"`
+}
+
+type ContractTemplate struct {
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	CodeHashes  []string `json:"code_hashes,omitempty"`
+	IfaceHashes []string `json:"iface_hashes,omitempty"`
+	Interfaces  []string `json:"interfaces,omitempty"`
+	Entrypoints []string `json:"entrypoints,omitempty"`
+}
+
+func NewContractTemplate(t etl.ContractTemplate) ContractTemplate {
+	ct := ContractTemplate{
+		Name:        t.Name,
+		Kind:        t.Kind,
+		Interfaces:  t.Interfaces,
+		Entrypoints: t.Entrypoints,
+	}
+	for _, v := range t.CodeHashes {
+		ct.CodeHashes = append(ct.CodeHashes, util.U64String(v).Hex())
+	}
+	for _, v := range t.IfaceHashes {
+		ct.IfaceHashes = append(ct.IfaceHashes, util.U64String(v).Hex())
+	}
+	return ct
+}
+
+func (c ContractCluster) LastModified() time.Time {
+	return c.LastSeenTime
+}
+
+func (c ContractCluster) Expires() time.Time {
+	return c.expires
+}
+
+type ClusterRequest struct {
+	ListRequest
+	By   string `schema:"by"`   // code (default), iface
+	Meta bool   `schema:"meta"` // include account metadata
+}
+
+func ReadSimilarContracts(ctx *server.Context) (interface{}, int) {
+	args := &ClusterRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+	switch args.By {
+	case "", "code":
+		return listContractCluster(ctx, args, cc.CodeHash, false, cc), http.StatusOK
+	case "iface":
+		return listContractCluster(ctx, args, cc.InterfaceHash, true, cc), http.StatusOK
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid hash type, use code or iface", nil))
+	}
+}
+
+func ListContractsByCodeHash(ctx *server.Context) (interface{}, int) {
+	args := &ClusterRequest{}
+	ctx.ParseRequestArgs(args)
+	return listContractCluster(ctx, args, parseContractHash(ctx), false, nil), http.StatusOK
+}
+
+func ListContractsByIfaceHash(ctx *server.Context) (interface{}, int) {
+	args := &ClusterRequest{}
+	ctx.ParseRequestArgs(args)
+	return listContractCluster(ctx, args, parseContractHash(ctx), true, nil), http.StatusOK
+}
+
+func ListContractTemplates(ctx *server.Context) (interface{}, int) {
+	list := etl.ListContractTemplates()
+	res := make([]ContractTemplate, len(list))
+	for i, v := range list {
+		res[i] = NewContractTemplate(v)
+	}
+	return res, http.StatusOK
+}
+
+func parseContractHash(ctx *server.Context) uint64 {
+	id, ok := mux.Vars(ctx.Request)["hash"]
+	if !ok || id == "" {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing hash", nil))
+	}
+	h, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid hash", err))
+	}
+	return h
+}
+
+// listContractCluster loads all cluster members and returns a paged list,
+// deployments are always reported over the full cluster. Templates are
+// matched against ref or the first deployed contract.
+func listContractCluster(ctx *server.Context, args *ClusterRequest, hash uint64, byIface bool, ref *model.Contract) *ContractCluster {
+	ccs, err := ctx.Indexer.ListSimilarContracts(ctx, hash, byIface)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list contracts", err))
+	}
+	if len(ccs) == 0 {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no contracts with this hash", nil))
+	}
+	res := &ContractCluster{
+		HashType:    "code",
+		Hash:        util.U64String(hash).Hex(),
+		Count:       len(ccs),
+		Templates:   make([]ContractTemplate, 0),
+		Deployments: make([]ClusterDeployments, 0),
+		expires:     ctx.Expires,
+	}
+	if byIface {
+		res.HashType = "iface"
+	}
+
+	// cluster stats, contracts are sorted by first seen
+	first, last := ccs[0], ccs[len(ccs)-1]
+	res.FirstContract = first.Address.String()
+	res.FirstDeployer = ctx.Indexer.LookupAddress(ctx, first.CreatorId).String()
+	heights := make([]int64, len(ccs))
+	for i, v := range ccs {
+		heights[i] = v.FirstSeen
+	}
+	times := ctx.Indexer.LookupBlockTimes(ctx.Context, heights)
+	res.FirstSeen = first.FirstSeen
+	res.FirstSeenTime = times[0]
+	res.LastSeen = last.FirstSeen
+	res.LastSeenTime = times[len(times)-1]
+	for i := range ccs {
+		day := times[i].Format("2006-01-02")
+		if n := len(res.Deployments); n > 0 && res.Deployments[n-1].Date == day {
+			res.Deployments[n-1].Count++
+		} else {
+			res.Deployments = append(res.Deployments, ClusterDeployments{Date: day, Count: 1})
+		}
+	}
+
+	// match templates, needs the full script
+	if ref == nil {
+		ref, err = ctx.Indexer.LookupContract(ctx, first.Address)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot load contract", err))
+		}
+	}
+	for _, v := range etl.MatchContractTemplates(ref) {
+		res.Templates = append(res.Templates, NewContractTemplate(v))
+	}
+
+	// page members
+	if args.Order == pack.OrderDesc {
+		for i, j := 0, len(ccs)-1; i < j; i, j = i+1, j-1 {
+			ccs[i], ccs[j] = ccs[j], ccs[i]
+			times[i], times[j] = times[j], times[i]
+		}
+	}
+	offset := min(int(args.Offset), len(ccs))
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	ccs = ccs[offset:min(offset+limit, len(ccs))]
+	times = times[offset : offset+len(ccs)]
+	res.Contracts = make([]ClusterMember, 0, len(ccs))
+	if args.Meta {
+		res.Metadata = make(map[string]*ShortMetadata)
+	}
+	for i, v := range ccs {
+		m := ClusterMember{
+			Address:       v.Address.String(),
+			Creator:       ctx.Indexer.LookupAddress(ctx, v.CreatorId).String(),
+			FirstSeen:     v.FirstSeen,
+			FirstSeenTime: times[i],
+			CodeHash:      util.U64String(v.CodeHash).Hex(),
+			InterfaceHash: util.U64String(v.InterfaceHash).Hex(),
+		}
+		res.Contracts = append(res.Contracts, m)
+		if args.Meta {
+			if md, ok := lookupAddressIdMetadata(ctx, v.AccountId); ok {
+				res.Metadata[m.Address] = md.Short()
+			}
+			if md, ok := lookupAddressIdMetadata(ctx, v.CreatorId); ok {
+				res.Metadata[m.Creator] = md.Short()
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// ConsensusKeyEvent is a consensus key update or drain of a baker.
+type ConsensusKeyEvent struct {
+	Type            model.ConsensusKeyEventType `json:"type"`
+	Height          int64                       `json:"height"`
+	Cycle           int64                       `json:"cycle"`
+	Time            time.Time                   `json:"time"`
+	OpId            uint64                      `json:"op_id"`
+	ActivationCycle int64                       `json:"activation_cycle,omitempty"`
+	IsPending       bool                        `json:"is_pending,omitempty"`
+	OldKey          *mavryk.Key                 `json:"old_key,omitempty"`
+	OldAddress      *mavryk.Address             `json:"old_address,omitempty"`
+	NewKey          *mavryk.Key                 `json:"new_key,omitempty"`
+	NewAddress      *mavryk.Address             `json:"new_address,omitempty"`
+	Signer          *mavryk.Address             `json:"signer,omitempty"`
+	Destination     *mavryk.Address             `json:"destination,omitempty"`
+	Amount          float64                     `json:"amount,omitempty"`
+	RowId           uint64                      `json:"row_id"`
+}
+
+func NewConsensusKeyEvent(ctx *server.Context, k *model.ConsensusKey) *ConsensusKeyEvent {
+	ev := &ConsensusKeyEvent{
+		Type:   k.Type,
+		Height: k.Height,
+		Cycle:  k.Cycle,
+		Time:   k.Time,
+		OpId:   k.OpId,
+		RowId:  k.RowId,
+	}
+	switch k.Type {
+	case model.ConsensusKeyEventTypeUpdate:
+		ev.ActivationCycle = k.ActivationCycle
+		ev.IsPending = k.ActivationCycle > ctx.Params.HeightToCycle(ctx.Tip.BestHeight)
+		if k.OldKey.IsValid() {
+			oldAddr := k.OldKey.Address()
+			ev.OldKey, ev.OldAddress = &k.OldKey, &oldAddr
+		}
+		newAddr := k.NewKey.Address()
+		ev.NewKey, ev.NewAddress = &k.NewKey, &newAddr
+	case model.ConsensusKeyEventTypeDrain:
+		dst := ctx.Indexer.LookupAddress(ctx, k.DestinationId)
+		ev.Signer = &k.Signer
+		ev.Destination = &dst
+		ev.Amount = ctx.Params.ConvertValue(k.Amount)
+	}
+	return ev
+}
+
+// BakerKeys is the consensus key audit trail of a baker.
+type BakerKeys struct {
+	Baker               mavryk.Address       `json:"baker"`
+	ActiveKey           mavryk.Key           `json:"active_key"`
+	ActiveAddress       mavryk.Address       `json:"active_address"`
+	PendingKey          *mavryk.Key          `json:"pending_key,omitempty"`
+	PendingAddress      *mavryk.Address      `json:"pending_address,omitempty"`
+	PendingCycle        int64                `json:"pending_cycle,omitempty"`
+	NUpdateConsensusKey int64                `json:"n_update_consensus_key"`
+	NDrainDelegate      int64                `json:"n_drain_delegate"`
+	Events              []*ConsensusKeyEvent `json:"events"`
+}
+
+type ConsensusKeyListRequest struct {
+	ListRequest
+	Type model.ConsensusKeyEventType `schema:"type"`
+}
+
+// ListBakerKeys returns the active and pending consensus key of a baker and
+// a paged history of key updates and drains.
+func ListBakerKeys(ctx *server.Context) (interface{}, int) {
+	args := &ConsensusKeyListRequest{}
+	ctx.ParseRequestArgs(args)
+	bkr := loadBaker(ctx)
+
+	table, err := ctx.Indexer.Table(model.ConsensusKeyTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access consensus key table", err))
+	}
+
+	resp := &BakerKeys{
+		Baker:               bkr.Address,
+		ActiveKey:           bkr.Account.Pubkey,
+		NUpdateConsensusKey: bkr.NUpdateConsensusKey,
+		NDrainDelegate:      bkr.NDrainDelegate,
+		Events:              make([]*ConsensusKeyEvent, 0),
+	}
+	switch key, err := ctx.Indexer.LookupConsensusKey(ctx, bkr.AccountId, ctx.Tip.BestHeight); err {
+	case nil:
+		resp.ActiveKey = key
+	case model.ErrNoConsensusKey:
+	default:
+		panic(server.EInternal(server.EC_DATABASE, "cannot read consensus key", err))
+	}
+	resp.ActiveAddress = resp.ActiveKey.Address()
+
+	// the latest update is pending until its activation cycle
+	last := &model.ConsensusKey{}
+	err = pack.NewQuery("baker.keys.pending").
+		WithTable(table).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("baker_id", bkr.AccountId).
+		AndEqual("type", model.ConsensusKeyEventTypeUpdate).
+		AndGt("activation_cycle", ctx.Params.HeightToCycle(ctx.Tip.BestHeight)).
+		Execute(ctx, last)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read consensus keys", err))
+	}
+	if last.RowId > 0 {
+		addr := last.NewKey.Address()
+		resp.PendingKey = &last.NewKey
+		resp.PendingAddress = &addr
+		resp.PendingCycle = last.ActivationCycle
+	}
+
+	q := pack.NewQuery("baker.keys.list").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("baker_id", bkr.AccountId)
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	if args.Type.IsValid() {
+		q = q.AndEqual("type", args.Type)
+	}
+	list := make([]*model.ConsensusKey, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list consensus keys", err))
+	}
+	for _, v := range list {
+		resp.Events = append(resp.Events, NewConsensusKeyEvent(ctx, v))
+	}
+	return resp, http.StatusOK
+}
+
+// consensusKeyAt returns the consensus key address a baker used at height
+// or nil when the baker signed with its own key.
+func consensusKeyAt(ctx *server.Context, id model.AccountID, height int64) *mavryk.Address {
+	key, err := ctx.Indexer.LookupConsensusKey(ctx, id, height)
+	if err != nil {
+		if err != model.ErrNoConsensusKey {
+			log.Errorf("explorer: cannot resolve consensus key for %d at %d: %v", id, height, err)
+		}
+		return nil
+	}
+	addr := key.Address()
+	return &addr
+}
@@ -134,14 +134,23 @@ func (b Contract) RegisterDirectRoutes(r *mux.Router) error {
 }
 
 func (b Contract) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/templates", server.C(ListContractTemplates)).Methods("GET")
+	r.HandleFunc("/code/{hash}", server.C(ListContractsByCodeHash)).Methods("GET")
+	r.HandleFunc("/iface/{hash}", server.C(ListContractsByIfaceHash)).Methods("GET")
 	r.HandleFunc("/{ident}", server.C(ReadContract)).Methods("GET").Name("contract")
+	r.HandleFunc("/{ident}/similar", server.C(ReadSimilarContracts)).Methods("GET")
 	r.HandleFunc("/{ident}/calls", server.C(ListContractCalls)).Methods("GET")
+	r.HandleFunc("/{ident}/entrypoint_stats", server.C(ListEntrypointStats)).Methods("GET")
 	r.HandleFunc("/{ident}/script", server.C(ReadContractScript)).Methods("GET")
 	r.HandleFunc("/{ident}/storage", server.C(ReadContractStorage)).Methods("GET")
+	r.HandleFunc("/{ident}/storage/diff", server.C(ReadContractStorageDiff)).Methods("GET")
 	r.HandleFunc("/{ident}/events", server.C(ListContractEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/event_types", server.C(ListContractEventTypes)).Methods("GET")
 	r.HandleFunc("/{ident}/tickets", server.C(ListTickets)).Methods("GET")
 	r.HandleFunc("/{ident}/ticket_events", server.C(ListTicketEvents)).Methods("GET")
 	r.HandleFunc("/{ident}/ticket_balances", server.C(ListTicketBalances)).Methods("GET")
+	r.HandleFunc("/{ident}/ticket_graph", server.C(ReadTicketGraph)).Methods("GET")
+	r.HandleFunc("/{ident}/ticket_supply", server.C(ReadTicketSupply)).Methods("GET")
 	return nil
 
 }
@@ -157,6 +166,9 @@ type ContractRequest struct {
 	Merge   bool           `schema:"merge"`   // collapse internal calls
 	Storage bool           `schema:"storage"` // embed storage updates
 	Sender  mavryk.Address `schema:"sender"`  // sender address
+	Bigmaps bool           `schema:"bigmaps"` // embed bigmap contents into storage
+	From    string         `schema:"from"`    // block hash or height for storage diff
+	To      string         `schema:"to"`      // block hash or height for storage diff
 
 	// decoded entrypoint condition (list of name, num or branch)
 	EntrypointMode pack.FilterMode `schema:"-"`
@@ -167,6 +179,8 @@ type ContractRequest struct {
 	BlockHash   mavryk.BlockHash `schema:"-"`
 	SinceHeight int64            `schema:"-"`
 	SinceHash   mavryk.BlockHash `schema:"-"`
+	FromHeight  int64            `schema:"-"`
+	ToHeight    int64            `schema:"-"`
 }
 
 func (r *ContractRequest) WithPrim() bool   { return r != nil && r.Prim }
@@ -183,40 +197,35 @@ func (r *ContractRequest) WithRights() bool  { return false }
 func (r *ContractRequest) WithMerge() bool   { return r != nil && r.Merge }
 func (r *ContractRequest) WithStorage() bool { return r != nil && r.Storage }
 
+func parseBlockIdent(ctx *server.Context, ident string) (mavryk.BlockHash, int64) {
+	hash, height, err := ctx.Indexer.LookupBlockId(ctx.Context, ident)
+	if err != nil {
+		switch err {
+		case model.ErrNoBlock:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such block", err))
+		case model.ErrInvalidBlockHeight:
+			panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block height", err))
+		case model.ErrInvalidBlockHash:
+			panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block hash", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+		}
+	}
+	return hash, height
+}
+
 func (r *ContractRequest) Parse(ctx *server.Context) {
 	if len(r.Block) > 0 {
-		hash, height, err := ctx.Indexer.LookupBlockId(ctx.Context, r.Block)
-		if err != nil {
-			switch err {
-			case model.ErrNoBlock:
-				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such block", err))
-			case model.ErrInvalidBlockHeight:
-				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block height", err))
-			case model.ErrInvalidBlockHash:
-				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block hash", err))
-			default:
-				panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
-			}
-		}
-		r.BlockHeight = height
-		r.BlockHash = hash
+		r.BlockHash, r.BlockHeight = parseBlockIdent(ctx, r.Block)
 	}
 	if len(r.Since) > 0 {
-		hash, height, err := ctx.Indexer.LookupBlockId(ctx.Context, r.Since)
-		if err != nil {
-			switch err {
-			case model.ErrNoBlock:
-				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such block", err))
-			case model.ErrInvalidBlockHeight:
-				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block height", err))
-			case model.ErrInvalidBlockHash:
-				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid block hash", err))
-			default:
-				panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
-			}
-		}
-		r.SinceHeight = height
-		r.SinceHash = hash
+		r.SinceHash, r.SinceHeight = parseBlockIdent(ctx, r.Since)
+	}
+	if len(r.From) > 0 {
+		_, r.FromHeight = parseBlockIdent(ctx, r.From)
+	}
+	if len(r.To) > 0 {
+		_, r.ToHeight = parseBlockIdent(ctx, r.To)
 	}
 	// filter by entrypoint condition
 	if mode, val, ok := server.Query(ctx, "entrypoint"); ok {
@@ -271,6 +280,7 @@ var (
 func ListContractCalls(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.OpTableKey, args.SinceHeight, args.BlockHeight)
 	cc := loadContract(ctx)
 	acc, err := ctx.Indexer.LookupAccountById(ctx, cc.AccountId)
 	if err != nil {
@@ -436,8 +446,17 @@ func ReadContractScript(ctx *server.Context) (interface{}, int) {
 func ReadContractStorage(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
+	ctx.CheckPruned(model.StorageTableKey, args.BlockHeight)
+	if args.Bigmaps {
+		ctx.CheckPruned(model.BigmapUpdateTableKey, args.BlockHeight)
+	}
 	cc := loadContract(ctx)
 
+	// historic storage is located via the last call in the op table
+	if args.BlockHeight < cc.LastSeen {
+		ctx.CheckPruned(model.OpTableKey, args.BlockHeight)
+	}
+
 	if args.BlockHeight > 0 && args.BlockHeight < cc.FirstSeen {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "empty storage before origination", nil))
 	}
@@ -458,64 +477,14 @@ func ReadContractStorage(ctx *server.Context) (interface{}, int) {
 	}
 
 	// type is always the most recently upgraded type stored in contract table
-	var (
-		typ  micheline.Type = script.StorageType()
-		data []byte
-		mod  time.Time
-		// patchBigmaps bool
-	)
-
-	if args.BlockHeight == 0 || args.BlockHeight >= cc.LastSeen {
-		mod = ctx.Indexer.LookupBlockTime(ctx.Context, cc.LastSeen)
-		// most recent storage is now stored in contract table!
-		data = cc.Storage
-		// when data is loaded from origination, we must patch bigmap pointers
-		// patchBigmaps = cc.FirstSeen == cc.LastSeen && bytes.Count(cc.CallStats, []byte{0}) == len(cc.CallStats)
-	} else {
-		// find earlier incoming call before height
-		op, err := ctx.Indexer.FindLastCall(
-			ctx.Context,
-			cc.AccountId,
-			cc.FirstSeen,
-			args.BlockHeight,
-		)
-		if err != nil && err != model.ErrNoOp {
-			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
-		}
-
-		if op != nil {
-			store, err := ctx.Indexer.LookupStorage(ctx, cc.AccountId, op.StorageHash, cc.FirstSeen, op.Height)
-			if err != nil {
-				panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
-			}
-			mod = op.Timestamp
-			data = store.Storage
-		} else {
-			// when no most recent call exists, load from origination
-			data, _ = script.Storage.MarshalBinary()
-			mod = ctx.Indexer.LookupBlockTime(ctx.Context, cc.FirstSeen)
-			// patchBigmaps = true
-		}
+	typ := script.StorageType()
+	data, height, err := ctx.Indexer.ContractStorageAt(ctx, cc, args.BlockHeight, ctx.Client)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot load storage", err))
 	}
-
-	// patch bigmap pointers when storage is loaded from origination
-	// if patchBigmaps && len(ids) > 0 {
-	// 	// Note: This is a heuristic only, and should work in the majority of cases.
-	// 	// Reason is that in value trees we cannot distinguish between bigmaps
-	// 	// and any other container type using PrimSequence as encoding (list, map, set).
-	// 	var i int
-	// 	prim.Visit(func(p *micheline.Prim) error {
-	// 		if p.LooksLikeContainer() && p.LooksLikeMap() {
-	// 			*p = micheline.NewBigmapRef(ids[i])
-	// 			i++
-	// 			if len(ids) <= i {
-	// 				return io.EOF
-	// 			}
-	// 			return micheline.PrimSkip
-	// 		}
-	// 		return nil
-	// 	})
-	// }
-
-	return NewStorage(ctx, data, typ, mod, args), http.StatusOK
+	resp := NewStorage(ctx, data, typ, ctx.Indexer.LookupBlockTime(ctx.Context, height), args)
+	if args.Bigmaps {
+		resp.Bigmaps = loadStorageBigmaps(ctx, cc, args.BlockHeight, args)
+	}
+	return resp, http.StatusOK
 }
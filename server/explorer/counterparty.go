@@ -0,0 +1,204 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// counterparty directions
+const (
+	CounterpartyIn   = "in"
+	CounterpartyOut  = "out"
+	CounterpartyBoth = "both"
+)
+
+type CounterpartyRequest struct {
+	ListRequest
+	Direction string `schema:"direction"` // in, out
+	OrderBy   string `schema:"order_by"`  // n_tx, volume, n_token_tx, last_time
+}
+
+// Counterparty summarizes all interactions of an account with a single other
+// account. In counts flows from counterparty to account, out the reverse.
+type Counterparty struct {
+	Address     mavryk.Address `json:"address"`
+	Direction   string         `json:"direction"`
+	NTx         int            `json:"n_tx"`
+	NTxIn       int            `json:"n_tx_in"`
+	NTxOut      int            `json:"n_tx_out"`
+	Volume      float64        `json:"volume"`
+	VolumeIn    float64        `json:"volume_in"`
+	VolumeOut   float64        `json:"volume_out"`
+	NTokenTx    int            `json:"n_token_tx"`
+	NTokenIn    int            `json:"n_token_in"`
+	NTokenOut   int            `json:"n_token_out"`
+	FirstHeight int64          `json:"first_height"`
+	FirstTime   time.Time      `json:"first_time"`
+	LastHeight  int64          `json:"last_height"`
+	LastTime    time.Time      `json:"last_time"`
+
+	id        model.AccountID
+	volumeIn  int64
+	volumeOut int64
+}
+
+func (c *Counterparty) add(e *model.Counterparty, isIn bool) {
+	if isIn {
+		c.NTxIn += e.NTx
+		c.volumeIn += e.Volume
+		c.NTokenIn += e.NTokenTx
+	} else {
+		c.NTxOut += e.NTx
+		c.volumeOut += e.Volume
+		c.NTokenOut += e.NTokenTx
+	}
+	if c.FirstHeight == 0 || e.FirstHeight < c.FirstHeight {
+		c.FirstHeight = e.FirstHeight
+	}
+	if e.LastHeight > c.LastHeight {
+		c.LastHeight = e.LastHeight
+	}
+}
+
+// ListAccountCounterparties returns accounts the account has transacted
+// with ranked by the order_by metric, highest first. Use time.gte, time.lt
+// or time.rg to limit the range. Ranges have daily granularity.
+func ListAccountCounterparties(ctx *server.Context) (interface{}, int) {
+	args := &CounterpartyRequest{}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	switch args.Direction {
+	case "", CounterpartyIn, CounterpartyOut:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid direction %q", args.Direction), nil))
+	}
+
+	table, err := ctx.Indexer.Table(model.CounterpartyTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access counterparty table", err))
+	}
+
+	// sum daily edges per counterparty
+	parties := make(map[model.AccountID]*Counterparty)
+	for _, isIn := range []bool{true, false} {
+		if (isIn && args.Direction == CounterpartyOut) || (!isIn && args.Direction == CounterpartyIn) {
+			continue
+		}
+		self, other := "receiver_id", "sender_id"
+		if !isIn {
+			self, other = other, self
+		}
+		q := pack.NewQuery("account.counterparties").
+			WithTable(table).
+			WithFields(other, "first_height", "last_height", "n_tx", "volume", "n_token_tx").
+			AndEqual(self, acc.RowId)
+		q = withTimeFilter(ctx, q)
+		var e model.Counterparty
+		err := q.Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&e); err != nil {
+				return err
+			}
+			id := e.SenderId
+			if !isIn {
+				id = e.ReceiverId
+			}
+			c, ok := parties[id]
+			if !ok {
+				c = &Counterparty{id: id}
+				parties[id] = c
+			}
+			c.add(&e, isIn)
+			return nil
+		})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list counterparties", err))
+		}
+	}
+
+	list := make([]*Counterparty, 0, len(parties))
+	for _, c := range parties {
+		c.NTx = c.NTxIn + c.NTxOut
+		c.NTokenTx = c.NTokenIn + c.NTokenOut
+		list = append(list, c)
+	}
+
+	var less func(a, b *Counterparty) bool
+	switch args.OrderBy {
+	case "", "n_tx":
+		less = func(a, b *Counterparty) bool {
+			if a.NTx != b.NTx {
+				return a.NTx > b.NTx
+			}
+			return a.volumeIn+a.volumeOut > b.volumeIn+b.volumeOut
+		}
+	case "volume":
+		less = func(a, b *Counterparty) bool {
+			if va, vb := a.volumeIn+a.volumeOut, b.volumeIn+b.volumeOut; va != vb {
+				return va > vb
+			}
+			return a.NTx > b.NTx
+		}
+	case "n_token_tx":
+		less = func(a, b *Counterparty) bool {
+			if a.NTokenTx != b.NTokenTx {
+				return a.NTokenTx > b.NTokenTx
+			}
+			return a.NTx > b.NTx
+		}
+	case "last_time":
+		less = func(a, b *Counterparty) bool {
+			return a.LastHeight > b.LastHeight
+		}
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid order_by %q", args.OrderBy), nil))
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if less(list[i], list[j]) {
+			return true
+		}
+		if less(list[j], list[i]) {
+			return false
+		}
+		return list[i].id < list[j].id
+	})
+
+	// paginate
+	offset := int(args.Offset)
+	if offset > len(list) {
+		offset = len(list)
+	}
+	list = list[offset:]
+	if limit := int(ctx.Cfg.ClampExplore(args.Limit)); len(list) > limit {
+		list = list[:limit]
+	}
+
+	params := ctx.Params
+	for _, c := range list {
+		c.Address = ctx.Indexer.LookupAddress(ctx, c.id)
+		switch {
+		case c.NTxIn+c.NTokenIn > 0 && c.NTxOut+c.NTokenOut > 0:
+			c.Direction = CounterpartyBoth
+		case c.NTxIn+c.NTokenIn > 0:
+			c.Direction = CounterpartyIn
+		default:
+			c.Direction = CounterpartyOut
+		}
+		c.VolumeIn = params.ConvertValue(c.volumeIn)
+		c.VolumeOut = params.ConvertValue(c.volumeOut)
+		c.Volume = params.ConvertValue(c.volumeIn + c.volumeOut)
+		c.FirstTime = ctx.Indexer.LookupBlockTime(ctx, c.FirstHeight)
+		c.LastTime = ctx.Indexer.LookupBlockTime(ctx, c.LastHeight)
+	}
+	return list, http.StatusOK
+}
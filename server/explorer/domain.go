@@ -0,0 +1,183 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func init() {
+	server.Register(Domain{})
+}
+
+var _ server.RESTful = (*Domain)(nil)
+
+type Domain struct {
+	Name       string          `json:"name"`
+	Parent     string          `json:"parent,omitempty"`
+	Level      int             `json:"level"`
+	Address    *mavryk.Address `json:"address,omitempty"`
+	Owner      mavryk.Address  `json:"owner"`
+	Expiry     *time.Time      `json:"expiry,omitempty"`
+	IsExpired  bool            `json:"is_expired"`
+	FirstBlock int64           `json:"first_block"`
+	FirstTime  time.Time       `json:"first_time"`
+	LastBlock  int64           `json:"last_block"`
+	LastTime   time.Time       `json:"last_time"`
+	History    []*DomainEvent  `json:"history"`
+}
+
+func NewDomain(ctx *server.Context, d *model.Domain) *Domain {
+	res := &Domain{
+		Name:       d.Name,
+		Parent:     d.Parent(),
+		Level:      d.Level,
+		Owner:      d.Owner,
+		IsExpired:  d.IsExpired(ctx.Tip.BestTime),
+		FirstBlock: d.FirstHeight,
+		FirstTime:  ctx.Indexer.LookupBlockTime(ctx, d.FirstHeight),
+		LastBlock:  d.LastHeight,
+		LastTime:   ctx.Indexer.LookupBlockTime(ctx, d.LastHeight),
+	}
+	if d.Address.IsValid() {
+		res.Address = &d.Address
+	}
+	if !d.Expiry.IsZero() {
+		res.Expiry = &d.Expiry
+	}
+	return res
+}
+
+func (d Domain) LastModified() time.Time {
+	return d.LastTime
+}
+
+func (d Domain) Expires() time.Time {
+	return time.Time{}
+}
+
+func (d Domain) RESTPrefix() string {
+	return "/explorer/domain"
+}
+
+func (d Domain) RESTPath(r *mux.Router) string {
+	path, _ := r.Get("domain").URLPath("name", d.Name)
+	return path.String()
+}
+
+func (d Domain) RegisterDirectRoutes(r *mux.Router) error {
+	return nil
+}
+
+func (d Domain) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/{name}", server.C(ReadDomain)).Methods("GET").Name("domain")
+	return nil
+}
+
+// DomainEvent is a single change to a domain. Previous values are only
+// set when they differ from the new ones.
+type DomainEvent struct {
+	Type        model.DomainEventType `json:"type"`
+	Address     *mavryk.Address       `json:"address,omitempty"`
+	Owner       *mavryk.Address       `json:"owner,omitempty"`
+	Expiry      *time.Time            `json:"expiry,omitempty"`
+	PrevAddress *mavryk.Address       `json:"prev_address,omitempty"`
+	PrevOwner   *mavryk.Address       `json:"prev_owner,omitempty"`
+	PrevExpiry  *time.Time            `json:"prev_expiry,omitempty"`
+	Height      int64                 `json:"height"`
+	Time        time.Time             `json:"time"`
+	OpId        uint64                `json:"op_id"`
+	RowId       uint64                `json:"row_id"`
+}
+
+func NewDomainEvent(e *model.DomainEvent) *DomainEvent {
+	res := &DomainEvent{
+		Type:   e.Type,
+		Height: e.Height,
+		Time:   e.Time,
+		OpId:   e.OpId,
+		RowId:  e.RowId,
+	}
+	if e.Address.IsValid() {
+		res.Address = &e.Address
+	}
+	if e.Owner.IsValid() {
+		res.Owner = &e.Owner
+	}
+	if !e.Expiry.IsZero() {
+		res.Expiry = &e.Expiry
+	}
+	if e.PrevAddress.IsValid() && !e.PrevAddress.Equal(e.Address) {
+		res.PrevAddress = &e.PrevAddress
+	}
+	if e.PrevOwner.IsValid() && !e.PrevOwner.Equal(e.Owner) {
+		res.PrevOwner = &e.PrevOwner
+	}
+	if !e.PrevExpiry.IsZero() && !e.PrevExpiry.Equal(e.Expiry) {
+		res.PrevExpiry = &e.PrevExpiry
+	}
+	return res
+}
+
+func loadDomain(ctx *server.Context) *model.Domain {
+	name, ok := mux.Vars(ctx.Request)["name"]
+	if !ok || name == "" {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing domain name", nil))
+	}
+	if !server.IsDomainName(name) {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid domain name", nil))
+	}
+	d, err := ctx.Indexer.LookupDomain(ctx, strings.ToLower(name))
+	if err != nil {
+		switch err {
+		case model.ErrNoDomain:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such domain", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+		}
+	}
+	return d
+}
+
+// ReadDomain returns the current state of a domain together with its most
+// recent changes. Use limit, cursor and order to page through history.
+func ReadDomain(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+	d := loadDomain(ctx)
+
+	table, err := ctx.Indexer.Table(model.DomainEventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access domain event table", err))
+	}
+	q := pack.NewQuery("domain.list.events").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("name", d.Name)
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	list := make([]*model.DomainEvent, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list domain events", err))
+	}
+
+	resp := NewDomain(ctx, d)
+	resp.History = make([]*DomainEvent, 0, len(list))
+	for _, v := range list {
+		resp.History = append(resp.History, NewDomainEvent(v))
+	}
+	return resp, http.StatusOK
+}
@@ -5,8 +5,12 @@ package explorer
 
 import (
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
@@ -20,8 +24,11 @@ type Event struct {
 	Contract mavryk.Address `json:"contract"`
 	Type     micheline.Prim `json:"type"`
 	Payload  micheline.Prim `json:"payload"`
+	Value    interface{}    `json:"value,omitempty"`
 	Tag      string         `json:"tag"`
 	TypeHash util.U64String `json:"type_hash"`
+	Height   int64          `json:"height"`
+	OpId     uint64         `json:"op_id"`
 }
 
 func NewEvent(ctx *server.Context, e *model.Event) *Event {
@@ -29,43 +36,80 @@ func NewEvent(ctx *server.Context, e *model.Event) *Event {
 		Contract: ctx.Indexer.LookupAddress(ctx, e.AccountId),
 		Tag:      e.Tag,
 		TypeHash: util.U64String(e.TypeHash),
+		Height:   e.Height,
+		OpId:     e.OpId,
 	}
 	_ = ev.Type.UnmarshalBinary(e.Type)
 	_ = ev.Payload.UnmarshalBinary(e.Payload)
+	ev.Value = decodeEventPayload(ev.Type, ev.Payload)
 	return ev
 }
 
+// decodeEventPayload translates an event payload into typed JSON using the
+// event's type. It returns nil when the payload does not match.
+func decodeEventPayload(typ, payload micheline.Prim) interface{} {
+	if !typ.IsValid() || !payload.IsValid() {
+		return nil
+	}
+	val := micheline.NewValue(micheline.NewType(typ), payload)
+	m, err := val.Map()
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
 type ContractEventListRequest struct {
 	ListRequest
 	TypeHash uint64 `schema:"type_hash"`
 	Tag      string `schema:"tag"`
+
+	// decoded payload conditions
+	Filters []PayloadFilter `schema:"-"`
+}
+
+func (r *ContractEventListRequest) Parse(ctx *server.Context) {
+	for key, val := range ctx.Request.URL.Query() {
+		path, ok := strings.CutPrefix(key, "payload")
+		if !ok || path != "" && path[0] != '.' && path[0] != '|' {
+			continue
+		}
+		path = strings.TrimPrefix(path, ".")
+		for _, v := range val {
+			r.Filters = append(r.Filters, parsePayloadFilter(path, v))
+		}
+	}
 }
 
 func ListContractEvents(ctx *server.Context) (interface{}, int) {
 	args := &ContractEventListRequest{}
 	ctx.ParseRequestArgs(args)
 	cc := loadContract(ctx)
+	args.Limit = ctx.Cfg.ClampExplore(args.Limit)
 
 	table, err := ctx.Indexer.Table(model.EventTableKey)
 	if err != nil {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access event table", err))
 	}
 
-	list := make([]*model.Event, 0)
 	q := pack.NewQuery("event.list").
 		WithTable(table).
 		AndEqual("account_id", cc.AccountId).
-		WithLimit(int(args.Limit)).
-		WithOffset(int(args.Offset)).
 		AndGt("row_id", args.Cursor)
 
+	// payload filters are applied after decoding, so limit and offset
+	// count matching events while streaming
+	if len(args.Filters) == 0 {
+		q = q.WithLimit(int(args.Limit)).
+			WithOffset(int(args.Offset))
+	}
+
 	if args.TypeHash > 0 {
 		q = q.AndEqual("type_hash", args.TypeHash)
 	}
 	if args.Tag != "" {
 		q = q.AndEqual("tag", args.Tag)
 	}
-
 	// filter by time condition
 	if mode, val, ok := server.Query(ctx, "time"); ok {
 		switch mode {
@@ -100,14 +144,248 @@ func ListContractEvents(ctx *server.Context) (interface{}, int) {
 		}
 	}
 
-	err = q.Execute(ctx, &list)
-	if err != nil {
+	resp := make([]*Event, 0)
+	if len(args.Filters) == 0 {
+		list := make([]*model.Event, 0)
+		err = q.Execute(ctx, &list)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list events", err))
+		}
+		for _, v := range list {
+			resp = append(resp, NewEvent(ctx, v))
+		}
+		return resp, http.StatusOK
+	}
+
+	// build full events for results only and stop at the limit
+	var (
+		ev   model.Event
+		skip uint
+	)
+	err = q.Stream(ctx, func(r pack.Row) error {
+		if err := r.Decode(&ev); err != nil {
+			return err
+		}
+		var typ, payload micheline.Prim
+		_ = typ.UnmarshalBinary(ev.Type)
+		_ = payload.UnmarshalBinary(ev.Payload)
+		val := decodeEventPayload(typ, payload)
+		for _, f := range args.Filters {
+			if !f.Match(val) {
+				return nil
+			}
+		}
+		if skip < args.Offset {
+			skip++
+			return nil
+		}
+		resp = append(resp, NewEvent(ctx, &ev))
+		if uint(len(resp)) >= args.Limit {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
 		panic(server.EInternal(server.EC_DATABASE, "cannot list events", err))
 	}
+	return resp, http.StatusOK
+}
+
+// EventType is a distinct event type and tag emitted by a contract.
+type EventType struct {
+	Tag         string            `json:"tag"`
+	TypeHash    util.U64String    `json:"type_hash"`
+	Type        micheline.Typedef `json:"type"`
+	Prim        *micheline.Prim   `json:"prim,omitempty"`
+	Count       int               `json:"count"`
+	FirstHeight int64             `json:"first_height"`
+	LastHeight  int64             `json:"last_height"`
+}
+
+type EventTypeListRequest struct {
+	Prim bool `schema:"prim"`
+}
+
+// ListContractEventTypes returns the event schema registry of a contract,
+// i.e. all distinct event types and tags it has emitted ordered by first use.
+func ListContractEventTypes(ctx *server.Context) (interface{}, int) {
+	args := &EventTypeListRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+
+	table, err := ctx.Indexer.Table(model.EventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access event table", err))
+	}
 
-	resp := make([]*Event, 0, len(list))
-	for _, v := range list {
-		resp = append(resp, NewEvent(ctx, v))
+	type key struct {
+		tag  string
+		hash uint64
+	}
+	var (
+		ev    model.Event
+		index = make(map[key]int)
+		resp  = make([]*EventType, 0)
+	)
+	err = pack.NewQuery("event.types").
+		WithTable(table).
+		WithFields("height", "type", "tag", "type_hash").
+		AndEqual("account_id", cc.AccountId).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&ev); err != nil {
+				return err
+			}
+			k := key{ev.Tag, ev.TypeHash}
+			if i, ok := index[k]; ok {
+				et := resp[i]
+				et.Count++
+				et.FirstHeight = min(et.FirstHeight, ev.Height)
+				et.LastHeight = max(et.LastHeight, ev.Height)
+				return nil
+			}
+			var prim micheline.Prim
+			if err := prim.UnmarshalBinary(ev.Type); err != nil {
+				return err
+			}
+			et := &EventType{
+				Tag:         ev.Tag,
+				TypeHash:    util.U64String(ev.TypeHash),
+				Type:        micheline.NewType(prim).Typedef(ev.Tag),
+				Count:       1,
+				FirstHeight: ev.Height,
+				LastHeight:  ev.Height,
+			}
+			if args.Prim {
+				et.Prim = &prim
+			}
+			index[k] = len(resp)
+			resp = append(resp, et)
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list event types", err))
 	}
 	return resp, http.StatusOK
 }
+
+// PayloadFilter is a condition on a decoded event payload field. Paths use
+// dots to select nested fields by name or list position. A filter mode is
+// appended after `|`, e.g. `payload.amount|gt=1000`, so that fields named
+// like a mode remain addressable.
+type PayloadFilter struct {
+	Path  []string
+	Mode  pack.FilterMode
+	Value []string
+}
+
+func parsePayloadFilter(path, val string) PayloadFilter {
+	f := PayloadFilter{
+		Mode: pack.FilterModeEqual,
+	}
+	// an explicit filter mode selects the comparison, without field path
+	// the condition applies to scalar payloads
+	if p, m, ok := strings.Cut(path, "|"); ok {
+		f.Mode = pack.ParseFilterMode(m)
+		if !f.Mode.IsValid() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode %q for payload.%s", m, path), nil))
+		}
+		path = p
+	}
+	if path != "" {
+		f.Path = strings.Split(path, ".")
+	}
+	switch f.Mode {
+	case pack.FilterModeEqual, pack.FilterModeNotEqual,
+		pack.FilterModeGt, pack.FilterModeGte, pack.FilterModeLt, pack.FilterModeLte:
+		f.Value = []string{val}
+	case pack.FilterModeIn, pack.FilterModeNotIn:
+		f.Value = strings.Split(val, ",")
+	case pack.FilterModeRange:
+		f.Value = strings.Split(val, ",")
+		if len(f.Value) != 2 {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid range value %q for payload.%s", val, path), nil))
+		}
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported filter mode %q for payload.%s", f.Mode, path), nil))
+	}
+	return f
+}
+
+// Match returns true when the field selected by path exists in v and its
+// value matches the filter condition.
+func (f PayloadFilter) Match(v interface{}) bool {
+	for _, p := range f.Path {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = x[p]; !ok {
+				return false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(x) {
+				return false
+			}
+			v = x[i]
+		default:
+			return false
+		}
+	}
+	s, ok := payloadString(v)
+	if !ok {
+		return false
+	}
+	switch f.Mode {
+	case pack.FilterModeEqual:
+		return comparePayload(s, f.Value[0]) == 0
+	case pack.FilterModeNotEqual:
+		return comparePayload(s, f.Value[0]) != 0
+	case pack.FilterModeGt:
+		return comparePayload(s, f.Value[0]) > 0
+	case pack.FilterModeGte:
+		return comparePayload(s, f.Value[0]) >= 0
+	case pack.FilterModeLt:
+		return comparePayload(s, f.Value[0]) < 0
+	case pack.FilterModeLte:
+		return comparePayload(s, f.Value[0]) <= 0
+	case pack.FilterModeRange:
+		return comparePayload(s, f.Value[0]) >= 0 && comparePayload(s, f.Value[1]) <= 0
+	case pack.FilterModeIn, pack.FilterModeNotIn:
+		var found bool
+		for _, x := range f.Value {
+			if comparePayload(s, x) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (f.Mode == pack.FilterModeIn)
+	}
+	return false
+}
+
+// payloadString renders scalar payload values for comparison.
+func payloadString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return "", false
+	case string:
+		return x, true
+	case time.Time:
+		return x.UTC().Format(time.RFC3339), true
+	case fmt.Stringer:
+		return x.String(), true
+	default:
+		return fmt.Sprint(x), true
+	}
+}
+
+// comparePayload compares numerically when both values are numbers and
+// lexicographically otherwise.
+func comparePayload(a, b string) int {
+	x, ok1 := new(big.Float).SetString(a)
+	y, ok2 := new(big.Float).SetString(b)
+	if ok1 && ok2 {
+		return x.Cmp(y)
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,37 @@
+package explorer
+
+import (
+	"reflect"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+)
+
+func TestPayloadFilterModeNamedField(t *testing.T) {
+	payload := map[string]interface{}{
+		"a": map[string]interface{}{
+			"in": "5",
+			"gt": "7",
+		},
+	}
+	for _, tc := range []struct {
+		key, val string
+		path     []string
+		mode     pack.FilterMode
+		match    bool
+	}{
+		{"a.in", "5", []string{"a", "in"}, pack.FilterModeEqual, true},
+		{"a.gt", "7", []string{"a", "gt"}, pack.FilterModeEqual, true},
+		{"a.gt|gt", "6", []string{"a", "gt"}, pack.FilterModeGt, true},
+		{"a.in|in", "4,6", []string{"a", "in"}, pack.FilterModeIn, false},
+		{"|gt", "1", nil, pack.FilterModeGt, false},
+	} {
+		f := parsePayloadFilter(tc.key, tc.val)
+		if !reflect.DeepEqual(f.Path, tc.path) || f.Mode != tc.mode {
+			t.Errorf("%s: got path %v mode %s, want %v %s", tc.key, f.Path, f.Mode, tc.path, tc.mode)
+		}
+		if got := f.Match(payload); got != tc.match {
+			t.Errorf("%s=%s: match %t, want %t", tc.key, tc.val, got, tc.match)
+		}
+	}
+}
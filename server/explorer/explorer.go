@@ -52,8 +52,14 @@ func (b Explorer) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/protocols", server.C(GetBlockchainProtocols)).Methods("GET")
 	r.HandleFunc("/config/{ident}", server.C(GetBlockchainConfig)).Methods("GET")
 	r.HandleFunc("/chain/{ident}", server.C(ReadChain)).Methods("GET")
+	r.HandleFunc("/supply/audit/{cycle}", server.C(ReadSupplyAudit)).Methods("GET")
 	r.HandleFunc("/supply/{ident}", server.C(ReadSupply)).Methods("GET")
 	r.HandleFunc("/status", server.C(GetStatus)).Methods("GET")
+	r.HandleFunc("/search", server.C(Search)).Methods("GET")
+	r.HandleFunc("/holders", server.C(ListHolders)).Methods("GET")
+	r.HandleFunc("/fees/estimate", server.C(EstimateFees)).Methods("GET")
+	r.HandleFunc("/simulate", server.C(SimulateOperation)).Methods("POST")
+	r.HandleFunc("/batch", server.C(RunBatch)).Methods("POST")
 	return nil
 }
 
@@ -0,0 +1,311 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	feeDefaultBlocks    = 1000  // history window
+	feeMaxBlocks        = 20000 // max history window
+	feeMaxSamples       = 5000  // max ops to sample
+	feeCongestionBlocks = 10    // recent blocks for congestion
+)
+
+type FeeEstimateRequest struct {
+	Type         string         `schema:"type"`          // default transaction
+	Receiver     mavryk.Address `schema:"receiver"`      // target contract or account
+	Entrypoint   string         `schema:"entrypoint"`    // name or id, requires receiver
+	StorageDelta *int64         `schema:"storage_delta"` // expected storage growth in bytes
+	Blocks       int64          `schema:"blocks"`        // history window
+}
+
+// FeePercentiles summarizes a sample distribution.
+type FeePercentiles struct {
+	Min  float64 `json:"min"`
+	P10  float64 `json:"p10"`
+	P25  float64 `json:"p25"`
+	P50  float64 `json:"p50"`
+	P75  float64 `json:"p75"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+type FeeSuggestion struct {
+	Fee          float64 `json:"fee"`
+	GasLimit     int64   `json:"gas_limit"`
+	StorageLimit int64   `json:"storage_limit"`
+	StorageBurn  float64 `json:"storage_burn"`
+}
+
+// FeeEstimate is a fee, gas and storage estimate derived from recent
+// successful operations. Gas and storage include internal operations.
+type FeeEstimate struct {
+	Type       model.OpType    `json:"type"`
+	Receiver   *mavryk.Address `json:"receiver,omitempty"`
+	Entrypoint string          `json:"entrypoint,omitempty"`
+	FromHeight int64           `json:"from_height"`
+	ToHeight   int64           `json:"to_height"`
+	NOps       int             `json:"n_ops"`
+	Congestion float64         `json:"congestion"` // recent block gas utilization 0..1
+	FeeFactor  float64         `json:"fee_factor"` // multiplier applied to suggested fee
+	Fee        FeePercentiles  `json:"fee"`
+	Gas        FeePercentiles  `json:"gas"`
+	Storage    FeePercentiles  `json:"storage"`
+	Suggested  FeeSuggestion   `json:"suggested"`
+}
+
+// feeSample tracks totals of a single operation and its internal results.
+type feeSample struct {
+	fee     int64
+	gas     int64
+	storage int64
+}
+
+// EstimateFees returns percentile fee, gas and storage estimates for an
+// operation type and optional target and entrypoint based on recent history.
+// The suggested fee is the historic median scaled by recent congestion.
+func EstimateFees(ctx *server.Context) (interface{}, int) {
+	args := &FeeEstimateRequest{}
+	ctx.ParseRequestArgs(args)
+
+	typ := model.OpTypeTransaction
+	if args.Type != "" {
+		typ = model.ParseOpType(args.Type)
+	}
+	if !typ.IsValid() || typ.IsEvent() {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid op type %q", args.Type), nil))
+	}
+	if args.Entrypoint != "" && !args.Receiver.IsValid() {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "entrypoint requires a receiver", nil))
+	}
+	if args.Blocks <= 0 {
+		args.Blocks = feeDefaultBlocks
+	}
+	args.Blocks = min(args.Blocks, feeMaxBlocks)
+
+	resp := &FeeEstimate{
+		Type:       typ,
+		ToHeight:   ctx.Tip.BestHeight,
+		FromHeight: max(ctx.Tip.BestHeight-args.Blocks+1, 0),
+		FeeFactor:  1,
+	}
+
+	table, err := ctx.Indexer.Table(model.OpTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access ops table", err))
+	}
+	q := pack.NewQuery("fees.estimate").
+		WithTable(table).
+		WithFields("hash", "op_n", "fee", "gas_used", "storage_paid", "is_contract").
+		WithDesc().
+		WithLimit(feeMaxSamples).
+		AndRange("height", resp.FromHeight, resp.ToHeight).
+		AndEqual("type", typ).
+		AndEqual("is_success", true).
+		AndEqual("is_internal", false)
+
+	if args.Receiver.IsValid() {
+		resp.Receiver = &args.Receiver
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Receiver)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such account", err))
+		}
+		q = q.AndEqual("receiver_id", id)
+	}
+	if args.Entrypoint != "" {
+		id, err := strconv.Atoi(args.Entrypoint)
+		if err != nil {
+			cc, err := ctx.Indexer.LookupContract(ctx, args.Receiver)
+			if err != nil {
+				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract", err))
+			}
+			id = util.StringList(cc.EntrypointNames()).Index(args.Entrypoint)
+			if id < 0 {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unknown entrypoint %q", args.Entrypoint), nil))
+			}
+		}
+		resp.Entrypoint = args.Entrypoint
+		q = q.AndEqual("entrypoint_id", id)
+	}
+
+	// internal ops are joined to their parent content by position, they
+	// directly follow it in block order within the same op hash
+	type feeKey struct {
+		hash mavryk.OpHash
+		n    int
+	}
+	samples := make([]*feeSample, 0)
+	byKey := make(map[feeKey]*feeSample)
+	var op model.Op
+	err = q.Stream(ctx, func(r pack.Row) error {
+		if err := r.Decode(&op); err != nil {
+			return err
+		}
+		s := &feeSample{op.Fee, op.GasUsed, op.StoragePaid}
+		samples = append(samples, s)
+		if op.IsContract {
+			byKey[feeKey{op.Hash.Clone(), op.OpN}] = s
+		}
+		return nil
+	})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read ops", err))
+	}
+
+	// add gas and storage of internal operations
+	if len(byKey) > 0 {
+		hashes := make([][]byte, 0, len(byKey))
+		seen := make(map[mavryk.OpHash]bool, len(byKey))
+		for k := range byKey {
+			if !seen[k.hash] {
+				seen[k.hash] = true
+				hashes = append(hashes, k.hash[:])
+			}
+		}
+		// current parent content per op hash, nil when not sampled
+		parent := make(map[mavryk.OpHash]*feeSample, len(hashes))
+		err = pack.NewQuery("fees.estimate.internal").
+			WithTable(table).
+			WithFields("hash", "op_n", "is_internal", "gas_used", "storage_paid").
+			AndRange("height", resp.FromHeight, resp.ToHeight).
+			AndIn("hash", hashes).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(&op); err != nil {
+					return err
+				}
+				if !op.IsInternal {
+					parent[op.Hash] = byKey[feeKey{op.Hash, op.OpN}]
+					return nil
+				}
+				if s := parent[op.Hash]; s != nil {
+					s.gas += op.GasUsed
+					s.storage += op.StoragePaid
+				}
+				return nil
+			})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read internal ops", err))
+		}
+	}
+	resp.NOps = len(samples)
+
+	// recent block gas utilization
+	resp.Congestion = feeCongestion(ctx)
+	if resp.Congestion > 0.5 {
+		// scale fee up to 2x as blocks fill up
+		resp.FeeFactor = 1 + (resp.Congestion-0.5)*2
+	}
+
+	params := ctx.Params
+	fees := make([]int64, len(samples))
+	gas := make([]int64, len(samples))
+	storage := make([]int64, len(samples))
+	for i, s := range samples {
+		fees[i], gas[i], storage[i] = s.fee, s.gas, s.storage
+	}
+	if args.StorageDelta != nil {
+		// explicit storage growth replaces history
+		storage = []int64{max(*args.StorageDelta, 0)}
+	}
+	resp.Fee = newFeePercentiles(fees, params.ConvertValue)
+	resp.Gas = newFeePercentiles(gas, nil)
+	resp.Storage = newFeePercentiles(storage, nil)
+
+	// suggest p90 limits with a 10% margin and the median fee
+	p90Gas := int64(math.Ceil(resp.Gas.P90 * 1.1))
+	p90Storage := int64(math.Ceil(resp.Storage.P90))
+	if args.StorageDelta != nil {
+		p90Storage = max(*args.StorageDelta, 0)
+	}
+	resp.Suggested = FeeSuggestion{
+		Fee:          math.Ceil(resp.Fee.P50*resp.FeeFactor*1e6) / 1e6,
+		GasLimit:     p90Gas,
+		StorageLimit: p90Storage,
+		StorageBurn:  params.ConvertValue(p90Storage * params.CostPerByte),
+	}
+	if limit := params.HardGasLimitPerOperation; limit > 0 && resp.Suggested.GasLimit > limit {
+		resp.Suggested.GasLimit = limit
+	}
+	return resp, http.StatusOK
+}
+
+// feeCongestion returns the average gas utilization of recent blocks.
+func feeCongestion(ctx *server.Context) float64 {
+	limit := ctx.Params.HardGasLimitPerBlock
+	if limit <= 0 {
+		return 0
+	}
+	table, err := ctx.Indexer.Table(model.BlockTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access block table", err))
+	}
+	var (
+		b          model.Block
+		sum, count int64
+	)
+	err = pack.NewQuery("fees.congestion").
+		WithTable(table).
+		WithFields("gas_used").
+		AndGt("height", ctx.Tip.BestHeight-feeCongestionBlocks).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&b); err != nil {
+				return err
+			}
+			sum += b.GasUsed
+			count++
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read blocks", err))
+	}
+	if count == 0 {
+		return 0
+	}
+	return min(float64(sum)/float64(count*limit), 1)
+}
+
+// newFeePercentiles returns nearest-rank percentiles of vals. When conv is
+// not nil values are converted, e.g. from mumav to MAV.
+func newFeePercentiles(vals []int64, conv func(int64) float64) FeePercentiles {
+	if len(vals) == 0 {
+		return FeePercentiles{}
+	}
+	if conv == nil {
+		conv = func(v int64) float64 { return float64(v) }
+	}
+	slices.Sort(vals)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(vals)))) - 1
+		return conv(vals[max(i, 0)])
+	}
+	var sum int64
+	for _, v := range vals {
+		sum += v
+	}
+	return FeePercentiles{
+		Min:  conv(vals[0]),
+		P10:  rank(0.10),
+		P25:  rank(0.25),
+		P50:  rank(0.50),
+		P75:  rank(0.75),
+		P90:  rank(0.90),
+		P99:  rank(0.99),
+		Max:  conv(vals[len(vals)-1]),
+		Mean: conv(sum) / float64(len(vals)),
+	}
+}
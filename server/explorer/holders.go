@@ -0,0 +1,301 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"blockwatch.cc/packdb/encoding/csv"
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type HolderRequest struct {
+	Limit  uint   `schema:"limit"`
+	Offset uint   `schema:"offset"`
+	Block  string `schema:"block"`  // height or hash, default is current head
+	Format string `schema:"format"` // json or csv
+
+	// decoded values
+	BlockHeight int64 `schema:"-"`
+}
+
+func (r *HolderRequest) Parse(ctx *server.Context) {
+	r.BlockHeight = ctx.Tip.BestHeight
+	if len(r.Block) > 0 {
+		_, r.BlockHeight = parseBlockIdent(ctx, r.Block)
+	}
+	switch r.Format {
+	case "":
+		r.Format = "json"
+	case "json", "csv":
+	default:
+		panic(server.EBadRequest(server.EC_CONTENTTYPE_UNSUPPORTED, "unsupported format '"+r.Format+"'", nil))
+	}
+}
+
+type TokenHolderRequest struct {
+	HolderRequest
+	MinBalance mavryk.Z `schema:"min_balance"` // in token base units
+}
+
+type TokenHolder struct {
+	Account mavryk.Address `json:"account"`
+	Balance mavryk.Z       `json:"balance"`
+	id      model.AccountID
+}
+
+func (h TokenHolder) MarshalCSV() ([]string, error) {
+	return []string{h.Account.String(), h.Balance.String()}, nil
+}
+
+// ListTokenHolders returns all holders of a token with non-zero balance at
+// a past block. Balances are reconstructed from current owner balances by
+// reverting all token events after the requested block. Results are sorted
+// by balance in descending order.
+func ListTokenHolders(ctx *server.Context) (interface{}, int) {
+	args := &TokenHolderRequest{}
+	ctx.ParseRequestArgs(args)
+	tokn := loadToken(ctx)
+	ctx.CheckPruned(model.TokenEventTableKey, args.BlockHeight)
+
+	owners, err := ctx.Indexer.Table(model.TokenOwnerTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token owner table", err))
+	}
+	events, err := ctx.Indexer.Table(model.TokenEventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token event table", err))
+	}
+
+	// load current balances
+	bal := make(map[model.AccountID]mavryk.Z)
+	var ownr model.TokenOwner
+	err = pack.NewQuery("token.holders.owners").
+		WithTable(owners).
+		WithFields("account", "balance").
+		AndEqual("token", tokn.Id).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&ownr); err != nil {
+				return err
+			}
+			if !ownr.Balance.IsZero() {
+				bal[ownr.Account] = ownr.Balance
+			}
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token owners", err))
+	}
+
+	// revert later events
+	if args.BlockHeight < tokn.LastBlock {
+		var ev model.TokenEvent
+		err = pack.NewQuery("token.holders.events").
+			WithTable(events).
+			WithFields("type", "sender", "receiver", "amount").
+			AndEqual("token", tokn.Id).
+			AndGt("height", args.BlockHeight).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(&ev); err != nil {
+					return err
+				}
+				switch ev.Type {
+				case model.TokenEventTypeMint:
+					bal[ev.Receiver] = bal[ev.Receiver].Sub(ev.Amount)
+				case model.TokenEventTypeBurn:
+					bal[ev.Sender] = bal[ev.Sender].Add(ev.Amount)
+				case model.TokenEventTypeTransfer:
+					bal[ev.Sender] = bal[ev.Sender].Add(ev.Amount)
+					bal[ev.Receiver] = bal[ev.Receiver].Sub(ev.Amount)
+				}
+				return nil
+			})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list token events", err))
+		}
+	}
+
+	list := make([]TokenHolder, 0, len(bal))
+	for id, v := range bal {
+		if v.IsZero() || v.IsNeg() || v.IsLess(args.MinBalance) {
+			continue
+		}
+		list = append(list, TokenHolder{Balance: v, id: id})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].Balance.Cmp(list[j].Balance); c != 0 {
+			return c > 0
+		}
+		return list[i].id < list[j].id
+	})
+	list = pageHolders(ctx, list, args.HolderRequest)
+	for i := range list {
+		list[i].Account = ctx.Indexer.LookupAddress(ctx, list[i].id)
+	}
+	return writeHolders(ctx, list, args.Format)
+}
+
+type NativeHolderRequest struct {
+	HolderRequest
+	MinBalance float64 `schema:"min_balance"`
+}
+
+type NativeHolder struct {
+	Account mavryk.Address `json:"account"`
+	Balance float64        `json:"balance"`
+	id      model.AccountID
+	value   int64
+}
+
+func (h NativeHolder) MarshalCSV() ([]string, error) {
+	return []string{h.Account.String(), strconv.FormatFloat(h.Balance, 'f', -1, 64)}, nil
+}
+
+// ListHolders returns all accounts with non-zero native balance at a block.
+// Balances at the current tip are read from the account table, balances at
+// past blocks from the balance history index. History scans are limited to
+// the configured max number of aggregate rows. Results are sorted by balance
+// in descending order.
+func ListHolders(ctx *server.Context) (interface{}, int) {
+	args := &NativeHolderRequest{}
+	ctx.ParseRequestArgs(args)
+
+	var balances map[model.AccountID]int64
+	if args.BlockHeight >= ctx.Tip.BestHeight {
+		balances = loadAccountBalances(ctx)
+	} else {
+		ctx.CheckPruned(model.BalanceTableKey, args.BlockHeight)
+		balances = loadHistoryBalances(ctx, args.BlockHeight)
+	}
+
+	params := ctx.Params
+	minBalance := params.ConvertAmount(args.MinBalance)
+	list := make([]NativeHolder, 0)
+	for id, v := range balances {
+		if v <= 0 || v < minBalance {
+			continue
+		}
+		list = append(list, NativeHolder{id: id, value: v})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].value != list[j].value {
+			return list[i].value > list[j].value
+		}
+		return list[i].id < list[j].id
+	})
+	list = pageHolders(ctx, list, args.HolderRequest)
+	for i := range list {
+		list[i].Account = ctx.Indexer.LookupAddress(ctx, list[i].id)
+		list[i].Balance = params.ConvertValue(list[i].value)
+	}
+	return writeHolders(ctx, list, args.Format)
+}
+
+// loadAccountBalances returns current balances of all funded accounts.
+func loadAccountBalances(ctx *server.Context) map[model.AccountID]int64 {
+	table, err := ctx.Indexer.Table(model.AccountTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access account table", err))
+	}
+	balances := make(map[model.AccountID]int64)
+	var acc model.Account
+	err = pack.NewQuery("holders.accounts").
+		WithTable(table).
+		WithFields("row_id", "spendable_balance", "frozen_rollup_bond", "unstaked_balance").
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&acc); err != nil {
+				return err
+			}
+			if v := acc.Balance(); v > 0 {
+				balances[acc.RowId] = v
+			}
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list accounts", err))
+	}
+	return balances
+}
+
+// loadHistoryBalances returns the most recent balance per account at height
+// from the balance history index.
+func loadHistoryBalances(ctx *server.Context, height int64) map[model.AccountID]int64 {
+	table, err := ctx.Indexer.Table(model.BalanceTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access balance table", err))
+	}
+	type entry struct {
+		balance int64
+		height  int64
+	}
+	var (
+		latest  = make(map[model.AccountID]entry)
+		maxRows = int(ctx.Cfg.Http.MaxAggregateRows)
+		nRows   int
+		b       model.Balance
+	)
+	err = pack.NewQuery("holders.balances").
+		WithTable(table).
+		WithFields("account_id", "balance", "valid_from").
+		AndLte("valid_from", height).
+		Stream(ctx, func(r pack.Row) error {
+			if nRows++; maxRows > 0 && nRows > maxRows {
+				return errHolderRows
+			}
+			if err := r.Decode(&b); err != nil {
+				return err
+			}
+			if e, ok := latest[b.AccountId]; !ok || b.ValidFrom >= e.height {
+				latest[b.AccountId] = entry{b.Balance, b.ValidFrom}
+			}
+			return nil
+		})
+	switch err {
+	case nil:
+	case errHolderRows:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID,
+			fmt.Sprintf("balance history at this block exceeds %d rows", maxRows), nil))
+	default:
+		panic(server.EInternal(server.EC_DATABASE, "cannot list balances", err))
+	}
+	balances := make(map[model.AccountID]int64, len(latest))
+	for id, e := range latest {
+		balances[id] = e.balance
+	}
+	return balances
+}
+
+var errHolderRows = errors.New("too many rows")
+
+func pageHolders[T any](ctx *server.Context, list []T, args HolderRequest) []T {
+	start := min(int(args.Offset), len(list))
+	end := min(start+int(ctx.Cfg.ClampList(args.Limit)), len(list))
+	return list[start:end]
+}
+
+func writeHolders[T csv.Marshaler](ctx *server.Context, list []T, format string) (interface{}, int) {
+	if format != "csv" {
+		return list, http.StatusOK
+	}
+	buf := bytes.NewBuffer(nil)
+	enc := csv.NewEncoder(buf)
+	if err := enc.EncodeHeader([]string{"account", "balance"}, nil); err != nil {
+		panic(server.EInternal(server.EC_MARSHAL_FAILED, "cannot write csv", err))
+	}
+	for _, v := range list {
+		if err := enc.EncodeRecord(v); err != nil {
+			panic(server.EInternal(server.EC_MARSHAL_FAILED, "cannot write csv", err))
+		}
+	}
+	ctx.ResponseWriter.Header().Set("Content-Type", "text/csv")
+	return buf.Bytes(), http.StatusOK
+}
@@ -566,6 +566,9 @@ func CreateMetadata(ctx *server.Context) (interface{}, int) {
 
 	// purge cache
 	metadataCache.Purge()
+	for _, v := range append(ins, upd...) {
+		ctx.Indexer.SearchIndex().UpdateMetadata(v.(*model.Metadata))
+	}
 	return nil, http.StatusNoContent
 }
 
@@ -595,6 +598,7 @@ func UpdateMetadata(ctx *server.Context) (interface{}, int) {
 
 	// purge cache
 	metadataCache.Purge()
+	ctx.Indexer.SearchIndex().UpdateMetadata(m)
 
 	return NewMetadata(m), http.StatusOK
 }
@@ -629,6 +633,11 @@ func RemoveMetadata(ctx *server.Context) (interface{}, int) {
 
 	// purge cache
 	metadataCache.Purge()
+	if len(current) == 0 {
+		ctx.Indexer.SearchIndex().RemoveMetadata(m.Address)
+	} else {
+		ctx.Indexer.SearchIndex().UpdateMetadata(m)
+	}
 
 	return nil, http.StatusNoContent
 }
@@ -684,6 +693,7 @@ func PurgeMetadata(ctx *server.Context) (interface{}, int) {
 	}
 
 	purgeMetadataStore()
+	ctx.Indexer.SearchIndex().Reset()
 	return nil, http.StatusNoContent
 }
 
@@ -720,6 +730,8 @@ func DescribeMetadata(ctx *server.Context) (interface{}, int) {
 		if err != nil {
 			switch err {
 			case model.ErrNoOp:
+				// a missing operation may have been pruned
+				ctx.CheckPruned(model.OpTableKey, 1)
 				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such operation", err))
 			case model.ErrInvalidOpID:
 				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid event id", err))
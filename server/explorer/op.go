@@ -176,6 +176,7 @@ type Op struct {
 	Receiver      *mavryk.Address           `json:"receiver,omitempty"`
 	Creator       *mavryk.Address           `json:"creator,omitempty"`
 	Baker         *mavryk.Address           `json:"baker,omitempty"`
+	ConsensusKey  *mavryk.Address           `json:"consensus_key,omitempty"`
 	OldBaker      *mavryk.Address           `json:"previous_baker,omitempty"`
 	Source        *mavryk.Address           `json:"source,omitempty"`
 	Accuser       *mavryk.Address           `json:"accuser,omitempty"`
@@ -880,6 +881,7 @@ func (r *OpsRequest) Parse(ctx *server.Context) {
 			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time mode %q", mode), nil))
 		}
 	}
+	ctx.CheckPruned(model.OpTableKey, r.SinceHeight, r.BlockHeight)
 }
 
 func loadOps(ctx *server.Context, args server.Options, limit uint) []*model.Op {
@@ -899,6 +901,8 @@ func loadOps(ctx *server.Context, args server.Options, limit uint) []*model.Op {
 		if err != nil && err2 != nil {
 			switch err {
 			case model.ErrNoOp:
+				// a missing operation may have been pruned
+				ctx.CheckPruned(model.OpTableKey, 1)
 				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such operation", err))
 			case model.ErrInvalidOpHash:
 				panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid operation hash", err))
@@ -0,0 +1,285 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func init() {
+	server.Register(Reorg{})
+}
+
+var _ server.RESTful = (*Reorg)(nil)
+
+// Reorg is a completed chain reorganization. Ops lists operations from
+// orphaned blocks that were not re-included on the new branch.
+type Reorg struct {
+	Id           uint64           `json:"id"`
+	Time         time.Time        `json:"time"`
+	ForkHeight   int64            `json:"fork_height"`
+	ForkHash     mavryk.BlockHash `json:"fork_hash"`
+	Depth        int              `json:"depth"`
+	Attached     int              `json:"attached"`
+	FormerHeight int64            `json:"former_height"`
+	FormerHash   mavryk.BlockHash `json:"former_hash"`
+	NewHeight    int64            `json:"new_height"`
+	NewHash      mavryk.BlockHash `json:"new_hash"`
+	IsRollback   bool             `json:"is_rollback"`
+	NReverted    int              `json:"n_reverted"`
+	Ops          []*ReorgOp       `json:"reverted_ops"`
+}
+
+type ReorgOp struct {
+	Hash   mavryk.OpHash  `json:"hash"`
+	Height int64          `json:"height"`
+	OpN    int            `json:"op_n"`
+	Type   model.OpType   `json:"type"`
+	Sender mavryk.Address `json:"sender"`
+	Volume float64        `json:"volume"`
+}
+
+func NewReorg(r *model.Reorg) *Reorg {
+	return &Reorg{
+		Id:           r.RowId,
+		Time:         r.Time,
+		ForkHeight:   r.ForkHeight,
+		ForkHash:     r.ForkHash,
+		Depth:        r.Depth,
+		Attached:     r.Attached,
+		FormerHeight: r.FormerHeight,
+		FormerHash:   r.FormerHash,
+		NewHeight:    r.NewHeight,
+		NewHash:      r.NewHash,
+		IsRollback:   r.IsRollback,
+		NReverted:    r.NReverted,
+		Ops:          make([]*ReorgOp, 0, r.NReverted),
+	}
+}
+
+func (r Reorg) LastModified() time.Time {
+	return r.Time
+}
+
+func (r Reorg) Expires() time.Time {
+	return time.Time{}
+}
+
+func (r Reorg) RESTPrefix() string {
+	return "/explorer/reorgs"
+}
+
+func (r Reorg) RESTPath(rt *mux.Router) string {
+	path, _ := rt.Get("reorg").URLPath("id", strconv.FormatUint(r.Id, 10))
+	return path.String()
+}
+
+func (r Reorg) RegisterDirectRoutes(rt *mux.Router) error {
+	rt.HandleFunc(r.RESTPrefix(), server.S(ListReorgs)).Methods("GET").Queries("follow", "{follow:true|1}")
+	rt.HandleFunc(r.RESTPrefix(), server.C(ListReorgs)).Methods("GET")
+	return nil
+}
+
+func (r Reorg) RegisterRoutes(rt *mux.Router) error {
+	rt.HandleFunc("/{id}", server.C(ReadReorg)).Methods("GET").Name("reorg")
+	return nil
+}
+
+type ReorgListRequest struct {
+	ListRequest
+	Op     mavryk.OpHash `schema:"op"`     // only reorgs that reverted this op
+	Follow bool          `schema:"follow"` // stream new reorgs as JSON lines
+}
+
+// ReadReorg returns a single reorg by id.
+func ReadReorg(ctx *server.Context) (interface{}, int) {
+	id, err := strconv.ParseUint(mux.Vars(ctx.Request)["id"], 10, 64)
+	if err != nil || id == 0 {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid reorg id", err))
+	}
+	table, err := ctx.Indexer.Table(model.ReorgTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access reorg table", err))
+	}
+	r := &model.Reorg{}
+	err = pack.NewQuery("reorg.find").
+		WithTable(table).
+		AndEqual("row_id", id).
+		Execute(ctx, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+	}
+	if r.RowId == 0 {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such reorg", model.ErrNoReorg))
+	}
+	list := []*Reorg{NewReorg(r)}
+	loadReorgOps(ctx, list)
+	return list[0], http.StatusOK
+}
+
+// ListReorgs lists persisted reorgs. With follow=true new reorgs after
+// cursor are streamed as JSON lines until the client disconnects. Follow
+// streams are served outside the worker pool.
+func ListReorgs(ctx *server.Context) (interface{}, int) {
+	args := &ReorgListRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Follow {
+		return streamReorgs(ctx, args)
+	}
+	list := listReorgs(ctx, args)
+	loadReorgOps(ctx, list)
+	return list, http.StatusOK
+}
+
+func listReorgs(ctx *server.Context, args *ReorgListRequest) []*Reorg {
+	table, err := ctx.Indexer.Table(model.ReorgTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access reorg table", err))
+	}
+	q := pack.NewQuery("reorg.list").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset))
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	if args.Op.IsValid() {
+		ids := make([]uint64, 0)
+		opTable, err := ctx.Indexer.Table(model.ReorgOpTableKey)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access reorg op table", err))
+		}
+		var op model.ReorgOp
+		err = pack.NewQuery("reorg.find_op").
+			WithTable(opTable).
+			WithFields("reorg_id").
+			AndEqual("hash", args.Op[:]).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(&op); err != nil {
+					return err
+				}
+				ids = append(ids, op.ReorgId)
+				return nil
+			})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot search reverted ops", err))
+		}
+		if len(ids) == 0 {
+			return []*Reorg{}
+		}
+		q = q.And("row_id", pack.FilterModeIn, ids)
+	}
+	list := make([]*model.Reorg, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list reorgs", err))
+	}
+	resp := make([]*Reorg, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, NewReorg(v))
+	}
+	return resp
+}
+
+// loadReorgOps adds reverted ops to reorgs.
+func loadReorgOps(ctx *server.Context, list []*Reorg) {
+	if len(list) == 0 {
+		return
+	}
+	table, err := ctx.Indexer.Table(model.ReorgOpTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access reorg op table", err))
+	}
+	ids := make([]uint64, len(list))
+	byId := make(map[uint64]*Reorg, len(list))
+	for i, v := range list {
+		ids[i] = v.Id
+		byId[v.Id] = v
+	}
+	params := ctx.Params
+	var op model.ReorgOp
+	err = pack.NewQuery("reorg.list_ops").
+		WithTable(table).
+		AndIn("reorg_id", ids).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&op); err != nil {
+				return err
+			}
+			if v, ok := byId[op.ReorgId]; ok {
+				v.Ops = append(v.Ops, &ReorgOp{
+					Hash:   op.Hash,
+					Height: op.Height,
+					OpN:    op.OpN,
+					Type:   op.Type,
+					Sender: op.Sender,
+					Volume: params.ConvertValue(op.Volume),
+				})
+			}
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list reverted ops", err))
+	}
+}
+
+func streamReorgs(ctx *server.Context, args *ReorgListRequest) (interface{}, int) {
+	ctx.StreamResponseHeaders(http.StatusOK, "application/x-ndjson")
+	flusher, _ := ctx.ResponseWriter.(http.Flusher)
+	enc := json.NewEncoder(ctx.ResponseWriter)
+	args.Order = pack.OrderAsc
+	args.Offset = 0
+
+	var (
+		count int
+		err   error
+	)
+	for {
+		// take the notify channel before listing to not miss a reorg
+		// stored in between
+		next := ctx.Crawler.ReorgNotify()
+		list := listReorgs(ctx, args)
+		loadReorgOps(ctx, list)
+		for _, v := range list {
+			if err = enc.Encode(v); err != nil {
+				break
+			}
+			args.Cursor = v.Id
+			count++
+		}
+		if err != nil {
+			break
+		}
+		if len(list) > 0 {
+			continue
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-next:
+		case <-ctx.Context.Done():
+			err = ctx.Context.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// client disconnect or shutdown ends a follow stream
+	if ctx.Context.Err() != nil {
+		err = nil
+	}
+	ctx.StreamTrailer(strconv.FormatUint(args.Cursor, 10), count, err)
+	return nil, -1
+}
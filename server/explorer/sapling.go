@@ -0,0 +1,240 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func init() {
+	server.Register(SaplingPool{})
+}
+
+var _ server.RESTful = (*SaplingPool)(nil)
+
+type SaplingPool struct {
+	Contract       mavryk.Address `json:"contract"`
+	FirstBlock     int64          `json:"first_block"`
+	FirstTime      time.Time      `json:"first_time"`
+	LastBlock      int64          `json:"last_block"`
+	LastTime       time.Time      `json:"last_time"`
+	Balance        float64        `json:"balance"`
+	AnonymitySet   int64          `json:"anonymity_set"`
+	NCommitments   int64          `json:"n_commitments"`
+	NNullifiers    int64          `json:"n_nullifiers"`
+	NShield        int            `json:"n_shield"`
+	NUnshield      int            `json:"n_unshield"`
+	NTransfer      int            `json:"n_transfer"`
+	ShieldVolume   float64        `json:"shield_volume"`
+	UnshieldVolume float64        `json:"unshield_volume"`
+}
+
+func NewSaplingPool(ctx *server.Context, p *model.SaplingPool) *SaplingPool {
+	params := ctx.Params
+	return &SaplingPool{
+		Contract:       ctx.Indexer.LookupAddress(ctx, p.AccountId),
+		FirstBlock:     p.FirstHeight,
+		FirstTime:      ctx.Indexer.LookupBlockTime(ctx, p.FirstHeight),
+		LastBlock:      p.LastHeight,
+		LastTime:       ctx.Indexer.LookupBlockTime(ctx, p.LastHeight),
+		Balance:        params.ConvertValue(p.Balance),
+		AnonymitySet:   p.NCommitments,
+		NCommitments:   p.NCommitments,
+		NNullifiers:    p.NNullifiers,
+		NShield:        p.NShield,
+		NUnshield:      p.NUnshield,
+		NTransfer:      p.NTransfer,
+		ShieldVolume:   params.ConvertValue(p.ShieldVolume),
+		UnshieldVolume: params.ConvertValue(p.UnshieldVolume),
+	}
+}
+
+func (p SaplingPool) LastModified() time.Time {
+	return p.LastTime
+}
+
+func (p SaplingPool) Expires() time.Time {
+	return time.Time{}
+}
+
+func (p SaplingPool) RESTPrefix() string {
+	return "/explorer/sapling"
+}
+
+func (p SaplingPool) RESTPath(r *mux.Router) string {
+	path, _ := r.Get("sapling").URLPath("ident", p.Contract.String())
+	return path.String()
+}
+
+func (p SaplingPool) RegisterDirectRoutes(r *mux.Router) error {
+	r.HandleFunc(p.RESTPrefix(), server.C(ListSaplingPools)).Methods("GET")
+	return nil
+}
+
+func (p SaplingPool) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/{ident}", server.C(ReadSaplingPool)).Methods("GET").Name("sapling")
+	r.HandleFunc("/{ident}/ops", server.C(ListSaplingOps)).Methods("GET")
+	return nil
+}
+
+// SaplingOp is the public record of a single Sapling transaction. Amount is
+// the transparent balance change of the pool.
+type SaplingOp struct {
+	Contract        mavryk.Address      `json:"contract"`
+	Sender          mavryk.Address      `json:"sender"`
+	Kind            model.SaplingOpKind `json:"kind"`
+	NInputs         int                 `json:"n_inputs"`
+	NOutputs        int                 `json:"n_outputs"`
+	NCommitments    int                 `json:"n_commitments"`
+	NNullifiers     int                 `json:"n_nullifiers"`
+	Amount          float64             `json:"amount"`
+	PoolBalance     float64             `json:"pool_balance"`
+	PoolCommitments int64               `json:"pool_commitments"`
+	PoolNullifiers  int64               `json:"pool_nullifiers"`
+	Height          int64               `json:"height"`
+	Time            time.Time           `json:"time"`
+	OpId            uint64              `json:"op_id"`
+	RowId           uint64              `json:"row_id"`
+}
+
+func NewSaplingOp(ctx *server.Context, o *model.SaplingOp) *SaplingOp {
+	params := ctx.Params
+	return &SaplingOp{
+		Contract:        ctx.Indexer.LookupAddress(ctx, o.AccountId),
+		Sender:          ctx.Indexer.LookupAddress(ctx, o.SenderId),
+		Kind:            o.Kind,
+		NInputs:         o.NInputs,
+		NOutputs:        o.NOutputs,
+		NCommitments:    o.NOutputs,
+		NNullifiers:     o.NInputs,
+		Amount:          params.ConvertValue(o.Amount),
+		PoolBalance:     params.ConvertValue(o.PoolBalance),
+		PoolCommitments: o.PoolCommitments,
+		PoolNullifiers:  o.PoolNullifiers,
+		Height:          o.Height,
+		Time:            o.Timestamp,
+		OpId:            o.OpId,
+		RowId:           o.RowId,
+	}
+}
+
+func loadSaplingPool(ctx *server.Context) *model.SaplingPool {
+	id, ok := mux.Vars(ctx.Request)["ident"]
+	if !ok || id == "" {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing contract address", nil))
+	}
+	addr, err := mavryk.ParseAddress(id)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid address", err))
+	}
+	acc, err := ctx.Indexer.LookupAccountId(ctx, addr)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract", err))
+	}
+	table, err := ctx.Indexer.Table(model.SaplingPoolTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access sapling pool table", err))
+	}
+	pool := &model.SaplingPool{}
+	err = pack.NewQuery("sapling.find").
+		WithTable(table).
+		AndEqual("account_id", acc).
+		Execute(ctx, pool)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+	}
+	if pool.RowId == 0 {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such sapling pool", model.ErrNoSaplingPool))
+	}
+	return pool
+}
+
+func ReadSaplingPool(ctx *server.Context) (interface{}, int) {
+	return NewSaplingPool(ctx, loadSaplingPool(ctx)), http.StatusOK
+}
+
+func ListSaplingPools(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+
+	table, err := ctx.Indexer.Table(model.SaplingPoolTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access sapling pool table", err))
+	}
+
+	list := make([]*model.SaplingPool, 0)
+	err = pack.NewQuery("sapling.list").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndGt("row_id", args.Cursor).
+		Execute(ctx, &list)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list sapling pools", err))
+	}
+
+	resp := make([]*SaplingPool, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, NewSaplingPool(ctx, v))
+	}
+	return resp, http.StatusOK
+}
+
+type SaplingOpListRequest struct {
+	ListRequest
+	Kind   model.SaplingOpKind `schema:"kind"`
+	Sender mavryk.Address      `schema:"sender"`
+}
+
+func ListSaplingOps(ctx *server.Context) (interface{}, int) {
+	args := &SaplingOpListRequest{}
+	ctx.ParseRequestArgs(args)
+	pool := loadSaplingPool(ctx)
+
+	table, err := ctx.Indexer.Table(model.SaplingOpTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access sapling op table", err))
+	}
+
+	q := pack.NewQuery("sapling.list.ops").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("account_id", pool.AccountId)
+
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	if args.Kind.IsValid() {
+		q = q.AndEqual("kind", args.Kind)
+	}
+	if args.Sender.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Sender)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such account", err))
+		}
+		q = q.AndEqual("sender_id", id)
+	}
+
+	list := make([]*model.SaplingOp, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list sapling ops", err))
+	}
+
+	resp := make([]*SaplingOp, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, NewSaplingOp(ctx, v))
+	}
+	return resp, http.StatusOK
+}
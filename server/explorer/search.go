@@ -0,0 +1,252 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// search input classes
+const (
+	SearchClassAddress  = "address"
+	SearchClassBlock    = "block"
+	SearchClassOp       = "operation"
+	SearchClassProtocol = "protocol"
+	SearchClassNumber   = "number"
+	SearchClassText     = "text"
+)
+
+// minimum length for address prefix scans, shorter prefixes match everything
+const minAddressPrefixLen = 5
+
+var addressPrefixRegexp = regexp.MustCompile(`^(mv[1-4]|KT1|sr1|txr1)[1-9A-HJ-NP-Za-km-z]*$`)
+
+type SearchResult struct {
+	Type     string         `json:"type"`  // account, contract, block, operation, protocol, cycle, token
+	Ident    string         `json:"ident"` // address, hash, height, cycle or token ident
+	Name     string         `json:"name,omitempty"`
+	Match    string         `json:"match"` // matched field
+	Score    int            `json:"score"`
+	Height   int64          `json:"height,omitempty"`
+	Time     time.Time      `json:"time,omitempty"`
+	Metadata *ShortMetadata `json:"metadata,omitempty"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Class   string         `json:"class"`
+	Results []SearchResult `json:"results"`
+	expires time.Time
+}
+
+func (r SearchResponse) LastModified() time.Time { return time.Time{} }
+func (r SearchResponse) Expires() time.Time      { return r.expires }
+
+var _ server.Resource = (*SearchResponse)(nil)
+
+type SearchRequest struct {
+	Query string `schema:"q"`
+	Limit uint   `schema:"limit"`
+}
+
+// Search classifies the query and returns ranked typed results. Exact hash
+// and number matches rank above address prefix and full-text matches.
+func Search(ctx *server.Context) (interface{}, int) {
+	args := &SearchRequest{}
+	ctx.ParseRequestArgs(args)
+	q := strings.TrimSpace(args.Query)
+	if q == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing query", nil))
+	}
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	resp := &SearchResponse{
+		Query:   q,
+		Results: make([]SearchResult, 0),
+		expires: ctx.Expires,
+	}
+
+	if a, err := mavryk.ParseAddress(q); err == nil {
+		resp.Class = SearchClassAddress
+		if acc, err := ctx.Indexer.LookupAccount(ctx, a); err == nil {
+			resp.Results = append(resp.Results, newAccountResult(ctx, a, acc.RowId, SearchClassAddress, 1000))
+		}
+	} else if h, err := mavryk.ParseBlockHash(q); err == nil {
+		resp.Class = SearchClassBlock
+		if b, err := ctx.Indexer.LookupBlock(ctx, h.String()); err == nil {
+			resp.Results = append(resp.Results, SearchResult{
+				Type:   "block",
+				Ident:  b.Hash.String(),
+				Match:  "hash",
+				Score:  1000,
+				Height: b.Height,
+				Time:   b.Timestamp,
+			})
+		}
+	} else if h, err := mavryk.ParseOpHash(q); err == nil {
+		resp.Class = SearchClassOp
+		if ops, err := ctx.Indexer.LookupOp(ctx, h.String(), etl.ListRequest{}); err == nil && len(ops) > 0 {
+			resp.Results = append(resp.Results, SearchResult{
+				Type:   "operation",
+				Ident:  h.String(),
+				Match:  "hash",
+				Score:  1000,
+				Height: ops[0].Height,
+				Time:   ops[0].Timestamp,
+			})
+		}
+	} else if h, err := mavryk.ParseProtocolHash(q); err == nil {
+		resp.Class = SearchClassProtocol
+		for _, v := range ctx.Tip.Deployments {
+			if v.Protocol.Equal(h) {
+				resp.Results = append(resp.Results, SearchResult{
+					Type:   "protocol",
+					Ident:  v.Protocol.String(),
+					Match:  "hash",
+					Score:  1000,
+					Height: v.StartHeight,
+					Time:   ctx.Indexer.LookupBlockTime(ctx, v.StartHeight),
+				})
+			}
+		}
+	} else if n, err := strconv.ParseInt(q, 10, 64); err == nil && n >= 0 {
+		// numbers may be a block height or a cycle
+		resp.Class = SearchClassNumber
+		if n <= ctx.Tip.BestHeight {
+			resp.Results = append(resp.Results, SearchResult{
+				Type:   "block",
+				Ident:  q,
+				Match:  "height",
+				Score:  900,
+				Height: n,
+				Time:   ctx.Indexer.LookupBlockTime(ctx, n),
+			})
+		}
+		if n <= ctx.Params.HeightToCycle(ctx.Tip.BestHeight) {
+			start := ctx.Params.CycleStartHeight(n)
+			resp.Results = append(resp.Results, SearchResult{
+				Type:   "cycle",
+				Ident:  q,
+				Match:  "cycle",
+				Score:  800,
+				Height: start,
+				Time:   ctx.Indexer.LookupBlockTime(ctx, start),
+			})
+		}
+	} else {
+		resp.Class = SearchClassText
+		if server.IsDomainName(q) {
+			if d, err := ctx.ResolveDomain(q); err == nil {
+				r := newAccountResult(ctx, d.Address, 0, "domain", 1000)
+				r.Name = d.Name
+				resp.Results = append(resp.Results, r)
+			}
+		}
+		if len(q) >= minAddressPrefixLen && addressPrefixRegexp.MatchString(q) {
+			addrs, err := ctx.Indexer.SearchAddressPrefix(ctx, q, limit)
+			if err != nil {
+				panic(server.EInternal(server.EC_DATABASE, "cannot search addresses", err))
+			}
+			for _, a := range addrs {
+				resp.Results = append(resp.Results, newAccountResult(ctx, a, 0, SearchClassAddress, 500))
+			}
+		}
+		matches, err := ctx.Indexer.SearchText(ctx, q, limit)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot search metadata", err))
+		}
+		resp.Results = append(resp.Results, newTextResults(ctx, matches)...)
+	}
+
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		return resp.Results[i].Score > resp.Results[j].Score
+	})
+	if len(resp.Results) > limit {
+		resp.Results = resp.Results[:limit]
+	}
+	return resp, http.StatusOK
+}
+
+func newAccountResult(ctx *server.Context, a mavryk.Address, id model.AccountID, match string, score int) SearchResult {
+	res := SearchResult{
+		Type:  "account",
+		Ident: a.String(),
+		Match: match,
+		Score: score,
+	}
+	if a.IsContract() {
+		res.Type = "contract"
+	}
+	var (
+		md *Metadata
+		ok bool
+	)
+	if id > 0 {
+		md, ok = lookupAddressIdMetadata(ctx, id)
+	} else {
+		md, ok = lookupAddressMetadata(ctx, a)
+	}
+	if ok {
+		res.Name = md.Name
+		res.Metadata = md.Short()
+	}
+	return res
+}
+
+func newTextResults(ctx *server.Context, matches []cache.SearchMatch) []SearchResult {
+	res := make([]SearchResult, 0, len(matches))
+
+	// resolve token identities in bulk
+	ids := make([]model.TokenID, 0)
+	for _, m := range matches {
+		if m.Doc.Kind == cache.SearchDocToken {
+			ids = append(ids, m.Doc.TokenId)
+		}
+	}
+	tokens := make(map[model.TokenID]*model.Token)
+	if len(ids) > 0 {
+		list, err := ctx.Indexer.LookupTokens(ctx, ids)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read tokens", err))
+		}
+		for _, v := range list {
+			tokens[v.Id] = v
+		}
+	}
+
+	for _, m := range matches {
+		switch m.Doc.Kind {
+		case cache.SearchDocAccount:
+			r := newAccountResult(ctx, m.Doc.Address, 0, m.Field, m.Score)
+			r.Name = m.Doc.Fields[m.Field]
+			res = append(res, r)
+		case cache.SearchDocToken:
+			tokn, ok := tokens[m.Doc.TokenId]
+			if !ok {
+				continue
+			}
+			ledger := ctx.Indexer.LookupAddress(ctx, tokn.Ledger)
+			res = append(res, SearchResult{
+				Type:   "token",
+				Ident:  mavryk.NewToken(ledger, tokn.TokenId).String(),
+				Name:   m.Doc.Fields[m.Field],
+				Match:  m.Field,
+				Score:  m.Score,
+				Height: tokn.FirstBlock,
+				Time:   tokn.FirstTime,
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,645 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/codec"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// simulation modes
+const (
+	SimulateModeSimulate = "simulate" // simulate_operation in a future block
+	SimulateModeRun      = "run"      // run_operation at the current head
+)
+
+const simGasSafetyMargin = 100 // extra gas added to suggested limits
+
+type SimulateRequest struct {
+	Data      mavryk.HexBytes `json:"data"`      // forged operation without signature
+	Signature string          `json:"signature"` // optional, not checked by the node
+	Mode      string          `json:"mode"`      // simulate (default) or run
+	Latency   int64           `json:"latency"`   // simulate only, blocks after head
+	Prim      bool            `json:"prim"`      // for prim/value rendering
+	Unpack    bool            `json:"unpack"`    // unpack packed key/values
+}
+
+func (r *SimulateRequest) WithPrim() bool    { return r != nil && r.Prim }
+func (r *SimulateRequest) WithUnpack() bool  { return r != nil && r.Unpack }
+func (r *SimulateRequest) WithHeight() int64 { return 0 }
+func (r *SimulateRequest) WithMeta() bool    { return false }
+func (r *SimulateRequest) WithRights() bool  { return false }
+func (r *SimulateRequest) WithMerge() bool   { return false }
+func (r *SimulateRequest) WithStorage() bool { return true }
+
+// implement ParsableRequest interface
+func (r *SimulateRequest) Parse(ctx *server.Context) {
+	if len(r.Data) == 0 {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing operation data", nil))
+	}
+	switch r.Mode {
+	case "":
+		r.Mode = SimulateModeSimulate
+	case SimulateModeSimulate, SimulateModeRun:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid mode %q", r.Mode), nil))
+	}
+	if r.Latency < 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "negative latency", nil))
+	}
+}
+
+// SimulatedOp is a single operation receipt from a simulation. Internal
+// results follow their parent operation.
+type SimulatedOp struct {
+	Type         mavryk.OpType   `json:"type"`
+	Status       mavryk.OpStatus `json:"status"`
+	IsSuccess    bool            `json:"is_success"`
+	IsInternal   bool            `json:"is_internal,omitempty"`
+	Sender       *mavryk.Address `json:"sender,omitempty"`
+	Receiver     *mavryk.Address `json:"receiver,omitempty"`
+	Counter      int64           `json:"counter,omitempty"`
+	Volume       float64         `json:"volume,omitempty"`
+	Fee          float64         `json:"fee,omitempty"`
+	GasLimit     int64           `json:"gas_limit,omitempty"`
+	GasUsed      int64           `json:"gas_used,omitempty"`
+	StorageLimit int64           `json:"storage_limit,omitempty"`
+	StoragePaid  int64           `json:"storage_paid,omitempty"`
+	Burned       float64         `json:"burned,omitempty"`
+	Errors       json.RawMessage `json:"errors,omitempty"`
+	Parameters   *Parameters     `json:"parameters,omitempty"`
+	Storage      *Storage        `json:"storage,omitempty"`      // originations only
+	StorageDiff  []StorageChange `json:"storage_diff,omitempty"` // storage and bigmap changes
+	Suggested    *FeeSuggestion  `json:"suggested,omitempty"`
+}
+
+// SimulatedTokenBalance is the expected ledger balance of a token owner after
+// the simulated operation. Change is relative to the indexed balance.
+type SimulatedTokenBalance struct {
+	Contract mavryk.Address  `json:"contract"`
+	TokenId  mavryk.Z        `json:"token_id"`
+	Account  mavryk.Address  `json:"account"`
+	Balance  mavryk.Z        `json:"balance"`
+	Change   mavryk.Z        `json:"change"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// Simulation is a node simulation receipt enriched with indexed context.
+type Simulation struct {
+	Mode       string                    `json:"mode"`
+	Branch     mavryk.BlockHash          `json:"branch"`
+	Height     int64                     `json:"height"` // indexer tip
+	IsSuccess  bool                      `json:"is_success"`
+	Contents   []*SimulatedOp            `json:"contents"`
+	Tokens     []*SimulatedTokenBalance  `json:"token_balances,omitempty"`
+	Congestion float64                   `json:"congestion"`
+	FeeFactor  float64                   `json:"fee_factor"`
+	Suggested  FeeSuggestion             `json:"suggested"` // totals
+	Metadata   map[string]*ShortMetadata `json:"metadata,omitempty"`
+}
+
+// simManager is implemented by all manager operation receipts.
+type simManager interface {
+	Sender() mavryk.Address
+	Limits() mavryk.Limits
+}
+
+// simContract caches contract types, newly originated contracts are not
+// indexed yet and only have types. Storage is the state before the next
+// simulated call.
+type simContract struct {
+	cc         *model.Contract
+	pTyp, sTyp micheline.Type
+	storage    []byte
+}
+
+// simBigmap tracks simulated bigmap updates. Keys without update are
+// resolved from the indexed bigmap source, removed keys map to nil.
+type simBigmap struct {
+	keyType, valueType micheline.Type
+	source             int64 // indexed bigmap, -1 if none
+	values             map[mavryk.ExprHash]*micheline.Prim
+}
+
+type simulator struct {
+	ctx       *server.Context
+	args      *SimulateRequest
+	resp      *Simulation
+	contracts map[string]*simContract
+	bigmaps   map[int64]*simBigmap
+	tokens    map[string]*SimulatedTokenBalance
+	addrs     *mavryk.AddressSet
+}
+
+var errSimulationMismatch = errors.New("receipt does not match operation contents")
+
+// newSimulator prepares the enrichment of a node receipt for operation op.
+func newSimulator(ctx *server.Context, args *SimulateRequest, op *codec.Op, rcpt *rpc.Operation) (*simulator, error) {
+	if len(rcpt.Contents) != len(op.Contents) {
+		return nil, errSimulationMismatch
+	}
+	return &simulator{
+		ctx:  ctx,
+		args: args,
+		resp: &Simulation{
+			Mode:      args.Mode,
+			Branch:    op.Branch,
+			Height:    ctx.Tip.BestHeight,
+			IsSuccess: true,
+			Contents:  make([]*SimulatedOp, 0, len(rcpt.Contents)),
+			FeeFactor: 1,
+			Metadata:  make(map[string]*ShortMetadata),
+		},
+		contracts: make(map[string]*simContract),
+		bigmaps:   make(map[int64]*simBigmap),
+		tokens:    make(map[string]*SimulatedTokenBalance),
+		addrs:     rcpt.Addresses(),
+	}, nil
+}
+
+// simulationError maps node errors to API errors. Operations the node
+// rejects are client errors, unreachable or failing nodes are not.
+func simulationError(err error) error {
+	var (
+		rerr rpc.RPCError
+		herr rpc.HTTPError
+	)
+	switch {
+	case errors.As(err, &rerr):
+		if rerr.ErrorKind() == rpc.ErrorKindTemporary {
+			return server.EServiceUnavailable(server.EC_RPC, "node temporarily unavailable", err)
+		}
+		return server.EBadRequest(server.EC_RPC, "simulation failed", err)
+	case errors.As(err, &herr):
+		if herr.StatusCode() < 500 {
+			return server.EBadRequest(server.EC_RPC, "simulation failed", err)
+		}
+		return server.EBadGateway(server.EC_RPC, "node error", err)
+	case errors.Is(err, context.Canceled):
+		return server.EConnectionClosed(server.EC_NETWORK, "request canceled", err)
+	default:
+		// network errors and timeouts
+		return server.EServiceUnavailable(server.EC_NETWORK, "node unavailable", err)
+	}
+}
+
+// SimulateOperation forwards a forged operation to the node's simulation
+// RPC and renders the receipt like indexed operations. Parameters, storage,
+// expected token balance changes and aliases are resolved from the index and
+// suggested limits and fees are derived from simulated gas and storage.
+func SimulateOperation(ctx *server.Context) (interface{}, int) {
+	args := &SimulateRequest{}
+	ctx.ParseRequestArgs(args)
+
+	op, err := codec.DecodeOp(args.Data)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "cannot decode operation", err))
+	}
+	if args.Signature != "" {
+		op.Signature, err = mavryk.ParseSignature(args.Signature)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid signature", err))
+		}
+	}
+
+	var rcpt *rpc.Operation
+	switch args.Mode {
+	case SimulateModeRun:
+		rcpt, err = ctx.Client.RunOperation(ctx, rpc.Head, op)
+	default:
+		rcpt, err = ctx.Client.SimulateOperation(ctx, op, args.Latency)
+	}
+	if err != nil {
+		panic(simulationError(err))
+	}
+	s, err := newSimulator(ctx, args, op, rcpt)
+	if err != nil {
+		panic(server.EBadGateway(server.EC_RPC, "simulation receipt mismatch", err))
+	}
+
+	s.resp.Congestion = feeCongestion(ctx)
+	if s.resp.Congestion > 0.5 {
+		// scale fee up to 2x as blocks fill up
+		s.resp.FeeFactor = 1 + (s.resp.Congestion-0.5)*2
+	}
+	s.addContents(op, rcpt)
+
+	// token owners
+	for _, v := range s.resp.Tokens {
+		s.addrs.AddUnique(v.Account)
+	}
+
+	// aliases
+	for _, a := range s.addrs.Slice() {
+		if md, ok := lookupAddressMetadata(ctx, a); ok {
+			s.resp.Metadata[a.String()] = md.Short()
+		}
+	}
+	return s.resp, http.StatusOK
+}
+
+// addContents renders receipts in operation order.
+func (s *simulator) addContents(op *codec.Op, rcpt *rpc.Operation) {
+	for i, v := range rcpt.Contents {
+		s.addOp(v, op.Contents[i], i == 0, op.Params)
+	}
+}
+
+func (s *simulator) addOp(v rpc.TypedOperation, c codec.Operation, withHeader bool, p *mavryk.Params) {
+	params := s.ctx.Params
+	res := v.Result()
+	sop := &SimulatedOp{
+		Type:      v.Kind(),
+		Status:    res.Status,
+		IsSuccess: res.IsSuccess(),
+		GasUsed:   res.Gas(),
+	}
+	s.resp.IsSuccess = s.resp.IsSuccess && sop.IsSuccess
+	if len(res.Errors) > 0 {
+		sop.Errors, _ = json.Marshal(res.Errors)
+	}
+	if m, ok := v.(simManager); ok {
+		sender := m.Sender()
+		lim := m.Limits()
+		sop.Sender = &sender
+		sop.Counter = c.GetCounter()
+		sop.Fee = params.ConvertValue(lim.Fee)
+		sop.GasLimit = lim.GasLimit
+		sop.StorageLimit = lim.StorageLimit
+	}
+	storage := s.addResult(sop, res)
+
+	switch o := v.(type) {
+	case *rpc.Transaction:
+		sop.Receiver = &o.Destination
+		sop.Volume = params.ConvertValue(o.Amount)
+		s.addContractData(sop, o.Destination, o.Parameters, res)
+	case *rpc.Origination:
+		sop.Volume = params.ConvertValue(o.Balance)
+		s.addOrigination(sop, o.Script, res)
+	}
+	s.resp.Contents = append(s.resp.Contents, sop)
+
+	// internal results
+	gas := sop.GasUsed
+	for _, it := range v.Meta().InternalResults {
+		iop := &SimulatedOp{
+			Type:       it.Kind,
+			Status:     it.Result.Status,
+			IsSuccess:  it.Result.IsSuccess(),
+			IsInternal: true,
+			Sender:     &it.Source,
+			GasUsed:    it.Result.Gas(),
+		}
+		if len(it.Result.Errors) > 0 {
+			iop.Errors, _ = json.Marshal(it.Result.Errors)
+		}
+		storage += s.addResult(iop, it.Result)
+		switch it.Kind {
+		case mavryk.OpTypeTransaction:
+			iop.Receiver = &it.Destination
+			iop.Volume = params.ConvertValue(it.Amount)
+			s.addContractData(iop, it.Destination, it.Parameters, it.Result)
+		case mavryk.OpTypeOrigination:
+			iop.Volume = params.ConvertValue(it.Balance)
+			s.addOrigination(iop, it.Script, it.Result)
+		case mavryk.OpTypeDelegation:
+			if it.Delegate.IsValid() {
+				iop.Receiver = &it.Delegate
+			}
+		}
+		gas += iop.GasUsed
+		s.resp.Contents = append(s.resp.Contents, iop)
+	}
+
+	// suggest limits from simulated usage and the minimum fee bakers accept
+	if _, ok := v.(simManager); !ok || !sop.IsSuccess {
+		return
+	}
+	gas += simGasSafetyMargin
+	if limit := params.HardGasLimitPerOperation; limit > 0 && gas > limit {
+		gas = limit
+	}
+	fee := codec.CalculateMinFee(c, gas, withHeader, p)
+	fee = int64(math.Ceil(float64(fee) * s.resp.FeeFactor))
+	sop.Suggested = &FeeSuggestion{
+		Fee:          params.ConvertValue(fee),
+		GasLimit:     gas,
+		StorageLimit: storage,
+		StorageBurn:  params.ConvertValue(storage * params.CostPerByte),
+	}
+	s.resp.Suggested.Fee += sop.Suggested.Fee
+	s.resp.Suggested.GasLimit += gas
+	s.resp.Suggested.StorageLimit += storage
+	s.resp.Suggested.StorageBurn += sop.Suggested.StorageBurn
+}
+
+// addResult sets storage usage and burn and returns the number of bytes
+// including allocations the operation must pay for.
+func (s *simulator) addResult(sop *SimulatedOp, res rpc.OperationResult) int64 {
+	params := s.ctx.Params
+	storage := res.PaidStorageSizeDiff
+	if res.Allocated {
+		storage += params.OriginationSize
+	}
+	storage += int64(len(res.OriginatedContracts)) * params.OriginationSize
+	sop.StoragePaid = res.PaidStorageSizeDiff
+	sop.Burned = params.ConvertValue(storage * params.CostPerByte)
+	return storage
+}
+
+func (s *simulator) addOrigination(sop *SimulatedOp, script *micheline.Script, res rpc.OperationResult) {
+	if len(res.OriginatedContracts) == 0 {
+		return
+	}
+	addr := res.OriginatedContracts[0]
+	sop.Receiver = &addr
+	if script == nil {
+		return
+	}
+	sc := &simContract{
+		pTyp: script.ParamType(),
+		sTyp: script.StorageType(),
+	}
+	s.contracts[addr.String()] = sc
+	if script.Storage.IsValid() {
+		if buf, err := script.Storage.MarshalBinary(); err == nil {
+			sop.Storage = NewStorage(s.ctx, buf, sc.sTyp, s.ctx.Now, s.args)
+			sc.storage = buf
+		}
+	}
+	if changes := s.diffBigmaps(res.BigmapEvents()); len(changes) > 0 {
+		sop.StorageDiff = changes
+	}
+}
+
+func (s *simulator) addContractData(sop *SimulatedOp, addr mavryk.Address, p micheline.Parameters, res rpc.OperationResult) {
+	if !addr.IsContract() {
+		return
+	}
+	sc := s.lookupContract(addr)
+	if sc == nil {
+		return
+	}
+	if p.Value.IsValid() && sc.pTyp.IsValid() {
+		if buf, err := p.MarshalBinary(); err == nil {
+			sop.Parameters = NewContractParameters(s.ctx, buf, sc.pTyp, mavryk.ZeroOpHash, s.args)
+		}
+	}
+	if res.IsSuccess() {
+		s.addStorageDiff(sop, sc, res)
+	}
+	if sc.cc != nil && sc.cc.LedgerSchema.IsValid() && res.IsSuccess() {
+		s.addTokenBalances(sc.cc, addr, res.BigmapEvents())
+	}
+}
+
+func (s *simulator) lookupContract(addr mavryk.Address) *simContract {
+	key := addr.String()
+	if sc, ok := s.contracts[key]; ok {
+		return sc
+	}
+	sc := &simContract{}
+	s.contracts[key] = sc
+	cc, err := s.ctx.Indexer.LookupContract(s.ctx, addr)
+	if err != nil {
+		return sc
+	}
+	sc.cc = cc
+	sc.storage = cc.Storage
+	sc.pTyp, sc.sTyp, _, err = s.ctx.Indexer.LookupContractType(s.ctx, cc.AccountId)
+	if err != nil {
+		log.Debugf("simulate: loading %s type: %v", addr, err)
+	}
+	return sc
+}
+
+// addStorageDiff renders changes from the storage before the call, which is
+// the indexed state or the result of an earlier simulated call, and bigmap
+// updates of the call.
+func (s *simulator) addStorageDiff(sop *SimulatedOp, sc *simContract, res rpc.OperationResult) {
+	changes := make([]StorageChange, 0)
+	if res.Storage.IsValid() && sc.sTyp.IsValid() {
+		if buf, err := res.Storage.MarshalBinary(); err == nil {
+			before := make(map[string]interface{})
+			if len(sc.storage) > 0 {
+				before["storage"] = plainValue(NewStorage(s.ctx, sc.storage, sc.sTyp, time.Time{}, s.args).Value)
+			}
+			after := map[string]interface{}{
+				"storage": plainValue(NewStorage(s.ctx, buf, sc.sTyp, time.Time{}, s.args).Value),
+			}
+			diffStorageTree("", before, after, &changes)
+			sc.storage = buf
+		}
+	}
+	changes = append(changes, s.diffBigmaps(res.BigmapEvents())...)
+	if len(changes) > 0 {
+		sop.StorageDiff = changes
+	}
+}
+
+// diffBigmaps renders bigmap events as changes against the value before the
+// event. Paths use bigmap ids because simulated bigmaps have no name yet.
+func (s *simulator) diffBigmaps(events micheline.BigmapEvents) []StorageChange {
+	changes := make([]StorageChange, 0)
+	for _, ev := range events {
+		path := joinPath("bigmaps", strconv.FormatInt(ev.Id, 10))
+		switch ev.Action {
+		case micheline.DiffActionAlloc:
+			s.bigmaps[ev.Id] = &simBigmap{
+				keyType:   micheline.NewType(ev.KeyType),
+				valueType: micheline.NewType(ev.ValueType),
+				source:    -1,
+				values:    make(map[mavryk.ExprHash]*micheline.Prim),
+			}
+			changes = append(changes, StorageChange{Path: path, Action: "added"})
+			continue
+		case micheline.DiffActionCopy:
+			src := s.lookupBigmap(ev.SourceId)
+			if src == nil {
+				continue
+			}
+			dst := &simBigmap{
+				keyType:   src.keyType,
+				valueType: src.valueType,
+				source:    src.source,
+				values:    make(map[mavryk.ExprHash]*micheline.Prim, len(src.values)),
+			}
+			for k, v := range src.values {
+				dst.values[k] = v
+			}
+			s.bigmaps[ev.DestId] = dst
+			changes = append(changes, StorageChange{
+				Path:   joinPath("bigmaps", strconv.FormatInt(ev.DestId, 10)),
+				Action: "added",
+				New:    ev.SourceId,
+			})
+			continue
+		case micheline.DiffActionRemove:
+			if !ev.KeyHash.IsValid() {
+				// bigmap removal
+				delete(s.bigmaps, ev.Id)
+				changes = append(changes, StorageChange{Path: path, Action: "removed", Old: ev.Id})
+				continue
+			}
+		}
+
+		bm := s.lookupBigmap(ev.Id)
+		if bm == nil {
+			continue
+		}
+		var oldVal, newVal interface{}
+		if prev := s.lookupBigmapValue(bm, ev.KeyHash); prev != nil {
+			oldVal = plainBigmapValue(micheline.NewValue(bm.valueType, *prev), s.args)
+		}
+		if ev.Action == micheline.DiffActionUpdate {
+			val := ev.Value
+			bm.values[ev.KeyHash] = &val
+			newVal = plainBigmapValue(micheline.NewValue(bm.valueType, val), s.args)
+		} else {
+			bm.values[ev.KeyHash] = nil
+		}
+		key, err := micheline.NewKey(bm.keyType, ev.Key)
+		if err != nil {
+			log.Debugf("simulate: decoding bigmap %d key: %v", ev.Id, err)
+			continue
+		}
+		if s.args.WithUnpack() && key.IsPacked() {
+			if up, err := key.Unpack(); err == nil {
+				key = up
+			}
+		}
+		p := joinPath(path, key.String())
+		switch {
+		case oldVal == nil && newVal == nil:
+		case oldVal == nil:
+			changes = append(changes, StorageChange{Path: p, Action: "added", New: newVal})
+		case newVal == nil:
+			changes = append(changes, StorageChange{Path: p, Action: "removed", Old: oldVal})
+		case !reflect.DeepEqual(oldVal, newVal):
+			changes = append(changes, StorageChange{Path: p, Action: "changed", Old: oldVal, New: newVal})
+		}
+	}
+	return changes
+}
+
+func (s *simulator) lookupBigmap(id int64) *simBigmap {
+	if bm, ok := s.bigmaps[id]; ok {
+		return bm
+	}
+	alloc, err := s.ctx.Indexer.LookupBigmapType(s.ctx, id)
+	if err != nil {
+		log.Debugf("simulate: loading bigmap %d type: %v", id, err)
+		return nil
+	}
+	bm := &simBigmap{
+		keyType:   alloc.GetKeyType(),
+		valueType: alloc.GetValueType(),
+		source:    id,
+		values:    make(map[mavryk.ExprHash]*micheline.Prim),
+	}
+	s.bigmaps[id] = bm
+	return bm
+}
+
+// lookupBigmapValue returns the current value of a key or nil when the key
+// does not exist.
+func (s *simulator) lookupBigmapValue(bm *simBigmap, key mavryk.ExprHash) *micheline.Prim {
+	if v, ok := bm.values[key]; ok {
+		return v
+	}
+	if bm.source < 0 {
+		return nil
+	}
+	items, err := s.ctx.Indexer.ListBigmapKeys(s.ctx, etl.ListRequest{
+		BigmapId:  bm.source,
+		BigmapKey: key,
+		Limit:     1,
+	})
+	if err != nil || len(items) == 0 {
+		return nil
+	}
+	v := items[0].GetValue(bm.valueType)
+	return &v.Value
+}
+
+// addTokenBalances decodes ledger updates into expected balances. Later
+// updates for the same owner replace earlier ones.
+func (s *simulator) addTokenBalances(cc *model.Contract, addr mavryk.Address, events micheline.BigmapEvents) {
+	upd, err := cc.LedgerSchema.DecodeBalanceUpdates(events, cc.LedgerBigmap)
+	if err != nil {
+		log.Debugf("simulate: decoding %s balance updates: %v", addr, err)
+		return
+	}
+	for _, v := range upd {
+		key := strings.Join([]string{addr.String(), v.TokenId.String(), v.Owner.String()}, "/")
+		if bal, ok := s.tokens[key]; ok {
+			bal.Change = bal.Change.Add(v.Balance.Sub(bal.Balance))
+			bal.Balance = v.Balance
+			continue
+		}
+		bal := &SimulatedTokenBalance{
+			Contract: addr,
+			TokenId:  v.TokenId,
+			Account:  v.Owner,
+			Balance:  v.Balance,
+			Change:   v.Balance,
+		}
+		if id, prev, ok := s.lookupTokenBalance(cc, v); ok {
+			bal.Change = v.Balance.Sub(prev)
+			bal.Metadata = lookupTokenIdMetadata(s.ctx, id)
+		}
+		s.tokens[key] = bal
+		s.resp.Tokens = append(s.resp.Tokens, bal)
+	}
+}
+
+// lookupTokenBalance returns the indexed token and balance of a ledger owner.
+// Unknown owners of known tokens have a zero balance.
+func (s *simulator) lookupTokenBalance(cc *model.Contract, b *model.LedgerBalance) (model.TokenID, mavryk.Z, bool) {
+	table, err := s.ctx.Indexer.Table(model.TokenTableKey)
+	if err != nil {
+		return 0, mavryk.Zero, false
+	}
+	tokn, err := model.GetToken(s.ctx, table, cc, b.TokenId)
+	if err != nil {
+		return 0, mavryk.Zero, false
+	}
+	defer tokn.Free()
+	acc, err := s.ctx.Indexer.LookupAccountId(s.ctx, b.Owner)
+	if err != nil {
+		return tokn.Id, mavryk.Zero, true
+	}
+	table, err = s.ctx.Indexer.Table(model.TokenOwnerTableKey)
+	if err != nil {
+		return tokn.Id, mavryk.Zero, true
+	}
+	ownr := &model.TokenOwner{}
+	err = pack.NewQuery("simulate.token_owner").
+		WithTable(table).
+		AndEqual("account", acc).
+		AndEqual("token", tokn.Id).
+		Execute(s.ctx, ownr)
+	if err != nil || ownr.Id == 0 {
+		return tokn.Id, mavryk.Zero, true
+	}
+	return tokn.Id, ownr.Balance, true
+}
@@ -0,0 +1,219 @@
+package explorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mavryk-network/mvgo/codec"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+var (
+	simTestSender   = mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{1}, 20))
+	simTestContract = mavryk.NewAddress(mavryk.AddressTypeContract, bytes.Repeat([]byte{2}, 20))
+)
+
+func simTestContext() *server.Context {
+	p := rpc.NewParams()
+	p.CostPerByte = 250
+	p.OriginationSize = 257
+	p.HardGasLimitPerOperation = 1040000
+	return &server.Context{
+		Context: context.Background(),
+		Params:  p,
+		Tip:     &model.ChainTip{BestHeight: 100},
+		Now:     time.Now(),
+	}
+}
+
+// simCall renders a contract call receipt that sets storage to val, updates
+// bigmap 7 key "a" to val and forwards 100 mumav to the sender.
+func simCall(counter, val int, lazy string) string {
+	return fmt.Sprintf(`{
+		"kind":"transaction","source":%[1]q,"fee":"1000","counter":"%[3]d","gas_limit":"10000","storage_limit":"100",
+		"amount":"0","destination":%[2]q,
+		"metadata":{
+			"operation_result":{"status":"applied","storage":{"int":"%[4]d"},"consumed_milligas":"2000000","paid_storage_size_diff":"10","lazy_storage_diff":%[5]s},
+			"internal_operation_results":[{"kind":"transaction","source":%[2]q,"nonce":0,"amount":"100","destination":%[1]q,
+				"result":{"status":"applied","consumed_milligas":"1000000"}}]
+		}}`, simTestSender, simTestContract, counter, val, lazy)
+}
+
+func simLazyDiff(action string, val int) string {
+	kh := micheline.KeyHash(micheline.NewString("a").Pack())
+	types := ""
+	if action == "alloc" {
+		types = `,"key_type":{"prim":"string"},"value_type":{"prim":"nat"}`
+	}
+	return fmt.Sprintf(`[{"kind":"big_map","id":"7","diff":{"action":%q,"updates":[{"key_hash":%q,"key":{"string":"a"},"value":{"int":"%d"}}]%s}}]`,
+		action, kh, val, types)
+}
+
+func simTestOp(n int) *codec.Op {
+	op := codec.NewOp().WithSource(simTestSender)
+	for i := 0; i < n; i++ {
+		op.WithCall(simTestContract, micheline.Parameters{Entrypoint: "default", Value: micheline.NewNat(nil)})
+	}
+	return op
+}
+
+func simTestReceipt(t *testing.T, contents ...string) *rpc.Operation {
+	t.Helper()
+	// the receipt decoder expects compact node JSON
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(fmt.Sprintf(`{"contents":[%s]}`, strings.Join(contents, ",")))); err != nil {
+		t.Fatal(err)
+	}
+	rcpt := &rpc.Operation{}
+	if err := json.Unmarshal(buf.Bytes(), rcpt); err != nil {
+		t.Fatal(err)
+	}
+	return rcpt
+}
+
+func TestSimulateReceiptMismatch(t *testing.T) {
+	rcpt := simTestReceipt(t, simCall(1, 5, simLazyDiff("alloc", 3)))
+	_, err := newSimulator(simTestContext(), &SimulateRequest{Mode: SimulateModeSimulate}, simTestOp(2), rcpt)
+	if err != errSimulationMismatch {
+		t.Fatalf("got error %v, want %v", err, errSimulationMismatch)
+	}
+}
+
+func TestSimulateEnrichment(t *testing.T) {
+	ctx := simTestContext()
+	rcpt := simTestReceipt(t,
+		simCall(1, 5, simLazyDiff("alloc", 3)),
+		simCall(2, 6, simLazyDiff("update", 4)),
+	)
+	op := simTestOp(2)
+	s, err := newSimulator(ctx, &SimulateRequest{Mode: SimulateModeSimulate}, op, rcpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pre-resolve the called contract, the indexed storage is nat 1
+	nat := micheline.NewType(micheline.NewCode(micheline.T_NAT))
+	storage, _ := micheline.NewInt64(1).MarshalBinary()
+	s.contracts[simTestContract.String()] = &simContract{
+		cc:      &model.Contract{Address: simTestContract},
+		pTyp:    nat,
+		sTyp:    nat,
+		storage: storage,
+	}
+	s.addContents(op, rcpt)
+
+	resp := s.resp
+	if !resp.IsSuccess {
+		t.Errorf("simulation not successful")
+	}
+	if len(resp.Contents) != 4 {
+		t.Fatalf("got %d results, want 4", len(resp.Contents))
+	}
+	for i, want := range []bool{false, true, false, true} {
+		if resp.Contents[i].IsInternal != want {
+			t.Errorf("result %d internal=%t, want %t", i, resp.Contents[i].IsInternal, want)
+		}
+	}
+
+	call := resp.Contents[0]
+	if call.Receiver == nil || !call.Receiver.Equal(simTestContract) {
+		t.Errorf("receiver %v, want %s", call.Receiver, simTestContract)
+	}
+	if call.Storage != nil {
+		t.Errorf("unexpected full storage on call")
+	}
+	if call.Burned != 0.0025 {
+		t.Errorf("burned %f, want 0.0025", call.Burned)
+	}
+	// gas from operation and internal result plus margin
+	if call.Suggested == nil || call.Suggested.GasLimit != 3000+simGasSafetyMargin {
+		t.Errorf("suggested %+v", call.Suggested)
+	}
+	if call.Suggested != nil && call.Suggested.StorageLimit != 10 {
+		t.Errorf("suggested storage %d, want 10", call.Suggested.StorageLimit)
+	}
+	if v := resp.Contents[1]; v.Volume != 0.0001 || v.Receiver == nil || !v.Receiver.Equal(simTestSender) {
+		t.Errorf("unexpected internal result %+v", v)
+	}
+
+	// first call diffs against indexed storage and allocates bigmap 7
+	checkChanges(t, call.StorageDiff, []StorageChange{
+		{Path: "storage", Action: "changed", Old: "1", New: "5"},
+		{Path: "bigmaps.7", Action: "added"},
+		{Path: "bigmaps.7.a", Action: "added", New: "3"},
+	})
+	// second call diffs against the result of the first call
+	checkChanges(t, resp.Contents[2].StorageDiff, []StorageChange{
+		{Path: "storage", Action: "changed", Old: "5", New: "6"},
+		{Path: "bigmaps.7.a", Action: "changed", Old: "3", New: "4"},
+	})
+}
+
+func checkChanges(t *testing.T, got, want []StorageChange) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if !bytes.Equal(g, w) {
+		t.Errorf("storage diff mismatch\ngot  %s\nwant %s", g, w)
+	}
+}
+
+func TestSimulationError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		ctype  string
+		body   string
+		want   int
+	}{
+		{"rejected", 500, "application/json", `[{"kind":"permanent","id":"proto.script_rejected"}]`, http.StatusBadRequest},
+		{"temporary", 500, "application/json", `[{"kind":"temporary","id":"node.mempool.full"}]`, http.StatusServiceUnavailable},
+		{"invalid", 400, "text/plain", "Failed to parse the request body", http.StatusBadRequest},
+		{"gateway", 502, "text/html", "bad gateway", http.StatusBadGateway},
+	}
+	op := simTestOp(1)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.ctype)
+				w.WriteHeader(c.status)
+				_, _ = io.WriteString(w, c.body)
+			}))
+			defer srv.Close()
+			cl, _ := rpc.NewClient(srv.URL, nil)
+			cl.WithChainId(mavryk.Mainnet).WithRetry(0, time.Millisecond)
+			_, err := cl.SimulateOperation(context.Background(), op, 0)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if e := simulationError(err).(*server.Error); e.Status != c.want {
+				t.Errorf("status %d, want %d (%v)", e.Status, c.want, err)
+			}
+		})
+	}
+
+	// unreachable node
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	cl, _ := rpc.NewClient(srv.URL, nil)
+	cl.WithChainId(mavryk.Mainnet).WithRetry(0, time.Millisecond)
+	_, err := cl.SimulateOperation(context.Background(), op, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if e := simulationError(err).(*server.Error); e.Status != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want %d (%v)", e.Status, http.StatusServiceUnavailable, err)
+	}
+}
@@ -4,15 +4,27 @@
 package explorer
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"time"
 
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/server"
 )
 
 type Storage struct {
-	Value    interface{}     `json:"value,omitempty"`
-	Prim     *micheline.Prim `json:"prim,omitempty"`
+	Value    interface{}              `json:"value,omitempty"`
+	Prim     *micheline.Prim          `json:"prim,omitempty"`
+	Bigmaps  map[string][]BigmapValue `json:"bigmaps,omitempty"`
 	modified time.Time
 	expires  time.Time
 }
@@ -69,3 +81,389 @@ func NewStorage(ctx *server.Context, data []byte, typ micheline.Type, mod time.T
 
 	return resp
 }
+
+// loadStorageBigmaps returns the contents of all bigmaps a contract owned at
+// height (0 = current state) keyed by bigmap name or id. At most limit keys
+// are loaded per bigmap.
+func loadStorageBigmaps(ctx *server.Context, cc *model.Contract, height int64, args *ContractRequest) map[string][]BigmapValue {
+	allocs, err := ctx.Indexer.ListContractBigmaps(ctx.Context, cc.AccountId, height)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list bigmaps", err))
+	}
+	idMap := make(map[int64]string)
+	for n, v := range cc.NamedBigmaps(allocs) {
+		idMap[v] = n
+	}
+	res := make(map[string][]BigmapValue, len(allocs))
+	for _, alloc := range allocs {
+		r := etl.ListRequest{
+			BigmapId: alloc.BigmapId,
+			Since:    height,
+			Limit:    ctx.Cfg.ClampList(args.Limit),
+		}
+		var items []*model.BigmapValue
+		if r.Since == 0 {
+			items, err = ctx.Indexer.ListBigmapKeys(ctx.Context, r)
+		} else {
+			items, err = ctx.Indexer.ListHistoricBigmapKeys(ctx.Context, r)
+		}
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+		}
+		keyType, valueType := alloc.GetKeyType(), alloc.GetValueType()
+		list := make([]BigmapValue, 0, len(items))
+		for _, v := range items {
+			key, err := v.GetKey(keyType)
+			if err != nil {
+				log.Errorf("explorer: decode bigmap key: %v", err)
+				continue
+			}
+			keyHash := v.GetKeyHash()
+			typedValue := v.GetValue(valueType)
+			val := BigmapValue{
+				Key:     &key,
+				KeyHash: &keyHash,
+				Value:   &typedValue,
+			}
+			if args.WithPrim() {
+				val.KeyPrim = key.PrimPtr()
+				val.ValuePrim = &typedValue.Value
+			}
+			if args.WithUnpack() {
+				if val.Value.IsPackedAny() {
+					if up, err := val.Value.UnpackAll(); err == nil {
+						val.Value = &up
+					}
+				}
+				if val.Key.IsPacked() {
+					if up, err := val.Key.Unpack(); err == nil {
+						val.Key = &up
+					}
+				}
+			}
+			list = append(list, val)
+		}
+		name, ok := idMap[alloc.BigmapId]
+		if !ok || name == "" {
+			name = strconv.FormatInt(alloc.BigmapId, 10)
+		}
+		res[name] = list
+	}
+	return res
+}
+
+type StorageChange struct {
+	Path   string      `json:"path"`
+	Action string      `json:"action"`
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// StorageDiff lists storage and bigmap changes of a contract between two
+// blocks. Paths are dot separated, bigmap entries are keyed by their key.
+type StorageDiff struct {
+	Contract string          `json:"contract"`
+	From     int64           `json:"from"`
+	To       int64           `json:"to"`
+	FromTime time.Time       `json:"from_time"`
+	ToTime   time.Time       `json:"to_time"`
+	Changes  []StorageChange `json:"changes"`
+	expires  time.Time
+}
+
+func (t StorageDiff) LastModified() time.Time { return t.ToTime }
+func (t StorageDiff) Expires() time.Time      { return t.expires }
+
+var _ server.Resource = (*StorageDiff)(nil)
+
+func ReadContractStorageDiff(ctx *server.Context) (interface{}, int) {
+	args := &ContractRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+
+	if args.From == "" || args.To == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing from or to block", nil))
+	}
+	if args.FromHeight > args.ToHeight {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "from block must not be after to block", nil))
+	}
+	if args.ToHeight < cc.FirstSeen {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "empty storage before origination", nil))
+	}
+	// from=0 compares against the origination state
+	if args.FromHeight < cc.FirstSeen {
+		args.FromHeight = cc.FirstSeen
+	}
+	ctx.CheckPruned(model.StorageTableKey, args.FromHeight, args.ToHeight)
+	if cc.Address.IsRollup() {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no script", nil))
+	}
+	script, err := cc.LoadScript()
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "script unmarshal failed", err))
+	}
+	if script == nil {
+		return nil, http.StatusNoContent
+	}
+
+	resp := &StorageDiff{
+		Contract: cc.Address.String(),
+		From:     args.FromHeight,
+		To:       args.ToHeight,
+		FromTime: ctx.Indexer.LookupBlockTime(ctx.Context, args.FromHeight),
+		ToTime:   ctx.Indexer.LookupBlockTime(ctx.Context, args.ToHeight),
+		Changes:  make([]StorageChange, 0),
+		expires:  ctx.Expires,
+	}
+	from := storageTree(ctx, cc, script.StorageType(), args.FromHeight, args)
+	to := storageTree(ctx, cc, script.StorageType(), args.ToHeight, args)
+	diffStorageTree("", from, to, &resp.Changes)
+	if args.Bigmaps {
+		diffStorageBigmaps(ctx, cc, args.FromHeight, args.ToHeight, args, &resp.Changes)
+	}
+	return resp, http.StatusOK
+}
+
+// storageTree renders storage at height into plain JSON values for comparison.
+func storageTree(ctx *server.Context, cc *model.Contract, typ micheline.Type, height int64, args *ContractRequest) map[string]interface{} {
+	tree := make(map[string]interface{})
+	if height < cc.FirstSeen {
+		return tree
+	}
+	// historic storage is located via the last call in the op table
+	if height < cc.LastSeen {
+		ctx.CheckPruned(model.OpTableKey, height)
+	}
+	data, _, err := ctx.Indexer.ContractStorageAt(ctx, cc, height, ctx.Client)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot load storage", err))
+	}
+	tree["storage"] = plainValue(NewStorage(ctx, data, typ, time.Time{}, args).Value)
+	return tree
+}
+
+// diffStorageBigmaps appends bigmap changes between from and to. Only keys
+// updated in between are loaded and compared against their value at from,
+// so results do not depend on bigmap size. Bigmaps removed in between are
+// reported as a whole.
+func diffStorageBigmaps(ctx *server.Context, cc *model.Contract, from, to int64, args *ContractRequest, res *[]StorageChange) {
+	table, err := ctx.Indexer.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access bigmap updates table", err))
+	}
+	ctx.CheckPruned(model.BigmapUpdateTableKey, from)
+	before, err := ctx.Indexer.ListContractBigmaps(ctx.Context, cc.AccountId, from)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list bigmaps", err))
+	}
+	after, err := ctx.Indexer.ListContractBigmaps(ctx.Context, cc.AccountId, to)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list bigmaps", err))
+	}
+	names := make(map[int64]string)
+	for n, v := range cc.NamedBigmaps(before) {
+		names[v] = n
+	}
+	for n, v := range cc.NamedBigmaps(after) {
+		names[v] = n
+	}
+	bigmapPath := func(id int64) string {
+		name, ok := names[id]
+		if !ok || name == "" {
+			name = strconv.FormatInt(id, 10)
+		}
+		return joinPath("bigmaps", name)
+	}
+
+	changes := make([]StorageChange, 0)
+	existed := make(map[int64]bool, len(before))
+	for _, alloc := range before {
+		existed[alloc.BigmapId] = true
+	}
+	exists := make(map[int64]bool, len(after))
+	for _, alloc := range after {
+		exists[alloc.BigmapId] = true
+	}
+	for _, alloc := range before {
+		if !exists[alloc.BigmapId] {
+			changes = append(changes, StorageChange{
+				Path:   bigmapPath(alloc.BigmapId),
+				Action: "removed",
+				Old:    alloc.BigmapId,
+			})
+		}
+	}
+
+	maxKeys := int(ctx.Cfg.Http.MaxListCount)
+	var nKeys int
+	for _, alloc := range after {
+		// last update per key in (from, to]
+		last := make(map[mavryk.ExprHash]model.BigmapUpdate)
+		keys := make([]mavryk.ExprHash, 0)
+		err := pack.NewQuery("api.storage_diff.bigmap").
+			WithTable(table).
+			AndEqual("bigmap_id", alloc.BigmapId).
+			AndGt("height", from).
+			AndLte("height", to).
+			Stream(ctx, func(r pack.Row) error {
+				u := model.BigmapUpdate{}
+				if err := r.Decode(&u); err != nil {
+					return err
+				}
+				switch u.Action {
+				case micheline.DiffActionUpdate, micheline.DiffActionRemove:
+				default:
+					return nil
+				}
+				// skip bigmap removal
+				if len(u.Key) == 0 {
+					return nil
+				}
+				h := u.GetKeyHash()
+				if _, ok := last[h]; !ok {
+					if nKeys++; nKeys > maxKeys {
+						return errTooManyBigmapChanges
+					}
+					keys = append(keys, h)
+				}
+				last[h] = u
+				return nil
+			})
+		switch err {
+		case nil:
+		case errTooManyBigmapChanges:
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "too many bigmap changes, narrow block range", nil))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap updates", err))
+		}
+
+		keyType, valueType := alloc.GetKeyType(), alloc.GetValueType()
+		path := bigmapPath(alloc.BigmapId)
+		for _, h := range keys {
+			u := last[h]
+			key, err := u.GetKey(keyType)
+			if err != nil {
+				log.Errorf("explorer: decode bigmap key: %v", err)
+				continue
+			}
+			var oldVal, newVal interface{}
+			if existed[alloc.BigmapId] {
+				prev, err := ctx.Indexer.ListBigmapUpdates(ctx.Context, etl.ListRequest{
+					BigmapId:  alloc.BigmapId,
+					BigmapKey: h,
+					Until:     from,
+					Order:     pack.OrderDesc,
+					Limit:     1,
+				})
+				if err != nil {
+					panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap updates", err))
+				}
+				if len(prev) > 0 && prev[0].Action == micheline.DiffActionUpdate {
+					oldVal = plainBigmapValue(prev[0].GetValue(valueType), args)
+				}
+			}
+			if u.Action == micheline.DiffActionUpdate {
+				newVal = plainBigmapValue(u.GetValue(valueType), args)
+			}
+			if args.WithUnpack() && key.IsPacked() {
+				if up, err := key.Unpack(); err == nil {
+					key = up
+				}
+			}
+			p := joinPath(path, key.String())
+			switch {
+			case oldVal == nil && newVal == nil:
+			case oldVal == nil:
+				changes = append(changes, StorageChange{Path: p, Action: "added", New: newVal})
+			case newVal == nil:
+				changes = append(changes, StorageChange{Path: p, Action: "removed", Old: oldVal})
+			case !reflect.DeepEqual(oldVal, newVal):
+				changes = append(changes, StorageChange{Path: p, Action: "changed", Old: oldVal, New: newVal})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	*res = append(*res, changes...)
+}
+
+var errTooManyBigmapChanges = errors.New("too many bigmap changes")
+
+func plainBigmapValue(v micheline.Value, args server.Options) interface{} {
+	if args.WithUnpack() && v.IsPackedAny() {
+		if up, err := v.UnpackAll(); err == nil {
+			v = up
+		}
+	}
+	return plainValue(&v)
+}
+
+// plainValue converts rendered values into generic JSON types.
+func plainValue(v interface{}) interface{} {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var res interface{}
+	_ = json.Unmarshal(buf, &res)
+	return res
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffStorageTree(path string, a, b interface{}, res *[]StorageChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			o, inA := av[k]
+			n, inB := bv[k]
+			switch {
+			case !inA:
+				*res = append(*res, StorageChange{Path: joinPath(path, k), Action: "added", New: n})
+			case !inB:
+				*res = append(*res, StorageChange{Path: joinPath(path, k), Action: "removed", Old: o})
+			default:
+				diffStorageTree(joinPath(path, k), o, n, res)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			p := joinPath(path, fmt.Sprint(i))
+			switch {
+			case i >= len(av):
+				*res = append(*res, StorageChange{Path: p, Action: "added", New: bv[i]})
+			case i >= len(bv):
+				*res = append(*res, StorageChange{Path: p, Action: "removed", Old: av[i]})
+			default:
+				diffStorageTree(p, av[i], bv[i], res)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*res = append(*res, StorageChange{Path: path, Action: "changed", Old: a, New: b})
+	}
+}
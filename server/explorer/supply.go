@@ -11,6 +11,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/mavryk-network/mvindex/etl"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/rpc"
 	"github.com/mavryk-network/mvindex/server"
@@ -147,3 +148,84 @@ func ReadSupply(ctx *server.Context) (interface{}, int) {
 		return Supply{*s, ctx.Crawler.Params()}, http.StatusOK
 	}
 }
+
+var _ server.Resource = (*SupplyAudit)(nil)
+
+// SupplyAudit reports exact mumav amounts, no conversion applied
+type SupplyAudit struct {
+	*etl.SupplyAudit
+	lastmod time.Time
+	expires time.Time
+}
+
+func (a SupplyAudit) LastModified() time.Time {
+	return a.lastmod
+}
+
+func (a SupplyAudit) Expires() time.Time {
+	return a.expires
+}
+
+// parseAuditCycle reads the cycle path argument, head resolves to the cycle
+// containing the tip when current is set and to the last completed cycle
+// otherwise.
+func parseAuditCycle(ctx *server.Context, current bool) int64 {
+	id, ok := mux.Vars(ctx.Request)["cycle"]
+	if !ok || id == "" {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing cycle", nil))
+	}
+	if id == "head" {
+		height := ctx.Tip.BestHeight
+		cycle := ctx.Params.HeightToCycle(height)
+		if !current && ctx.Params.CycleEndHeight(cycle) != height {
+			cycle--
+		}
+		return max(cycle, 0)
+	}
+	val, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || val < 0 {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid cycle", err))
+	}
+	return val
+}
+
+// ReadSupplyAudit returns the audit stored at cycle end when supply
+// validation is enabled.
+func ReadSupplyAudit(ctx *server.Context) (interface{}, int) {
+	cycle := parseAuditCycle(ctx, false)
+	audit, err := ctx.Indexer.SupplyAuditByCycle(ctx, cycle)
+	if err != nil {
+		switch err {
+		case etl.ErrNoAudit:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no audit for this cycle", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "cannot read supply audit", err))
+		}
+	}
+	return SupplyAudit{
+		SupplyAudit: audit,
+		lastmod:     ctx.Indexer.LookupBlockTime(ctx, audit.EndHeight),
+		expires:     ctx.Now.Add(ctx.Cfg.Http.CacheMaxExpires),
+	}, http.StatusOK
+}
+
+// RunSupplyAudit reconciles supply for any cycle up to the current tip. This
+// scans all account and baker balances and queries the node, so it is only
+// registered as system route.
+func RunSupplyAudit(ctx *server.Context) (interface{}, int) {
+	cycle := parseAuditCycle(ctx, true)
+	height := ctx.Tip.BestHeight
+	audit, err := ctx.Indexer.AuditSupply(ctx, cycle, height)
+	if err != nil {
+		switch err {
+		case model.ErrNoCycle, model.ErrNoSupply:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such cycle", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "cannot audit supply", err))
+		}
+	}
+	return SupplyAudit{
+		SupplyAudit: audit,
+		lastmod:     ctx.Tip.BestTime,
+	}, http.StatusOK
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// Ticket graph node kinds. Mints originate at the ticketer node, burns end
+// at a virtual burn node.
+const (
+	TicketNodeTicketer = "ticketer"
+	TicketNodeContract = "contract"
+	TicketNodeImplicit = "implicit"
+	TicketNodeRollup   = "rollup"
+	TicketNodeBurn     = "burn"
+)
+
+type TicketGraphRequest struct {
+	TicketListRequest
+	From   int64  `schema:"from"`   // first height, inclusive
+	To     int64  `schema:"to"`     // last height, inclusive, default head
+	Format string `schema:"format"` // json, dot or graphml
+}
+
+func (r *TicketGraphRequest) Parse(ctx *server.Context) {
+	if r.To <= 0 || r.To > ctx.Tip.BestHeight {
+		r.To = ctx.Tip.BestHeight
+	}
+	if r.From > r.To {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "from height after to height", nil))
+	}
+	switch r.Format {
+	case "":
+		r.Format = "json"
+	case "json", "dot", "graphml":
+	default:
+		panic(server.EBadRequest(server.EC_CONTENTTYPE_UNSUPPORTED, "unsupported format '"+r.Format+"'", nil))
+	}
+}
+
+type TicketNode struct {
+	Address  string   `json:"address"`
+	Kind     string   `json:"kind"`
+	Balance  mavryk.Z `json:"balance"` // current balance
+	Received mavryk.Z `json:"received"`
+	Sent     mavryk.Z `json:"sent"`
+	id       model.AccountID
+}
+
+type TicketEdge struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Amount      mavryk.Z `json:"amount"`
+	Count       int      `json:"count"`
+	FirstHeight int64    `json:"first_height"`
+	LastHeight  int64    `json:"last_height"`
+}
+
+// TicketGraph is the directed transfer graph of a single ticket type
+// within a height range.
+type TicketGraph struct {
+	Ticket     *Ticket       `json:"ticket"`
+	FromHeight int64         `json:"from_height"`
+	ToHeight   int64         `json:"to_height"`
+	Nodes      []*TicketNode `json:"nodes"`
+	Edges      []*TicketEdge `json:"edges"`
+}
+
+// ReadTicketGraph traces the flow of a ticket type from its ticketer through
+// contracts, implicit accounts and rollups as graph of aggregated transfers.
+func ReadTicketGraph(ctx *server.Context) (any, int) {
+	var args TicketGraphRequest
+	ctx.ParseRequestArgs(&args)
+	issuer := loadAccount(ctx)
+	tick, err := args.Load(ctx, issuer.Address)
+	if err != nil {
+		panic(err)
+	}
+	ctx.CheckPruned(model.TicketEventTableKey, args.From)
+
+	events, err := ctx.Indexer.Table(model.TicketEventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket events table", err))
+	}
+
+	type edgeKey struct {
+		from, to model.AccountID
+	}
+	var (
+		graph = &TicketGraph{
+			Ticket:     NewTicket(ctx, tick),
+			FromHeight: args.From,
+			ToHeight:   args.To,
+			Nodes:      make([]*TicketNode, 0),
+			Edges:      make([]*TicketEdge, 0),
+		}
+		nodes = make(map[model.AccountID]*TicketNode)
+		edges = make(map[edgeKey]*TicketEdge)
+		burn  = &TicketNode{Address: TicketNodeBurn, Kind: TicketNodeBurn}
+		ev    model.TicketEvent
+	)
+	node := func(id model.AccountID) *TicketNode {
+		if id == 0 {
+			return burn
+		}
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		addr := ctx.Indexer.LookupAddress(ctx, id)
+		n := &TicketNode{Address: addr.String(), Kind: ticketNodeKind(addr, id == tick.Ticketer), id: id}
+		nodes[id] = n
+		graph.Nodes = append(graph.Nodes, n)
+		return n
+	}
+
+	err = pack.NewQuery("api.ticket_graph").
+		WithTable(events).
+		AndEqual("ticket", tick.Id).
+		AndRange("height", args.From, args.To).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&ev); err != nil {
+				return err
+			}
+			src, dst := ev.Sender, ev.Receiver
+			if ev.Type == model.TicketEventTypeMint {
+				src = tick.Ticketer
+			}
+			from, to := node(src), node(dst)
+			from.Sent = from.Sent.Add(ev.Amount)
+			to.Received = to.Received.Add(ev.Amount)
+			k := edgeKey{src, dst}
+			e, ok := edges[k]
+			if !ok {
+				e = &TicketEdge{From: from.Address, To: to.Address, FirstHeight: ev.Height}
+				edges[k] = e
+				graph.Edges = append(graph.Edges, e)
+			}
+			e.Amount = e.Amount.Add(ev.Amount)
+			e.Count++
+			e.LastHeight = ev.Height
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list ticket events", err))
+	}
+	if !burn.Received.IsZero() {
+		graph.Nodes = append(graph.Nodes, burn)
+	}
+
+	// add current balances
+	if len(nodes) > 0 {
+		owners, err := ctx.Indexer.Table(model.TicketOwnerTableKey)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket owners table", err))
+		}
+		var ownr model.TicketOwner
+		err = pack.NewQuery("api.ticket_graph_balances").
+			WithTable(owners).
+			WithFields("account", "balance").
+			AndEqual("ticket", tick.Id).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(&ownr); err != nil {
+					return err
+				}
+				if n, ok := nodes[ownr.Account]; ok {
+					n.Balance = ownr.Balance
+				}
+				return nil
+			})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list ticket balances", err))
+		}
+	}
+
+	switch args.Format {
+	case "dot":
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/vnd.graphviz")
+		return graph.MarshalDOT(), http.StatusOK
+	case "graphml":
+		ctx.ResponseWriter.Header().Set("Content-Type", "application/graphml+xml")
+		return graph.MarshalGraphML(), http.StatusOK
+	default:
+		return graph, http.StatusOK
+	}
+}
+
+func ticketNodeKind(addr mavryk.Address, isTicketer bool) string {
+	switch {
+	case isTicketer:
+		return TicketNodeTicketer
+	case addr.IsRollup():
+		return TicketNodeRollup
+	case addr.IsContract():
+		return TicketNodeContract
+	default:
+		return TicketNodeImplicit
+	}
+}
+
+// MarshalDOT renders the graph in Graphviz DOT format.
+func (g *TicketGraph) MarshalDOT() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("digraph ticket {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "ellipse"
+		switch n.Kind {
+		case TicketNodeTicketer:
+			shape = "doubleoctagon"
+		case TicketNodeContract:
+			shape = "box"
+		case TicketNodeRollup:
+			shape = "cylinder"
+		case TicketNodeBurn:
+			shape = "point"
+		}
+		fmt.Fprintf(buf, "  %s [kind=%s, shape=%s, balance=%s];\n",
+			strconv.Quote(n.Address), n.Kind, shape, strconv.Quote(n.Balance.String()))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(buf, "  %s -> %s [label=%s, amount=%s, count=%d];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Amount.String()),
+			strconv.Quote(e.Amount.String()), e.Count)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// MarshalGraphML renders the graph in GraphML format.
+func (g *TicketGraph) MarshalGraphML() []byte {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	buf.WriteString(`  <key id="kind" for="node" attr.name="kind" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <key id="balance" for="node" attr.name="balance" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <key id="amount" for="edge" attr.name="amount" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <key id="count" for="edge" attr.name="count" attr.type="int"/>` + "\n")
+	buf.WriteString(`  <key id="first_height" for="edge" attr.name="first_height" attr.type="long"/>` + "\n")
+	buf.WriteString(`  <key id="last_height" for="edge" attr.name="last_height" attr.type="long"/>` + "\n")
+	buf.WriteString(`  <graph id="ticket" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(buf, "    <node id=\"%s\"><data key=\"kind\">%s</data><data key=\"balance\">%s</data></node>\n",
+			esc(n.Address), n.Kind, n.Balance.String())
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(buf, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"><data key=\"amount\">%s</data><data key=\"count\">%d</data><data key=\"first_height\">%d</data><data key=\"last_height\">%d</data></edge>\n",
+			i, esc(e.From), esc(e.To), e.Amount.String(), e.Count, e.FirstHeight, e.LastHeight)
+	}
+	buf.WriteString("  </graph>\n</graphml>\n")
+	return buf.Bytes()
+}
+
+type TicketSupplyHolder struct {
+	Address string   `json:"address"`
+	Kind    string   `json:"kind"`
+	Balance mavryk.Z `json:"balance"`
+}
+
+// TicketSupply breaks down where the supply of a ticket type is held now.
+// Unaccounted is the difference between total supply and the sum of all
+// balances and must be zero unless tickets leak.
+type TicketSupply struct {
+	Ticket          *Ticket               `json:"ticket"`
+	TotalSupply     mavryk.Z              `json:"total_supply"`
+	TotalMint       mavryk.Z              `json:"total_mint"`
+	TotalBurn       mavryk.Z              `json:"total_burn"`
+	L1Balance       mavryk.Z              `json:"l1_balance"`
+	ContractBalance mavryk.Z              `json:"contract_balance"`
+	ImplicitBalance mavryk.Z              `json:"implicit_balance"`
+	RollupBalance   mavryk.Z              `json:"rollup_balance"`
+	Unaccounted     mavryk.Z              `json:"unaccounted"`
+	Rollups         []*TicketSupplyHolder `json:"rollups"`
+	Top             []*TicketSupplyHolder `json:"top_l1_holders"`
+}
+
+// ReadTicketSupply returns current ticket supply split into L1 balances and
+// balances held by rollups.
+func ReadTicketSupply(ctx *server.Context) (any, int) {
+	var args TicketListRequest
+	ctx.ParseRequestArgs(&args)
+	issuer := loadAccount(ctx)
+	tick, err := args.Load(ctx, issuer.Address)
+	if err != nil {
+		panic(err)
+	}
+
+	owners, err := ctx.Indexer.Table(model.TicketOwnerTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket owners table", err))
+	}
+
+	resp := &TicketSupply{
+		Ticket:      NewTicket(ctx, tick),
+		TotalSupply: tick.Supply,
+		TotalMint:   tick.TotalMint,
+		TotalBurn:   tick.TotalBurn,
+		Rollups:     make([]*TicketSupplyHolder, 0),
+		Top:         make([]*TicketSupplyHolder, 0),
+	}
+	var (
+		ownr model.TicketOwner
+		sum  mavryk.Z
+	)
+	err = pack.NewQuery("api.ticket_supply").
+		WithTable(owners).
+		WithFields("account", "balance").
+		AndEqual("ticket", tick.Id).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&ownr); err != nil {
+				return err
+			}
+			if ownr.Balance.IsZero() {
+				return nil
+			}
+			sum = sum.Add(ownr.Balance)
+			addr := ctx.Indexer.LookupAddress(ctx, ownr.Account)
+			h := &TicketSupplyHolder{
+				Address: addr.String(),
+				Kind:    ticketNodeKind(addr, ownr.Account == tick.Ticketer),
+				Balance: ownr.Balance,
+			}
+			switch h.Kind {
+			case TicketNodeRollup:
+				resp.RollupBalance = resp.RollupBalance.Add(ownr.Balance)
+				resp.Rollups = append(resp.Rollups, h)
+				return nil
+			case TicketNodeImplicit:
+				resp.ImplicitBalance = resp.ImplicitBalance.Add(ownr.Balance)
+			default:
+				resp.ContractBalance = resp.ContractBalance.Add(ownr.Balance)
+			}
+			resp.L1Balance = resp.L1Balance.Add(ownr.Balance)
+			resp.Top = append(resp.Top, h)
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list ticket balances", err))
+	}
+	resp.Unaccounted = tick.Supply.Sub(sum)
+
+	byBalance := func(l []*TicketSupplyHolder) func(i, j int) bool {
+		return func(i, j int) bool { return l[i].Balance.Cmp(l[j].Balance) > 0 }
+	}
+	sort.Slice(resp.Rollups, byBalance(resp.Rollups))
+	sort.Slice(resp.Top, byBalance(resp.Top))
+	if n := int(ctx.Cfg.ClampExplore(args.Limit)); len(resp.Top) > n {
+		resp.Top = resp.Top[:n]
+	}
+	return resp, http.StatusOK
+}
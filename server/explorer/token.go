@@ -84,6 +84,7 @@ func (t Token) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/{ident}", server.C(ReadToken)).Methods("GET").Name("token")
 	r.HandleFunc("/{ident}/events", server.C(ListTokenEvents)).Methods("GET")
 	r.HandleFunc("/{ident}/balances", server.C(ListTokenBalances)).Methods("GET")
+	r.HandleFunc("/{ident}/holders", server.C(ListTokenHolders)).Methods("GET")
 	return nil
 }
 
@@ -5,9 +5,13 @@ package explorer
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvindex/server"
 )
 
 var null = []byte(`null`)
@@ -39,6 +43,40 @@ func (r ListRequest) Mode() pack.FilterMode {
 	return pack.FilterModeLt
 }
 
+// withTimeFilter adds the optional time.gt/gte/lt/lte/rg query argument as
+// condition on the time column of daily aggregate tables.
+func withTimeFilter(ctx *server.Context, q pack.Query) pack.Query {
+	if mode, val, ok := server.Query(ctx, "time"); ok {
+		switch mode {
+		case pack.FilterModeGt, pack.FilterModeGte, pack.FilterModeLt, pack.FilterModeLte:
+			tm, err := util.ParseTime(val)
+			if err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time value %q", val), err))
+			}
+			q = q.And("time", mode, tm.Time())
+
+		case pack.FilterModeRange:
+			from, to, ok := strings.Cut(val, ",")
+			if !ok {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time range value %q", val), nil))
+			}
+			fromTime, err := util.ParseTime(from)
+			if err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid from time value %q", val), err))
+			}
+			toTime, err := util.ParseTime(to)
+			if err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid to time value %q", val), err))
+			}
+			q = q.AndRange("time", fromTime.Time(), toTime.Time())
+
+		default:
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time mode %q", mode), nil))
+		}
+	}
+	return q
+}
+
 type NullMoney int64
 
 func (m NullMoney) MarshalJSON() ([]byte, error) {
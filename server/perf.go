@@ -4,9 +4,14 @@
 package server
 
 import (
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 type PerformanceCounter struct {
@@ -47,3 +52,131 @@ func (p *PerformanceCounter) WriteResponseTrailer(w http.ResponseWriter) {
 func (p *PerformanceCounter) Since() time.Duration {
 	return time.Since(p.start)
 }
+
+// latency histogram bucket upper bounds, last bucket is unbounded
+var routeBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+type routeCounter struct {
+	calls   int64
+	errors  int64
+	sum     time.Duration
+	max     time.Duration
+	buckets [15]int64
+}
+
+func (c *routeCounter) add(d time.Duration, isError bool) {
+	c.calls++
+	if isError {
+		c.errors++
+	}
+	c.sum += d
+	if d > c.max {
+		c.max = d
+	}
+	i := sort.Search(len(routeBuckets), func(i int) bool { return d <= routeBuckets[i] })
+	c.buckets[i]++
+}
+
+// quantile estimates the q-th latency quantile as the upper bound of the
+// histogram bucket containing it.
+func (c *routeCounter) quantile(q float64) time.Duration {
+	if c.calls == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(c.calls)))
+	var n int64
+	for i, v := range c.buckets {
+		n += v
+		if n >= rank {
+			if i < len(routeBuckets) {
+				return min(routeBuckets[i], c.max)
+			}
+			break
+		}
+	}
+	return c.max
+}
+
+// RouteStats reports API call latencies per route in milliseconds.
+type RouteStats struct {
+	Route  string  `json:"route"`
+	Calls  int64   `json:"calls"`
+	Errors int64   `json:"errors"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+var routeStats = struct {
+	sync.Mutex
+	m map[string]*routeCounter
+}{
+	m: make(map[string]*routeCounter),
+}
+
+func recordRouteLatency(route string, d time.Duration, status int) {
+	routeStats.Lock()
+	defer routeStats.Unlock()
+	c, ok := routeStats.m[route]
+	if !ok {
+		c = &routeCounter{}
+		routeStats.m[route] = c
+	}
+	c.add(d, status >= 500)
+}
+
+// recordLatency adds the time since request start to the statistics of the
+// matched route.
+func (api *Context) recordLatency() {
+	route := mux.CurrentRoute(api.Request)
+	if route == nil {
+		return
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return
+	}
+	recordRouteLatency(api.Request.Method+" "+tpl, time.Since(api.Now), api.status)
+}
+
+// GetRouteStats returns latency statistics for all routes called since
+// server start, sorted by route.
+func GetRouteStats() []RouteStats {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	routeStats.Lock()
+	res := make([]RouteStats, 0, len(routeStats.m))
+	for n, c := range routeStats.m {
+		res = append(res, RouteStats{
+			Route:  n,
+			Calls:  c.calls,
+			Errors: c.errors,
+			Mean:   ms(c.sum) / float64(c.calls),
+			P50:    ms(c.quantile(0.50)),
+			P95:    ms(c.quantile(0.95)),
+			P99:    ms(c.quantile(0.99)),
+			Max:    ms(c.max),
+		})
+	}
+	routeStats.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Route < res[j].Route })
+	return res
+}
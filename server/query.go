@@ -5,9 +5,11 @@ package server
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
 )
 
 func Query(ctx *Context, key string) (mode pack.FilterMode, val string, ok bool) {
@@ -32,3 +34,54 @@ func Query(ctx *Context, key string) (mode pack.FilterMode, val string, ok bool)
 	}
 	return
 }
+
+// QueryHeights returns the block heights referenced by filter conditions on
+// column height and timestamp column tm in the request query. Times resolve
+// to the block height at that time. Negated conditions do not bound the
+// result and are skipped.
+func QueryHeights(ctx *Context, height, tm string) []int64 {
+	heights := make([]int64, 0)
+	for n, vals := range ctx.Request.URL.Query() {
+		k, m, _ := strings.Cut(n, ".")
+		if k != height && k != tm {
+			continue
+		}
+		mode := pack.FilterModeEqual
+		if m != "" {
+			mode = pack.ParseFilterMode(m)
+		}
+		for _, val := range vals {
+			var list []string
+			switch mode {
+			case pack.FilterModeEqual, pack.FilterModeGt, pack.FilterModeGte,
+				pack.FilterModeLt, pack.FilterModeLte:
+				list = []string{val}
+			case pack.FilterModeIn, pack.FilterModeRange:
+				list = strings.Split(val, ",")
+			default:
+				continue
+			}
+			for _, v := range list {
+				var h int64
+				if k == height {
+					var err error
+					h, err = strconv.ParseInt(v, 10, 64)
+					if err != nil {
+						panic(EBadRequest(EC_PARAM_INVALID, fmt.Sprintf("invalid %s filter value '%s'", n, v), err))
+					}
+				} else {
+					t, err := util.ParseTime(v)
+					if err != nil {
+						panic(EBadRequest(EC_PARAM_INVALID, fmt.Sprintf("invalid %s filter value '%s'", n, v), err))
+					}
+					h = ctx.Indexer.LookupBlockHeightFromTime(ctx, t.Time())
+				}
+				if mode == pack.FilterModeGt {
+					h++
+				}
+				heights = append(heights, h)
+			}
+		}
+	}
+	return heights
+}
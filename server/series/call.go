@@ -0,0 +1,394 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package series
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+var (
+	callSeriesNames = util.StringList([]string{"time", "n_calls", "volume", "gas_used", "storage_burn"})
+)
+
+// configurable marshalling helper
+//
+// Note: distinct senders are only counted per day and cannot be summed over
+// buckets, they are available from the explorer entrypoint stats instead.
+type CallSeries struct {
+	Timestamp   time.Time `json:"time"`
+	NCalls      int       `json:"n_calls"`
+	Volume      int64     `json:"volume"`
+	GasUsed     int64     `json:"gas_used"`
+	StorageBurn int64     `json:"storage_burn"`
+
+	columns util.StringList // cond. cols & order when brief
+	params  *rpc.Params
+	verbose bool
+	null    bool
+}
+
+var _ SeriesBucket = (*CallSeries)(nil)
+
+func (s *CallSeries) Init(params *rpc.Params, columns []string, verbose bool) {
+	s.params = params
+	s.columns = columns
+	s.verbose = verbose
+}
+
+func (s *CallSeries) IsEmpty() bool {
+	return s.NCalls == 0
+}
+
+func (s *CallSeries) Add(m SeriesModel) {
+	o := m.(*model.CallStat)
+	s.NCalls += o.NCalls
+	s.Volume += o.Volume
+	s.GasUsed += o.GasUsed
+	s.StorageBurn += o.StorageBurn
+}
+
+func (s *CallSeries) Reset() {
+	s.Timestamp = time.Time{}
+	s.NCalls = 0
+	s.Volume = 0
+	s.GasUsed = 0
+	s.StorageBurn = 0
+	s.null = false
+}
+
+func (s *CallSeries) Null(ts time.Time) SeriesBucket {
+	s.Reset()
+	s.Timestamp = ts
+	s.null = true
+	return s
+}
+
+func (s *CallSeries) Zero(ts time.Time) SeriesBucket {
+	s.Reset()
+	s.Timestamp = ts
+	return s
+}
+
+func (s *CallSeries) SetTime(ts time.Time) SeriesBucket {
+	s.Timestamp = ts
+	return s
+}
+
+func (s *CallSeries) Time() time.Time {
+	return s.Timestamp
+}
+
+func (s *CallSeries) Clone() SeriesBucket {
+	return &CallSeries{
+		Timestamp:   s.Timestamp,
+		NCalls:      s.NCalls,
+		Volume:      s.Volume,
+		GasUsed:     s.GasUsed,
+		StorageBurn: s.StorageBurn,
+		columns:     s.columns,
+		params:      s.params,
+		verbose:     s.verbose,
+		null:        s.null,
+	}
+}
+
+func (s *CallSeries) Interpolate(m SeriesBucket, ts time.Time) SeriesBucket {
+	o := m.(*CallSeries)
+	weight := float64(ts.Sub(s.Timestamp)) / float64(o.Timestamp.Sub(s.Timestamp))
+	if math.IsInf(weight, 1) {
+		weight = 1
+	}
+	switch weight {
+	case 0:
+		return s
+	default:
+		return &CallSeries{
+			Timestamp:   ts,
+			NCalls:      s.NCalls + int(weight*float64(o.NCalls-s.NCalls)),
+			Volume:      s.Volume + int64(weight*float64(o.Volume-s.Volume)),
+			GasUsed:     s.GasUsed + int64(weight*float64(o.GasUsed-s.GasUsed)),
+			StorageBurn: s.StorageBurn + int64(weight*float64(o.StorageBurn-s.StorageBurn)),
+			columns:     s.columns,
+			params:      s.params,
+			verbose:     s.verbose,
+			null:        false,
+		}
+	}
+}
+
+func (s *CallSeries) MarshalJSON() ([]byte, error) {
+	if s.verbose {
+		return s.MarshalJSONVerbose()
+	} else {
+		return s.MarshalJSONBrief()
+	}
+}
+
+func (s *CallSeries) MarshalJSONVerbose() ([]byte, error) {
+	call := struct {
+		Timestamp   time.Time `json:"time"`
+		NCalls      int       `json:"n_calls"`
+		Volume      float64   `json:"volume"`
+		GasUsed     int64     `json:"gas_used"`
+		StorageBurn float64   `json:"storage_burn"`
+	}{
+		Timestamp:   s.Timestamp,
+		NCalls:      s.NCalls,
+		Volume:      s.params.ConvertValue(s.Volume),
+		GasUsed:     s.GasUsed,
+		StorageBurn: s.params.ConvertValue(s.StorageBurn),
+	}
+	return json.Marshal(call)
+}
+
+func (s *CallSeries) MarshalJSONBrief() ([]byte, error) {
+	dec := s.params.Decimals
+	buf := make([]byte, 0, 2048)
+	buf = append(buf, '[')
+	for i, v := range s.columns {
+		if s.null {
+			switch v {
+			case "time":
+				buf = strconv.AppendInt(buf, util.UnixMilliNonZero(s.Timestamp), 10)
+			default:
+				buf = append(buf, null...)
+			}
+		} else {
+			switch v {
+			case "time":
+				buf = strconv.AppendInt(buf, util.UnixMilliNonZero(s.Timestamp), 10)
+			case "n_calls":
+				buf = strconv.AppendInt(buf, int64(s.NCalls), 10)
+			case "volume":
+				buf = strconv.AppendFloat(buf, s.params.ConvertValue(s.Volume), 'f', dec, 64)
+			case "gas_used":
+				buf = strconv.AppendInt(buf, s.GasUsed, 10)
+			case "storage_burn":
+				buf = strconv.AppendFloat(buf, s.params.ConvertValue(s.StorageBurn), 'f', dec, 64)
+			default:
+				continue
+			}
+		}
+		if i < len(s.columns)-1 {
+			buf = append(buf, ',')
+		}
+	}
+	buf = append(buf, ']')
+	return buf, nil
+}
+
+func (s *CallSeries) MarshalCSV() ([]string, error) {
+	dec := s.params.Decimals
+	res := make([]string, len(s.columns))
+	for i, v := range s.columns {
+		if s.null {
+			switch v {
+			case "time":
+				res[i] = strconv.Quote(s.Timestamp.Format(time.RFC3339))
+			default:
+				continue
+			}
+		}
+		switch v {
+		case "time":
+			res[i] = strconv.Quote(s.Timestamp.Format(time.RFC3339))
+		case "n_calls":
+			res[i] = strconv.FormatInt(int64(s.NCalls), 10)
+		case "volume":
+			res[i] = strconv.FormatFloat(s.params.ConvertValue(s.Volume), 'f', dec, 64)
+		case "gas_used":
+			res[i] = strconv.FormatInt(s.GasUsed, 10)
+		case "storage_burn":
+			res[i] = strconv.FormatFloat(s.params.ConvertValue(s.StorageBurn), 'f', dec, 64)
+		default:
+			continue
+		}
+	}
+	return res, nil
+}
+
+func (s *CallSeries) BuildQuery(ctx *server.Context, args *SeriesRequest) pack.Query {
+	// use chain params at current height
+	params := ctx.Params
+
+	// access table
+	table, err := ctx.Indexer.Table(args.Series)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("cannot access table '%s'", args.Series), err))
+	}
+
+	// time is auto-added from parser
+	if len(args.Columns) == 1 {
+		// use all series columns
+		args.Columns = callSeriesNames
+	}
+	// resolve short column names
+	srcNames := make([]string, 0, len(args.Columns))
+	for _, v := range args.Columns {
+		// ignore non-series columns
+		if !callSeriesNames.Contains(v) {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time-series column '%s'", v), nil))
+		}
+		srcNames = append(srcNames, v)
+	}
+	// always load call count to detect empty buckets
+	if !util.StringList(srcNames).Contains("n_calls") {
+		srcNames = append(srcNames, "n_calls")
+	}
+
+	// build table query
+	q := pack.NewQuery(ctx.RequestID).
+		WithTable(table).
+		WithFields(srcNames...).
+		WithOrder(args.Order).
+		AndRange("time", args.From.Time(), args.To.Time())
+
+	// entrypoint names can only be resolved for a single contract
+	var contract *model.Contract
+
+	// build dynamic filter conditions from query (will panic on error)
+	for key, val := range ctx.Request.URL.Query() {
+		keys := strings.Split(key, ".")
+		prefix := keys[0]
+		mode := pack.FilterModeEqual
+		if len(keys) > 1 {
+			mode = pack.ParseFilterMode(keys[1])
+			if !mode.IsValid() {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s'", keys[1]), nil))
+			}
+		}
+		switch prefix {
+		case "columns", "collapse", "start_date", "end_date", "limit", "order", "verbose", "filename", "fill", "entrypoint":
+			// skip these fields
+			continue
+
+		case "address":
+			field := "account_id" // contract
+			switch mode {
+			case pack.FilterModeEqual, pack.FilterModeNotEqual:
+				// single-address lookup and compile condition
+				addr, err := mavryk.ParseAddress(val[0])
+				if err != nil {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", val[0]), err))
+				}
+				acc, err := ctx.Indexer.LookupAccount(ctx, addr)
+				if err != nil && err != model.ErrNoAccount {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", val[0]), err))
+				}
+				// Note: when not found we insert an always false condition
+				if acc == nil || acc.RowId == 0 {
+					q = q.And(field, mode, uint64(math.MaxUint64))
+				} else {
+					// add id as extra condition
+					q = q.And(field, mode, acc.RowId)
+					if mode == pack.FilterModeEqual && acc.IsContract {
+						contract, _ = ctx.Indexer.LookupContractId(ctx, acc.RowId)
+					}
+				}
+			case pack.FilterModeIn, pack.FilterModeNotIn:
+				// multi-address lookup and compile condition
+				ids := make([]uint64, 0)
+				for _, v := range strings.Split(val[0], ",") {
+					addr, err := mavryk.ParseAddress(v)
+					if err != nil {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", v), err))
+					}
+					acc, err := ctx.Indexer.LookupAccount(ctx, addr)
+					if err != nil && err != model.ErrNoAccount {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", v), err))
+					}
+					// skip not found account
+					if acc == nil || acc.RowId == 0 {
+						continue
+					}
+					// collect list of account ids
+					ids = append(ids, acc.RowId.U64())
+				}
+				// Note: when list is empty (no accounts were found, the match will
+				//       always be false and return no result as expected)
+				q = q.And(field, mode, ids)
+			default:
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s' for column '%s'", mode, prefix), nil))
+			}
+		default:
+			// the same field name may appear multiple times, in which case conditions
+			// are combined like any other condition with logical AND
+			for _, v := range val {
+				// convert amounts from float to int64
+				switch prefix {
+				case "volume", "storage_burn":
+					fval, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s filter value '%s'", key, v), err))
+					}
+					v = strconv.FormatInt(params.ConvertAmount(fval), 10)
+				}
+				if cond, err := pack.ParseCondition(key, v, table.Fields()); err != nil {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s filter value '%s'", key, v), err))
+				} else {
+					q = q.AndCondition(cond)
+				}
+			}
+		}
+	}
+
+	// entrypoints may be given by id or by name when a single contract is selected
+	for key, val := range ctx.Request.URL.Query() {
+		keys := strings.Split(key, ".")
+		if keys[0] != "entrypoint" {
+			continue
+		}
+		mode := pack.FilterModeEqual
+		if len(keys) > 1 {
+			mode = pack.ParseFilterMode(keys[1])
+		}
+		switch mode {
+		case pack.FilterModeEqual, pack.FilterModeNotEqual, pack.FilterModeIn, pack.FilterModeNotIn:
+		default:
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s' for column '%s'", mode, keys[0]), nil))
+		}
+		var names []string
+		if contract != nil {
+			names = contract.EntrypointNames()
+		}
+		ids := make([]int, 0)
+		for _, v := range strings.Split(val[0], ",") {
+			if id, err := strconv.Atoi(v); err == nil {
+				ids = append(ids, id)
+				continue
+			}
+			if names == nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("entrypoint name '%s' requires a single contract address", v), nil))
+			}
+			id := util.StringList(names).Index(v)
+			if id < 0 {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unknown entrypoint '%s'", v), nil))
+			}
+			ids = append(ids, id)
+		}
+		switch mode {
+		case pack.FilterModeEqual, pack.FilterModeNotEqual:
+			if len(ids) != 1 {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid entrypoint filter '%s'", val[0]), nil))
+			}
+			q = q.And("entrypoint_id", mode, ids[0])
+		default:
+			q = q.And("entrypoint_id", mode, ids)
+		}
+	}
+
+	return q
+}
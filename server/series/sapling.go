@@ -0,0 +1,417 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package series
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+var (
+	saplingSeriesNames = util.StringList([]string{
+		"time",
+		"n_shield",
+		"n_unshield",
+		"n_transfer",
+		"n_inputs",
+		"n_outputs",
+		"shield_volume",
+		"unshield_volume",
+		"pool_balance",
+		"pool_commitments",
+		"pool_nullifiers",
+	})
+)
+
+// configurable marshalling helper
+//
+// Note: pool_balance, pool_commitments (the anonymity set size) and
+// pool_nullifiers are the latest values in each bucket and are only
+// meaningful when filtering for a single pool address.
+type SaplingSeries struct {
+	Timestamp       time.Time `json:"time"`
+	NShield         int       `json:"n_shield"`
+	NUnshield       int       `json:"n_unshield"`
+	NTransfer       int       `json:"n_transfer"`
+	NInputs         int       `json:"n_inputs"`
+	NOutputs        int       `json:"n_outputs"`
+	ShieldVolume    int64     `json:"shield_volume"`
+	UnshieldVolume  int64     `json:"unshield_volume"`
+	PoolBalance     int64     `json:"pool_balance"`
+	PoolCommitments int64     `json:"pool_commitments"`
+	PoolNullifiers  int64     `json:"pool_nullifiers"`
+
+	columns util.StringList // cond. cols & order when brief
+	params  *rpc.Params
+	verbose bool
+	null    bool
+	last    uint64 // row id of latest pool values
+}
+
+var _ SeriesBucket = (*SaplingSeries)(nil)
+
+func (s *SaplingSeries) Init(params *rpc.Params, columns []string, verbose bool) {
+	s.params = params
+	s.columns = columns
+	s.verbose = verbose
+}
+
+func (s *SaplingSeries) IsEmpty() bool {
+	return s.NShield+s.NUnshield+s.NTransfer == 0
+}
+
+func (s *SaplingSeries) Add(m SeriesModel) {
+	o := m.(*model.SaplingOp)
+	switch o.Kind {
+	case model.SaplingOpKindShield:
+		s.NShield++
+		s.ShieldVolume += o.Amount
+	case model.SaplingOpKindUnshield:
+		s.NUnshield++
+		s.UnshieldVolume -= o.Amount
+	default:
+		s.NTransfer++
+	}
+	s.NInputs += o.NInputs
+	s.NOutputs += o.NOutputs
+	if o.RowId >= s.last {
+		s.last = o.RowId
+		s.PoolBalance = o.PoolBalance
+		s.PoolCommitments = o.PoolCommitments
+		s.PoolNullifiers = o.PoolNullifiers
+	}
+}
+
+func (s *SaplingSeries) Reset() {
+	s.Timestamp = time.Time{}
+	s.NShield = 0
+	s.NUnshield = 0
+	s.NTransfer = 0
+	s.NInputs = 0
+	s.NOutputs = 0
+	s.ShieldVolume = 0
+	s.UnshieldVolume = 0
+	s.PoolBalance = 0
+	s.PoolCommitments = 0
+	s.PoolNullifiers = 0
+	s.null = false
+	s.last = 0
+}
+
+func (s *SaplingSeries) Null(ts time.Time) SeriesBucket {
+	s.Reset()
+	s.Timestamp = ts
+	s.null = true
+	return s
+}
+
+func (s *SaplingSeries) Zero(ts time.Time) SeriesBucket {
+	s.Reset()
+	s.Timestamp = ts
+	return s
+}
+
+func (s *SaplingSeries) SetTime(ts time.Time) SeriesBucket {
+	s.Timestamp = ts
+	return s
+}
+
+func (s *SaplingSeries) Time() time.Time {
+	return s.Timestamp
+}
+
+func (s *SaplingSeries) Clone() SeriesBucket {
+	c := *s
+	return &c
+}
+
+func (s *SaplingSeries) Interpolate(m SeriesBucket, ts time.Time) SeriesBucket {
+	o := m.(*SaplingSeries)
+	weight := float64(ts.Sub(s.Timestamp)) / float64(o.Timestamp.Sub(s.Timestamp))
+	if math.IsInf(weight, 1) {
+		weight = 1
+	}
+	switch weight {
+	case 0:
+		return s
+	default:
+		return &SaplingSeries{
+			Timestamp:       ts,
+			PoolBalance:     s.PoolBalance + int64(weight*float64(o.PoolBalance-s.PoolBalance)),
+			PoolCommitments: s.PoolCommitments + int64(weight*float64(o.PoolCommitments-s.PoolCommitments)),
+			PoolNullifiers:  s.PoolNullifiers + int64(weight*float64(o.PoolNullifiers-s.PoolNullifiers)),
+			columns:         s.columns,
+			params:          s.params,
+			verbose:         s.verbose,
+			null:            false,
+		}
+	}
+}
+
+func (s *SaplingSeries) MarshalJSON() ([]byte, error) {
+	if s.verbose {
+		return s.MarshalJSONVerbose()
+	} else {
+		return s.MarshalJSONBrief()
+	}
+}
+
+func (s *SaplingSeries) MarshalJSONVerbose() ([]byte, error) {
+	sap := struct {
+		Timestamp       time.Time `json:"time"`
+		NShield         int       `json:"n_shield"`
+		NUnshield       int       `json:"n_unshield"`
+		NTransfer       int       `json:"n_transfer"`
+		NInputs         int       `json:"n_inputs"`
+		NOutputs        int       `json:"n_outputs"`
+		ShieldVolume    float64   `json:"shield_volume"`
+		UnshieldVolume  float64   `json:"unshield_volume"`
+		PoolBalance     float64   `json:"pool_balance"`
+		PoolCommitments int64     `json:"pool_commitments"`
+		PoolNullifiers  int64     `json:"pool_nullifiers"`
+	}{
+		Timestamp:       s.Timestamp,
+		NShield:         s.NShield,
+		NUnshield:       s.NUnshield,
+		NTransfer:       s.NTransfer,
+		NInputs:         s.NInputs,
+		NOutputs:        s.NOutputs,
+		ShieldVolume:    s.params.ConvertValue(s.ShieldVolume),
+		UnshieldVolume:  s.params.ConvertValue(s.UnshieldVolume),
+		PoolBalance:     s.params.ConvertValue(s.PoolBalance),
+		PoolCommitments: s.PoolCommitments,
+		PoolNullifiers:  s.PoolNullifiers,
+	}
+	return json.Marshal(sap)
+}
+
+func (s *SaplingSeries) MarshalJSONBrief() ([]byte, error) {
+	dec := s.params.Decimals
+	buf := make([]byte, 0, 2048)
+	buf = append(buf, '[')
+	for i, v := range s.columns {
+		if s.null {
+			switch v {
+			case "time":
+				buf = strconv.AppendInt(buf, util.UnixMilliNonZero(s.Timestamp), 10)
+			default:
+				buf = append(buf, null...)
+			}
+		} else {
+			switch v {
+			case "time":
+				buf = strconv.AppendInt(buf, util.UnixMilliNonZero(s.Timestamp), 10)
+			case "n_shield":
+				buf = strconv.AppendInt(buf, int64(s.NShield), 10)
+			case "n_unshield":
+				buf = strconv.AppendInt(buf, int64(s.NUnshield), 10)
+			case "n_transfer":
+				buf = strconv.AppendInt(buf, int64(s.NTransfer), 10)
+			case "n_inputs":
+				buf = strconv.AppendInt(buf, int64(s.NInputs), 10)
+			case "n_outputs":
+				buf = strconv.AppendInt(buf, int64(s.NOutputs), 10)
+			case "shield_volume":
+				buf = strconv.AppendFloat(buf, s.params.ConvertValue(s.ShieldVolume), 'f', dec, 64)
+			case "unshield_volume":
+				buf = strconv.AppendFloat(buf, s.params.ConvertValue(s.UnshieldVolume), 'f', dec, 64)
+			case "pool_balance":
+				buf = strconv.AppendFloat(buf, s.params.ConvertValue(s.PoolBalance), 'f', dec, 64)
+			case "pool_commitments":
+				buf = strconv.AppendInt(buf, s.PoolCommitments, 10)
+			case "pool_nullifiers":
+				buf = strconv.AppendInt(buf, s.PoolNullifiers, 10)
+			default:
+				continue
+			}
+		}
+		if i < len(s.columns)-1 {
+			buf = append(buf, ',')
+		}
+	}
+	buf = append(buf, ']')
+	return buf, nil
+}
+
+func (s *SaplingSeries) MarshalCSV() ([]string, error) {
+	dec := s.params.Decimals
+	res := make([]string, len(s.columns))
+	for i, v := range s.columns {
+		if s.null {
+			switch v {
+			case "time":
+				res[i] = strconv.Quote(s.Timestamp.Format(time.RFC3339))
+			default:
+				continue
+			}
+		}
+		switch v {
+		case "time":
+			res[i] = strconv.Quote(s.Timestamp.Format(time.RFC3339))
+		case "n_shield":
+			res[i] = strconv.FormatInt(int64(s.NShield), 10)
+		case "n_unshield":
+			res[i] = strconv.FormatInt(int64(s.NUnshield), 10)
+		case "n_transfer":
+			res[i] = strconv.FormatInt(int64(s.NTransfer), 10)
+		case "n_inputs":
+			res[i] = strconv.FormatInt(int64(s.NInputs), 10)
+		case "n_outputs":
+			res[i] = strconv.FormatInt(int64(s.NOutputs), 10)
+		case "shield_volume":
+			res[i] = strconv.FormatFloat(s.params.ConvertValue(s.ShieldVolume), 'f', dec, 64)
+		case "unshield_volume":
+			res[i] = strconv.FormatFloat(s.params.ConvertValue(s.UnshieldVolume), 'f', dec, 64)
+		case "pool_balance":
+			res[i] = strconv.FormatFloat(s.params.ConvertValue(s.PoolBalance), 'f', dec, 64)
+		case "pool_commitments":
+			res[i] = strconv.FormatInt(s.PoolCommitments, 10)
+		case "pool_nullifiers":
+			res[i] = strconv.FormatInt(s.PoolNullifiers, 10)
+		default:
+			continue
+		}
+	}
+	return res, nil
+}
+
+func (s *SaplingSeries) BuildQuery(ctx *server.Context, args *SeriesRequest) pack.Query {
+	// access table
+	table, err := ctx.Indexer.Table(args.Series)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("cannot access table '%s'", args.Series), err))
+	}
+
+	// time is auto-added from parser
+	if len(args.Columns) == 1 {
+		// use all series columns
+		args.Columns = saplingSeriesNames
+	}
+	// check column names
+	for _, v := range args.Columns {
+		if !saplingSeriesNames.Contains(v) {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid time-series column '%s'", v), nil))
+		}
+	}
+
+	// build table query, all counters are derived from these fields
+	q := pack.NewQuery(ctx.RequestID).
+		WithTable(table).
+		WithFields(
+			"row_id",
+			"time",
+			"kind",
+			"amount",
+			"n_inputs",
+			"n_outputs",
+			"pool_balance",
+			"pool_commitments",
+			"pool_nullifiers",
+		).
+		WithOrder(args.Order).
+		AndRange("time", args.From.Time(), args.To.Time())
+
+	// build dynamic filter conditions from query (will panic on error)
+	for key, val := range ctx.Request.URL.Query() {
+		keys := strings.Split(key, ".")
+		prefix := keys[0]
+		mode := pack.FilterModeEqual
+		if len(keys) > 1 {
+			mode = pack.ParseFilterMode(keys[1])
+			if !mode.IsValid() {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s'", keys[1]), nil))
+			}
+		}
+		switch prefix {
+		case "columns", "collapse", "start_date", "end_date", "limit", "order", "verbose", "filename", "fill":
+			// skip these fields
+			continue
+
+		case "address", "sender":
+			field := "account_id" // pool contract
+			if prefix == "sender" {
+				field = "sender_id"
+			}
+			switch mode {
+			case pack.FilterModeEqual, pack.FilterModeNotEqual:
+				// single-address lookup and compile condition
+				addr, err := mavryk.ParseAddress(val[0])
+				if err != nil {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", val[0]), err))
+				}
+				acc, err := ctx.Indexer.LookupAccount(ctx, addr)
+				if err != nil && err != model.ErrNoAccount {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", val[0]), err))
+				}
+				// Note: when not found we insert an always false condition
+				if acc == nil || acc.RowId == 0 {
+					q = q.And(field, mode, uint64(math.MaxUint64))
+				} else {
+					// add id as extra condition
+					q = q.And(field, mode, acc.RowId)
+				}
+			case pack.FilterModeIn, pack.FilterModeNotIn:
+				// multi-address lookup and compile condition
+				ids := make([]uint64, 0)
+				for _, v := range strings.Split(val[0], ",") {
+					addr, err := mavryk.ParseAddress(v)
+					if err != nil {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", v), err))
+					}
+					acc, err := ctx.Indexer.LookupAccount(ctx, addr)
+					if err != nil && err != model.ErrNoAccount {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address '%s'", v), err))
+					}
+					// skip not found account
+					if acc == nil || acc.RowId == 0 {
+						continue
+					}
+					// collect list of account ids
+					ids = append(ids, acc.RowId.U64())
+				}
+				// Note: when list is empty (no accounts were found, the match will
+				//       always be false and return no result as expected)
+				q = q.And(field, mode, ids)
+			default:
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s' for column '%s'", mode, prefix), nil))
+			}
+		case "kind":
+			switch mode {
+			case pack.FilterModeEqual, pack.FilterModeNotEqual:
+				kind := model.ParseSaplingOpKind(val[0])
+				if !kind.IsValid() {
+					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid kind '%s'", val[0]), nil))
+				}
+				q = q.And("kind", mode, uint8(kind))
+			case pack.FilterModeIn, pack.FilterModeNotIn:
+				kinds := make([]uint8, 0)
+				for _, v := range strings.Split(val[0], ",") {
+					kind := model.ParseSaplingOpKind(v)
+					if !kind.IsValid() {
+						panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid kind '%s'", v), nil))
+					}
+					kinds = append(kinds, uint8(kind))
+				}
+				q = q.And("kind", mode, kinds)
+			default:
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid filter mode '%s' for column '%s'", mode, prefix), nil))
+			}
+		default:
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported filter '%s'", key), nil))
+		}
+	}
+
+	return q
+}
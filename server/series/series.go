@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 
+	"github.com/mavryk-network/mvindex/etl"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/rpc"
 	"github.com/mavryk-network/mvindex/server"
@@ -411,6 +413,12 @@ func StreamSeries(ctx *server.Context) (interface{}, int) {
 	case model.FlowTableKey:
 		args.bucket = &FlowSeries{}
 		args.model = &model.Flow{}
+	case model.CallStatTableKey:
+		args.bucket = &CallSeries{}
+		args.model = &model.CallStat{}
+	case model.SaplingOpTableKey:
+		args.bucket = &SaplingSeries{}
+		args.model = &model.SaplingOp{}
 	case model.ChainTableKey:
 		args.bucket = &ChainSeries{}
 		args.model = &model.Chain{}
@@ -427,6 +435,13 @@ func StreamSeries(ctx *server.Context) (interface{}, int) {
 	default:
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such series '%s'", args.Series), nil))
 	}
+
+	// fail requests for history removed by the retention policy
+	if slices.Contains(etl.RetentionTables(), args.Series) {
+		heights := server.QueryHeights(ctx, "height", "time")
+		heights = append(heights, ctx.Indexer.LookupBlockHeightFromTime(ctx, args.From.Time()))
+		ctx.CheckPruned(args.Series, heights...)
+	}
 	return args.StreamResponse(ctx)
 }
 
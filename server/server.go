@@ -26,6 +26,8 @@ type RestServer struct {
 	cfg        *Config
 	shutdown   atomic.Value
 	offline    atomic.Value
+	streams    chan struct{} // slots for long-lived streams
+	quit       chan struct{} // closed on shutdown to end streams
 }
 
 var (
@@ -72,6 +74,8 @@ func New(cfg *Config) (*RestServer, error) {
 			ErrorLog:          log.Logger(),
 		},
 	}
+	srv.streams = make(chan struct{}, cfg.Http.MaxStreams)
+	srv.quit = make(chan struct{})
 	srv.shutdown.Store(false)
 	srv.offline.Store(false)
 	return srv, nil
@@ -107,6 +111,7 @@ func (s *RestServer) Start() {
 func (s *RestServer) Stop() {
 	log.Info("Stopping HTTP server.")
 	s.shutdown.Store(true)
+	close(s.quit)
 	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Http.ShutdownTimeout)
 	defer cancel()
 	if err := s.srv.Shutdown(ctx); err != nil {
@@ -131,8 +136,50 @@ func C(f ApiCall) func(http.ResponseWriter, *http.Request) {
 	return wrapper(f)
 }
 
+// S wraps long-lived streaming calls like change log followers. Streams
+// run in their connection's goroutine without request timeout so that they
+// do not hold a worker slot. The number of concurrent streams is capped
+// separately and streams end on client disconnect or server shutdown.
+func S(f ApiCall) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		api := NewContext(ctx, r, w, f, srv)
+
+		select {
+		case srv.streams <- struct{}{}:
+			defer func() { <-srv.streams }()
+		default:
+			api.handleError(ETooManyRequests(EC_ACCESS_RATE_LIMITED, "too many concurrent streams", nil))
+			api.sendResponse()
+			return
+		}
+
+		go func() {
+			select {
+			case <-srv.quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		// streams outlive the server write timeout
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		api.serve()
+		api.sendResponse()
+	}
+}
+
 func wrapper(f ApiCall) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// batch sub-requests run inline in the worker slot of their batch
+		if isSubrequest(r) {
+			api := NewContext(r.Context(), r, w, f, srv)
+			api.serve()
+			api.sendResponse()
+			return
+		}
+
 		var (
 			ctx    context.Context
 			cancel context.CancelFunc
@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package system
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mavryk-network/mvindex/etl/cdc"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type CdcRequest struct {
+	Since  uint64 `schema:"since"`  // last seen seq, 0 = oldest available
+	Follow bool   `schema:"follow"` // keep streaming new events
+	Limit  uint   `schema:"limit"`  // max events, 0 = unlimited
+}
+
+// TailCdc streams change log events after a checkpoint as JSON lines. The
+// seq of the last event sent is returned as cursor trailer and can be used
+// as next checkpoint. Follow streams are served outside the worker pool.
+func TailCdc(ctx *server.Context) (interface{}, int) {
+	args := &CdcRequest{}
+	ctx.ParseRequestArgs(args)
+	l := ctx.Indexer.CDC()
+	if l == nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "change log is disabled", nil))
+	}
+	if args.Since > 0 && args.Since+1 < l.FirstSeq() {
+		panic(server.EConflict(server.EC_RESOURCE_STATE_UNEXPECTED, "checkpoint no longer available", cdc.ErrPruned))
+	}
+
+	ctx.StreamResponseHeaders(http.StatusOK, "application/x-ndjson")
+	flusher, _ := ctx.ResponseWriter.(http.Flusher)
+
+	var (
+		count int
+		err   error
+	)
+	since := args.Since
+	for {
+		since, err = l.Read(since, func(_ uint64, line []byte) error {
+			if _, err := ctx.ResponseWriter.Write(line); err != nil {
+				return err
+			}
+			count++
+			if args.Limit > 0 && count == int(args.Limit) {
+				return io.EOF
+			}
+			return nil
+		})
+		if err != nil || !args.Follow {
+			break
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if err = l.Wait(ctx.Context, since); err != nil {
+			break
+		}
+	}
+
+	// client disconnect or shutdown ends a follow stream
+	if ctx.Context.Err() != nil || err == cdc.ErrClosed {
+		err = nil
+	}
+	ctx.StreamTrailer(strconv.FormatUint(since, 10), count, err)
+	return nil, -1
+}
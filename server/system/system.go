@@ -59,6 +59,13 @@ func (t SystemRequest) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/tables", server.C(GetTableStats)).Methods("GET")
 	r.HandleFunc("/caches", server.C(GetCacheStats)).Methods("GET")
 	r.HandleFunc("/sysstat", server.C(GetSysStats)).Methods("GET")
+	r.HandleFunc("/tasks", server.C(GetTaskStats)).Methods("GET")
+	r.HandleFunc("/routes", server.C(GetRouteStats)).Methods("GET")
+	r.HandleFunc("/reorgs", server.C(GetReorgs)).Methods("GET")
+	r.HandleFunc("/rpc", server.C(GetRpcEndpoints)).Methods("GET")
+	r.HandleFunc("/supply/audit/{cycle}", server.C(explorer.RunSupplyAudit)).Methods("GET")
+	r.HandleFunc("/cdc", server.S(TailCdc)).Methods("GET").Queries("follow", "{follow:true|1}")
+	r.HandleFunc("/cdc", server.C(TailCdc)).Methods("GET")
 
 	// actions
 	r.HandleFunc("/tables/snapshot", server.C(SnapshotDatabases)).Methods("PUT")
@@ -88,6 +95,33 @@ func GetCacheStats(ctx *server.Context) (interface{}, int) {
 	return cs, http.StatusOK
 }
 
+func GetTaskStats(ctx *server.Context) (interface{}, int) {
+	sched := ctx.Indexer.Sched()
+	if sched == nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "task scheduler disabled", nil))
+	}
+	s, err := sched.Stats(ctx.Context)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read task stats", err))
+	}
+	return s, http.StatusOK
+}
+
+func GetRpcEndpoints(ctx *server.Context) (interface{}, int) {
+	if ctx.Client == nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "rpc client disabled", nil))
+	}
+	return ctx.Client.Endpoints(), http.StatusOK
+}
+
+func GetRouteStats(ctx *server.Context) (interface{}, int) {
+	return server.GetRouteStats(), http.StatusOK
+}
+
+func GetReorgs(ctx *server.Context) (interface{}, int) {
+	return ctx.Crawler.Reorgs(), http.StatusOK
+}
+
 func GetSysStats(ctx *server.Context) (interface{}, int) {
 	s, err := GetSysStat(ctx.Context)
 	if err != nil {
@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"blockwatch.cc/packdb/vec"
@@ -485,7 +484,8 @@ func StreamAccountTable(ctx *server.Context, args *TableRequest) (interface{}, i
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -675,6 +675,11 @@ func StreamAccountTable(ctx *server.Context, args *TableRequest) (interface{}, i
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, acc, accSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -719,8 +724,8 @@ func StreamAccountTable(ctx *server.Context, args *TableRequest) (interface{}, i
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), accSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -731,7 +736,7 @@ func StreamAccountTable(ctx *server.Context, args *TableRequest) (interface{}, i
 				if err := r.Decode(acc); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(acc); err != nil {
+				if err := enc.EncodeRow(r, acc); err != nil {
 					return err
 				}
 				count++
@@ -742,7 +747,10 @@ func StreamAccountTable(ctx *server.Context, args *TableRequest) (interface{}, i
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
@@ -0,0 +1,599 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package tables
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/encoding/csv"
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/server"
+	"github.com/mavryk-network/mvindex/server/series"
+)
+
+var errAggregateRows = errors.New("too many rows")
+
+type aggFunc byte
+
+const (
+	aggCount aggFunc = iota
+	aggCountDistinct
+	aggSum
+	aggMin
+	aggMax
+	aggAvg
+)
+
+func (f aggFunc) String() string {
+	switch f {
+	case aggCount:
+		return "count"
+	case aggCountDistinct:
+		return "count_distinct"
+	case aggSum:
+		return "sum"
+	case aggMin:
+		return "min"
+	case aggMax:
+		return "max"
+	case aggAvg:
+		return "avg"
+	default:
+		return ""
+	}
+}
+
+// aggColumn is a single aggregate output column. Column `*` is only valid
+// for count and counts rows.
+type aggColumn struct {
+	fn     aggFunc
+	column string
+	index  int
+	field  string // integer table field summed exactly, empty otherwise
+	scale  int    // decimals of amount columns
+}
+
+func (c aggColumn) Name() string {
+	if c.column == "*" {
+		return c.fn.String()
+	}
+	return c.fn.String() + "_" + c.column
+}
+
+// tableAggregate is the aggregation plan parsed from a table request.
+type tableAggregate struct {
+	groupBy  []string
+	groupIdx []int
+	aggs     []aggColumn
+	collapse series.Collapse
+	limit    uint
+}
+
+// IsAggregate returns true when the request asks for server-side aggregation.
+func (t TableRequest) IsAggregate() bool {
+	return t.aggregate != nil
+}
+
+// parseAggregate builds the aggregation plan and replaces output columns by
+// the set of input columns required for grouping and aggregation.
+func (t *TableRequest) parseAggregate() {
+	funcs := []struct {
+		fn   aggFunc
+		cols []string
+	}{
+		{aggCount, t.Count},
+		{aggCountDistinct, t.CountDistinct},
+		{aggSum, t.Sum},
+		{aggMin, t.Min},
+		{aggMax, t.Max},
+		{aggAvg, t.Avg},
+	}
+	agg := &tableAggregate{
+		groupBy:  t.GroupBy,
+		collapse: t.Collapse,
+	}
+	for _, f := range funcs {
+		for _, v := range f.cols {
+			if v == "*" && f.fn != aggCount {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("%s: column '*' is only supported by count", f.fn), nil))
+			}
+			agg.aggs = append(agg.aggs, aggColumn{fn: f.fn, column: v})
+		}
+	}
+	if len(agg.groupBy) == 0 && len(agg.aggs) == 0 {
+		return
+	}
+	if len(t.Columns) > 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "columns cannot be combined with group_by or aggregates", nil))
+	}
+
+	// without aggregates, count rows per group
+	if len(agg.aggs) == 0 {
+		agg.aggs = append(agg.aggs, aggColumn{fn: aggCount, column: "*"})
+	}
+
+	// prevent duplicate output columns
+	seen := make(map[string]struct{})
+	for _, v := range agg.groupBy {
+		if _, ok := seen[v]; ok {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("duplicate group_by column %s", v), nil))
+		}
+		seen[v] = struct{}{}
+	}
+	for _, v := range agg.aggs {
+		if _, ok := seen[v.Name()]; ok {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("duplicate aggregate %s", v.Name()), nil))
+		}
+		seen[v.Name()] = struct{}{}
+	}
+
+	// select input columns; an empty list selects all table columns which
+	// is only the case when rows are counted without grouping
+	cols := make([]string, 0)
+	has := make(map[string]struct{})
+	for _, v := range agg.groupBy {
+		cols = append(cols, v)
+		has[v] = struct{}{}
+	}
+	for _, v := range agg.aggs {
+		if _, ok := has[v.column]; ok || v.column == "*" {
+			continue
+		}
+		cols = append(cols, v.column)
+		has[v.column] = struct{}{}
+	}
+	t.Columns = cols
+
+	// the output limit applies to groups, the query must see all rows
+	agg.limit = t.Limit
+	t.Limit = 0
+	t.aggregate = agg
+}
+
+// resolve maps group and aggregate columns to positions in the list of
+// columns produced by the table marshaller.
+func (a *tableAggregate) resolve(columns []string) {
+	pos := make(map[string]int)
+	for i, v := range columns {
+		pos[v] = i
+	}
+	a.groupIdx = make([]int, len(a.groupBy))
+	for i, v := range a.groupBy {
+		a.groupIdx[i] = pos[v]
+	}
+	for i, v := range a.aggs {
+		if v.column != "*" {
+			a.aggs[i].index = pos[v.column]
+		}
+	}
+}
+
+// resolveFields selects the table fields sum and avg read as exact integers
+// instead of parsing marshalled decimals. Amount columns are stored in base
+// units and rendered with decimals.
+func (a *tableAggregate) resolveFields(fields pack.FieldList, names map[string]string, decimals int) {
+	for i, v := range a.aggs {
+		if v.fn != aggSum && v.fn != aggAvg {
+			continue
+		}
+		f := fields.Find(names[v.column])
+		if !f.IsValid() || f.Alias != v.column {
+			continue
+		}
+		switch f.Type {
+		case pack.FieldTypeInt64, pack.FieldTypeUint64:
+			a.aggs[i].field = f.Name
+			if columnKinds[v.column] == columnAmount {
+				a.aggs[i].scale = decimals
+			}
+		}
+	}
+}
+
+// Columns returns output column names in order.
+func (a *tableAggregate) Columns() []string {
+	cols := make([]string, 0, len(a.groupBy)+len(a.aggs))
+	cols = append(cols, a.groupBy...)
+	for _, v := range a.aggs {
+		cols = append(cols, v.Name())
+	}
+	return cols
+}
+
+// aggState keeps the running state of a single aggregate in a group.
+type aggState struct {
+	n        int
+	sum      float64
+	isum     *big.Int
+	min, max string
+	distinct map[string]struct{}
+}
+
+type aggGroup struct {
+	keys   []string
+	states []aggState
+}
+
+// aggregator collects groups from marshalled table rows. Groups are output in
+// order of first appearance, i.e. in table order for time-based groups.
+type aggregator struct {
+	plan   *tableAggregate
+	max    int
+	groups map[string]*aggGroup
+	order  []*aggGroup
+	rows   int
+	tmp    big.Int
+}
+
+func newAggregator(plan *tableAggregate, max int) *aggregator {
+	return &aggregator{
+		plan:   plan,
+		max:    max,
+		groups: make(map[string]*aggGroup),
+	}
+}
+
+// Add adds a marshalled row. raw holds the table value for each aggregate
+// with an integer field and may be nil otherwise.
+func (a *aggregator) Add(vals []string, raw []interface{}) error {
+	keys := make([]string, len(a.plan.groupIdx))
+	for i, idx := range a.plan.groupIdx {
+		keys[i] = vals[idx]
+		if a.plan.collapse.Value > 0 && isTimeColumn(a.plan.groupBy[i]) {
+			keys[i] = collapseTime(keys[i], a.plan.collapse)
+		}
+	}
+	key := strings.Join(keys, "\x00")
+	g, ok := a.groups[key]
+	if !ok {
+		if a.max > 0 && len(a.order) >= a.max {
+			return fmt.Errorf("result exceeds %d groups", a.max)
+		}
+		g = &aggGroup{
+			keys:   keys,
+			states: make([]aggState, len(a.plan.aggs)),
+		}
+		a.groups[key] = g
+		a.order = append(a.order, g)
+	}
+	for i, v := range a.plan.aggs {
+		s := &g.states[i]
+		if v.column == "*" {
+			s.n++
+			continue
+		}
+		val := vals[v.index]
+		if val == "" || val == `""` {
+			continue
+		}
+		switch v.fn {
+		case aggCount:
+			s.n++
+		case aggCountDistinct:
+			if s.distinct == nil {
+				s.distinct = make(map[string]struct{})
+			}
+			s.distinct[val] = struct{}{}
+		case aggSum, aggAvg:
+			if v.field != "" {
+				if err := a.addInt(s, raw[i]); err != nil {
+					return fmt.Errorf("%s: %w", v.Name(), err)
+				}
+				s.n++
+				continue
+			}
+			f, err := parseAggNumber(val)
+			if err != nil {
+				return fmt.Errorf("%s: column %s is not numeric", v.Name(), v.column)
+			}
+			s.sum += f
+			s.n++
+		case aggMin:
+			if s.n == 0 || lessValue(val, s.min) {
+				s.min = val
+			}
+			s.n++
+		case aggMax:
+			if s.n == 0 || lessValue(s.max, val) {
+				s.max = val
+			}
+			s.n++
+		}
+	}
+	a.rows++
+	return nil
+}
+
+func (a *aggregator) addInt(s *aggState, v interface{}) error {
+	if s.isum == nil {
+		s.isum = new(big.Int)
+	}
+	switch n := v.(type) {
+	case int64:
+		a.tmp.SetInt64(n)
+	case uint64:
+		a.tmp.SetUint64(n)
+	default:
+		return fmt.Errorf("unexpected value type %T", v)
+	}
+	s.isum.Add(s.isum, &a.tmp)
+	return nil
+}
+
+// Row returns marshalled values for group i in CSV format.
+func (a *aggregator) Row(i int) aggRow {
+	g := a.order[i]
+	row := make(aggRow, 0, len(g.keys)+len(g.states))
+	row = append(row, g.keys...)
+	for i, v := range a.plan.aggs {
+		s := g.states[i]
+		switch v.fn {
+		case aggCount:
+			row = append(row, strconv.Itoa(s.n))
+		case aggCountDistinct:
+			row = append(row, strconv.Itoa(len(s.distinct)))
+		case aggSum:
+			if v.field != "" {
+				row = append(row, formatScaled(s.isum, v.scale))
+			} else {
+				row = append(row, strconv.FormatFloat(s.sum, 'f', -1, 64))
+			}
+		case aggAvg:
+			if v.field != "" && s.n > 0 {
+				d := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(v.scale)), nil)
+				d.Mul(d, big.NewInt(int64(s.n)))
+				f, _ := new(big.Rat).SetFrac(s.isum, d).Float64()
+				row = append(row, strconv.FormatFloat(f, 'f', -1, 64))
+			} else if s.n > 0 {
+				row = append(row, strconv.FormatFloat(s.sum/float64(s.n), 'f', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		case aggMin:
+			row = append(row, s.min)
+		case aggMax:
+			row = append(row, s.max)
+		}
+	}
+	return row
+}
+
+// aggRow is a single output row with values in CSV format.
+type aggRow []string
+
+func (r aggRow) MarshalCSV() ([]string, error) {
+	return r, nil
+}
+
+// jsonValues converts CSV formatted values into JSON types.
+func (r aggRow) jsonValues() []interface{} {
+	res := make([]interface{}, len(r))
+	for i, v := range r {
+		switch {
+		case v == "":
+			res[i] = nil
+		case v[0] == '"':
+			if s, err := strconv.Unquote(v); err == nil {
+				res[i] = s
+			} else {
+				res[i] = v
+			}
+		case v == "true" || v == "false":
+			res[i] = v == "true"
+		default:
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				res[i] = json.Number(v)
+			} else {
+				res[i] = v
+			}
+		}
+	}
+	return res
+}
+
+// formatScaled renders an integer in base units as exact decimal with scale
+// fractional digits and trailing zeros removed.
+func formatScaled(n *big.Int, scale int) string {
+	if n == nil {
+		return "0"
+	}
+	s := n.String()
+	if scale == 0 {
+		return s
+	}
+	var sign string
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	i, f := s[:len(s)-scale], strings.TrimRight(s[len(s)-scale:], "0")
+	if f == "" {
+		return sign + i
+	}
+	return sign + i + "." + f
+}
+
+func isTimeColumn(name string) bool {
+	return name == "time" || strings.HasSuffix(name, "_time")
+}
+
+// collapseTime truncates a marshalled time value (quoted RFC3339 string or
+// unix milliseconds) and returns it in the same format.
+func collapseTime(v string, c series.Collapse) string {
+	if v == "" {
+		return v
+	}
+	if v[0] == '"' {
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return v
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return v
+		}
+		return strconv.Quote(c.Truncate(t.UTC()).Format(time.RFC3339))
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatInt(c.Truncate(time.UnixMilli(ms).UTC()).UnixMilli(), 10)
+}
+
+func parseAggNumber(v string) (float64, error) {
+	switch v {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// lessValue compares marshalled values numerically when both are numbers
+// and lexicographically otherwise. RFC3339 times in UTC sort correctly as
+// strings.
+func lessValue(a, b string) bool {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return fa < fb
+	}
+	return a < b
+}
+
+// aggregateTable runs query q, aggregates rows marshalled by val and writes
+// the result in the requested format. Unlike plain table streams the full
+// result is computed before any output is written so that errors are
+// reported with a proper status code. Queries that match more than the
+// configured number of rows are rejected.
+func aggregateTable(ctx *server.Context, args *TableRequest, table *pack.Table, q pack.Query, val csv.Marshaler, names map[string]string) (interface{}, int) {
+	plan := args.aggregate
+	plan.resolve(args.Columns)
+	plan.resolveFields(table.Fields(), names, ctx.Params.Decimals)
+
+	var (
+		maxRows = int(ctx.Cfg.Http.MaxAggregateRows)
+		raw     = make([]interface{}, len(plan.aggs))
+		nRows   int
+	)
+	agg := newAggregator(plan, int(ctx.Cfg.Http.MaxListCount))
+	err := table.Stream(ctx.Context, q, func(r pack.Row) error {
+		if nRows++; maxRows > 0 && nRows > maxRows {
+			return errAggregateRows
+		}
+		if err := r.Decode(val); err != nil {
+			return err
+		}
+		vals, err := val.MarshalCSV()
+		if err != nil {
+			return err
+		}
+		for i, v := range plan.aggs {
+			if v.field == "" {
+				continue
+			}
+			if raw[i], err = r.Field(v.field); err != nil {
+				return err
+			}
+		}
+		return agg.Add(vals, raw)
+	})
+	if err != nil {
+		if err == errAggregateRows {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID,
+				fmt.Sprintf("aggregation exceeds %d rows, add a height or time filter", maxRows), nil))
+		}
+		if ctx.Context.Err() != nil {
+			panic(server.EServiceUnavailable(server.EC_DATABASE, "aggregation canceled", err))
+		}
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "cannot aggregate table", err))
+	}
+
+	// without groups, aggregates over an empty set produce a single row
+	if len(plan.groupBy) == 0 && len(agg.order) == 0 {
+		agg.order = append(agg.order, &aggGroup{states: make([]aggState, len(plan.aggs))})
+	}
+	n := len(agg.order)
+	if plan.limit > 0 && n > int(plan.limit) {
+		n = int(plan.limit)
+	}
+	columns := plan.Columns()
+
+	// prepare response stream
+	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
+
+	var count int
+	switch args.Format {
+	case "json":
+		enc := json.NewEncoder(ctx.ResponseWriter)
+		enc.SetIndent("", "")
+		enc.SetEscapeHTML(false)
+		_, _ = io.WriteString(ctx.ResponseWriter, "[")
+		for i := 0; i < n && err == nil; i++ {
+			if i > 0 {
+				_, _ = io.WriteString(ctx.ResponseWriter, ",")
+			}
+			vals := agg.Row(i).jsonValues()
+			if args.Verbose {
+				obj := make(map[string]interface{}, len(vals))
+				for j, v := range vals {
+					obj[columns[j]] = v
+				}
+				err = enc.Encode(obj)
+			} else {
+				err = enc.Encode(vals)
+			}
+			count++
+		}
+		_, _ = io.WriteString(ctx.ResponseWriter, "]")
+
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), names)
+		if cenc, ok := enc.(*columnEncoder); ok {
+			for _, v := range plan.aggs {
+				switch v.fn {
+				case aggCount, aggCountDistinct:
+					cenc.SetKind(v.Name(), columnInt)
+				case aggSum:
+					switch {
+					case v.field == "":
+						cenc.SetKind(v.Name(), columnFloat)
+					case v.scale > 0:
+						cenc.SetKind(v.Name(), columnAmount)
+					default:
+						cenc.SetKind(v.Name(), columnInt)
+					}
+				case aggAvg:
+					cenc.SetKind(v.Name(), columnFloat)
+				case aggMin, aggMax:
+					cenc.SetKind(v.Name(), cenc.resolveKind(v.column))
+				}
+			}
+		}
+		err = enc.EncodeHeader(columns, nil)
+		for i := 0; i < n && err == nil; i++ {
+			err = enc.EncodeRecord(agg.Row(i))
+			count++
+		}
+		if cerr := enc.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	// aggregates have no cursor, trailer count is the number of groups
+	ctx.StreamTrailer("", count, err)
+	return nil, -1
+}
@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"blockwatch.cc/packdb/vec"
@@ -245,7 +244,8 @@ func StreamBallotTable(ctx *server.Context, args *TableRequest) (interface{}, in
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -512,6 +512,11 @@ func StreamBallotTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		ops:     opMap,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, ballot, ballotSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -557,8 +562,8 @@ func StreamBallotTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), ballotSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -569,7 +574,7 @@ func StreamBallotTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				if err := r.Decode(ballot); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(ballot); err != nil {
+				if err := enc.EncodeRow(r, ballot); err != nil {
 					return err
 				}
 				count++
@@ -580,7 +585,10 @@ func StreamBallotTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
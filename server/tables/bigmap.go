@@ -14,7 +14,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -276,7 +275,8 @@ func StreamBigmapAllocTable(ctx *server.Context, args *TableRequest) (interface{
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -377,6 +377,11 @@ func StreamBigmapAllocTable(ctx *server.Context, args *TableRequest) (interface{
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, bigmap, bigmapAllocSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -421,8 +426,8 @@ func StreamBigmapAllocTable(ctx *server.Context, args *TableRequest) (interface{
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), bigmapAllocSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -433,7 +438,7 @@ func StreamBigmapAllocTable(ctx *server.Context, args *TableRequest) (interface{
 				if err := r.Decode(bigmap); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(bigmap); err != nil {
+				if err := enc.EncodeRow(r, bigmap); err != nil {
 					return err
 				}
 				count++
@@ -444,7 +449,10 @@ func StreamBigmapAllocTable(ctx *server.Context, args *TableRequest) (interface{
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
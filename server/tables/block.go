@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -505,7 +504,8 @@ func StreamBlockTable(ctx *server.Context, args *TableRequest) (interface{}, int
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -738,6 +738,11 @@ func StreamBlockTable(ctx *server.Context, args *TableRequest) (interface{}, int
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, block, blockSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -789,8 +794,8 @@ func StreamBlockTable(ctx *server.Context, args *TableRequest) (interface{}, int
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), blockSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -800,7 +805,7 @@ func StreamBlockTable(ctx *server.Context, args *TableRequest) (interface{}, int
 				if err := r.Decode(block); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(block); err != nil {
+				if err := enc.EncodeRow(r, block); err != nil {
 					return err
 				}
 				count++
@@ -818,7 +823,10 @@ func StreamBlockTable(ctx *server.Context, args *TableRequest) (interface{}, int
 				err = table.Stream(ctx, q, process)
 			}
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
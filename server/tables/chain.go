@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvindex/etl/model"
@@ -415,7 +414,8 @@ func StreamChainTable(ctx *server.Context, args *TableRequest) (interface{}, int
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -466,6 +466,11 @@ func StreamChainTable(ctx *server.Context, args *TableRequest) (interface{}, int
 		params:  params,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, ch, chainSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -510,8 +515,8 @@ func StreamChainTable(ctx *server.Context, args *TableRequest) (interface{}, int
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), chainSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -522,7 +527,7 @@ func StreamChainTable(ctx *server.Context, args *TableRequest) (interface{}, int
 				if err := r.Decode(ch); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(ch); err != nil {
+				if err := enc.EncodeRow(r, ch); err != nil {
 					return err
 				}
 				count++
@@ -533,7 +538,10 @@ func StreamChainTable(ctx *server.Context, args *TableRequest) (interface{}, int
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
@@ -0,0 +1,520 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package tables
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockwatch.cc/packdb/encoding/csv"
+	"blockwatch.cc/packdb/pack"
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/decimal128"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/apache/arrow/go/v15/parquet"
+	"github.com/apache/arrow/go/v15/parquet/compress"
+	"github.com/apache/arrow/go/v15/parquet/pqarrow"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// rows per Parquet row group and Arrow record batch
+const columnRowGroupSize = 1 << 16
+
+type columnKind byte
+
+const (
+	columnString columnKind = iota
+	columnInt
+	columnUint
+	columnFloat
+	columnBool
+	columnTime
+	columnAmount
+)
+
+// amountPrecision is the decimal precision of amount columns. Amounts are
+// written in base units with the chain's decimals as scale.
+const amountPrecision = 38
+
+func (k columnKind) DataType(decimals int) arrow.DataType {
+	switch k {
+	case columnAmount:
+		return &arrow.Decimal128Type{Precision: amountPrecision, Scale: int32(decimals)}
+	case columnInt:
+		return arrow.PrimitiveTypes.Int64
+	case columnUint:
+		return arrow.PrimitiveTypes.Uint64
+	case columnFloat:
+		return arrow.PrimitiveTypes.Float64
+	case columnBool:
+		return arrow.FixedWidthTypes.Boolean
+	case columnTime:
+		return &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// columnKinds lists output types of columns the API renders differently from
+// their stored type, e.g. amounts as decimal, percentages as float and type
+// codes or hashes as string. Columns that are not stored at all default to string, *_time
+// columns to timestamps.
+var columnKinds = map[string]columnKind{
+	// uint64 row ids and int heights computed at query time
+	"id":                  columnUint,
+	"op_ni":               columnInt,
+	"period_start_block":  columnInt,
+	"period_end_block":    columnInt,
+	"period_start_height": columnInt,
+	"period_end_height":   columnInt,
+	"no_proposal":         columnBool,
+
+	// enums, hashes and vote flags
+	"action":             columnString,
+	"address_type":       columnString,
+	"ai_vote":            columnString,
+	"ballot":             columnString,
+	"code_hash":          columnString,
+	"features":           columnString,
+	"iface_hash":         columnString,
+	"kind":               columnString,
+	"lb_vote":            columnString,
+	"nonce":              columnString,
+	"status":             columnString,
+	"storage_hash":       columnString,
+	"type":               columnString,
+	"type_hash":          columnString,
+	"voting_period_kind": columnString,
+
+	// amounts and percentages
+	"accusation_income":        columnAmount,
+	"accusation_loss":          columnAmount,
+	"activated":                columnAmount,
+	"activated_supply":         columnAmount,
+	"active_delegated":         columnAmount,
+	"active_stake":             columnAmount,
+	"active_staking":           columnAmount,
+	"amount_in":                columnAmount,
+	"amount_out":               columnAmount,
+	"baking_income":            columnAmount,
+	"balance":                  columnAmount,
+	"burned":                   columnAmount,
+	"burned_allocation":        columnAmount,
+	"burned_double_baking":     columnAmount,
+	"burned_double_endorse":    columnAmount,
+	"burned_explicit":          columnAmount,
+	"burned_offline":           columnAmount,
+	"burned_origination":       columnAmount,
+	"burned_rollup":            columnAmount,
+	"burned_seed_miss":         columnAmount,
+	"burned_storage":           columnAmount,
+	"burned_supply":            columnAmount,
+	"circulating":              columnAmount,
+	"contribution_percent":     columnFloat,
+	"delegated":                columnAmount,
+	"deposit":                  columnAmount,
+	"eligible_stake":           columnAmount,
+	"endorsing_income":         columnAmount,
+	"endorsing_loss":           columnAmount,
+	"expected_income":          columnAmount,
+	"fee":                      columnAmount,
+	"fees_income":              columnAmount,
+	"frozen":                   columnAmount,
+	"frozen_baker_stake":       columnAmount,
+	"frozen_bonds":             columnAmount,
+	"frozen_deposits":          columnAmount,
+	"frozen_fees":              columnAmount,
+	"frozen_rewards":           columnAmount,
+	"frozen_rollup_bond":       columnAmount,
+	"frozen_stake":             columnAmount,
+	"frozen_staker_stake":      columnAmount,
+	"inactive_delegated":       columnAmount,
+	"inactive_staking":         columnAmount,
+	"liquid":                   columnAmount,
+	"lost_accusation_deposits": columnAmount,
+	"lost_accusation_fees":     columnAmount,
+	"lost_accusation_rewards":  columnAmount,
+	"lost_rollup_bond":         columnAmount,
+	"lost_seed_fees":           columnAmount,
+	"lost_seed_rewards":        columnAmount,
+	"lost_stake":               columnAmount,
+	"luck":                     columnAmount,
+	"luck_percent":             columnFloat,
+	"minted":                   columnAmount,
+	"minted_airdrop":           columnAmount,
+	"minted_baking":            columnAmount,
+	"minted_endorsing":         columnAmount,
+	"minted_seeding":           columnAmount,
+	"minted_subsidy":           columnAmount,
+	"minted_supply":            columnAmount,
+	"nay_stake":                columnAmount,
+	"own_stake":                columnAmount,
+	"pass_stake":               columnAmount,
+	"pct_account_reuse":        columnFloat,
+	"performance_percent":      columnFloat,
+	"quorum_stake":             columnAmount,
+	"reward":                   columnAmount,
+	"seed_income":              columnAmount,
+	"seed_loss":                columnAmount,
+	"shielded":                 columnAmount,
+	"spendable_balance":        columnAmount,
+	"stake":                    columnAmount,
+	"staked_balance":           columnAmount,
+	"staking":                  columnAmount,
+	"staking_balance":          columnAmount,
+	"storage_burn":             columnAmount,
+	"total":                    columnAmount,
+	"total_burned":             columnAmount,
+	"total_fees_paid":          columnAmount,
+	"total_fees_used":          columnAmount,
+	"total_income":             columnAmount,
+	"total_loss":               columnAmount,
+	"total_received":           columnAmount,
+	"total_sent":               columnAmount,
+	"turnout_stake":            columnAmount,
+	"unclaimed":                columnAmount,
+	"unclaimed_balance":        columnAmount,
+	"unstaked_balance":         columnAmount,
+	"unstaking":                columnAmount,
+	"volume":                   columnAmount,
+	"yay_stake":                columnAmount,
+}
+
+// tableEncoder writes table rows in one of the row based output formats.
+// EncodeRow passes the source table row along with its marshaller so that
+// columnar formats can write stored values without conversion.
+type tableEncoder interface {
+	EncodeHeader(columns []string, v interface{}) error
+	EncodeRecord(v interface{}) error
+	EncodeRow(r pack.Row, v interface{}) error
+	Close() error
+}
+
+type csvEncoder struct {
+	*csv.Encoder
+}
+
+func (e csvEncoder) EncodeRow(_ pack.Row, v interface{}) error { return e.EncodeRecord(v) }
+
+func (e csvEncoder) Close() error { return nil }
+
+// newTableEncoder returns a CSV, Parquet or Arrow encoder for table rows.
+func newTableEncoder(ctx *server.Context, format string, fields pack.FieldList, names map[string]string) tableEncoder {
+	if format == "csv" {
+		return csvEncoder{csv.NewEncoder(ctx.ResponseWriter)}
+	}
+	return newColumnEncoder(ctx.ResponseWriter, format, ctx.Params.Decimals, fields, names)
+}
+
+// columnEncoder streams table rows as Apache Parquet file or Arrow IPC stream.
+// Rows are collected into row groups of columnRowGroupSize and written as
+// soon as a group is full, so memory use is bounded by a single group.
+//
+// Values are taken from the same per-column marshaller as CSV output. The
+// schema only depends on requested columns: types are mapped from pack field
+// definitions and columnKinds, so all responses for a table are compatible.
+// Values that do not parse as their column type fail the request.
+//
+// Amounts are written as decimal128 in base units with the chain's decimals
+// as scale, i.e. the decimal value equals the amount shown in JSON and CSV.
+// Stored amounts are taken from the table row without float conversion.
+type columnEncoder struct {
+	w        io.Writer
+	format   string
+	decimals int
+	fields   pack.FieldList
+	names    map[string]string // long -> short name
+	columns  []string
+	fixed    map[string]columnKind // explicit column types
+	schema   *arrow.Schema
+	kinds    []columnKind
+	raw      []string // stored integer field of amount columns
+	builder  *array.RecordBuilder
+	rows     int
+	ipcw     *ipc.Writer
+	pqw      *pqarrow.FileWriter
+}
+
+func newColumnEncoder(w io.Writer, format string, decimals int, fields pack.FieldList, names map[string]string) *columnEncoder {
+	return &columnEncoder{
+		w:        w,
+		format:   format,
+		decimals: decimals,
+		fields:   fields,
+		names:    names,
+	}
+}
+
+// EncodeHeader sets output columns and their order.
+func (e *columnEncoder) EncodeHeader(columns []string, _ interface{}) error {
+	if e.schema != nil {
+		return fmt.Errorf("%s: header already written", e.format)
+	}
+	e.columns = columns
+	return nil
+}
+
+// SetKind sets the output type of a column that is neither a stored field
+// nor listed in columnKinds.
+func (e *columnEncoder) SetKind(name string, kind columnKind) {
+	if e.fixed == nil {
+		e.fixed = make(map[string]columnKind)
+	}
+	e.fixed[name] = kind
+}
+
+// EncodeRecord adds a row from marshalled values only. Amounts are parsed
+// from their decimal string.
+func (e *columnEncoder) EncodeRecord(v interface{}) error {
+	return e.encode(nil, v)
+}
+
+// EncodeRow adds a row, stored amounts are read from table row r.
+func (e *columnEncoder) EncodeRow(r pack.Row, v interface{}) error {
+	return e.encode(&r, v)
+}
+
+func (e *columnEncoder) encode(r *pack.Row, v interface{}) error {
+	m, ok := v.(csv.Marshaler)
+	if !ok {
+		return fmt.Errorf("%s: unsupported type %T", e.format, v)
+	}
+	vals, err := m.MarshalCSV()
+	if err != nil {
+		return err
+	}
+	if len(vals) != len(e.columns) {
+		return fmt.Errorf("%s: got %d values for %d columns", e.format, len(vals), len(e.columns))
+	}
+	if e.schema == nil {
+		if err := e.init(); err != nil {
+			return err
+		}
+	}
+	if err := e.append(r, vals); err != nil {
+		return err
+	}
+	if e.rows >= columnRowGroupSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// Close writes pending rows and the file footer. It must be called even
+// when no rows were encoded to produce a valid empty file.
+func (e *columnEncoder) Close() error {
+	if e.schema == nil {
+		if err := e.init(); err != nil {
+			return err
+		}
+	}
+	err := e.flush()
+	e.builder.Release()
+	switch {
+	case e.pqw != nil:
+		if cerr := e.pqw.Close(); err == nil {
+			err = cerr
+		}
+	case e.ipcw != nil:
+		if cerr := e.ipcw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// init builds the schema from column types and opens the writer.
+func (e *columnEncoder) init() error {
+	fields := make([]arrow.Field, len(e.columns))
+	e.kinds = make([]columnKind, len(e.columns))
+	e.raw = make([]string, len(e.columns))
+	for i, name := range e.columns {
+		e.kinds[i] = e.resolveKind(name)
+		fields[i] = arrow.Field{
+			Name:     name,
+			Type:     e.kinds[i].DataType(e.decimals),
+			Nullable: true,
+		}
+		if e.kinds[i] != columnAmount {
+			continue
+		}
+		if _, ok := e.fixed[name]; ok {
+			continue
+		}
+		f := e.fields.Find(e.names[name])
+		if f.IsValid() && f.Alias == name && (f.Type == pack.FieldTypeInt64 || f.Type == pack.FieldTypeUint64) {
+			e.raw[i] = f.Name
+		}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	var err error
+	switch e.format {
+	case "parquet":
+		props := parquet.NewWriterProperties(
+			parquet.WithCompression(compress.Codecs.Snappy),
+			parquet.WithMaxRowGroupLength(columnRowGroupSize),
+		)
+		e.pqw, err = pqarrow.NewFileWriter(schema, e.w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	case "arrow":
+		e.ipcw = ipc.NewWriter(e.w, ipc.WithSchema(schema))
+	default:
+		err = fmt.Errorf("unsupported columnar format %q", e.format)
+	}
+	if err != nil {
+		return err
+	}
+	e.schema = schema
+	e.builder = array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	return nil
+}
+
+// resolveKind maps a column to its output type. Explicit and rendered column
+// types take precedence over pack field types, all other columns are
+// rendered as string.
+func (e *columnEncoder) resolveKind(name string) columnKind {
+	if k, ok := e.fixed[name]; ok {
+		return k
+	}
+	if k, ok := columnKinds[name]; ok {
+		return k
+	}
+	if name == "time" || strings.HasSuffix(name, "_time") {
+		return columnTime
+	}
+	f := e.fields.Find(e.names[name])
+	if !f.IsValid() || f.Alias != name {
+		return columnString
+	}
+	switch f.Type {
+	case pack.FieldTypeBoolean:
+		return columnBool
+	case pack.FieldTypeDatetime:
+		return columnTime
+	case pack.FieldTypeFloat64:
+		return columnFloat
+	case pack.FieldTypeInt64:
+		return columnInt
+	case pack.FieldTypeUint64:
+		return columnUint
+	default:
+		return columnString
+	}
+}
+
+// append adds a row to the current row group. Empty values are stored as
+// null, values that do not match the column type are an error.
+func (e *columnEncoder) append(r *pack.Row, vals []string) error {
+	for i, v := range vals {
+		b := e.builder.Field(i)
+		if v == "" {
+			b.AppendNull()
+			continue
+		}
+		var err error
+		switch e.kinds[i] {
+		case columnAmount:
+			var n decimal128.Num
+			if r != nil && e.raw[i] != "" {
+				n, err = rawDecimal(r, e.raw[i])
+			} else {
+				n, err = decimal128.FromString(v, amountPrecision, int32(e.decimals))
+			}
+			if err == nil {
+				b.(*array.Decimal128Builder).Append(n)
+			}
+		case columnString:
+			if v[0] == '"' {
+				if s, err := strconv.Unquote(v); err == nil {
+					v = s
+				}
+			}
+			b.(*array.StringBuilder).Append(v)
+		case columnInt:
+			var n int64
+			if n, err = strconv.ParseInt(v, 10, 64); err == nil {
+				b.(*array.Int64Builder).Append(n)
+			}
+		case columnUint:
+			var n uint64
+			if n, err = strconv.ParseUint(v, 10, 64); err == nil {
+				b.(*array.Uint64Builder).Append(n)
+			}
+		case columnFloat:
+			var f float64
+			if f, err = strconv.ParseFloat(v, 64); err == nil {
+				b.(*array.Float64Builder).Append(f)
+			}
+		case columnBool:
+			var t bool
+			if t, err = strconv.ParseBool(v); err == nil {
+				b.(*array.BooleanBuilder).Append(t)
+			}
+		case columnTime:
+			// times are either quoted RFC3339 strings or unix milliseconds,
+			// zero times are null
+			var ms int64
+			if v[0] == '"' {
+				var (
+					s string
+					t time.Time
+				)
+				if s, err = strconv.Unquote(v); err == nil {
+					if t, err = time.Parse(time.RFC3339, s); err == nil && !t.IsZero() {
+						ms = t.UnixMilli()
+					}
+				}
+			} else {
+				ms, err = strconv.ParseInt(v, 10, 64)
+			}
+			switch {
+			case err != nil:
+			case ms != 0:
+				b.(*array.TimestampBuilder).Append(arrow.Timestamp(ms))
+			default:
+				b.AppendNull()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: column %s: invalid value %s: %w", e.format, e.columns[i], v, err)
+		}
+	}
+	e.rows++
+	return nil
+}
+
+// rawDecimal reads a stored integer amount in base units.
+func rawDecimal(r *pack.Row, field string) (decimal128.Num, error) {
+	val, err := r.Field(field)
+	if err != nil {
+		return decimal128.Num{}, err
+	}
+	switch n := val.(type) {
+	case int64:
+		return decimal128.FromI64(n), nil
+	case uint64:
+		return decimal128.FromU64(n), nil
+	default:
+		return decimal128.Num{}, fmt.Errorf("unexpected value type %T", val)
+	}
+}
+
+// flush writes the current row group.
+func (e *columnEncoder) flush() error {
+	if e.rows == 0 {
+		return nil
+	}
+	rec := e.builder.NewRecord()
+	defer rec.Release()
+	e.rows = 0
+	if e.pqw != nil {
+		return e.pqw.Write(rec)
+	}
+	return e.ipcw.Write(rec)
+}
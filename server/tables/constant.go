@@ -12,7 +12,6 @@ import (
 	"strconv"
 	"strings"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -194,7 +193,8 @@ func StreamConstantTable(ctx *server.Context, args *TableRequest) (interface{},
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -292,6 +292,11 @@ func StreamConstantTable(ctx *server.Context, args *TableRequest) (interface{},
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, val, constantSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -336,8 +341,8 @@ func StreamConstantTable(ctx *server.Context, args *TableRequest) (interface{},
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), constantSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -348,7 +353,7 @@ func StreamConstantTable(ctx *server.Context, args *TableRequest) (interface{},
 				if err := r.Decode(val); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(val); err != nil {
+				if err := enc.EncodeRow(r, val); err != nil {
 					return err
 				}
 				count++
@@ -359,7 +364,10 @@ func StreamConstantTable(ctx *server.Context, args *TableRequest) (interface{},
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
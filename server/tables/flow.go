@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"blockwatch.cc/packdb/vec"
@@ -310,7 +309,8 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -382,6 +382,8 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 					if err != nil {
 						switch err {
 						case model.ErrNoOp:
+							// a missing operation may have been pruned
+							ctx.CheckPruned(model.OpTableKey, 1)
 							panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such op '%s'", val[0]), nil))
 						case model.ErrInvalidOpHash:
 							panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid op hash '%s'", val[0]), err))
@@ -495,6 +497,11 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, flow, flowSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -539,8 +546,8 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), flowSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -551,7 +558,7 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 				if err := r.Decode(flow); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(flow); err != nil {
+				if err := enc.EncodeRow(r, flow); err != nil {
 					return err
 				}
 				count++
@@ -562,7 +569,10 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
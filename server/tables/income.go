@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -394,7 +393,8 @@ func StreamIncomeTable(ctx *server.Context, args *TableRequest) (interface{}, in
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -592,6 +592,11 @@ func StreamIncomeTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, inc, incomeSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -636,8 +641,8 @@ func StreamIncomeTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), incomeSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -648,7 +653,7 @@ func StreamIncomeTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				if err := r.Decode(inc); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(inc); err != nil {
+				if err := enc.EncodeRow(r, inc); err != nil {
 					return err
 				}
 				count++
@@ -659,7 +664,10 @@ func StreamIncomeTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
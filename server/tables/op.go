@@ -15,7 +15,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"blockwatch.cc/packdb/vec"
@@ -544,7 +543,8 @@ func StreamOpTable(ctx *server.Context, args *TableRequest) (interface{}, int) {
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			id, err := strconv.ParseUint(val[0], 10, 64)
@@ -905,7 +905,8 @@ func StreamOpTable(ctx *server.Context, args *TableRequest) (interface{}, int) {
 				}
 			}
 			switch prefix {
-			case "columns", "limit", "order", "verbose", "filename":
+			case "columns", "limit", "order", "verbose", "filename",
+				"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 				// skip these fields
 			case "receiver", "creator", "baker", "status",
 				"is_success", "is_contract", "is_internal", "is_event", "is_rollup",
@@ -1120,6 +1121,11 @@ func StreamOpTable(ctx *server.Context, args *TableRequest) (interface{}, int) {
 		ctx:     ctx,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, op, opSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -1162,8 +1168,8 @@ func StreamOpTable(ctx *server.Context, args *TableRequest) (interface{}, int) {
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), opSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -1183,7 +1189,10 @@ func StreamOpTable(ctx *server.Context, args *TableRequest) (interface{}, int) {
 				}
 			}
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"blockwatch.cc/packdb/vec"
@@ -230,7 +229,8 @@ func StreamProposalTable(ctx *server.Context, args *TableRequest) (interface{},
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -460,6 +460,11 @@ func StreamProposalTable(ctx *server.Context, args *TableRequest) (interface{},
 		ops:     opMap,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, proposal, proposalSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -506,8 +511,8 @@ func StreamProposalTable(ctx *server.Context, args *TableRequest) (interface{},
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), proposalSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -518,7 +523,7 @@ func StreamProposalTable(ctx *server.Context, args *TableRequest) (interface{},
 				if err := r.Decode(proposal); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(proposal); err != nil {
+				if err := enc.EncodeRow(r, proposal); err != nil {
 					return err
 				}
 				count++
@@ -529,7 +534,10 @@ func StreamProposalTable(ctx *server.Context, args *TableRequest) (interface{},
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
@@ -13,7 +13,6 @@ import (
 	"strconv"
 	"strings"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvgo/mavryk"
@@ -210,7 +209,8 @@ func StreamRightsTable(ctx *server.Context, args *TableRequest) (interface{}, in
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -312,6 +312,11 @@ func StreamRightsTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		params:  params,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, right, rightSourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -356,8 +361,8 @@ func StreamRightsTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), rightSourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -368,7 +373,7 @@ func StreamRightsTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				if err := r.Decode(right); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(right); err != nil {
+				if err := enc.EncodeRow(r, right); err != nil {
 					return err
 				}
 				count++
@@ -379,7 +384,10 @@ func StreamRightsTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
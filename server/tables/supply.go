@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"blockwatch.cc/packdb/encoding/csv"
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
 	"github.com/mavryk-network/mvindex/etl/model"
@@ -389,7 +388,8 @@ func StreamSupplyTable(ctx *server.Context, args *TableRequest) (interface{}, in
 			}
 		}
 		switch prefix {
-		case "columns", "limit", "order", "verbose", "filename":
+		case "columns", "limit", "order", "verbose", "filename",
+			"group_by", "count", "count_distinct", "sum", "min", "max", "avg", "collapse":
 			// skip these fields
 		case "cursor":
 			// add row id condition: id > cursor (new cursor == last row id)
@@ -456,6 +456,11 @@ func StreamSupplyTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		params:  params,
 	}
 
+	// evaluate aggregates server-side
+	if args.IsAggregate() {
+		return aggregateTable(ctx, args, table, q, supply, supplySourceNames)
+	}
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -500,8 +505,8 @@ func StreamSupplyTable(ctx *server.Context, args *TableRequest) (interface{}, in
 		_, _ = io.WriteString(ctx.ResponseWriter, "]")
 		// ctx.Log.Tracef("JSON encoded %d rows", count)
 
-	case "csv":
-		enc := csv.NewEncoder(ctx.ResponseWriter)
+	case "csv", "parquet", "arrow":
+		enc := newTableEncoder(ctx, args.Format, table.Fields(), supplySourceNames)
 		// use custom header columns and order
 		if len(args.Columns) > 0 {
 			err = enc.EncodeHeader(args.Columns, nil)
@@ -512,7 +517,7 @@ func StreamSupplyTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				if err := r.Decode(supply); err != nil {
 					return err
 				}
-				if err := enc.EncodeRecord(supply); err != nil {
+				if err := enc.EncodeRow(r, supply); err != nil {
 					return err
 				}
 				count++
@@ -523,7 +528,10 @@ func StreamSupplyTable(ctx *server.Context, args *TableRequest) (interface{}, in
 				return nil
 			})
 		}
-		// ctx.Log.Tracef("CSV Encoded %d rows", count)
+		// write pending rows and footer
+		if cerr := enc.Close(); cerr != nil && (err == nil || err == io.EOF) {
+			err = cerr
+		}
 	}
 
 	// without new records, cursor remains the same as input (may be empty)
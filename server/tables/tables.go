@@ -5,6 +5,7 @@ package tables
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,15 +13,19 @@ import (
 
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvindex/etl"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/server"
+	"github.com/mavryk-network/mvindex/server/series"
 )
 
 var null = []byte(`null`)
 
 var mimetypes = map[string]string{
-	"json": "application/json; charset=utf-8",
-	"csv":  "text/csv",
+	"json":    "application/json; charset=utf-8",
+	"csv":     "text/csv",
+	"parquet": "application/vnd.apache.parquet",
+	"arrow":   "application/vnd.apache.arrow.stream",
 }
 
 func init() {
@@ -40,6 +45,18 @@ type TableRequest struct {
 	Verbose  bool            `schema:"verbose"`
 	Filename string          `schema:"filename"` // for CSV downloads
 	// OrderBy string // column name
+
+	// server-side aggregation
+	GroupBy       util.StringList `schema:"group_by"`
+	Count         util.StringList `schema:"count"`
+	CountDistinct util.StringList `schema:"count_distinct"`
+	Sum           util.StringList `schema:"sum"`
+	Min           util.StringList `schema:"min"`
+	Max           util.StringList `schema:"max"`
+	Avg           util.StringList `schema:"avg"`
+	Collapse      series.Collapse `schema:"collapse"` // time bucket for group_by
+
+	aggregate *tableAggregate
 }
 
 func (t TableRequest) LastModified() time.Time {
@@ -83,6 +100,9 @@ func (t *TableRequest) Parse(ctx *server.Context) {
 		}
 	}
 
+	// replace output columns by aggregation inputs
+	t.parseAggregate()
+
 	// read table code from URL
 	t.Table = strings.ToLower(mux.Vars(ctx.Request)["table"])
 
@@ -92,7 +112,7 @@ func (t *TableRequest) Parse(ctx *server.Context) {
 		t.Format = "json"
 	}
 	switch t.Format {
-	case "json", "csv":
+	case "json", "csv", "parquet", "arrow":
 	default:
 		panic(server.EBadRequest(server.EC_CONTENTTYPE_UNSUPPORTED, fmt.Sprintf("unsupported format '%s'", t.Format), nil))
 	}
@@ -101,6 +121,16 @@ func (t *TableRequest) Parse(ctx *server.Context) {
 func StreamTable(ctx *server.Context) (interface{}, int) {
 	args := &TableRequest{}
 	ctx.ParseRequestArgs(args)
+
+	// fail requests for history removed by the retention policy
+	if slices.Contains(etl.RetentionTables(), args.Table) {
+		height, tm := "height", "time"
+		if args.Table == model.BalanceTableKey {
+			height, tm = "valid_from", "valid_from_time"
+		}
+		ctx.CheckPruned(args.Table, server.QueryHeights(ctx, height, tm)...)
+	}
+
 	switch args.Table {
 	case model.BlockTableKey:
 		return StreamBlockTable(ctx, args)